@@ -1,55 +1,101 @@
 package main
 
 import (
+	"context"
+	"crypto/ed25519"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"math"
+	"math/rand/v2"
 	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
-	"runtime"
-	"sort"
+	"runtime/debug"
 	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"catalogo/audit"
+	"catalogo/budget"
+	"catalogo/canonurl"
+	"catalogo/categorias"
+	"catalogo/cortesia"
+	"catalogo/desafio"
+	"catalogo/diskq"
+	"catalogo/divisas"
+	"catalogo/enlaces"
+	"catalogo/envio"
+	"catalogo/etiquetas"
+	"catalogo/extraer"
+	"catalogo/firma"
+	"catalogo/fixtures"
+	"catalogo/historial"
+	"catalogo/hooks"
+	"catalogo/imagenes"
+	"catalogo/impuestos"
+	"catalogo/lockfile"
+	"catalogo/logfile"
+	"catalogo/match"
+	"catalogo/metrics"
+	"catalogo/producto"
+	"catalogo/redondeo"
+	"catalogo/runid"
+	"catalogo/secretos"
+	"catalogo/spill"
+	"catalogo/status"
+	"catalogo/texto"
+	"catalogo/tienda"
+	"catalogo/timing"
+	"catalogo/tracing"
+	"catalogo/transporte"
+	"catalogo/watchdog"
 )
 
 // --- Output JSON schema ---
 
-type Product struct {
-	Nombre         string   `json:"nombre"`
-	Precio         float64  `json:"precio"`
-	PrecioOriginal float64  `json:"precioOriginal"`
-	EnOferta       bool     `json:"enOferta"`
-	Stock          string   `json:"stock"`
-	Imagen         string   `json:"imagen"`
-	Imagen64       string   `json:"imagen64"`
-	Link           string   `json:"link"`
-	Categoria      string   `json:"categoria"`
-	Subcategorias  []string `json:"subcategorias"`
-}
+type Product = producto.Product
 
 // --- WooCommerce Store API response ---
 
 type APIProduct struct {
-	Name              string            `json:"name"`
-	Permalink         string            `json:"permalink"`
-	OnSale            bool              `json:"on_sale"`
-	Prices            APIPrices         `json:"prices"`
-	Images            []APIImage        `json:"images"`
-	Categories        []APICategory     `json:"categories"`
-	StockAvailability APIStockAvail     `json:"stock_availability"`
+	ID                int            `json:"id"`
+	Type              string         `json:"type"`
+	Name              string         `json:"name"`
+	SKU               string         `json:"sku"`
+	Permalink         string         `json:"permalink"`
+	OnSale            bool           `json:"on_sale"`
+	Prices            APIPrices      `json:"prices"`
+	Images            []APIImage     `json:"images"`
+	Categories        []APICategory  `json:"categories"`
+	StockAvailability APIStockAvail  `json:"stock_availability"`
+	Variations        []APIVariation `json:"variations"`
+	// ShortDescription is HTML; financing badges ("12 MSI") go there.
+	ShortDescription string `json:"short_description"`
+	Description      string `json:"description"`
+}
+
+// APIVariation is one variation of a variable product, as its parent lists it.
+type APIVariation struct {
+	ID         int `json:"id"`
+	Attributes []struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	} `json:"attributes"`
 }
 
 type APIPrices struct {
 	Price             string `json:"price"`
 	RegularPrice      string `json:"regular_price"`
 	SalePrice         string `json:"sale_price"`
+	CurrencyCode      string `json:"currency_code"`
 	CurrencyMinorUnit int    `json:"currency_minor_unit"`
 }
 
@@ -74,18 +120,81 @@ type APIStockAvail struct {
 // --- Task for the worker pool ---
 
 type task struct {
+	id           string
 	slug         string
 	categoryName string
 	page         int
+	requeued     bool
+	qid          int64 // position in the disk queue, for done
+}
+
+// url is the Store API listing URL of the task's page; a task with no slug
+// pages the store-wide listing (-mode all-products).
+func (t task) url() string {
+	if t.slug == "" {
+		return fmt.Sprintf("%s?page=%d&per_page=%d", apiBase, t.page, pageSize()) + listingFilter
+	}
+	return fmt.Sprintf("%s?category=%s&page=%d&per_page=%d", apiBase, t.slug, t.page, pageSize()) + listingFilter
+}
+
+// pageSize is the products per listing page: perPage, or just the -sample
+// products when fewer, up to the API's limit.
+func pageSize() int {
+	if flagSample > 0 {
+		return min(flagSample, maxPerPage)
+	}
+	return perPage
+}
+
+// productFilter drops the products -match-name, -min-price, -max-price,
+// -only-on-sale and -in-stock-only leave out; filtered counts them.
+var (
+	productFilter producto.Filtro
+	filtered      atomic.Int32
+)
+
+// blocklist drops the products named in the -blocklist file; blocked counts
+// them.
+var (
+	blocklist *producto.Bloqueo
+	blocked   atomic.Int32
+)
+
+// listingFilter asks the Store API for only the products on sale, in stock
+// and in the price range of productFilter, so a filtered run fetches fewer
+// pages. The API takes prices in cents; productFilter still checks every
+// product.
+var listingFilter string
+
+func storeAPIFilter(f producto.Filtro) string {
+	q := url.Values{}
+	if f.SoloOferta {
+		q.Set("on_sale", "true")
+	}
+	if f.PrecioMin > 0 {
+		q.Set("min_price", strconv.Itoa(int(math.Floor(f.PrecioMin*100))))
+	}
+	if f.PrecioMax > 0 {
+		q.Set("max_price", strconv.Itoa(int(math.Ceil(f.PrecioMax*100))))
+	}
+	if f.SoloDisponibles {
+		q.Set("stock_status", "instock,onbackorder")
+	}
+	if len(q) == 0 {
+		return ""
+	}
+	return "&" + q.Encode()
 }
 
 // --- Configuration ---
 
 const (
+	siteDomain    = "buytiti.com"
 	apiBase       = "https://buytiti.com/wp-json/wc/store/v1/products"
 	categoriesAPI = "https://buytiti.com/wp-json/wc/store/v1/products/categories"
 	maxRetries    = 3
 	perPage       = 20
+	maxPerPage    = 100 // Store API upper limit for per_page
 )
 
 // Slugs to ignore when fetching categories automatically
@@ -93,15 +202,100 @@ var ignoreSlugs = map[string]bool{
 	"uncategorized": true,
 }
 
+// Crawl modes of -mode: one listing per root category, or the store-wide
+// listing with each product's category taken from its own categories.
+const (
+	modeCategories  = "categories"
+	modeAllProducts = "all-products"
+)
+
+// allListing names the single task of -mode all-products in the logs.
+const allListing = "Todos los productos"
+
+// categoryRoots maps the ID of every category of the store to the name of
+// its root category, for ownCategory. Categories under an ignored root are
+// left out.
+var categoryRoots map[int]string
+
+// loadRoots builds categoryRoots from the store's whole category tree. A
+// tree that cannot be fetched leaves products with their own category names.
+func loadRoots(client *http.Client) map[int]string {
+	all, err := fetchAllCategories(client, nil)
+	if err != nil {
+		log.Printf("[WARN]   Sin árbol de categorías, se usan las categorías propias de cada producto: %v", err)
+		return nil
+	}
+	byID := make(map[int]APICategory, len(all))
+	for _, c := range all {
+		byID[c.ID] = c
+	}
+	roots := make(map[int]string, len(all))
+	for _, c := range all {
+		root := c
+		for depth := 0; root.Parent != 0 && depth < len(all); depth++ {
+			parent, ok := byID[root.Parent]
+			if !ok {
+				break
+			}
+			root = parent
+		}
+		if !ignoreSlugs[root.Slug] {
+			roots[c.ID] = root.Name
+		}
+	}
+	return roots
+}
+
 // fetchCategories obtains all root categories (parent=0) from the WooCommerce API.
-func fetchCategories(client *http.Client) (map[string]string, error) {
+func fetchCategories(client *http.Client, parent *tracing.Span) (map[string]string, error) {
+	all, err := fetchAllCategories(client, parent)
+	if err != nil {
+		return nil, err
+	}
 	categories := make(map[string]string)
+	for _, c := range all {
+		if c.Parent == 0 && c.Count > 0 && !ignoreSlugs[c.Slug] {
+			categories[c.Name] = c.Slug
+		}
+	}
+	return categories, nil
+}
+
+// dumpCategories writes the store's whole category tree to fpath
+// (-dump-categories), subcategories and empty categories included.
+func dumpCategories(client *http.Client, fpath string) error {
+	all, err := fetchAllCategories(client, nil)
+	if err != nil {
+		return err
+	}
+	nodes := make([]categorias.Nodo, 0, len(all))
+	for _, c := range all {
+		n := categorias.Nodo{ID: strconv.Itoa(c.ID), Slug: c.Slug, Nombre: c.Name, Productos: &c.Count}
+		if c.Parent != 0 {
+			n.Padre = strconv.Itoa(c.Parent)
+		}
+		nodes = append(nodes, n)
+	}
+	if err := categorias.NewArbol("buytiti", nodes).Escribir(fpath); err != nil {
+		return err
+	}
+	log.Printf("[CATS]   %d categorías escritas en %s", len(nodes), fpath)
+	return nil
+}
+
+// fetchAllCategories obtains every category of the store, at any depth, from
+// the WooCommerce API.
+func fetchAllCategories(client *http.Client, parent *tracing.Span) ([]APICategory, error) {
+	var all []APICategory
 	page := 1
 
 	for {
 		url := fmt.Sprintf("%s?per_page=100&page=%d", categoriesAPI, page)
 		log.Printf("[CATS]   Fetching categorías pág %d...", page)
 
+		if err := storeBlock.Err(); err != nil {
+			return nil, err
+		}
 		req, err := http.NewRequest("GET", url, nil)
 		if err != nil {
 			return nil, fmt.Errorf("error creando request de categorías: %w", err)
@@ -109,153 +303,411 @@ func fetchCategories(client *http.Client) (map[string]string, error) {
 		req.Header.Set("User-Agent", "BuyTitiCatalogScraper/1.0")
 		req.Header.Set("Accept", "application/json")
 
+		span := tracer.StartClient(parent, "GET", "url.full", url)
+		reqStart := time.Now()
 		resp, err := client.Do(req)
 		if err != nil {
+			scrapeMetrics.ObserveRequest(0, time.Since(reqStart))
+			span.End(err)
 			return nil, fmt.Errorf("error de red al obtener categorías: %w", err)
 		}
 
 		body, err := io.ReadAll(resp.Body)
 		resp.Body.Close()
 		if err != nil {
+			scrapeMetrics.ObserveRequest(0, time.Since(reqStart))
+			span.End(err)
 			return nil, fmt.Errorf("error leyendo body de categorías: %w", err)
 		}
+		scrapeMetrics.ObserveRequest(resp.StatusCode, time.Since(reqStart))
+		span.SetAttr("http.response.status_code", resp.StatusCode)
+		if err := checkChallenge(url, resp, body); err != nil {
+			span.End(err)
+			return nil, err
+		}
 
 		if resp.StatusCode != 200 {
-			return nil, fmt.Errorf("HTTP %d al obtener categorías", resp.StatusCode)
+			err := fmt.Errorf("HTTP %d al obtener categorías", resp.StatusCode)
+			span.End(err)
+			return nil, err
 		}
+		span.End(nil)
 
 		var cats []APICategory
-		if err := json.Unmarshal(body, &cats); err != nil {
+		if err := json.Unmarshal(texto.UTF8(body, resp.Header.Get("Content-Type")), &cats); err != nil {
+			scrapeMetrics.ParseFailures.Inc()
+			warnBudget.Warning()
 			return nil, fmt.Errorf("error parsing categorías: %w", err)
 		}
 
 		if len(cats) == 0 {
 			break
 		}
-
-		for _, c := range cats {
-			if c.Parent == 0 && c.Count > 0 && !ignoreSlugs[c.Slug] {
-				categories[c.Name] = c.Slug
-			}
-		}
-
+		all = append(all, cats...)
 		page++
 	}
 
-	return categories, nil
+	return all, nil
+}
+
+// storeBlock is set by the first bot-challenge page the store answers with;
+// from then on the run makes no more requests to it.
+var storeBlock desafio.Bloqueo
+
+// checkChallenge marks the store as blocked when resp, with its body, is a
+// bot-challenge page instead of the store's, and returns the error every
+// request gets from then on.
+func checkChallenge(rawURL string, resp *http.Response, body []byte) error {
+	servicio := desafio.Detectar(resp.StatusCode, resp.Header, body)
+	if servicio == "" {
+		return nil
+	}
+	err, first := storeBlock.Marcar(&desafio.Error{Servicio: servicio, URL: rawURL, Status: resp.StatusCode})
+	if first {
+		runStatus.Blocked(servicio)
+		log.Printf("[BLOCK]  %v", err)
+	}
+	return err
 }
 
+// scrapeMetrics collects request and parsing counters for -metrics-file and -pushgateway.
+var scrapeMetrics = metrics.NewScrape("buytiti")
+
+// tracer exports the run's spans when -otlp-endpoint is set; nil otherwise.
+var tracer *tracing.Tracer
+
+// auditLog records every request when -audit-log is set; nil otherwise.
+var auditLog *audit.Log
+
+// recorder saves the first responses as test fixtures when
+// -record-fixtures is set; nil otherwise.
+var recorder *fixtures.Grabadora
+
+// httpTransport is the transport of every request to the store, with the
+// TLS settings of -ca-cert and -insecure-skip-verify and the -max-bandwidth
+// limit, refusing hosts outside the store's domains.
+var httpTransport http.RoundTripper
+
+// runStatus keeps -status-file up to date; nil when it is not set.
+var runStatus *status.Reporter
+
+// warnBudget fails the run when -max-warnings or -max-error-rate is exceeded.
+var warnBudget = &budget.Budget{}
+
+// previousHash fingerprints the output left by the previous run, and
+// previousRaw holds it as written: a full run resets the output as it goes,
+// so when nothing changed, or the run fails, it puts those exact bytes back.
+var (
+	previousHash string
+	previousRaw  []byte
+)
+
+// runID identifies this run in logs, metrics and reports; taskSeq numbers
+// its tasks.
+var (
+	runID   string
+	taskSeq runid.Seq
+)
+
 var (
-	flagOutput  string
-	flagDelay   time.Duration
-	flagWorkers int
-	flagVerbose bool
+	flagOutput     string
+	flagDelay      time.Duration
+	flagBackoff    time.Duration
+	flagPoliteness string
+	flagWorkers    int
+	flagVerbose    bool
+	flagWhatsApp   string
+	flagCambios    string
+	flagJitter     time.Duration
+	flagWatch      string
+	flagQuick      bool
+
+	flagCatCache    string
+	flagDumpCats    string
+	flagFacets      string
+	flagSimilares   string
+	flagHistory     string
+	flagSign        string
+	flagLangEN      string
+	flagCategories  string
+	flagExcludeCats string
+	flagOnlyCatSlug string
+	flagStartAtCat  string
+	flagSample      int
+	flagFields      string
+	flagSort        string
+	flagBlocklist   string
+	flagConfig      string
+	flagSnapshot    string
+	flagConvertTo   string
+	flagFXSource    string
+	flagPriceCents  bool
+	flagSchema      string
+	flagExpandVars  bool
+	flagParentsOnly bool
+	flagMatchName   string
+	flagMinPrice    float64
+	flagMaxPrice    float64
+	flagOnlyOnSale  bool
+	flagInStock     bool
+	flagOutOfStock  bool
+	flagSimilaresN  int
+	flagCatTTL      time.Duration
+	flagRefreshCats bool
+
+	flagMetricsFile string
+	flagPushgateway string
+	flagOTLP        string
+	flagAuditLog    string
+	flagCACert      string
+	flagInsecure    bool
+	flagBandwidth   string
+	flagFixtures    string
+	flagFixturesN   int
+
+	flagQuiet      bool
+	flagLogFile    string
+	flagLogMaxMB   int
+	flagLogBackups int
+
+	flagStatusFile     string
+	flagStatusInterval time.Duration
+
+	flagMaxWarnings  int
+	flagMaxErrorRate string
+	flagCheckLinks   string
+	flagCountTol     string
+	flagUncat        bool
+	flagMode         string
+	flagRunID        string
+
+	flagSpillFile     string
+	flagSpillInterval time.Duration
+
+	flagFinalRetryWorkers  int
+	flagFinalRetryCooldown time.Duration
+
+	flagDiskQueue bool
+	flagQueueFile string
+
+	flagStuckTimeout time.Duration
 )
 
 func init() {
-	_, srcFile, _, _ := runtime.Caller(0)
-	defaultOutput := filepath.Join(filepath.Dir(srcFile), "..", "productos.json")
+	defaultOutput, defaultConfig := tienda.Rutas("catalogo-buytiti")
 	flag.StringVar(&flagOutput, "output", defaultOutput, "Ruta del archivo JSON de salida")
+	flag.StringVar(&flagConvertTo, "convert-to", "", "Agregar los precios convertidos a esta moneda (código ISO 4217, como USD)")
+	flag.StringVar(&flagFXSource, "fx-source", "banxico", "Fuente del tipo de cambio de -convert-to: banxico, openexchange o fixed:<pesos por unidad>")
+	flag.StringVar(&flagSchema, "schema", "es", "Nombres de los campos de la salida: es (el esquema de los sitios) o en (en inglés, para otras herramientas)")
+	flag.BoolVar(&flagPriceCents, "price-cents", false, "Agregar precioCentavos y precioOriginalCentavos, los precios como enteros en centavos")
+	flag.StringVar(&flagSnapshot, "changed-since", "", "Escribir en la salida solo los productos nuevos o cambiados respecto a este productos.json anterior")
+	flag.StringVar(&flagConfig, "config", defaultConfig, "Configuración con las reglas de etiquetas derivadas (sección etiquetas) y si los precios de la tienda incluyen IVA")
 	flag.DurationVar(&flagDelay, "delay", 500*time.Millisecond, "Delay entre requests por worker")
+	flag.DurationVar(&flagBackoff, "backoff", 2*time.Second, "Espera antes del primer reintento; se duplica en cada intento y se triplica tras cada 429")
+	flag.StringVar(&flagPoliteness, "politeness", cortesia.Predeterminado, "Preset de workers, delay, backoff y ancho de banda: gentle (seguro para tiendas nuevas), normal o aggressive; los flags explícitos ganan")
 	flag.IntVar(&flagWorkers, "workers", 3, "Número de goroutines workers")
 	flag.BoolVar(&flagVerbose, "verbose", false, "Logging detallado")
+	flag.StringVar(&flagWhatsApp, "whatsapp-csv", "", "Ruta opcional del CSV para importar en el catálogo de WhatsApp Business")
+	flag.StringVar(&flagCambios, "cambios-dir", "", "Directorio donde escribir CAMBIOS-<fecha>.md comparando contra la salida anterior")
+	flag.DurationVar(&flagJitter, "jitter", 0, "Retraso aleatorio máximo antes de empezar (ej. 15m)")
+	flag.StringVar(&flagWatch, "watch", "", "Archivo con links de productos vigilados: solo actualiza su precio y stock en la salida existente")
+	flag.BoolVar(&flagQuick, "quick", false, "Solo actualizar precio y stock de los productos de la salida existente, sin descubrir categorías")
+	flag.StringVar(&flagCatCache, "categories-cache", "", "Ruta de la caché de categorías (por defecto categorias.cache.json junto a la salida)")
+	flag.StringVar(&flagDumpCats, "dump-categories", "", "Solo escribir en este archivo el árbol completo de categorías (id, slug, nombre, padre, productos) y salir, sin scrapear productos")
+	flag.StringVar(&flagFacets, "facets", "", "Ruta de facets.json con los conteos para los filtros de la página (por defecto junto a la salida)")
+	flag.StringVar(&flagCategories, "categories", "", "Scrapear solo estas categorías, por nombre o slug separados por coma (sin distinguir acentos ni mayúsculas)")
+	flag.StringVar(&flagExcludeCats, "exclude-categories", "", "No scrapear estas categorías, por nombre o slug separados por coma")
+	flag.StringVar(&flagOnlyCatSlug, "only-category-slug", "", "Scrapear solo la categoría con este slug, conservando el resto de la salida anterior")
+	flag.StringVar(&flagStartAtCat, "start-at-category", "", "Empezar por esta categoría (nombre o slug) y seguir con las siguientes en orden alfabético, conservando las anteriores")
+	flag.BoolVar(&flagExpandVars, "expand-variants", false, "Listar cada variante (color, talla, ...) de los productos variables con su precio y stock, en vez del producto padre")
+	flag.BoolVar(&flagParentsOnly, "parents-only", false, "Listar solo el producto padre de los productos variables (por defecto)")
+	flag.StringVar(&flagBlocklist, "blocklist", "", "Archivo con palabras o /expresiones/ (una por línea) de nombres de productos a descartar")
+	flag.StringVar(&flagFields, "fields", "", "Escribir en la salida solo estos campos, separados por coma (ej. nombre,precio,link,imagen64; vacío = todos)")
+	flag.StringVar(&flagSort, "sort", producto.OrdenPredeterminado, "Orden de la salida: campos separados por coma, con - para descendente (ej. precio,-nombre)")
+	flag.IntVar(&flagSample, "sample", 0, "Prueba rápida: scrapear solo los primeros N productos de cada categoría y escribir en productos.sample.json salvo que se indique -output (0 = corrida completa)")
+	flag.StringVar(&flagMatchName, "match-name", "", "Conservar solo los productos cuyo nombre coincide con esta expresión regular (sin distinguir mayúsculas)")
+	flag.Float64Var(&flagMinPrice, "min-price", 0, "Conservar solo los productos de al menos este precio (0 = sin mínimo)")
+	flag.Float64Var(&flagMaxPrice, "max-price", 0, "Conservar solo los productos de hasta este precio (0 = sin máximo)")
+	flag.BoolVar(&flagOnlyOnSale, "only-on-sale", false, "Conservar solo los productos en oferta")
+	flag.BoolVar(&flagInStock, "in-stock-only", false, "Descartar los productos agotados")
+	flag.BoolVar(&flagOutOfStock, "include-out-of-stock", false, "Conservar los agotados aunque se pase -in-stock-only (p. ej. en los args de catalogo.json)")
+	flag.StringVar(&flagSimilares, "similares", "", "Ruta de similares.json con las alternativas de cada producto (por defecto junto a la salida)")
+	flag.StringVar(&flagHistory, "runs-history", "", "Ruta de runs-history.tsv, al que cada corrida agrega una fila (por defecto junto a la salida)")
+	flag.StringVar(&flagLangEN, "lang-en", "", "Código WPML del inglés (en) para agregar nombreEN y descripcionEN desde la traducción de cada producto")
+	flag.StringVar(&flagSign, "sign", "", "Clave privada Ed25519 (PEM) con la que firmar la salida en <salida>.sig")
+	flag.IntVar(&flagSimilaresN, "similares-n", 5, "Alternativas con stock por producto en similares.json (0 = no escribirlo)")
+	flag.DurationVar(&flagCatTTL, "categories-ttl", 24*time.Hour, "Vigencia de la caché de categorías (0 = no usarla)")
+	flag.BoolVar(&flagRefreshCats, "refresh-categories", false, "Ignorar la caché y volver a descubrir las categorías")
+	flag.StringVar(&flagMetricsFile, "metrics-file", "", "Archivo donde escribir las métricas Prometheus al terminar")
+	flag.StringVar(&flagPushgateway, "pushgateway", "", "URL de un Prometheus Pushgateway al que enviar las métricas al terminar")
+	flag.StringVar(&flagOTLP, "otlp-endpoint", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), "URL del colector OpenTelemetry (OTLP/HTTP) al que enviar las trazas de la corrida")
+	flag.StringVar(&flagAuditLog, "audit-log", "", "Archivo NDJSON donde registrar cada request (método, URL, status, latencia, bytes e intento)")
+	flag.StringVar(&flagCACert, "ca-cert", "", "Archivo PEM con certificados de CA a confiar además de los del sistema (proxy corporativo, staging autofirmado)")
+	flag.StringVar(&flagBandwidth, "max-bandwidth", "", "Límite de descarga de toda la corrida, compartido por todos los workers (ej. 2MB/s, 512KB/s; vacío = sin límite)")
+	flag.StringVar(&flagFixtures, "record-fixtures", "", "Directorio en el que grabar, normalizadas, las primeras respuestas del sitio como fixtures de prueba (lo usa \"catalogo fixtures record\")")
+	flag.IntVar(&flagFixturesN, "record-n", 20, "Respuestas a grabar con -record-fixtures")
+	flag.BoolVar(&flagInsecure, "insecure-skip-verify", false, "No verificar los certificados TLS de los sitios (INSEGURO: solo para pruebas)")
+	flag.BoolVar(&flagQuiet, "quiet", false, "Mostrar en consola solo el resumen final y los errores fatales")
+	flag.StringVar(&flagLogFile, "log-file", "", "Archivo donde guardar el log completo (se rota por tamaño)")
+	flag.IntVar(&flagLogMaxMB, "log-max-mb", 10, "Tamaño en MB a partir del cual se rota -log-file")
+	flag.IntVar(&flagLogBackups, "log-backups", 5, "Cuántos archivos rotados de -log-file conservar")
+	flag.StringVar(&flagStatusFile, "status-file", "", "Archivo JSON con el progreso de la corrida (fase, categorías, productos, errores), reescrito periódicamente")
+	flag.DurationVar(&flagStatusInterval, "status-interval", 10*time.Second, "Cada cuánto reescribir -status-file")
+	flag.IntVar(&flagMaxWarnings, "max-warnings", -1, "Fallar la corrida (sin escribir la salida final) si hay más advertencias de parsing que esto (-1 = sin límite)")
+	flag.StringVar(&flagMaxErrorRate, "max-error-rate", "", "Fallar la corrida si falla más de esta proporción de requests (ej. 5%)")
+	flag.StringVar(&flagCheckLinks, "check-links", "", "Antes de escribir la salida, pedir el link de cada producto (all) o de una muestra de N: los que dan 404 o redirigen al inicio cuentan como advertencia y los que redirigen a otra página se guardan con su destino")
+	flag.StringVar(&flagCountTol, "count-tolerance", "2%", "Diferencia tolerada entre los productos listados por categoría y el count que reporta la tienda; más allá es una advertencia (vacío = no comparar)")
+	flag.StringVar(&flagMode, "mode", modeCategories, "Cómo recorrer la tienda: categories (un listado por categoría raíz) o all-products (el listado completo, con la categoría de cada producto)")
+	flag.BoolVar(&flagUncat, "uncategorized", true, "Recorrer al final el listado completo de la tienda para agregar los productos que ninguna categoría listó (p. ej. los que solo están en uncategorized)")
+	flag.StringVar(&flagRunID, "run-id", "", "ID de la corrida para logs, métricas y reportes (por defecto el que pasa el daemon o uno nuevo)")
+	flag.StringVar(&flagSpillFile, "spill-file", "", "Archivo donde volcar periódicamente los productos recolectados (por defecto <output>.spill.ndjson)")
+	flag.DurationVar(&flagSpillInterval, "spill-interval", 10*time.Second, "Cada cuánto volcar los productos recolectados al spill (0 = desactivado)")
+	flag.IntVar(&flagFinalRetryWorkers, "final-retry-workers", 1, "Workers de la pasada final que reintenta las páginas fallidas (0 = sin pasada final)")
+	flag.DurationVar(&flagFinalRetryCooldown, "final-retry-cooldown", time.Minute, "Espera antes de la pasada final de reintentos")
+	flag.BoolVar(&flagDiskQueue, "disk-queue", false, "Guardar la cola de tareas en disco en vez de memoria (permite reanudar una corrida interrumpida)")
+	flag.StringVar(&flagQueueFile, "queue-file", "", "Archivo de la cola en disco (por defecto <output>.queue.ndjson)")
+	flag.DurationVar(&flagStuckTimeout, "stuck-timeout", 5*time.Minute, "Cancelar la tarea de un worker que lleve más de este tiempo sin terminar (0 = desactivado)")
 }
 
 // fetchPage makes a GET request to the WooCommerce Store API for a single page.
 // Returns the parsed products or an error. Retries with exponential backoff.
-func fetchPage(client *http.Client, t task) ([]APIProduct, error) {
-	url := fmt.Sprintf("%s?category=%s&page=%d&per_page=%d", apiBase, t.slug, t.page, perPage)
+func fetchPage(ctx context.Context, client *http.Client, span *tracing.Span, t task) ([]APIProduct, int, error) {
+	ctx = audit.WithTask(ctx, t.id)
+	return fetchProducts(ctx, client, span, t.url(), fmt.Sprintf("%s %s pág %d", t.id, t.categoryName, t.page))
+}
 
+// fetchProducts GETs a Store API products URL, retrying with exponential
+// backoff. label identifies the request in logs. Each attempt and the JSON
+// decoding are traced as children of parent. It also returns the number of
+// retries the request needed.
+func fetchProducts(ctx context.Context, client *http.Client, parent *tracing.Span, url, label string) ([]APIProduct, int, error) {
 	var lastErr error
 	for attempt := range maxRetries {
+		// Cancelled by the watchdog: further attempts would fail the same way
+		if err := ctx.Err(); err != nil {
+			return nil, attempt, fmt.Errorf("[%s] tarea cancelada: %w", label, err)
+		}
+		if err := storeBlock.Err(); err != nil {
+			return nil, attempt, err
+		}
 		if attempt > 0 {
-			backoff := time.Duration(math.Pow(2, float64(attempt))) * time.Second
-			log.Printf("[RETRY]  %s pág %d — intento %d/%d (espera %v)", t.categoryName, t.page, attempt+1, maxRetries, backoff)
+			backoff := time.Duration(math.Pow(2, float64(attempt-1)) * float64(flagBackoff))
+			log.Printf("[RETRY]  %s — intento %d/%d (espera %v)", label, attempt+1, maxRetries, backoff)
 			time.Sleep(backoff)
+			scrapeMetrics.Retries.Inc()
 		}
 
 		if flagVerbose {
 			log.Printf("[HTTP]   GET %s", url)
 		}
 
-		req, err := http.NewRequest("GET", url, nil)
+		req, err := http.NewRequestWithContext(audit.WithAttempt(ctx, attempt+1), "GET", url, nil)
 		if err != nil {
-			return nil, fmt.Errorf("error creando request: %w", err)
+			return nil, attempt, fmt.Errorf("error creando request: %w", err)
 		}
 		req.Header.Set("User-Agent", "BuyTitiCatalogScraper/1.0")
 		req.Header.Set("Accept", "application/json")
 
+		span := tracer.StartClient(parent, "GET", "url.full", url, "http.request.resend_count", attempt)
+		reqStart := time.Now()
 		resp, err := client.Do(req)
 		if err != nil {
+			scrapeMetrics.ObserveRequest(0, time.Since(reqStart))
+			span.End(err)
 			lastErr = fmt.Errorf("error de red: %w", err)
-			log.Printf("[ERROR]  %s pág %d — error de red: %v", t.categoryName, t.page, err)
+			log.Printf("[ERROR]  %s — error de red: %v", label, err)
 			continue
 		}
 
 		body, err := io.ReadAll(resp.Body)
 		resp.Body.Close()
 		if err != nil {
+			scrapeMetrics.ObserveRequest(0, time.Since(reqStart))
+			span.End(err)
 			lastErr = fmt.Errorf("error leyendo body: %w", err)
-			log.Printf("[ERROR]  %s pág %d — error leyendo respuesta: %v", t.categoryName, t.page, err)
+			log.Printf("[ERROR]  %s — error leyendo respuesta: %v", label, err)
 			continue
 		}
+		scrapeMetrics.ObserveRequest(resp.StatusCode, time.Since(reqStart))
+		span.SetAttr("http.response.status_code", resp.StatusCode)
+		span.SetAttr("http.response.body.size", len(body))
+		if err := checkChallenge(url, resp, body); err != nil {
+			span.End(err)
+			return nil, attempt, err
+		}
 
 		if resp.StatusCode == 429 {
-			backoff := time.Duration(math.Pow(3, float64(attempt+1))) * time.Second
-			log.Printf("[WARN]   %s pág %d — Rate limited (429), espera %v", t.categoryName, t.page, backoff)
-			time.Sleep(backoff)
+			backoff := time.Duration(math.Pow(3, float64(attempt+1)) * float64(flagBackoff) / 2)
+			log.Printf("[WARN]   %s — Rate limited (429), espera %v", label, backoff)
 			lastErr = fmt.Errorf("HTTP 429 rate limited")
+			span.End(lastErr)
+			time.Sleep(backoff)
 			continue
 		}
 
 		if resp.StatusCode != 200 {
 			lastErr = fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body[:min(200, len(body))]))
-			log.Printf("[ERROR]  %s pág %d — HTTP %d", t.categoryName, t.page, resp.StatusCode)
+			span.End(lastErr)
+			log.Printf("[ERROR]  %s — HTTP %d", label, resp.StatusCode)
 			continue
 		}
+		span.End(nil)
 
+		parseSpan := tracer.Start(parent, "parse json")
 		var products []APIProduct
-		if err := json.Unmarshal(body, &products); err != nil {
+		if err := json.Unmarshal(texto.UTF8(body, resp.Header.Get("Content-Type")), &products); err != nil {
+			scrapeMetrics.ParseFailures.Inc()
+			warnBudget.Warning()
+			parseSpan.End(err)
 			lastErr = fmt.Errorf("error parsing JSON: %w", err)
-			log.Printf("[ERROR]  %s pág %d — JSON inválido: %v", t.categoryName, t.page, err)
+			log.Printf("[ERROR]  %s — JSON inválido: %v", label, err)
 			continue
 		}
+		parseSpan.SetAttr("catalogo.productos", len(products))
+		parseSpan.End(nil)
 
-		return products, nil
+		return products, attempt, nil
 	}
 
-	return nil, fmt.Errorf("[%s] página %d falló después de %d intentos: %w", t.categoryName, t.page, maxRetries, lastErr)
+	return nil, maxRetries - 1, fmt.Errorf("[%s] falló después de %d intentos: %w", label, maxRetries, lastErr)
 }
 
-// convertPrice converts a WooCommerce minor-unit price string to float64.
-// e.g. "2700" with minorUnit=2 -> 27.00
+// convertPrice converts a WooCommerce minor-unit price string to float64,
+// e.g. "2700" with minorUnit=2 -> 27.00. One that does not parse is logged
+// and read as 0.
 func convertPrice(priceStr string, minorUnit int) float64 {
-	if priceStr == "" {
-		return 0.0
-	}
-	val, err := strconv.Atoi(priceStr)
+	val, err := extraer.UnidadesMinimas(priceStr, minorUnit)
 	if err != nil {
-		log.Printf("[WARN]   Precio inválido %q, usando 0.0", priceStr)
+		scrapeMetrics.ParseFailures.Inc()
+		warnBudget.Warning()
+		log.Printf("[WARN]   %v, usando 0.0", err)
 		return 0.0
 	}
+	return val
+}
 
-	divisor := math.Pow(10, float64(minorUnit))
-	return math.Round(float64(val)/divisor*100) / 100
+// stockText is the stock the catalog stores: the store's text ("12
+// disponibles"), except that the out-of-stock class always reads "Agotado",
+// whatever the wording, so the pages and -in-stock-only recognize it.
+func stockText(s APIStockAvail) string {
+	if s.Class == "out-of-stock" {
+		return "Agotado"
+	}
+	return s.Text
 }
 
-// extractSrcsetURL extracts a URL for a specific width descriptor from a srcset string.
-// e.g. extractSrcsetURL("...img-64x64.jpg 64w, ...img-100x100.jpg 100w", "64w") returns the 64w URL.
-func extractSrcsetURL(srcset string, width string) string {
-	for entry := range strings.SplitSeq(srcset, ",") {
-		parts := strings.Fields(strings.TrimSpace(entry))
-		if len(parts) == 2 && parts[1] == width {
-			return parts[0]
-		}
+// apiPrices returns the price of ap, its sale price when on sale, its
+// regular price and their ISO 4217 currency.
+func apiPrices(ap APIProduct) (float64, float64, string) {
+	precio := convertPrice(ap.Prices.Price, ap.Prices.CurrencyMinorUnit)
+	if ap.OnSale && ap.Prices.SalePrice != "" {
+		precio = convertPrice(ap.Prices.SalePrice, ap.Prices.CurrencyMinorUnit)
 	}
-	return ""
+	return precio, convertPrice(ap.Prices.RegularPrice, ap.Prices.CurrencyMinorUnit), strings.ToUpper(ap.Prices.CurrencyCode)
 }
 
-// parseProducts transforms API products into the output JSON format.
+// parseProducts transforms API products into the output JSON format. An
+// empty categoryName takes each product's category from ownCategory.
 func parseProducts(apiProducts []APIProduct, categoryName string) []Product {
 	products := make([]Product, 0, len(apiProducts))
 	for _, ap := range apiProducts {
@@ -263,7 +715,7 @@ func parseProducts(apiProducts []APIProduct, categoryName string) []Product {
 		imagen64 := ""
 		if len(ap.Images) > 0 {
 			imagen = ap.Images[0].Src
-			imagen64 = extractSrcsetURL(ap.Images[0].Srcset, "100w")
+			imagen64 = extraer.SrcsetURL(ap.Images[0].Srcset, "100w")
 			if imagen64 == "" {
 				imagen64 = imagen
 			}
@@ -271,12 +723,7 @@ func parseProducts(apiProducts []APIProduct, categoryName string) []Product {
 			log.Printf("[WARN]   Producto sin imagen: %q", ap.Name)
 		}
 
-		// Price: use sale_price if on sale, otherwise price
-		precio := convertPrice(ap.Prices.Price, ap.Prices.CurrencyMinorUnit)
-		if ap.OnSale && ap.Prices.SalePrice != "" {
-			precio = convertPrice(ap.Prices.SalePrice, ap.Prices.CurrencyMinorUnit)
-		}
-		precioOriginal := convertPrice(ap.Prices.RegularPrice, ap.Prices.CurrencyMinorUnit)
+		precio, precioOriginal, moneda := apiPrices(ap)
 
 		// Subcategories from API
 		var subcategorias []string
@@ -284,133 +731,636 @@ func parseProducts(apiProducts []APIProduct, categoryName string) []Product {
 			subcategorias = append(subcategorias, cat.Name)
 		}
 
-		products = append(products, Product{
+		p := Product{
 			Nombre:         ap.Name,
 			Precio:         precio,
 			PrecioOriginal: precioOriginal,
 			EnOferta:       ap.OnSale,
-			Stock:          ap.StockAvailability.Text,
+			Stock:          stockText(ap.StockAvailability),
 			Imagen:         imagen,
 			Imagen64:       imagen64,
-			Link:           ap.Permalink,
+			Link:           canonurl.Clean(ap.Permalink),
 			Categoria:      categoryName,
 			Subcategorias:  subcategorias,
-		})
+			Moneda:         moneda,
+			Tienda:         "buytiti",
+		}
+		if categoryName == "" {
+			p.Categoria = ownCategory(ap)
+		}
+		p.MesesSinIntereses = producto.MesesSinIntereses(ap.ShortDescription)
+		p.EnvioGratis = envio.Insignia(ap.ShortDescription)
+		if t, ok := english[ap.SKU]; ok && ap.SKU != "" {
+			p.NombreEN, p.DescripcionEN = t.Name, descripcion(t)
+		}
+		p.SetUnitPrice()
+		products = append(products, p)
 	}
 	return products
 }
 
-// worker reads tasks from the tasks channel, fetches and parses products,
+// english holds the English translation of each product by SKU, loaded
+// before the workers start when -lang-en is set; nil otherwise.
+var english map[string]APIProduct
+
+// loadEnglish lists the whole store in the -lang-en language. WPML gives
+// each translation its own ID and permalink, but WooCommerce Multilingual
+// keeps the SKU of the original, so that is what pairs them. A listing that
+// fails leaves the products it did not reach without translation.
+func loadEnglish(client *http.Client) map[string]APIProduct {
+	bySKU := make(map[string]APIProduct)
+	for page := 1; ; page++ {
+		apiURL := fmt.Sprintf("%s?page=%d&per_page=%d&lang=%s", apiBase, page, maxPerPage, url.QueryEscape(flagLangEN))
+		apiProducts, _, err := fetchProducts(context.Background(), client, nil, apiURL, fmt.Sprintf("listado %s pág %d", flagLangEN, page))
+		if err != nil {
+			log.Printf("[WARN]   Traducciones: %v", err)
+			break
+		}
+		if len(apiProducts) == 0 {
+			break
+		}
+		for _, ap := range apiProducts {
+			if ap.SKU != "" {
+				bySKU[ap.SKU] = ap
+			}
+		}
+		time.Sleep(flagDelay)
+	}
+	log.Printf("[LANG]   %d productos traducidos a %s", len(bySKU), flagLangEN)
+	return bySKU
+}
+
+// descripcion is the plain-text description of ap, or its short one.
+func descripcion(ap APIProduct) string {
+	if d := extraer.TextoPlano(ap.Description); d != "" {
+		return d
+	}
+	return extraer.TextoPlano(ap.ShortDescription)
+}
+
+// errPanic marks a task whose processing panicked.
+var errPanic = errors.New("panic")
+
+// panics counts the tasks that panicked during the run.
+var panics atomic.Int32
+
+// watch cancels worker tasks stuck for longer than -stuck-timeout; stuck
+// counts them.
+var (
+	watch *watchdog.Watchdog
+	stuck atomic.Int32
+)
+
+// scrapePage fetches and parses one listing page. A panic while doing so is
+// returned as an error wrapping errPanic instead of killing the worker.
+func scrapePage(ctx context.Context, client *http.Client, span *tracing.Span, t task) (products []Product, retries int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v\n%s", errPanic, r, debug.Stack())
+		}
+	}()
+
+	apiProducts, retries, err := fetchPage(ctx, client, span, t)
+	if err != nil || len(apiProducts) == 0 {
+		return nil, retries, err
+	}
+	parseSpan := tracer.Start(span, "parse products")
+	name := t.categoryName
+	if t.slug == "" {
+		name = ""
+	}
+	products = parseProducts(apiProducts, name)
+	parseSpan.End(nil)
+	if variantMode == producto.Expandir {
+		products = expandVariants(ctx, client, span, apiProducts, products)
+	}
+	listed.Sumar(t.categoryName, len(apiProducts))
+	return products, retries, nil
+}
+
+// listed counts the products the listing returned per category, for
+// checkCounts; countTolerance is -count-tolerance.
+var (
+	listed         categorias.Conteo
+	countTolerance float64
+)
+
+// checkCounts compares the products listed in each category of cats with
+// the count the Store API reports for it, and warns about each category
+// off by more than -count-tolerance: a pagination bug or failed pages
+// leave a category short. Runs whose listing is partial on purpose
+// (-sample, a listing filter, a resumed queue) are not checked, nor the
+// store-wide listing of -mode all-products.
+func checkCounts(client *http.Client, cats map[string]string, resumed bool) {
+	if flagCountTol == "" || flagSample > 0 || listingFilter != "" || resumed || flagMode == modeAllProducts {
+		return
+	}
+	all, err := fetchAllCategories(client, nil)
+	if err != nil {
+		log.Printf("[WARN]   No se pudieron comparar los conteos por categoría: %v", err)
+		return
+	}
+	bySlug := make(map[string]int, len(all))
+	for _, c := range all {
+		bySlug[c.Slug] = c.Count
+	}
+	reported := make(map[string]int, len(cats))
+	for name, slug := range cats {
+		if n, ok := bySlug[slug]; ok {
+			reported[name] = n
+		}
+	}
+	diffs := listed.Comparar(reported, countTolerance)
+	for _, d := range diffs {
+		warnBudget.Warning()
+		log.Printf("[COUNT]  %s: %d productos listados, la tienda reporta %d (%+d)", d.Categoria, d.Listados, d.Reportados, d.Listados-d.Reportados)
+	}
+	if len(diffs) == 0 {
+		log.Printf("[COUNT]  Los %d conteos por categoría coinciden (tolerancia %s)", len(reported), flagCountTol)
+	}
+}
+
+// uncategorized walks the store-wide listing, with no category, for the
+// products whose link seen does not know: products whose only category is
+// one of ignoreSlugs, or a root category with no count, are in no listing
+// the run walked. Each takes its category from ownCategory. The blocklist and product filter apply as
+// in the workers.
+func uncategorized(client *http.Client, seen func(link string) bool) ([]Product, error) {
+	var out []Product
+	for page := 1; ; page++ {
+		apiURL := fmt.Sprintf("%s?page=%d&per_page=%d", apiBase, page, maxPerPage) + listingFilter
+		apiProducts, _, err := fetchProducts(context.Background(), client, nil, apiURL, fmt.Sprintf("listado pág %d", page))
+		warnBudget.Request(err != nil)
+		if err != nil {
+			return out, err
+		}
+		if len(apiProducts) == 0 {
+			return out, nil
+		}
+		byCategory := make(map[string][]APIProduct)
+		var names []string
+		for _, ap := range apiProducts {
+			if seen(ap.Permalink) {
+				continue
+			}
+			name := ownCategory(ap)
+			if byCategory[name] == nil {
+				names = append(names, name)
+			}
+			byCategory[name] = append(byCategory[name], ap)
+		}
+		for _, name := range names {
+			products := parseProducts(byCategory[name], name)
+			if variantMode == producto.Expandir {
+				products = expandVariants(context.Background(), client, nil, byCategory[name], products)
+			}
+			n := len(products)
+			products = blocklist.Aplicar(products)
+			blocked.Add(int32(n - len(products)))
+			n = len(products)
+			products = productFilter.Aplicar(products)
+			filtered.Add(int32(n - len(products)))
+			out = append(out, products...)
+		}
+		if flagVerbose {
+			log.Printf("[UNCAT]  Listado pág %d → %d productos sin listar", page, len(out))
+		}
+		time.Sleep(flagDelay)
+	}
+}
+
+// ownCategory is the root category of the first of ap's categories in
+// categoryRoots or, with no tree, the first of them that is not ignored.
+func ownCategory(ap APIProduct) string {
+	for _, c := range ap.Categories {
+		if root, ok := categoryRoots[c.ID]; ok {
+			return root
+		}
+	}
+	for _, c := range ap.Categories {
+		if !ignoreSlugs[c.Slug] {
+			return c.Name
+		}
+	}
+	return "Sin categoría"
+}
+
+// linkSample is -check-links: how many product links checkLinks requests.
+var linkSample int
+
+// checkLinks requests the links of products, or a sample of them, before
+// the output is written (-check-links). Broken ones, usually products the
+// store removed but still lists, count as warnings; the ones that moved
+// are recorded under their new address.
+func checkLinks(client *http.Client, products []Product) {
+	if linkSample == 0 {
+		return
+	}
+	runStatus.Phase("enlaces")
+	inf := enlaces.Revisar(context.Background(), client, products, linkSample, flagWorkers, flagDelay)
+	for _, p := range inf.Problemas {
+		warnBudget.Warning()
+		if p.Final != "" {
+			log.Printf("[LINK]   %s → %s: %s", p.Link, p.Final, p.Motivo)
+		} else {
+			log.Printf("[LINK]   %s: %s", p.Link, p.Motivo)
+		}
+	}
+	log.Printf("[LINK]   %d enlaces revisados: %d movidos, %d con problemas", inf.Revisados, inf.Movidos, len(inf.Problemas))
+}
+
+// variantMode is -expand-variants or -parents-only.
+var variantMode producto.Variantes
+
+// expandVariants replaces each variable product in products, parsed from
+// apiProducts, with its variations, fetched in one request per product. A
+// product whose variations cannot be fetched stays as the parent.
+func expandVariants(ctx context.Context, client *http.Client, span *tracing.Span, apiProducts []APIProduct, products []Product) []Product {
+	out := make([]Product, 0, len(products))
+	for i, ap := range apiProducts {
+		parent := products[i]
+		if ap.Type != "variable" || len(ap.Variations) == 0 {
+			out = append(out, parent)
+			continue
+		}
+		ids := make([]string, len(ap.Variations))
+		for j, v := range ap.Variations {
+			ids[j] = strconv.Itoa(v.ID)
+		}
+		apiURL := fmt.Sprintf("%s?type=variation&include=%s&per_page=%d", apiBase, strings.Join(ids, ","), maxPerPage)
+		variations, _, err := fetchProducts(ctx, client, span, apiURL, ap.Name+" (variantes)")
+		if err != nil || len(variations) == 0 {
+			log.Printf("[WARN]   %q: no se obtuvieron sus variantes (%v); se conserva el producto padre", ap.Name, err)
+			out = append(out, parent)
+			continue
+		}
+		byID := make(map[int]APIProduct, len(variations))
+		for _, va := range variations {
+			byID[va.ID] = va
+		}
+		for _, v := range ap.Variations {
+			va, ok := byID[v.ID]
+			if !ok {
+				continue
+			}
+			attrs := make([]producto.Atributo, len(v.Attributes))
+			for j, a := range v.Attributes {
+				attrs[j] = producto.Atributo{Nombre: a.Name, Valor: a.Value}
+			}
+			// Variations without their own page open the parent's with the
+			// variation preselected
+			link := canonurl.Clean(va.Permalink)
+			if link == "" || canonurl.Key(link) == canonurl.Key(parent.Link) {
+				link = canonurl.Clean(parent.Link + "?variation_id=" + strconv.Itoa(v.ID))
+			}
+			p := parent.ComoVariante(attrs, link)
+			p.Precio, p.PrecioOriginal, p.Moneda = apiPrices(va)
+			p.EnOferta = va.OnSale
+			p.Stock = stockText(va.StockAvailability)
+			if len(va.Images) > 0 {
+				p.Imagen = va.Images[0].Src
+				if p.Imagen64 = extraer.SrcsetURL(va.Images[0].Srcset, "100w"); p.Imagen64 == "" {
+					p.Imagen64 = p.Imagen
+				}
+			}
+			p.SetUnitPrice()
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// taskList collects tasks from several workers.
+type taskList struct {
+	mu    sync.Mutex
+	tasks []task
+}
+
+func (l *taskList) add(t task) {
+	l.mu.Lock()
+	l.tasks = append(l.tasks, t)
+	l.mu.Unlock()
+}
+
+// taskQueue is where workers take tasks from and put the next pages on: a
+// channel, or a file with -disk-queue.
+type taskQueue interface {
+	push(t task) error
+	pop() (task, bool)
+	// done marks a popped task as finished.
+	done(t task)
+	len() int
+	// end makes pop return false once the queue is empty.
+	end()
+}
+
+type chanQueue chan task
+
+func (q chanQueue) push(t task) error { q <- t; return nil }
+func (q chanQueue) pop() (task, bool) { t, ok := <-q; return t, ok }
+func (q chanQueue) done(task)         {}
+func (q chanQueue) len() int          { return len(q) }
+func (q chanQueue) end()              { close(q) }
+
+// queuedTask is a task as stored in the disk queue.
+type queuedTask struct {
+	Slug       string `json:"slug"`
+	Categoria  string `json:"categoria"`
+	Pagina     int    `json:"pagina"`
+	Reencolada bool   `json:"reencolada,omitempty"`
+}
+
+type diskQueue struct {
+	q *diskq.Queue[queuedTask]
+}
+
+func (d diskQueue) push(t task) error {
+	return d.q.Push(queuedTask{Slug: t.slug, Categoria: t.categoryName, Pagina: t.page, Reencolada: t.requeued})
+}
+
+func (d diskQueue) pop() (task, bool) {
+	qt, qid, ok := d.q.Pop()
+	if !ok {
+		return task{}, false
+	}
+	return task{id: taskSeq.Next(), slug: qt.Slug, categoryName: qt.Categoria, page: qt.Pagina, requeued: qt.Reencolada, qid: qid}, true
+}
+
+func (d diskQueue) done(t task) { d.q.Done(t.qid) }
+func (d diskQueue) len() int    { return d.q.Len() }
+func (d diskQueue) end()        { d.q.End() }
+
+// enqueue adds t to q, counting it in pending.
+func enqueue(q taskQueue, pending *atomic.Int32, t task) {
+	pending.Add(1)
+	if err := q.push(t); err != nil {
+		log.Printf("[QUEUE]  No se pudo encolar %s pág %d: %v", t.categoryName, t.page, err)
+		runStatus.Error()
+		pending.Add(-1)
+	}
+}
+
+// worker reads tasks from the queue, fetches and parses products,
 // sends results to the results channel. If a page returns products,
-// it enqueues the next page as a new task.
-func worker(id int, client *http.Client, tasks <-chan task, results chan<- []Product, tasksCh chan<- task, pending *atomic.Int32, wg *sync.WaitGroup, delay time.Duration) {
+// it enqueues the next page as a new task. A task that panics is requeued once;
+// one that still fails after its retries goes to retryLater, when not nil.
+func worker(id int, client *http.Client, q taskQueue, results chan<- []Product, pending *atomic.Int32, wg *sync.WaitGroup, delay time.Duration, stats *timing.Stats, retryLater *taskList) {
 	defer wg.Done()
 
-	for t := range tasks {
-		log.Printf("[W%d]     Fetch %s pág %d", id, t.categoryName, t.page)
+	for {
+		waitStart := time.Now()
+		t, ok := q.pop()
+		stats.Idle(id, time.Since(waitStart))
+		if !ok {
+			return
+		}
+		finish := func() {
+			q.done(t)
+			pending.Add(-1)
+		}
+		// A blocked store gets no more requests: drain the queue
+		if storeBlock.Err() != nil {
+			finish()
+			continue
+		}
+
+		log.Printf("[W%d]     %s Fetch %s pág %d", id, t.id, t.categoryName, t.page)
+
+		pageStart := time.Now()
+		span := tracer.Start(nil, "page", "catalogo.categoria", t.categoryName, "catalogo.pagina", t.page, "catalogo.worker", id, "catalogo.tarea", t.id)
+		ctx, end := watch.Begin(context.Background(), id, t.id+" "+t.url())
+		products, retries, err := scrapePage(ctx, client, span, t)
+		end()
+		stats.Page(id, t.categoryName, time.Since(pageStart), retries)
+		span.SetAttr("catalogo.productos", len(products))
+		span.End(err)
+
+		if errors.Is(err, errPanic) {
+			panics.Add(1)
+			log.Printf("[PANIC]  W%d %s %s: %v", id, t.id, t.url(), err)
+			if !t.requeued {
+				log.Printf("[QUEUE]  Reencolando %s pág %d tras el panic", t.categoryName, t.page)
+				retry := t
+				retry.requeued = true
+				enqueue(q, pending, retry)
+				finish()
+				continue
+			}
+		}
+
+		if err != nil && retryLater != nil {
+			log.Printf("[W%d]     %s ERROR (se reintentará al final): %v", id, t.id, err)
+			retryLater.add(t)
+			finish()
+			continue
+		}
 
-		apiProducts, err := fetchPage(client, t)
+		warnBudget.Request(err != nil)
 		if err != nil {
-			log.Printf("[W%d]     ERROR: %v", id, err)
-			pending.Add(-1)
+			log.Printf("[W%d]     %s ERROR: %v", id, t.id, err)
+			runStatus.Error()
+			runStatus.CategoryDone()
+			finish()
 			continue
 		}
 
-		if len(apiProducts) == 0 {
+		if len(products) == 0 {
 			log.Printf("[DONE]   %s completada (pág %d vacía)", t.categoryName, t.page)
-			pending.Add(-1)
+			runStatus.CategoryDone()
+			finish()
 			continue
 		}
 
-		products := parseProducts(apiProducts, t.categoryName)
+		log.Printf("[W%d]     %s %s pág %d → %d productos", id, t.id, t.categoryName, t.page, len(products))
+		sampled := flagSample > 0 && t.page*pageSize() >= flagSample
+		if sampled {
+			products = products[:min(len(products), flagSample-(t.page-1)*pageSize())]
+		}
+		n := len(products)
+		products = blocklist.Aplicar(products)
+		blocked.Add(int32(n - len(products)))
+		n = len(products)
+		products = productFilter.Aplicar(products)
+		filtered.Add(int32(n - len(products)))
 		results <- products
 
-		log.Printf("[W%d]     %s pág %d → %d productos", id, t.categoryName, t.page, len(products))
-
-		// Enqueue next page for this category
-		pending.Add(1)
-		tasksCh <- task{
-			slug:         t.slug,
-			categoryName: t.categoryName,
-			page:         t.page + 1,
+		// Enqueue next page for this category, unless the sample is complete
+		if sampled {
+			log.Printf("[DONE]   %s completada (muestra de %d)", t.categoryName, flagSample)
+			runStatus.CategoryDone()
+		} else {
+			enqueue(q, pending, task{
+				id:           taskSeq.Next(),
+				slug:         t.slug,
+				categoryName: t.categoryName,
+				page:         t.page + 1,
+			})
 		}
 
 		// Mark current task done
-		pending.Add(-1)
+		finish()
 
 		time.Sleep(delay)
+		stats.Delay(id, delay)
 	}
 }
 
-// run orchestrates the scraping: creates channels, launches workers,
-// seeds initial tasks, collects results, and writes JSON incrementally.
-func run(cats map[string]string, numWorkers int, delay time.Duration, outputPath string) error {
-	tasksCh := make(chan task, 100)
-	results := make(chan []Product, 100)
+// crawl runs numWorkers workers over the tasks already in q, the seed tasks
+// and the next pages they discover until no work is left, sending each page's
+// products to results.
+func crawl(client *http.Client, q taskQueue, seeds []task, numWorkers int, delay time.Duration, stats *timing.Stats, results chan<- []Product, retryLater *taskList) {
 	var pending atomic.Int32
 	var wg sync.WaitGroup
 
-	client := &http.Client{Timeout: 30 * time.Second}
-
-	// Launch workers
-	// Reset JSON file at start
-	if err := writeJSON([]Product{}, outputPath); err != nil {
-		return fmt.Errorf("error reseteando JSON: %w", err)
-	}
-	log.Printf("[RESET]  JSON reiniciado: %s", outputPath)
-
-	log.Printf("[START]  Lanzando %d workers...", numWorkers)
+	pending.Add(int32(q.len()))
 	for i := range numWorkers {
 		wg.Add(1)
-		go worker(i+1, client, tasksCh, results, tasksCh, &pending, &wg, delay)
+		go worker(i+1, client, q, results, &pending, &wg, delay, stats, retryLater)
 	}
 
-	// Seed initial tasks (page 1 for each category)
-	for name, slug := range cats {
-		pending.Add(1)
-		log.Printf("[QUEUE]  Encolando %s (slug: %s) pág 1", name, slug)
-		tasksCh <- task{slug: slug, categoryName: name, page: 1}
+	for _, t := range seeds {
+		enqueue(q, &pending, t)
 	}
 
-	// Monitor: close tasks channel when all work is done
+	// Monitor: end the queue when all work is done
 	go func() {
 		for {
 			time.Sleep(200 * time.Millisecond)
 			if pending.Load() <= 0 {
-				close(tasksCh)
+				q.end()
 				return
 			}
 		}
 	}()
 
-	// Wait for workers to finish, then close results
+	wg.Wait()
+}
+
+// run orchestrates the scraping: creates channels, launches workers,
+// seeds initial tasks, collects results, and writes JSON incrementally.
+// previous, when set, holds the products of categories not in cats to keep;
+// the output is then left alone until the final write, so a run that stops
+// halfway does not publish only the categories it re-scraped.
+func run(cats map[string]string, previous []Product, numWorkers int, delay time.Duration, outputPath string) error {
+	results := make(chan []Product, 100)
+	client := auditLog.Client(httpTransport, 30*time.Second)
+
+	// Reset JSON file at start
+	incremental := previous == nil
+	if incremental {
+		if err := writeJSON([]Product{}, outputPath); err != nil {
+			return fmt.Errorf("error reseteando JSON: %w", err)
+		}
+		log.Printf("[RESET]  JSON reiniciado: %s", outputPath)
+	}
+
+	sp, recovered, err := openSpill(outputPath)
+	if err != nil {
+		return err
+	}
+	defer sp.Close()
+
+	var q taskQueue = chanQueue(make(chan task, 100))
+	dq, err := openQueue(outputPath)
+	if err != nil {
+		return err
+	}
+	if dq != nil {
+		defer dq.Close()
+		q = diskQueue{dq}
+	}
+
+	runStatus.Phase("productos")
+	log.Printf("[START]  Lanzando %d workers...", numWorkers)
+	stats := timing.New()
+
+	// Seed initial tasks (page 1 for each category), unless resuming the
+	// pages left in the disk queue by an interrupted run
+	var seeds []task
+	resumed := q.len() > 0
+	if n := q.len(); n > 0 {
+		log.Printf("[QUEUE]  Reanudando %d tareas pendientes de una corrida interrumpida", n)
+		if sp == nil {
+			log.Printf("[WARN]   Sin spill (-spill-interval 0): los productos de las categorías ya terminadas no se recuperan")
+		}
+	} else {
+		for _, name := range categorias.Ordenadas(cats) {
+			slug := cats[name]
+			log.Printf("[QUEUE]  Encolando %s (slug: %s) pág 1", name, slug)
+			seeds = append(seeds, task{id: taskSeq.Next(), slug: slug, categoryName: name, page: 1})
+		}
+	}
+
+	// Crawl, then give the pages that exhausted their retries one more chance
+	// at low concurrency after a cool-down, before closing results
 	go func() {
-		wg.Wait()
-		close(results)
+		defer close(results)
+		var retryLater *taskList
+		if flagFinalRetryWorkers > 0 {
+			retryLater = &taskList{}
+		}
+		crawl(client, q, seeds, numWorkers, delay, stats, results, retryLater)
+		if retryLater == nil || len(retryLater.tasks) == 0 || storeBlock.Err() != nil {
+			return
+		}
+
+		failed := retryLater.tasks
+		runStatus.Phase("reintentos")
+		log.Printf("[RETRY]  %d páginas fallidas; pasada final con %d worker(s) en %v", len(failed), flagFinalRetryWorkers, flagFinalRetryCooldown)
+		time.Sleep(flagFinalRetryCooldown)
+		for i := range failed {
+			failed[i].id = taskSeq.Next()
+		}
+		crawl(client, chanQueue(make(chan task, 100)), failed, flagFinalRetryWorkers, delay, stats, results, nil)
 	}()
 
-	// Collect results incrementally and write JSON after each batch
+	// Collect results incrementally and write JSON after each batch.
+	// Products recovered from the spill are kept until this run fetches them again.
 	var allProducts []Product
 	var mu sync.Mutex
-	seen := make(map[string]bool)
+	index := make(map[string]int)
+	stale := make(map[string]bool)
 	counts := make(map[string]int)
 	totalBatches := 0
+	added := 0
+	for _, p := range recovered {
+		key := canonurl.Key(p.Link)
+		index[key] = len(allProducts)
+		stale[key] = true
+		allProducts = append(allProducts, p)
+		counts[p.Categoria]++
+	}
 
 	for batch := range results {
+		sp.Add(batch...)
 		mu.Lock()
 		for _, p := range batch {
-			if seen[p.Link] {
+			key := canonurl.Key(p.Link)
+			if i, ok := index[key]; ok {
+				// A product listed in several categories keeps the
+				// alphabetically first category, regardless of which
+				// listing the workers read first
+				if stale[key] || texto.Normalize(p.Categoria) < texto.Normalize(allProducts[i].Categoria) {
+					delete(stale, key)
+					counts[allProducts[i].Categoria]--
+					counts[p.Categoria]++
+					allProducts[i] = p
+				}
 				continue
 			}
-			seen[p.Link] = true
+			index[key] = len(allProducts)
 			allProducts = append(allProducts, p)
 			counts[p.Categoria]++
 		}
 		totalBatches++
 		currentTotal := len(allProducts)
 		mu.Unlock()
+		runStatus.Products(currentTotal)
 
 		// Write JSON incrementally after each batch
+		if !incremental {
+			continue
+		}
 		if err := writeJSON(allProducts, outputPath); err != nil {
 			log.Printf("[ERROR]  Error escribiendo JSON incremental: %v", err)
 		} else if flagVerbose {
@@ -418,36 +1368,391 @@ func run(cats map[string]string, numWorkers int, delay time.Duration, outputPath
 		}
 	}
 
+	// Products the category listings missed, from the store-wide listing.
+	// Runs that leave categories out on purpose have nothing to add.
+	if flagUncat && flagMode == modeCategories && previous == nil && !categoryFilter().Activo() && flagSample == 0 && storeBlock.Err() == nil {
+		runStatus.Phase("sin categoría")
+		if categoryRoots == nil {
+			categoryRoots = loadRoots(client)
+		}
+		extra, err := uncategorized(client, func(link string) bool {
+			_, ok := index[canonurl.Key(link)]
+			return ok
+		})
+		if err != nil {
+			warnBudget.Warning()
+			log.Printf("[WARN]   Pasada sin categoría incompleta: %v", err)
+		}
+		for _, p := range extra {
+			key := canonurl.Key(p.Link)
+			if _, ok := index[key]; ok {
+				continue
+			}
+			index[key] = len(allProducts)
+			allProducts = append(allProducts, p)
+			counts[p.Categoria]++
+			added++
+			log.Printf("[UNCAT]  %s → %s", p.Nombre, p.Categoria)
+		}
+		if added > 0 {
+			runStatus.Products(len(allProducts))
+			if err := writeJSON(allProducts, outputPath); err != nil {
+				log.Printf("[ERROR]  Error escribiendo JSON incremental: %v", err)
+			}
+		}
+	}
+
+	if previous != nil {
+		scraped := len(allProducts)
+		allProducts = categorias.Conservar(allProducts, previous, cats)
+		log.Printf("[CATS]   %d productos de otras categorías conservados de la salida anterior", len(allProducts)-scraped)
+	}
+
 	// Final summary
 	fmt.Println()
 	log.Printf("[RESUMEN] ─────────────────────────────")
-	for name := range cats {
+	summary := cats
+	if flagMode == modeAllProducts {
+		summary = make(map[string]string, len(counts))
+		for name := range counts {
+			summary[name] = ""
+		}
+	}
+	for _, name := range categorias.Ordenadas(summary) {
 		log.Printf("[RESUMEN] %s: %d productos", name, counts[name])
 	}
 	log.Printf("[RESUMEN] ─────────────────────────────")
 	log.Printf("[RESUMEN] Total: %d productos en %d batches", len(allProducts), totalBatches)
+	if added > 0 {
+		log.Printf("[RESUMEN] Agregados por la pasada sin categoría: %d", added)
+	}
+	if n := panics.Load(); n > 0 {
+		log.Printf("[RESUMEN] Panics recuperados: %d", n)
+	}
+	if n := stuck.Load(); n > 0 {
+		log.Printf("[RESUMEN] Tareas atascadas canceladas: %d", n)
+	}
+	if n := filtered.Load(); n > 0 {
+		log.Printf("[RESUMEN] Descartados por el filtro de productos: %d", n)
+	}
+	if n := blocked.Load(); n > 0 {
+		log.Printf("[RESUMEN] Excluidos por la lista de bloqueo: %d", n)
+	}
+	if lines := stats.Summary(); lines != nil {
+		log.Printf("[RESUMEN] ─────────────────────────────")
+		for _, line := range lines {
+			log.Printf("[RESUMEN] %s", line)
+		}
+	}
+
+	if err := storeBlock.Err(); err != nil {
+		return savePartial(allProducts, outputPath, err)
+	}
+	checkCounts(client, cats, resumed)
+	checkLinks(client, allProducts)
+	if err := warnBudget.Check(); err != nil {
+		return savePartial(allProducts, outputPath, err)
+	}
+
+	// Final sorted write (-sort, by category then name by default)
+	runStatus.Phase("escritura")
+	outputOrder.Ordenar(allProducts)
+	allProducts = prepareOutput(allProducts)
+	unchanged := previousRaw != nil && producto.Hash(outputFields.Recortar(allProducts)) == previousHash
+	if unchanged {
+		// The incremental writes replaced the previous output; restore it
+		// byte for byte so nothing downstream sees a change
+		if err := os.WriteFile(outputPath, previousRaw, 0644); err != nil {
+			return savePartial(allProducts, outputPath, fmt.Errorf("error en escritura final: %w", err))
+		}
+		log.Printf("[WRITE]  Sin cambios: se conserva la salida anterior")
+		signOutput(outputPath)
+	} else {
+		if err := writeJSON(allProducts, outputPath); err != nil {
+			return savePartial(allProducts, outputPath, fmt.Errorf("error en escritura final: %w", err))
+		}
+		sortKeys := strings.TrimSpace(flagSort)
+		if sortKeys == "" {
+			sortKeys = producto.OrdenPredeterminado
+		}
+		log.Printf("[WRITE]  JSON final escrito (ordenado por %s)", sortKeys)
+		writeMeta(allProducts, outputPath)
+	}
+	os.Remove(producto.PartialPath(outputPath))
+	if err := sp.Done(); err != nil {
+		log.Printf("[WARN]   No se pudo borrar el spill: %v", err)
+	}
+	if dq != nil {
+		if err := dq.Remove(); err != nil {
+			log.Printf("[WARN]   No se pudo borrar la cola: %v", err)
+		}
+	}
 
-	// Final sorted write (sort by category, then name)
-	sort.Slice(allProducts, func(i, j int) bool {
-		if allProducts[i].Categoria != allProducts[j].Categoria {
-			return allProducts[i].Categoria < allProducts[j].Categoria
+	if flagWhatsApp != "" && !unchanged {
+		if err := producto.WriteWhatsAppCSV(allProducts, flagWhatsApp, "MXN", "BuyTiti"); err != nil {
+			return fmt.Errorf("error escribiendo CSV de WhatsApp: %w", err)
 		}
-		return allProducts[i].Nombre < allProducts[j].Nombre
+		log.Printf("[WRITE]  CSV de WhatsApp escrito: %s", flagWhatsApp)
+	}
+
+	return nil
+}
+
+// runWatch re-checks only the products listed in the watch file (price and
+// stock) and updates them in the existing output, leaving the rest untouched.
+func runWatch(client *http.Client, watchPath, outputPath string) error {
+	links, err := producto.ReadLinks(watchPath)
+	if err != nil {
+		return err
+	}
+	products, err := producto.ReadJSON(outputPath)
+	if err != nil {
+		return fmt.Errorf("-watch necesita la salida de una corrida completa: %w", err)
+	}
+
+	runStatus.Phase("watch")
+	runStatus.Products(len(products))
+	log.Printf("[WATCH]  Revisando %d productos vigilados", len(links))
+	stats := producto.Refresh(products, links, flagWorkers, flagDelay, func(p Product) (Product, error) {
+		// Looking up by slug finds the parent, not this variation
+		if p.Variante != "" {
+			return p, nil
+		}
+		fresh, err := fetchProductByLink(audit.WithTask(context.Background(), taskSeq.Next()), client, p)
+		warnBudget.Request(err != nil)
+		if err != nil {
+			runStatus.Error()
+			log.Printf("[ERROR]  %s: %v", p.Link, err)
+			return fresh, err
+		}
+		log.Printf("[WATCH]  %q — $%.2f | %s", fresh.Nombre, fresh.Precio, fresh.Stock)
+		return fresh, nil
 	})
-	if err := writeJSON(allProducts, outputPath); err != nil {
-		return fmt.Errorf("error en escritura final: %w", err)
+	log.Printf("[WATCH]  %d actualizados, %d sin cambios, %d fallidos, %d fuera del catálogo",
+		stats.Actualizados, stats.SinCambios, stats.Fallidos, stats.Desconocidos)
+	if err := storeBlock.Err(); err != nil {
+		return err
+	}
+	if err := warnBudget.Check(); err != nil {
+		return err
+	}
+
+	products = prepareOutput(products)
+	if err := writeJSON(products, outputPath); err != nil {
+		return err
+	}
+	writeMeta(products, outputPath)
+	return nil
+}
+
+// runQuick refreshes price and stock of every product in the existing output
+// from the store-wide listing at 100 products per page, skipping category
+// discovery. Products missing from the listing are kept as they were.
+func runQuick(client *http.Client, outputPath string) error {
+	products, err := producto.ReadJSON(outputPath)
+	if err != nil {
+		return fmt.Errorf("-quick necesita la salida de una corrida completa: %w", err)
+	}
+	runStatus.Phase("quick")
+	runStatus.Products(len(products))
+
+	fresh := make(map[string]APIProduct)
+	for page := 1; ; page++ {
+		apiURL := fmt.Sprintf("%s?page=%d&per_page=%d", apiBase, page, maxPerPage)
+		apiProducts, _, err := fetchProducts(context.Background(), client, nil, apiURL, fmt.Sprintf("listado pág %d", page))
+		if err != nil {
+			return err
+		}
+		if len(apiProducts) == 0 {
+			break
+		}
+		for _, ap := range apiProducts {
+			fresh[canonurl.Key(ap.Permalink)] = ap
+		}
+		log.Printf("[QUICK]  Listado pág %d → %d productos", page, len(apiProducts))
+		time.Sleep(flagDelay)
 	}
-	log.Printf("[WRITE]  JSON final escrito (ordenado por categoría y nombre)")
 
+	var stats producto.RefreshStats
+	for i := range products {
+		ap, ok := fresh[canonurl.Key(products[i].Link)]
+		if !ok {
+			stats.Desconocidos++
+			continue
+		}
+		if products[i].RefreshPriceStock(parseProducts([]APIProduct{ap}, products[i].Categoria)[0]) {
+			stats.Actualizados++
+		} else {
+			stats.SinCambios++
+		}
+	}
+	log.Printf("[QUICK]  %d actualizados, %d sin cambios, %d ya no aparecen en el listado",
+		stats.Actualizados, stats.SinCambios, stats.Desconocidos)
+	if err := storeBlock.Err(); err != nil {
+		return err
+	}
+	if err := warnBudget.Check(); err != nil {
+		return err
+	}
+
+	products = prepareOutput(products)
+	if err := writeJSON(products, outputPath); err != nil {
+		return err
+	}
+	writeMeta(products, outputPath)
 	return nil
 }
 
-// writeJSON writes the product list to a JSON file with 4-space indentation.
-func writeJSON(products []Product, fpath string) error {
-	data, err := json.MarshalIndent(products, "", "    ")
+// fetchProductByLink looks a single product up by the slug at the end of its permalink.
+func fetchProductByLink(ctx context.Context, client *http.Client, p Product) (Product, error) {
+	slug := path.Base(strings.TrimSuffix(p.Link, "/"))
+	apiURL := fmt.Sprintf("%s?slug=%s", apiBase, url.QueryEscape(slug))
+	apiProducts, _, err := fetchProducts(ctx, client, nil, apiURL, p.Nombre)
+	if err != nil {
+		return Product{}, err
+	}
+	for _, ap := range apiProducts {
+		if canonurl.Key(ap.Permalink) == canonurl.Key(p.Link) {
+			return parseProducts([]APIProduct{ap}, p.Categoria)[0], nil
+		}
+	}
+	return Product{}, fmt.Errorf("producto no encontrado en la API")
+}
+
+// loadCategories returns the store's categories, from the on-disk cache when
+// it is younger than -categories-ttl.
+func loadCategories(client *http.Client, outputPath string) (map[string]string, error) {
+	cachePath := flagCatCache
+	if cachePath == "" {
+		cachePath = categorias.DefaultPath(outputPath)
+	}
+	span := tracer.Start(nil, "discover categories", "catalogo.cache", cachePath)
+	cacheHit := true
+	cats, err := categorias.Cached(cachePath, flagCatTTL, flagRefreshCats, func() (map[string]string, error) {
+		cacheHit = false
+		return fetchCategories(client, span)
+	})
+	span.SetAttr("catalogo.cache_hit", cacheHit)
+	span.SetAttr("catalogo.categorias", len(cats))
+	span.End(err)
+	return cats, err
+}
+
+// runFull discovers categories and scrapes the whole store.
+func runFull(client *http.Client, outputPath string) error {
+	runStatus.Phase("categorias")
+	if flagMode == modeAllProducts {
+		return runAllProducts(client, outputPath)
+	}
+	categories, err := loadCategories(client, outputPath)
+	if err != nil {
+		return fmt.Errorf("error obteniendo categorías: %w", err)
+	}
+	if len(categories) == 0 {
+		return fmt.Errorf("no se encontraron categorías")
+	}
+	categories, previous, err := selectCategories(categories, outputPath)
+	if err != nil {
+		return err
+	}
+
+	runStatus.Categories(len(categories))
+	log.Printf("[CONFIG] Categorías: %d", len(categories))
+	for name, slug := range categories {
+		log.Printf("[CONFIG]   %s → %s", name, slug)
+	}
+	fmt.Println()
+
+	if flagLangEN != "" {
+		runStatus.Phase("traducciones")
+		english = loadEnglish(client)
+	}
+	return run(categories, previous, flagWorkers, flagDelay, outputPath)
+}
+
+// runAllProducts scrapes the store-wide listing (-mode all-products) as a
+// single task, each product in the root category of its own categories:
+// no category discovery, and products in no root category are listed too.
+func runAllProducts(client *http.Client, outputPath string) error {
+	categoryRoots = loadRoots(client)
+	if err := storeBlock.Err(); err != nil {
+		return err
+	}
+	runStatus.Categories(1)
+	log.Printf("[CONFIG] Modo: %s (listado completo de la tienda)", modeAllProducts)
+	fmt.Println()
+
+	if flagLangEN != "" {
+		runStatus.Phase("traducciones")
+		english = loadEnglish(client)
+	}
+	return run(map[string]string{allListing: ""}, nil, flagWorkers, flagDelay, outputPath)
+}
+
+// categoryFilter is the category selection of -categories,
+// -exclude-categories, -only-category-slug and -start-at-category.
+func categoryFilter() categorias.Filtro {
+	return categorias.ParseFiltro(flagCategories, flagExcludeCats).SoloSlug(flagOnlyCatSlug).Desde(flagStartAtCat)
+}
+
+// selectCategories applies categoryFilter to cats. A filtered run keeps the
+// products of the other categories from the previous output, which it also
+// returns; an unfiltered run returns none.
+func selectCategories(cats map[string]string, outputPath string) (map[string]string, []Product, error) {
+	filter := categoryFilter()
+	if !filter.Activo() {
+		return cats, nil, nil
+	}
+	selected, unknown := filter.Aplicar(cats)
+	for _, name := range unknown {
+		log.Printf("[WARN]   Ninguna categoría coincide con %q", name)
+	}
+	if len(selected) == 0 {
+		return nil, nil, fmt.Errorf("ninguna categoría pasa los filtros de categorías")
+	}
+	log.Printf("[CATS]   %d de %d categorías seleccionadas", len(selected), len(cats))
+	previous, err := producto.ReadJSON(outputPath)
+	if err != nil {
+		log.Printf("[WARN]   Sin salida anterior: la salida tendrá solo las categorías seleccionadas")
+	}
+	return selected, previous, nil
+}
+
+// savePartial writes the products gathered by a run that failed with err to
+// the partial output, so hours of scraping are not lost, puts back the
+// output the incremental writes replaced, so a failed run publishes
+// nothing, and returns err.
+func savePartial(products []Product, outputPath string, err error) error {
+	if previousRaw != nil {
+		if werr := os.WriteFile(outputPath, previousRaw, 0644); werr != nil {
+			log.Printf("[WARN]   No se pudo restaurar la salida anterior: %v", werr)
+		} else {
+			log.Printf("[WRITE]  Salida anterior restaurada: %s", outputPath)
+		}
+	}
+	if len(products) == 0 {
+		return err
+	}
+	fpath := producto.PartialPath(outputPath)
+	if werr := writeJSON(products, fpath); werr != nil {
+		log.Printf("[WARN]   No se pudo escribir la salida parcial: %v", werr)
+		return err
+	}
+	log.Printf("[PARCIAL] %d productos escritos en %s", len(products), fpath)
+	return err
+}
+
+// writeJSON writes the product list, with the fields of outputFields named
+// as in outputSchema, to a JSON file with 4-space indentation.
+func writeJSON(products []Product, fpath string) (err error) {
+	span := tracer.Start(nil, "write json", "file.path", fpath, "catalogo.productos", len(products))
+	defer func() { span.End(err) }()
+
+	data, err := outputFields.Marshal(products, outputSchema)
 	if err != nil {
 		return fmt.Errorf("error serializando JSON: %w", err)
 	}
+	span.SetAttr("file.size", len(data))
 
 	if err := os.WriteFile(fpath, data, 0644); err != nil {
 		return fmt.Errorf("error escribiendo archivo: %w", err)
@@ -456,13 +1761,466 @@ func writeJSON(products []Product, fpath string) error {
 	return nil
 }
 
+// reportChanges tells whether the output differs from the previous run's. It
+// also passes the answer to GitHub Actions as the step outputs "cambios" and
+// "hash", so the workflow only commits a catalog that changed.
+func reportChanges(output string) bool {
+	hash := ""
+	if current, err := producto.ReadJSON(output); err == nil {
+		hash = producto.Hash(current)
+	}
+	changed := hash == "" || hash != previousHash
+	if !changed {
+		log.Printf("[FIN]    Sin cambios respecto a la corrida anterior (hash %.12s)", hash)
+	}
+	if fpath := os.Getenv("GITHUB_OUTPUT"); fpath != "" {
+		f, err := os.OpenFile(fpath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err == nil {
+			fmt.Fprintf(f, "cambios=%t\nhash=%s\n", changed, hash)
+			f.Close()
+		}
+	}
+	return changed
+}
+
+// writeChangelog compares the freshly written output against the previous run
+// and writes CAMBIOS-<fecha>.md into the -cambios-dir directory.
+func writeChangelog(previous []Product, output string) error {
+	current, err := producto.ReadJSON(output)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	fpath := producto.ChangelogPath(flagCambios, now)
+	if err := producto.WriteChangelog(producto.Compare(previous, current), fpath, "BuyTiti", now, runID); err != nil {
+		return err
+	}
+	log.Printf("[WRITE]  Changelog escrito: %s", fpath)
+	return nil
+}
+
+// writeHistory appends the run's row to -runs-history. Sample and
+// -changed-since runs, whose output is not the catalog, add none.
+func writeHistory(previous []Product, output string, elapsed time.Duration, runErr error) {
+	if flagSample > 0 || changedSince != nil {
+		return
+	}
+	fpath := flagHistory
+	if fpath == "" {
+		fpath = historial.Ruta(output)
+	}
+	c := historial.Corrida{Fecha: now(), Tienda: "buytiti", ID: runID, Modo: runMode(), Errores: warnBudget.Errores(), Duracion: elapsed, Err: runErr}
+	if runErr == nil {
+		current, err := producto.ReadJSON(output)
+		if err != nil {
+			log.Printf("[ERROR]  Error escribiendo historial: %v", err)
+			return
+		}
+		c.Resumir(previous, current)
+	}
+	if err := historial.Agregar(fpath, c); err != nil {
+		log.Printf("[ERROR]  Error escribiendo historial: %v", err)
+	}
+}
+
+// writeFacets writes facets.json for the output when the catalog changed or
+// the file does not exist yet.
+func writeFacets(output string, changed bool) error {
+	fpath := flagFacets
+	if fpath == "" {
+		fpath = producto.FacetsPath(output)
+	}
+	if _, err := os.Stat(fpath); err == nil && !changed {
+		return nil
+	}
+	products, err := producto.ReadJSON(output)
+	if err != nil {
+		return err
+	}
+	if err := producto.WriteFacets(products, fpath, time.Now()); err != nil {
+		return err
+	}
+	log.Printf("[WRITE]  Facetas escritas: %s", fpath)
+	return nil
+}
+
+// writeSimilares writes similares.json for the output when the catalog
+// changed or the file does not exist yet.
+func writeSimilares(output string, changed bool) error {
+	if flagSimilaresN <= 0 {
+		return nil
+	}
+	fpath := flagSimilares
+	if fpath == "" {
+		fpath = match.SimilaresPath(output)
+	}
+	if _, err := os.Stat(fpath); err == nil && !changed {
+		return nil
+	}
+	products, err := producto.ReadJSON(output)
+	if err != nil {
+		return err
+	}
+	if err := match.WriteSimilares(products, flagSimilaresN, fpath, time.Now()); err != nil {
+		return err
+	}
+	log.Printf("[WRITE]  Similares escritos: %s", fpath)
+	return nil
+}
+
+// publishMetrics records the per-category product counts of the output and
+// writes or pushes the run's metrics, if configured.
+func publishMetrics(output string, ok bool, elapsed time.Duration) {
+	if flagMetricsFile == "" && flagPushgateway == "" {
+		return
+	}
+	if products, err := producto.ReadJSON(output); err == nil {
+		counts := make(map[string]int)
+		for _, p := range products {
+			counts[p.Categoria]++
+		}
+		for cat, n := range counts {
+			scrapeMetrics.Products.Set(float64(n), cat)
+		}
+	}
+	scrapeMetrics.RunInfo.Set(1, runID)
+	if err := scrapeMetrics.Publish(flagMetricsFile, flagPushgateway, "catalogo-buytiti", ok, elapsed); err != nil {
+		log.Printf("[ERROR]  %v", err)
+	}
+}
+
+// runMode names the kind of run selected by the flags.
+func runMode() string {
+	switch {
+	case flagWatch != "":
+		return "watch"
+	case flagQuick:
+		return "quick"
+	}
+	return "full"
+}
+
+// shutdownTracer exports the spans still buffered, if tracing is enabled.
+func shutdownTracer() {
+	if err := tracer.Shutdown(); err != nil {
+		log.Printf("[ERROR]  %v", err)
+	}
+}
+
+// openSpill starts checkpointing collected products for a full run and
+// returns the ones recovered from an interrupted run, if any.
+// openQueue opens the disk queue when -disk-queue is set; it returns nil
+// otherwise.
+func openQueue(outputPath string) (*diskq.Queue[queuedTask], error) {
+	if !flagDiskQueue {
+		return nil, nil
+	}
+	fpath := flagQueueFile
+	if fpath == "" {
+		fpath = diskq.DefaultPath(outputPath)
+	}
+	q, err := diskq.Open[queuedTask](fpath)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[QUEUE]  Cola en disco: %s", fpath)
+	return q, nil
+}
+
+func openSpill(outputPath string) (*spill.Spill, []Product, error) {
+	if flagSpillInterval <= 0 {
+		return nil, nil, nil
+	}
+	fpath := flagSpillFile
+	if fpath == "" {
+		fpath = spill.DefaultPath(outputPath)
+	}
+	sp, recovered, err := spill.Open(fpath, flagSpillInterval)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(recovered) > 0 {
+		log.Printf("[SPILL]  %d productos recuperados de una corrida interrumpida (%s)", len(recovered), fpath)
+	}
+	return sp, recovered, nil
+}
+
+// setupLogging applies -quiet to the console and tees the full log into
+// -log-file when set, masking the secrets in both.
+func setupLogging() error {
+	var console io.Writer = os.Stderr
+	if flagQuiet {
+		console = logfile.Only(os.Stderr, "[RESUMEN]", "[FIN]", "[FATAL]", "[TLS]")
+	}
+	if flagLogFile == "" {
+		log.SetOutput(secretos.Filtrar(console))
+		return nil
+	}
+	f, err := logfile.Open(flagLogFile, int64(flagLogMaxMB)<<20, flagLogBackups)
+	if err != nil {
+		return err
+	}
+	// The file spans many runs, so its lines carry the date too
+	log.SetFlags(log.Ldate | log.Ltime | log.Lmsgprefix)
+	log.SetOutput(secretos.Filtrar(io.MultiWriter(console, f)))
+	return nil
+}
+
+// tagRules derive each product's EtiquetasDerivadas, from the -config file.
+var tagRules etiquetas.Reglas
+
+// converter adds the -convert-to prices; nil without the flag.
+var converter *divisas.Conversor
+
+// storeIVA says whether the store's prices include IVA, from the -config
+// file.
+var storeIVA impuestos.IVA
+
+// shipping is the store's free-shipping threshold and rates, from the
+// -config file.
+var shipping envio.Regla
+
+// displayPrice is the store's rounding policy for precioPublico, from the
+// -config file.
+var displayPrice redondeo.Politica
+
+// storeHooks is the store's transform hook, from the -config file.
+var storeHooks hooks.Hooks
+
+// imageRules rewrite the image URLs of the output, from the -config file.
+var imageRules imagenes.Reglas
+
+// storeZone is the store's time zone, from the -config file, for the
+// output's timestamps; previousOutput is the output found at start, whose
+// products keep their UltimaActualizacion when unchanged.
+var (
+	storeZone      *time.Location
+	previousOutput []Product
+)
+
+// now is the current time in the store's zone, to the second.
+func now() time.Time {
+	return time.Now().In(storeZone).Truncate(time.Second)
+}
+
+// writeMeta writes the output's productos.meta.json after it was written,
+// and signs it.
+func writeMeta(products []Product, outputPath string) {
+	m := producto.Meta{Tienda: "buytiti", GeneradoEn: now(), Productos: len(products)}
+	if err := producto.WriteMeta(outputPath, m); err != nil {
+		log.Printf("[WARN]   No se pudo escribir %s: %v", producto.MetaPath(outputPath), err)
+	}
+	signOutput(outputPath)
+}
+
+// signKey is the -sign key; nil leaves the output unsigned.
+var signKey ed25519.PrivateKey
+
+// signOutput writes the output's signature with -sign. One that cannot be
+// written is removed rather than left stale, so the site rejects the
+// output instead of trusting an old signature.
+func signOutput(outputPath string) {
+	if signKey == nil {
+		return
+	}
+	if err := firma.Firmar(signKey, outputPath); err != nil {
+		log.Printf("[WARN]   No se pudo firmar la salida: %v", err)
+		os.Remove(firma.Ruta(outputPath))
+	}
+}
+
+// changedSince is the -changed-since snapshot; when set, the output holds
+// only what changed since it.
+var changedSince []Product
+
+// prepareOutput applies the derived tags, the prices with and without IVA,
+// the shipping estimate, the display price, the transform hook,
+// -price-cents, -convert-to, the time of each product's last change and
+// -changed-since to the products about to be written as the output.
+func prepareOutput(products []Product) []Product {
+	tagRules.Aplicar(products)
+	storeIVA.Aplicar(products)
+	shipping.Aplicar(products)
+	displayPrice.Aplicar(products)
+	if transformed, err := storeHooks.Transformar(context.Background(), products); err != nil {
+		log.Printf("[WARN]   %v; se escriben los productos sin transformar", err)
+	} else {
+		products = transformed
+	}
+	imageRules.Aplicar(products)
+	divisas.Centavos(products, flagPriceCents)
+	producto.Sellar(products, previousOutput, outputFields, now())
+	if err := converter.Aplicar(context.Background(), products); err != nil {
+		log.Printf("[WARN]   -convert-to: %v", err)
+	}
+	if changedSince == nil {
+		return products
+	}
+	delta := producto.Cambiados(changedSince, outputFields.Recortar(products))
+	log.Printf("[DELTA]  %d de %d productos nuevos o cambiados desde %s", len(delta), len(products), flagSnapshot)
+	return delta
+}
+
+// outputFields are the product fields -fields keeps in the output; nil is
+// all of them.
+var outputFields producto.Campos
+
+// outputSchema names the output's fields (-schema); nil is the Spanish
+// schema.
+var outputSchema producto.Esquema
+
+// outputOrder is the order of the output's products (-sort).
+var outputOrder producto.Orden
+
+// sampleOutput is where a -sample run writes when -output is not given:
+// productos.sample.json next to the real output, which a smoke test must not
+// replace.
+func sampleOutput(output string) string {
+	explicit := false
+	flag.Visit(func(f *flag.Flag) { explicit = explicit || f.Name == "output" })
+	if flagSample <= 0 || explicit {
+		return output
+	}
+	return strings.TrimSuffix(output, ".json") + ".sample.json"
+}
+
+// politeness are the -politeness presets for BuyTiti's Store API, whose
+// JSON pages are light: even "aggressive" stays well under what a browser
+// loading the shop requests.
+var politeness = cortesia.Presets{
+	"gentle":     {"workers": "1", "delay": "2s", "backoff": "10s", "max-bandwidth": "512KB/s"},
+	"normal":     {"workers": "3", "delay": "500ms", "backoff": "2s", "max-bandwidth": ""},
+	"aggressive": {"workers": "10", "delay": "100ms", "backoff": "1s", "max-bandwidth": ""},
+}
+
 func main() {
 	flag.Parse()
+	if err := politeness.Aplicar(flag.CommandLine, flagPoliteness); err != nil {
+		log.Fatalf("[FATAL]  -politeness: %v", err)
+	}
+	rate, err := budget.ParseRate(flagMaxErrorRate)
+	if err != nil {
+		log.Fatalf("[FATAL]  -max-error-rate: %v", err)
+	}
+	warnBudget.MaxWarnings, warnBudget.MaxErrorRate = flagMaxWarnings, rate
+	if linkSample, err = enlaces.ParseMuestra(flagCheckLinks); err != nil {
+		log.Fatalf("[FATAL]  -check-links: %v", err)
+	}
+	if countTolerance, err = budget.ParseRate(flagCountTol); err != nil {
+		log.Fatalf("[FATAL]  -count-tolerance: %v", err)
+	}
+	switch flagMode {
+	case modeCategories:
+	case modeAllProducts:
+		if categoryFilter().Activo() {
+			log.Fatalf("[FATAL]  -mode %s recorre toda la tienda: no admite -categories, -exclude-categories, -only-category-slug ni -start-at-category", modeAllProducts)
+		}
+	default:
+		log.Fatalf("[FATAL]  -mode %q desconocido (categories o all-products)", flagMode)
+	}
+	productFilter, err = producto.NewFiltro(flagMatchName, flagMinPrice, flagMaxPrice, flagOnlyOnSale)
+	if err != nil {
+		log.Fatalf("[FATAL]  %v", err)
+	}
+	productFilter.SoloDisponibles = flagInStock && !flagOutOfStock
+	if outputFields, err = producto.ParseCampos(flagFields); err != nil {
+		log.Fatalf("[FATAL]  -fields: %v", err)
+	}
+	if outputSchema, err = producto.ParseEsquema(flagSchema); err != nil {
+		log.Fatalf("[FATAL]  -schema: %v", err)
+	}
+	if outputOrder, err = producto.ParseOrden(flagSort); err != nil {
+		log.Fatalf("[FATAL]  -sort: %v", err)
+	}
+	if flagSnapshot != "" {
+		if changedSince, err = producto.ReadJSON(flagSnapshot); err != nil {
+			log.Fatalf("[FATAL]  -changed-since: %v", err)
+		}
+	}
+	if tagRules, err = etiquetas.Leer(flagConfig); err != nil {
+		log.Fatalf("[FATAL]  %v", err)
+	}
+	if storeZone, err = tienda.LeerZona(flagConfig, "buytiti"); err != nil {
+		log.Fatalf("[FATAL]  %v", err)
+	}
+	if storeIVA, err = impuestos.Leer(flagConfig, "buytiti"); err != nil {
+		log.Fatalf("[FATAL]  %v", err)
+	}
+	if shipping, err = envio.Leer(flagConfig, "buytiti"); err != nil {
+		log.Fatalf("[FATAL]  %v", err)
+	}
+	if displayPrice, err = redondeo.Leer(flagConfig, "buytiti"); err != nil {
+		log.Fatalf("[FATAL]  %v", err)
+	}
+	if storeHooks, err = hooks.Leer(flagConfig, "buytiti"); err != nil {
+		log.Fatalf("[FATAL]  %v", err)
+	}
+	if imageRules, err = imagenes.Leer(flagConfig, "buytiti"); err != nil {
+		log.Fatalf("[FATAL]  %v", err)
+	}
+	if flagSign != "" {
+		if signKey, err = firma.LeerPrivada(flagSign); err != nil {
+			log.Fatalf("[FATAL]  -sign: %v", err)
+		}
+	}
+	tlsTransport, err := transporte.TLS(flagCACert, flagInsecure)
+	if err != nil {
+		log.Fatalf("[FATAL]  -ca-cert: %v", err)
+	}
+	bandwidth, err := transporte.ParseAnchoBanda(flagBandwidth)
+	if err != nil {
+		log.Fatalf("[FATAL]  -max-bandwidth: %v", err)
+	}
+	limiter := transporte.NewLimitador(bandwidth)
+	domains, err := transporte.LeerDominios(flagConfig, "buytiti", siteDomain)
+	if err != nil {
+		log.Fatalf("[FATAL]  %v", err)
+	}
+	// A link or redirect on a scraped page must not send the scraper to an
+	// arbitrary host
+	guarded := transporte.Restringir(tlsTransport, domains, func(req *http.Request) {
+		log.Printf("[DOMINIO] Rechazada la petición a %s: fuera de %s", req.URL, strings.Join(domains, ", "))
+	})
+	httpTransport = transporte.Limitar(guarded, limiter)
+	if flagFixtures != "" {
+		if recorder, err = fixtures.Grabar(httpTransport, flagFixtures, flagFixturesN); err != nil {
+			log.Fatalf("[FATAL]  -record-fixtures: %v", err)
+		}
+		httpTransport = recorder
+	}
+	if flagConvertTo != "" {
+		fxTransport := transporte.Limitar(tlsTransport, limiter)
+		fx, err := divisas.ParseFuente(flagFXSource, &http.Client{Timeout: 30 * time.Second, Transport: fxTransport})
+		if err != nil {
+			log.Fatalf("[FATAL]  -fx-source: %v", err)
+		}
+		if converter, err = divisas.NewConversor(context.Background(), flagConvertTo, fx); err != nil {
+			log.Fatalf("[FATAL]  -convert-to: %v", err)
+		}
+		log.Printf("[FX]     1 %s = %.4f %s (%s)", converter.Moneda, converter.TipoCambio, divisas.Base, converter.Fuente)
+	}
+	if variantMode, err = producto.ModoVariantes(flagExpandVars, flagParentsOnly); err != nil {
+		log.Fatalf("[FATAL]  %v", err)
+	}
+	if flagBlocklist != "" {
+		if blocklist, err = producto.LeerBloqueo(flagBlocklist); err != nil {
+			log.Fatalf("[FATAL]  %v", err)
+		}
+	}
+	listingFilter = storeAPIFilter(productFilter)
 
-	log.SetFlags(log.Ltime)
+	runID = flagRunID
+	if runID == "" {
+		runID = runid.FromEnv()
+	}
+	log.SetFlags(log.Ltime | log.Lmsgprefix)
+	log.SetPrefix(runid.Short(runID) + " ")
+	if err := setupLogging(); err != nil {
+		log.Fatalf("[FATAL]  %v", err)
+	}
 
 	// Resolve output path relative to the working directory
-	output := flagOutput
+	output := filepath.FromSlash(flagOutput)
 	if !filepath.IsAbs(output) {
 		execDir, err := os.Getwd()
 		if err != nil {
@@ -470,33 +2228,119 @@ func main() {
 		}
 		output = filepath.Join(execDir, output)
 	}
+	output = sampleOutput(output)
 
+	log.Printf("[CONFIG] Corrida: %s", runID)
 	log.Printf("[CONFIG] Output:  %s", output)
 	log.Printf("[CONFIG] Workers: %d", flagWorkers)
 	log.Printf("[CONFIG] Delay:   %v", flagDelay)
+	log.Printf("[CONFIG] Preset:  %s", flagPoliteness)
+	if flagCACert != "" {
+		log.Printf("[CONFIG] CA:      %s", flagCACert)
+	}
+	if flagBandwidth != "" {
+		log.Printf("[CONFIG] Límite:  %s", flagBandwidth)
+	}
+	if flagInsecure {
+		log.Printf("[TLS]    ¡ATENCIÓN! -insecure-skip-verify: los certificados TLS NO se verifican; cualquiera en la red puede suplantar al sitio y alterar los precios. Úsalo solo para pruebas")
+	}
 
-	// Fetch categories dynamically from the API
-	client := &http.Client{Timeout: 30 * time.Second}
-	categories, err := fetchCategories(client)
-	if err != nil {
-		log.Fatalf("[FATAL]  Error obteniendo categorías: %v", err)
+	// -dump-categories only discovers the categories, without the output's
+	// lock: it neither reads nor writes the catalog
+	if flagDumpCats != "" {
+		if err := dumpCategories(auditLog.Client(httpTransport, 30*time.Second), flagDumpCats); err != nil {
+			log.Fatalf("[FATAL]  %v", err)
+		}
+		return
 	}
-	if len(categories) == 0 {
-		log.Fatalf("[FATAL]  No se encontraron categorías")
+
+	// Spread scheduled runs over a window instead of hitting the site at the exact cron minute
+	if flagJitter > 0 {
+		wait := rand.N(flagJitter)
+		log.Printf("[JITTER] Esperando %v antes de empezar", wait.Round(time.Second))
+		time.Sleep(wait)
 	}
 
-	log.Printf("[CONFIG] Categorías: %d", len(categories))
-	for name, slug := range categories {
-		log.Printf("[CONFIG]   %s → %s", name, slug)
+	// Refuse to start if another run (e.g. an overlapping cron) writes the same output
+	lock, err := lockfile.Acquire(output + ".lock")
+	if errors.Is(err, lockfile.ErrLocked) {
+		log.Fatalf("[FATAL]  Ya hay otra corrida escribiendo %s: %v", output, err)
+	} else if err != nil {
+		log.Fatalf("[FATAL]  %v", err)
 	}
-	fmt.Println()
+	defer lock.Release()
 
+	if flagAuditLog != "" {
+		if auditLog, err = audit.Open(flagAuditLog, runID); err != nil {
+			log.Fatalf("[FATAL]  %v", err)
+		}
+		defer auditLog.Close()
+		log.Printf("[CONFIG] Audit log: %s", flagAuditLog)
+	}
+	runStatus = status.Start(flagStatusFile, "buytiti", runID, flagStatusInterval)
+
+	// Snapshot of the previous output, compared against at the end of the run
+	previous, prevErr := producto.ReadJSON(output)
+	if prevErr == nil {
+		previousOutput = previous
+		previousHash = producto.Hash(previous)
+	} else if flagCambios != "" {
+		log.Printf("[WARN]   Sin salida anterior para el changelog: %v", prevErr)
+	}
+	previousRaw, _ = os.ReadFile(output)
+
+	client := auditLog.Client(httpTransport, 30*time.Second)
+	tracer = tracing.New(flagOTLP, "catalogo-buytiti")
+	runSpan := tracer.StartRun("scrape", "catalogo.run_id", runID, "catalogo.modo", runMode(), "catalogo.workers", flagWorkers)
+	watch = watchdog.New(flagStuckTimeout, func(worker int, label string, running time.Duration) {
+		stuck.Add(1)
+		log.Printf("[STUCK]  W%d lleva %v en %s; cancelando la tarea", worker, running.Round(time.Second), label)
+	})
 	start := time.Now()
-	if err := run(categories, flagWorkers, flagDelay, output); err != nil {
+	switch {
+	case flagWatch != "":
+		err = runWatch(client, flagWatch, output)
+	case flagQuick:
+		err = runQuick(client, output)
+	default:
+		err = runFull(client, output)
+	}
+	watch.Stop()
+	runSpan.End(err)
+	shutdownTracer()
+	runStatus.Finish(err)
+	if err != nil {
+		publishMetrics(output, false, time.Since(start))
+		writeHistory(previous, output, time.Since(start), err)
 		log.Fatalf("[FATAL]  %v", err)
 	}
 	elapsed := time.Since(start)
+	publishMetrics(output, true, elapsed)
+	writeHistory(previous, output, elapsed, nil)
+
+	changed := reportChanges(output)
+	// facets.json and similares.json sit next to the real output
+	if flagSample > 0 {
+		log.Printf("[SAMPLE] Muestra: sin changelog, facets ni similares")
+	} else if changedSince != nil {
+		log.Printf("[DELTA]  Salida con solo los cambios: sin changelog, facets ni similares")
+	} else {
+		if changed && flagCambios != "" && previous != nil {
+			if err := writeChangelog(previous, output); err != nil {
+				log.Printf("[ERROR]  Error escribiendo changelog: %v", err)
+			}
+		}
+		if err := writeFacets(output, changed); err != nil {
+			log.Printf("[ERROR]  Error escribiendo facets: %v", err)
+		}
+		if err := writeSimilares(output, changed); err != nil {
+			log.Printf("[ERROR]  Error escribiendo similares: %v", err)
+		}
+	}
 
+	if recorder != nil {
+		log.Printf("[FIN]    %d fixtures grabados en %s", recorder.Grabados(), flagFixtures)
+	}
 	log.Printf("[FIN]    Escrito en: %s", output)
 	log.Printf("[FIN]    Tiempo total: %v", elapsed.Round(time.Millisecond))
 }
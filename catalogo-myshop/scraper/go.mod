@@ -1,3 +1,7 @@
 module myshop-scraper
 
 go 1.24.5
+
+require catalogo v0.0.0
+
+replace catalogo => ../../catalogo
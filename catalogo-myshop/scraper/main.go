@@ -1,99 +1,354 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"html"
 	"io"
 	"log"
 	"math"
+	"math/rand/v2"
 	"net/http"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
-	"runtime"
-	"sort"
+	"runtime/debug"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"catalogo/audit"
+	"catalogo/budget"
+	"catalogo/canonurl"
+	"catalogo/categorias"
+	"catalogo/cortesia"
+	"catalogo/desafio"
+	"catalogo/diskq"
+	"catalogo/divisas"
+	"catalogo/enlaces"
+	"catalogo/envio"
+	"catalogo/etiquetas"
+	"catalogo/extraer"
+	"catalogo/firma"
+	"catalogo/fixtures"
+	"catalogo/historial"
+	"catalogo/hooks"
+	"catalogo/imagenes"
+	"catalogo/impuestos"
+	"catalogo/lockfile"
+	"catalogo/logfile"
+	"catalogo/match"
+	"catalogo/metrics"
+	"catalogo/producto"
+	"catalogo/redondeo"
+	"catalogo/runid"
+	"catalogo/secretos"
+	"catalogo/spill"
+	"catalogo/status"
+	"catalogo/texto"
+	"catalogo/tienda"
+	"catalogo/timing"
+	"catalogo/tracing"
+	"catalogo/transporte"
+	"catalogo/watchdog"
 )
 
 const (
+	siteDomain = "my-shop.mx"
 	baseURL    = "https://www.my-shop.mx"
 	shopURL    = baseURL + "/shop"
 	maxRetries = 3
 )
 
-type Product struct {
-	Nombre         string   `json:"nombre"`
-	Precio         float64  `json:"precio"`
-	PrecioOriginal float64  `json:"precioOriginal"`
-	EnOferta       bool     `json:"enOferta"`
-	Stock          string   `json:"stock"`
-	Imagen         string   `json:"imagen"`
-	Imagen64       string   `json:"imagen64"`
-	Link           string   `json:"link"`
-	Categoria      string   `json:"categoria"`
-	Subcategorias  []string `json:"subcategorias"`
-}
+type Product = producto.Product
+
+// scrapeMetrics collects request and parsing counters for -metrics-file and -pushgateway.
+var scrapeMetrics = metrics.NewScrape("myshop")
+
+// tracer exports the run's spans when -otlp-endpoint is set; nil otherwise.
+var tracer *tracing.Tracer
+
+// auditLog records every request when -audit-log is set; nil otherwise.
+var auditLog *audit.Log
+
+// recorder saves the first responses as test fixtures when
+// -record-fixtures is set; nil otherwise.
+var recorder *fixtures.Grabadora
+
+// httpTransport is the transport of every request to the store, with the
+// TLS settings of -ca-cert and -insecure-skip-verify and the -max-bandwidth
+// limit, refusing hosts outside the store's domains.
+var httpTransport http.RoundTripper
+
+// runStatus keeps -status-file up to date; nil when it is not set.
+var runStatus *status.Reporter
+
+// warnBudget fails the run when -max-warnings or -max-error-rate is exceeded.
+var warnBudget = &budget.Budget{}
+
+// previousHash fingerprints the output left by the previous run; a full run
+// that finds the same products leaves the output untouched.
+var previousHash string
+
+// runID identifies this run in logs, metrics and reports; taskSeq numbers
+// its tasks.
+var (
+	runID   string
+	taskSeq runid.Seq
+)
 
 type productEntry struct {
+	id       string
 	url      string
 	imagen64 string
 	category string
+	// categories are all the categories whose listing showed the product
+	categories []string
+	// listed is the product as its listing card shows it, with -shallow
+	listed   *Product
+	requeued bool
+	qid      int64 // position in the disk queue, for done
+}
+
+// entryList collects product entries from several workers.
+type entryList struct {
+	mu      sync.Mutex
+	entries []productEntry
+}
+
+func (l *entryList) add(e productEntry) {
+	l.mu.Lock()
+	l.entries = append(l.entries, e)
+	l.mu.Unlock()
+}
+
+// failedListing is a category whose listing stopped at a failed page.
+type failedListing struct {
+	name, url string
+	page      int
 }
 
 var (
-	flagOutput  string
-	flagDelay   time.Duration
-	flagWorkers int
-	flagVerbose bool
+	flagOutput     string
+	flagDelay      time.Duration
+	flagBackoff    time.Duration
+	flagPoliteness string
+	flagWorkers    int
+	flagListWork   int
+	flagDetailWork int
+	flagVerbose    bool
+	flagWhatsApp   string
+	flagCambios    string
+	flagJitter     time.Duration
+	flagWatch      string
+	flagQuick      bool
+
+	flagCatCache    string
+	flagDumpCats    string
+	flagFacets      string
+	flagSimilares   string
+	flagHistory     string
+	flagSign        string
+	flagLangEN      string
+	flagCategories  string
+	flagExcludeCats string
+	flagOnlyCatSlug string
+	flagStartAtCat  string
+	flagSample      int
+	flagShallow     bool
+	flagPPG         int
+	flagFields      string
+	flagSort        string
+	flagBlocklist   string
+	flagConfig      string
+	flagSnapshot    string
+	flagConvertTo   string
+	flagFXSource    string
+	flagPriceCents  bool
+	flagSchema      string
+	flagPriceLocale string
+	flagExpandVars  bool
+	flagParentsOnly bool
+	flagMatchName   string
+	flagMinPrice    float64
+	flagMaxPrice    float64
+	flagOnlyOnSale  bool
+	flagInStock     bool
+	flagOutOfStock  bool
+	flagSimilaresN  int
+	flagCatTTL      time.Duration
+	flagRefreshCats bool
+
+	flagMetricsFile string
+	flagPushgateway string
+	flagOTLP        string
+	flagAuditLog    string
+	flagCACert      string
+	flagInsecure    bool
+	flagBandwidth   string
+	flagFixtures    string
+	flagFixturesN   int
+
+	flagQuiet      bool
+	flagLogFile    string
+	flagLogMaxMB   int
+	flagLogBackups int
+
+	flagStatusFile     string
+	flagStatusInterval time.Duration
+
+	flagMaxWarnings  int
+	flagMaxErrorRate string
+	flagCheckLinks   string
+	flagRunID        string
+
+	flagSpillFile     string
+	flagSpillInterval time.Duration
+
+	flagFinalRetryWorkers  int
+	flagFinalRetryCooldown time.Duration
+
+	flagDiskQueue bool
+	flagQueueFile string
+
+	flagStuckTimeout time.Duration
+
+	flagResolveRedirects bool
 
 	// Regex patterns for HTML parsing
 	reProductHref = regexp.MustCompile(`href="(/shop/[^"?]+\-(\d+))(?:\?[^"]*)?"\s*`)
 	reCatHref     = regexp.MustCompile(`href="(/shop/category/([^"]+))"`)
+	rePagePath    = regexp.MustCompile(`/page/\d+/?$`)
 	reImgSrc      = regexp.MustCompile(`src="(/web/image/product[^"]*)"`)
 	reH1          = regexp.MustCompile(`<h1[^>]*>(.*?)</h1>`)
-	rePrice       = regexp.MustCompile(`\$\s*([\d,]+\.?\d*)`)
-	reHiddenPrice = regexp.MustCompile(`itemprop="price"[^>]*>\s*([\d.]+)\s*<`)
-	reListPrice   = regexp.MustCompile(`oe_default_price[^>]*>.*?oe_currency_value">([\d,.]+)<`)
-	reBreadcrumb  = regexp.MustCompile(`<li[^>]*class="breadcrumb-item[^"]*"[^>]*>(?:<a[^>]*>)?([^<]+)`)
 	reItempName   = regexp.MustCompile(`itemprop="name"[^>]*>([^<]+)<`)
+	reCardTitle   = regexp.MustCompile(`<a\b[^>]*href="/shop/[^"]*"[^>]*>\s*([^<\s][^<]*)</a>`)
 	reAddToCart   = regexp.MustCompile(`id="add_to_cart"`)
 	reCombNoExist = regexp.MustCompile(`Esta combinación no existe`)
 )
 
 func init() {
-	_, srcFile, _, _ := runtime.Caller(0)
-	defaultOutput := filepath.Join(filepath.Dir(srcFile), "..", "productos.json")
+	defaultOutput, defaultConfig := tienda.Rutas("catalogo-myshop")
 	flag.StringVar(&flagOutput, "output", defaultOutput, "Ruta del archivo JSON de salida")
+	flag.StringVar(&flagConvertTo, "convert-to", "", "Agregar los precios convertidos a esta moneda (código ISO 4217, como USD)")
+	flag.StringVar(&flagFXSource, "fx-source", "banxico", "Fuente del tipo de cambio de -convert-to: banxico, openexchange o fixed:<pesos por unidad>")
+	flag.StringVar(&flagPriceLocale, "price-locale", "es-MX", "Formato de los precios que muestra la tienda: es-MX (1,234.56), es-ES (1.234,56), ...")
+	flag.StringVar(&flagSchema, "schema", "es", "Nombres de los campos de la salida: es (el esquema de los sitios) o en (en inglés, para otras herramientas)")
+	flag.BoolVar(&flagPriceCents, "price-cents", false, "Agregar precioCentavos y precioOriginalCentavos, los precios como enteros en centavos")
+	flag.StringVar(&flagSnapshot, "changed-since", "", "Escribir en la salida solo los productos nuevos o cambiados respecto a este productos.json anterior")
+	flag.StringVar(&flagConfig, "config", defaultConfig, "Configuración con las reglas de etiquetas derivadas (sección etiquetas) y si los precios de la tienda incluyen IVA")
 	flag.DurationVar(&flagDelay, "delay", 500*time.Millisecond, "Delay entre requests")
-	flag.IntVar(&flagWorkers, "workers", 3, "Número de goroutines workers")
+	flag.DurationVar(&flagBackoff, "backoff", 2*time.Second, "Espera antes del primer reintento; se duplica en cada intento y se triplica tras cada 429")
+	flag.StringVar(&flagPoliteness, "politeness", cortesia.Predeterminado, "Preset de workers, delay, backoff y ancho de banda: gentle (seguro para tiendas nuevas), normal o aggressive; los flags explícitos ganan")
+	flag.IntVar(&flagWorkers, "workers", 3, "Número de goroutines workers (las de detalle si no se pasa -detail-workers)")
+	flag.IntVar(&flagListWork, "list-workers", 1, "Categorías que se listan a la vez (pocas páginas pero pesadas)")
+	flag.IntVar(&flagDetailWork, "detail-workers", 0, "Workers que scrapean las páginas de producto (muchas y ligeras; 0 = -workers)")
 	flag.BoolVar(&flagVerbose, "verbose", false, "Logging detallado")
+	flag.StringVar(&flagWhatsApp, "whatsapp-csv", "", "Ruta opcional del CSV para importar en el catálogo de WhatsApp Business")
+	flag.StringVar(&flagCambios, "cambios-dir", "", "Directorio donde escribir CAMBIOS-<fecha>.md comparando contra la salida anterior")
+	flag.DurationVar(&flagJitter, "jitter", 0, "Retraso aleatorio máximo antes de empezar (ej. 15m)")
+	flag.StringVar(&flagWatch, "watch", "", "Archivo con links de productos vigilados: solo actualiza su precio y stock en la salida existente")
+	flag.BoolVar(&flagQuick, "quick", false, "Solo actualizar precio y stock de los productos de la salida existente, sin descubrir categorías")
+	flag.StringVar(&flagCatCache, "categories-cache", "", "Ruta de la caché de categorías (por defecto categorias.cache.json junto a la salida)")
+	flag.StringVar(&flagDumpCats, "dump-categories", "", "Solo escribir en este archivo el árbol completo de categorías (id, slug, nombre, padre, productos) y salir, sin scrapear productos")
+	flag.StringVar(&flagFacets, "facets", "", "Ruta de facets.json con los conteos para los filtros de la página (por defecto junto a la salida)")
+	flag.StringVar(&flagCategories, "categories", "", "Scrapear solo estas categorías, por nombre o slug separados por coma (sin distinguir acentos ni mayúsculas)")
+	flag.StringVar(&flagExcludeCats, "exclude-categories", "", "No scrapear estas categorías, por nombre o slug separados por coma")
+	flag.StringVar(&flagOnlyCatSlug, "only-category-slug", "", "Scrapear solo la categoría con este slug, conservando el resto de la salida anterior")
+	flag.StringVar(&flagStartAtCat, "start-at-category", "", "Empezar por esta categoría (nombre o slug) y seguir con las siguientes en orden alfabético, conservando las anteriores")
+	flag.BoolVar(&flagExpandVars, "expand-variants", false, "Listar cada variante (color, talla, ...) de los productos con variantes, con su precio, en vez del producto padre")
+	flag.BoolVar(&flagParentsOnly, "parents-only", false, "Listar solo el producto padre de los productos con variantes (por defecto)")
+	flag.StringVar(&flagBlocklist, "blocklist", "", "Archivo con palabras o /expresiones/ (una por línea) de nombres de productos a descartar")
+	flag.StringVar(&flagFields, "fields", "", "Escribir en la salida solo estos campos, separados por coma (ej. nombre,precio,link,imagen64; vacío = todos)")
+	flag.StringVar(&flagSort, "sort", producto.OrdenPredeterminado, "Orden de la salida: campos separados por coma, con - para descendente (ej. precio,-nombre)")
+	flag.IntVar(&flagPPG, "ppg", 0, "Productos por página del listado de categorías (parámetro ppg de Odoo); más grande son menos requests (0 = el de la tienda)")
+	flag.BoolVar(&flagShallow, "shallow", false, "Armar los productos solo con lo que muestra el listado (nombre, precio, miniatura, categoría), sin abrir cada página de producto: mucho más rápido cuando solo importan los precios")
+	flag.IntVar(&flagSample, "sample", 0, "Prueba rápida: scrapear solo los primeros N productos de cada categoría y escribir en productos.sample.json salvo que se indique -output (0 = corrida completa)")
+	flag.StringVar(&flagMatchName, "match-name", "", "Conservar solo los productos cuyo nombre coincide con esta expresión regular (sin distinguir mayúsculas)")
+	flag.Float64Var(&flagMinPrice, "min-price", 0, "Conservar solo los productos de al menos este precio (0 = sin mínimo)")
+	flag.Float64Var(&flagMaxPrice, "max-price", 0, "Conservar solo los productos de hasta este precio (0 = sin máximo)")
+	flag.BoolVar(&flagOnlyOnSale, "only-on-sale", false, "Conservar solo los productos en oferta")
+	flag.BoolVar(&flagInStock, "in-stock-only", false, "Descartar los productos agotados")
+	flag.BoolVar(&flagOutOfStock, "include-out-of-stock", false, "Conservar los agotados aunque se pase -in-stock-only (p. ej. en los args de catalogo.json)")
+	flag.StringVar(&flagSimilares, "similares", "", "Ruta de similares.json con las alternativas de cada producto (por defecto junto a la salida)")
+	flag.StringVar(&flagHistory, "runs-history", "", "Ruta de runs-history.tsv, al que cada corrida agrega una fila (por defecto junto a la salida)")
+	flag.StringVar(&flagLangEN, "lang-en", "", "Código de idioma de Odoo para el inglés (en, en_US) para agregar nombreEN y descripcionEN desde la página traducida")
+	flag.StringVar(&flagSign, "sign", "", "Clave privada Ed25519 (PEM) con la que firmar la salida en <salida>.sig")
+	flag.IntVar(&flagSimilaresN, "similares-n", 5, "Alternativas con stock por producto en similares.json (0 = no escribirlo)")
+	flag.DurationVar(&flagCatTTL, "categories-ttl", 24*time.Hour, "Vigencia de la caché de categorías (0 = no usarla)")
+	flag.BoolVar(&flagRefreshCats, "refresh-categories", false, "Ignorar la caché y volver a descubrir las categorías")
+	flag.StringVar(&flagMetricsFile, "metrics-file", "", "Archivo donde escribir las métricas Prometheus al terminar")
+	flag.StringVar(&flagPushgateway, "pushgateway", "", "URL de un Prometheus Pushgateway al que enviar las métricas al terminar")
+	flag.StringVar(&flagOTLP, "otlp-endpoint", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), "URL del colector OpenTelemetry (OTLP/HTTP) al que enviar las trazas de la corrida")
+	flag.StringVar(&flagAuditLog, "audit-log", "", "Archivo NDJSON donde registrar cada request (método, URL, status, latencia, bytes e intento)")
+	flag.StringVar(&flagCACert, "ca-cert", "", "Archivo PEM con certificados de CA a confiar además de los del sistema (proxy corporativo, staging autofirmado)")
+	flag.StringVar(&flagBandwidth, "max-bandwidth", "", "Límite de descarga de toda la corrida, compartido por todos los workers (ej. 2MB/s, 512KB/s; vacío = sin límite)")
+	flag.StringVar(&flagFixtures, "record-fixtures", "", "Directorio en el que grabar, normalizadas, las primeras respuestas del sitio como fixtures de prueba (lo usa \"catalogo fixtures record\")")
+	flag.IntVar(&flagFixturesN, "record-n", 20, "Respuestas a grabar con -record-fixtures")
+	flag.BoolVar(&flagInsecure, "insecure-skip-verify", false, "No verificar los certificados TLS de los sitios (INSEGURO: solo para pruebas)")
+	flag.BoolVar(&flagQuiet, "quiet", false, "Mostrar en consola solo el resumen final y los errores fatales")
+	flag.StringVar(&flagLogFile, "log-file", "", "Archivo donde guardar el log completo (se rota por tamaño)")
+	flag.IntVar(&flagLogMaxMB, "log-max-mb", 10, "Tamaño en MB a partir del cual se rota -log-file")
+	flag.IntVar(&flagLogBackups, "log-backups", 5, "Cuántos archivos rotados de -log-file conservar")
+	flag.StringVar(&flagStatusFile, "status-file", "", "Archivo JSON con el progreso de la corrida (fase, categorías, productos, errores), reescrito periódicamente")
+	flag.DurationVar(&flagStatusInterval, "status-interval", 10*time.Second, "Cada cuánto reescribir -status-file")
+	flag.IntVar(&flagMaxWarnings, "max-warnings", -1, "Fallar la corrida (sin escribir la salida final) si hay más advertencias de parsing que esto (-1 = sin límite)")
+	flag.StringVar(&flagMaxErrorRate, "max-error-rate", "", "Fallar la corrida si falla más de esta proporción de requests (ej. 5%)")
+	flag.StringVar(&flagCheckLinks, "check-links", "", "Antes de escribir la salida, pedir el link de cada producto (all) o de una muestra de N: los que dan 404 o redirigen al inicio cuentan como advertencia y los que redirigen a otra página se guardan con su destino")
+	flag.StringVar(&flagRunID, "run-id", "", "ID de la corrida para logs, métricas y reportes (por defecto el que pasa el daemon o uno nuevo)")
+	flag.StringVar(&flagSpillFile, "spill-file", "", "Archivo donde volcar periódicamente los productos recolectados (por defecto <output>.spill.ndjson)")
+	flag.DurationVar(&flagSpillInterval, "spill-interval", 10*time.Second, "Cada cuánto volcar los productos recolectados al spill (0 = desactivado)")
+	flag.IntVar(&flagFinalRetryWorkers, "final-retry-workers", 1, "Workers de la pasada final que reintenta las páginas fallidas (0 = sin pasada final)")
+	flag.DurationVar(&flagFinalRetryCooldown, "final-retry-cooldown", time.Minute, "Espera antes de la pasada final de reintentos")
+	flag.BoolVar(&flagDiskQueue, "disk-queue", false, "Guardar la cola de productos en disco en vez de memoria (permite reanudar una corrida interrumpida)")
+	flag.StringVar(&flagQueueFile, "queue-file", "", "Archivo de la cola en disco (por defecto <output>.queue.ndjson)")
+	flag.DurationVar(&flagStuckTimeout, "stuck-timeout", 5*time.Minute, "Cancelar la tarea de un worker que lleve más de este tiempo sin terminar (0 = desactivado)")
+	flag.BoolVar(&flagResolveRedirects, "resolve-redirects", false, "Seguir una vez las redirecciones de cada link de producto y guardar la dirección final")
 }
 
-func fetchHTML(client *http.Client, rawURL string) (string, error) {
+// fetchHTML GETs a page, retrying with exponential backoff. Each attempt is
+// traced as a child of parent. It also returns the number of retries needed.
+func fetchHTML(ctx context.Context, client *http.Client, parent *tracing.Span, rawURL string) (string, int, error) {
 	var lastErr error
 	for attempt := range maxRetries {
+		// Cancelled by the watchdog: further attempts would fail the same way
+		if err := ctx.Err(); err != nil {
+			return "", attempt, fmt.Errorf("tarea cancelada: %w", err)
+		}
+		if err := storeBlock.Err(); err != nil {
+			return "", attempt, err
+		}
 		if attempt > 0 {
-			backoff := time.Duration(math.Pow(2, float64(attempt))) * time.Second
+			backoff := time.Duration(math.Pow(2, float64(attempt-1)) * float64(flagBackoff))
 			log.Printf("[RETRY]  %s — intento %d/%d (espera %v)", rawURL, attempt+1, maxRetries, backoff)
 			time.Sleep(backoff)
+			scrapeMetrics.Retries.Inc()
 		}
 
-		req, err := http.NewRequest("GET", rawURL, nil)
+		req, err := http.NewRequestWithContext(audit.WithAttempt(ctx, attempt+1), "GET", rawURL, nil)
 		if err != nil {
-			return "", err
+			return "", attempt, err
 		}
 		req.Header.Set("User-Agent", "MyShopCatalogScraper/1.0")
 		req.Header.Set("Accept", "text/html")
 		req.Header.Set("Accept-Language", "es-MX,es;q=0.9")
 
+		span := tracer.StartClient(parent, "GET", "url.full", rawURL, "http.request.resend_count", attempt)
+		reqStart := time.Now()
 		resp, err := client.Do(req)
 		if err != nil {
+			scrapeMetrics.ObserveRequest(0, time.Since(reqStart))
+			span.End(err)
 			lastErr = err
 			log.Printf("[ERROR]  %s — red: %v", rawURL, err)
 			continue
@@ -102,26 +357,59 @@ func fetchHTML(client *http.Client, rawURL string) (string, error) {
 		body, err := io.ReadAll(resp.Body)
 		resp.Body.Close()
 		if err != nil {
+			scrapeMetrics.ObserveRequest(0, time.Since(reqStart))
+			span.End(err)
 			lastErr = err
 			continue
 		}
+		body = texto.UTF8(body, resp.Header.Get("Content-Type"))
+		scrapeMetrics.ObserveRequest(resp.StatusCode, time.Since(reqStart))
+		span.SetAttr("http.response.status_code", resp.StatusCode)
+		span.SetAttr("http.response.body.size", len(body))
+		if err := checkChallenge(rawURL, resp, body); err != nil {
+			span.End(err)
+			return "", attempt, err
+		}
 
 		if resp.StatusCode == 429 {
-			backoff := time.Duration(math.Pow(3, float64(attempt+1))) * time.Second
+			backoff := time.Duration(math.Pow(3, float64(attempt+1)) * float64(flagBackoff) / 2)
 			log.Printf("[WARN]   Rate limited (429), espera %v", backoff)
-			time.Sleep(backoff)
 			lastErr = fmt.Errorf("HTTP 429")
+			span.End(lastErr)
+			time.Sleep(backoff)
 			continue
 		}
 		if resp.StatusCode != 200 {
 			lastErr = fmt.Errorf("HTTP %d", resp.StatusCode)
+			span.End(lastErr)
 			log.Printf("[ERROR]  %s — HTTP %d", rawURL, resp.StatusCode)
 			continue
 		}
+		span.End(nil)
+
+		return string(body), attempt, nil
+	}
+	return "", maxRetries - 1, fmt.Errorf("falló después de %d intentos: %w", maxRetries, lastErr)
+}
+
+// storeBlock is set by the first bot-challenge page the store answers with;
+// from then on the run makes no more requests to it.
+var storeBlock desafio.Bloqueo
 
-		return string(body), nil
+// checkChallenge marks the store as blocked when resp, with its body, is a
+// bot-challenge page instead of the store's, and returns the error every
+// request gets from then on.
+func checkChallenge(rawURL string, resp *http.Response, body []byte) error {
+	servicio := desafio.Detectar(resp.StatusCode, resp.Header, body)
+	if servicio == "" {
+		return nil
 	}
-	return "", fmt.Errorf("falló después de %d intentos: %w", maxRetries, lastErr)
+	err, first := storeBlock.Marcar(&desafio.Error{Servicio: servicio, URL: rawURL, Status: resp.StatusCode})
+	if first {
+		runStatus.Blocked(servicio)
+		log.Printf("[BLOCK]  %v", err)
+	}
+	return err
 }
 
 func absURL(rel string) string {
@@ -131,15 +419,21 @@ func absURL(rel string) string {
 	return baseURL + rel
 }
 
-func parsePrice(s string) float64 {
-	s = strings.ReplaceAll(s, ",", "")
-	v, _ := strconv.ParseFloat(s, 64)
-	return v
+// priceFormat is how the store writes the prices it shows, from
+// -price-locale.
+var priceFormat = producto.FormatoMX
+
+// warnPrice logs a price that does not parse, which is read as 0 and then
+// reported as a missing price, rather than guessed at.
+func warnPrice(err error) {
+	if err != nil {
+		log.Printf("[WARN]   %v", err)
+	}
 }
 
 // fetchCategories discovers categories from the shop sidebar
-func fetchCategories(client *http.Client) (map[string]string, error) {
-	body, err := fetchHTML(client, shopURL)
+func fetchCategories(client *http.Client, parent *tracing.Span) (map[string]string, error) {
+	body, _, err := fetchHTML(context.Background(), client, parent, shopURL)
 	if err != nil {
 		return nil, err
 	}
@@ -173,25 +467,85 @@ func fetchCategories(client *http.Client) (map[string]string, error) {
 	return cats, nil
 }
 
-// collectFromCategory scrapes all pages of a category to collect product URLs
-func collectFromCategory(client *http.Client, catName, catURL string, delay time.Duration) []productEntry {
+// dumpCategories writes the store's categories to fpath (-dump-categories).
+// The shop sidebar shows neither their hierarchy nor their product counts,
+// so the tree is flat and without counts.
+func dumpCategories(client *http.Client, fpath string) error {
+	cats, err := fetchCategories(client, nil)
+	if err != nil {
+		return err
+	}
+	nodes := make([]categorias.Nodo, 0, len(cats))
+	for name, catURL := range cats {
+		slug := path.Base(strings.TrimSuffix(catURL, "/"))
+		// Odoo ends category slugs in the record id: "belleza-1"
+		id := slug
+		if i := strings.LastIndex(slug, "-"); i >= 0 {
+			id = slug[i+1:]
+		}
+		nodes = append(nodes, categorias.Nodo{ID: id, Slug: slug, Nombre: name, URL: catURL})
+	}
+	if err := categorias.NewArbol("myshop", nodes).Escribir(fpath); err != nil {
+		return err
+	}
+	log.Printf("[CATS]   %d categorías escritas en %s", len(nodes), fpath)
+	return nil
+}
+
+// loadCategories returns the store's categories, from the on-disk cache when
+// it is younger than -categories-ttl.
+func loadCategories(client *http.Client, outputPath string) (map[string]string, error) {
+	cachePath := flagCatCache
+	if cachePath == "" {
+		cachePath = categorias.DefaultPath(outputPath)
+	}
+	span := tracer.Start(nil, "discover categories", "catalogo.cache", cachePath)
+	cacheHit := true
+	cats, err := categorias.Cached(cachePath, flagCatTTL, flagRefreshCats, func() (map[string]string, error) {
+		cacheHit = false
+		return fetchCategories(client, span)
+	})
+	span.SetAttr("catalogo.cache_hit", cacheHit)
+	span.SetAttr("catalogo.categorias", len(cats))
+	span.End(err)
+	return cats, err
+}
+
+// collectFromCategory scrapes the pages of a category from startPage on to
+// collect product URLs. With deferErr, a page that fails after its retries is
+// not counted as an error: its number is returned so the caller can retry
+// the rest of the category later.
+func collectFromCategory(client *http.Client, catName, catURL string, startPage int, deferErr bool, delay time.Duration, stats *timing.Stats) ([]productEntry, int) {
 	var entries []productEntry
 	seen := make(map[string]bool)
 
-	for page := 1; ; page++ {
-		pageURL := catURL
-		if page > 1 {
-			sep := "?"
-			if strings.Contains(catURL, "?") {
-				sep = "&"
-			}
-			pageURL = fmt.Sprintf("%s%spage=%d", catURL, sep, page)
-		}
+	taskID := taskSeq.Next()
+	ctx := audit.WithTask(context.Background(), taskID)
+	span := tracer.Start(nil, "collect category", "catalogo.categoria", catName, "catalogo.tarea", taskID)
+	defer func() {
+		span.SetAttr("catalogo.productos", len(entries))
+		span.End(nil)
+	}()
 
-		log.Printf("[CAT]    %s pág %d...", catName, page)
-		body, err := fetchHTML(client, pageURL)
+	for page := startPage; ; page++ {
+		pageURL := listingPage(catURL, page, flagPPG)
+
+		log.Printf("[CAT]    %s %s pág %d...", taskID, catName, page)
+		pageStart := time.Now()
+		pageCtx, end := watch.Begin(ctx, 0, taskID+" "+pageURL)
+		body, retries, err := fetchHTML(pageCtx, client, span, pageURL)
+		end()
+		stats.Page(0, catName, time.Since(pageStart), retries)
+		if err != nil && deferErr {
+			log.Printf("[ERROR]  %s pág %d (se reintentará al final): %v", catName, page, err)
+			span.Event("página fallida", "catalogo.pagina", page, "error", err.Error())
+			return entries, page
+		}
+		warnBudget.Request(err != nil)
 		if err != nil {
 			log.Printf("[ERROR]  %s pág %d: %v", catName, page, err)
+			runStatus.Error()
+			span.Event("página fallida", "catalogo.pagina", page, "error", err.Error())
 			break
 		}
 
@@ -202,11 +556,12 @@ func collectFromCategory(client *http.Client, catName, catURL string, delay time
 			if strings.Contains(path, "/category/") || strings.Contains(path, "/cart") || strings.Contains(path, "/wishlist") {
 				continue
 			}
-			fullURL := absURL(path)
-			if seen[fullURL] {
+			fullURL := resolver.Resolve(ctx, absURL(path))
+			key := canonurl.Key(fullURL)
+			if seen[key] {
 				continue
 			}
-			seen[fullURL] = true
+			seen[key] = true
 
 			// Try to find nearby image
 			imagen64 := ""
@@ -221,11 +576,16 @@ func collectFromCategory(client *http.Client, catName, catURL string, delay time
 				}
 			}
 
-			entries = append(entries, productEntry{
+			entry := productEntry{
 				url:      fullURL,
 				imagen64: imagen64,
 				category: catName,
-			})
+			}
+			if flagShallow && idx >= 0 {
+				p := cardProduct(listingCard(body, idx), entry)
+				entry.listed = &p
+			}
+			entries = append(entries, entry)
 			found++
 		}
 
@@ -233,70 +593,182 @@ func collectFromCategory(client *http.Client, catName, catURL string, delay time
 		if found == 0 {
 			break
 		}
+		if flagSample > 0 && len(entries) >= flagSample {
+			entries = entries[:flagSample]
+			log.Printf("[CAT]    %s: muestra de %d productos", catName, flagSample)
+			break
+		}
 
-		// Check if next page link exists
-		nextPage := fmt.Sprintf("page=%d", page+1)
-		if !strings.Contains(body, nextPage) {
+		// Go on while the pager links the next page or, for themes with
+		// infinite scroll and no pager, while pages come full
+		if !hasNextPage(body, page) && (flagPPG == 0 || found < flagPPG) {
 			break
 		}
 		time.Sleep(delay)
 	}
 
-	return entries
+	return entries, 0
 }
 
-// scrapeProduct fetches a product detail page and parses it
-func scrapeProduct(client *http.Client, entry productEntry) (Product, error) {
-	body, err := fetchHTML(client, entry.url)
-	if err != nil {
-		return Product{}, err
+// listingCard is the product card around the product link at idx of a
+// listing page, from Odoo's oe_product_cart class to the next card, or
+// the characters around the link in themes without it.
+func listingCard(body string, idx int) string {
+	const mark = "oe_product_cart"
+	start := strings.LastIndex(body[:idx], mark)
+	if start < 0 {
+		return body[max(0, idx-500):min(len(body), idx+1500)]
+	}
+	end := len(body)
+	if i := strings.Index(body[idx:], mark); i >= 0 {
+		end = idx + i
 	}
+	return body[start:end]
+}
 
+// cardProduct builds the product of entry from its listing card, for
+// -shallow: name, price, list price, currency, thumbnail and category. The
+// card says nothing of the stock, the breadcrumb or the variants.
+func cardProduct(card string, entry productEntry) Product {
 	p := Product{
-		Link:     entry.url,
-		Imagen64: entry.imagen64,
+		Link:          entry.url,
+		Imagen:        entry.imagen64,
+		Imagen64:      entry.imagen64,
+		Categoria:     entry.category,
+		Subcategorias: []string{entry.category},
+		Tienda:        "myshop",
+	}
+	if m := reItempName.FindStringSubmatch(card); m != nil {
+		p.Nombre = strings.TrimSpace(html.UnescapeString(m[1]))
+	} else if m := reCardTitle.FindStringSubmatch(card); m != nil {
+		p.Nombre = strings.TrimSpace(html.UnescapeString(m[1]))
 	}
+	parsePriceStock(card, &p)
+	p.MesesSinIntereses = producto.MesesSinIntereses(card)
+	p.EnvioGratis = envio.Insignia(card)
+	if p.Nombre == "" || p.Precio == 0 {
+		scrapeMetrics.ParseFailures.Inc()
+		warnBudget.Warning()
+		log.Printf("[WARN]   %s — el listado no muestra nombre o precio", entry.url)
+	}
+	p.SetUnitPrice()
+	return p
+}
 
-	// Name — try itemprop="name" first, then <h1>
-	if m := reItempName.FindStringSubmatch(body); m != nil {
-		p.Nombre = html.UnescapeString(strings.TrimSpace(m[1]))
-	} else if m := reH1.FindStringSubmatch(body); m != nil {
-		// Strip HTML tags inside h1
-		name := regexp.MustCompile(`<[^>]+>`).ReplaceAllString(m[1], "")
-		p.Nombre = html.UnescapeString(strings.TrimSpace(name))
+// listingPage is the URL of page of the listing at catURL in Odoo's form,
+// /shop/category/belleza-1/page/2, keeping catURL's query and setting ppg
+// (products per page) when it is not 0.
+func listingPage(catURL string, page, ppg int) string {
+	u, err := url.Parse(catURL)
+	if err != nil {
+		return catURL
 	}
+	u.Path = rePagePath.ReplaceAllString(u.Path, "")
+	if page > 1 {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/page/" + strconv.Itoa(page)
+	}
+	if ppg > 0 {
+		q := u.Query()
+		q.Set("ppg", strconv.Itoa(ppg))
+		u.RawQuery = q.Encode()
+	}
+	return u.String()
+}
 
-	// Price — Odoo hides the machine-readable price in:
-	// <span itemprop="price" style="display:none;">15.0</span>
-	if m := reHiddenPrice.FindStringSubmatch(body); m != nil {
-		p.Precio = parsePrice(m[1])
-	} else if m := rePrice.FindStringSubmatch(body); m != nil {
-		p.Precio = parsePrice(m[1])
+// hasNextPage reports whether a listing page links the page after page,
+// as /page/N or, in older themes, page=N.
+func hasNextPage(body string, page int) bool {
+	next := strconv.Itoa(page + 1)
+	for _, mark := range []string{"/page/" + next, "page=" + next} {
+		for rest := body; ; {
+			i := strings.Index(rest, mark)
+			if i < 0 {
+				break
+			}
+			rest = rest[i+len(mark):]
+			if rest == "" || rest[0] < '0' || rest[0] > '9' {
+				return true
+			}
+		}
 	}
+	return false
+}
 
-	// Original/list price — Odoo renders it in a span with class "oe_default_price"
-	// (hidden with d-none when not on sale)
-	if m := reListPrice.FindStringSubmatch(body); m != nil {
-		listPrice := parsePrice(m[1])
-		if listPrice > p.Precio {
-			p.PrecioOriginal = listPrice
-			p.EnOferta = true
-		} else {
-			p.PrecioOriginal = p.Precio
+// entryCategories picks the category of the product of entry among the
+// categories whose listings showed it: the deepest one in its breadcrumb
+// migas or else the first by name, so the pick does not depend on which
+// listing was read first. Subcategorias are the breadcrumb followed by the
+// other listing categories. A product with no listing category takes the
+// deepest breadcrumb, or "General".
+func entryCategories(entry productEntry, migas []string) (string, []string) {
+	cats := slices.Clone(entry.categories)
+	if len(cats) == 0 && entry.category != "" {
+		cats = []string{entry.category}
+	}
+	if len(cats) == 0 {
+		if len(migas) == 0 {
+			return "General", []string{"General"}
 		}
-	} else {
-		p.PrecioOriginal = p.Precio
+		return migas[len(migas)-1], migas
 	}
+	slices.SortFunc(cats, func(a, b string) int {
+		return strings.Compare(texto.Normalize(a), texto.Normalize(b))
+	})
+	categoria := cats[0]
+	found := false
+	for i := len(migas) - 1; i >= 0 && !found; i-- {
+		for _, c := range cats {
+			if texto.Normalize(c) == texto.Normalize(migas[i]) {
+				categoria, found = c, true
+				break
+			}
+		}
+	}
+	subcats := slices.Clone(migas)
+	for _, c := range cats {
+		if !slices.ContainsFunc(subcats, func(m string) bool { return texto.Normalize(m) == texto.Normalize(c) }) {
+			subcats = append(subcats, c)
+		}
+	}
+	return categoria, subcats
+}
 
-	// Stock — check for add-to-cart button vs "no existe" message
-	switch {
-	case reCombNoExist.MatchString(body):
-		p.Stock = "Agotado"
-	case reAddToCart.MatchString(body):
-		p.Stock = "Disponible"
-	default:
-		p.Stock = "Desconocido"
+// scrapeProduct fetches a product detail page and parses it. It also returns
+// the number of retries the page needed.
+func scrapeProduct(ctx context.Context, client *http.Client, span *tracing.Span, entry productEntry) ([]Product, int, error) {
+	body, retries, err := fetchHTML(audit.WithTask(ctx, entry.id), client, span, entry.url)
+	if err != nil {
+		return nil, retries, err
+	}
+
+	parseSpan := tracer.Start(span, "parse product")
+	defer parseSpan.End(nil)
+
+	p := Product{
+		Link:     entry.url,
+		Imagen64: entry.imagen64,
+		Tienda:   "myshop",
+	}
+
+	p.Nombre = pageName(body)
+	parsePriceStock(body, &p)
+	// Pages without the microdata may still carry schema.org JSON-LD
+	if p.Nombre == "" || p.Precio == 0 {
+		if ld := extraer.JSONLD(body); len(ld) > 0 {
+			if p.Nombre == "" {
+				p.Nombre = ld[0].Nombre
+			}
+			if p.Precio == 0 && ld[0].Precio > 0 {
+				p.Precio, p.PrecioOriginal, p.EnOferta = ld[0].Precio, ld[0].Precio, false
+				if ld[0].Moneda != "" {
+					p.Moneda = ld[0].Moneda
+				}
+			}
+		}
 	}
+	p.MesesSinIntereses = producto.MesesSinIntereses(productSection(body))
+	p.EnvioGratis = envio.Insignia(productSection(body))
+	readThreshold.Do(func() { siteThreshold(body) })
 
 	// Image — high-res from detail page
 	if m := reImgSrc.FindStringSubmatch(body); m != nil {
@@ -310,165 +782,1573 @@ func scrapeProduct(client *http.Client, entry productEntry) (Product, error) {
 	}
 
 	// Categories from breadcrumb
-	var subcats []string
-	for _, m := range reBreadcrumb.FindAllStringSubmatch(body, -1) {
-		name := html.UnescapeString(strings.TrimSpace(m[1]))
-		if name != "" && !strings.EqualFold(name, "inicio") && !strings.EqualFold(name, "home") {
-			subcats = append(subcats, name)
-		}
-	}
-	// Last breadcrumb is product name — remove
-	if len(subcats) > 0 {
-		subcats = subcats[:len(subcats)-1]
+	p.Categoria, p.Subcategorias = entryCategories(entry, extraer.Migas(body))
+	if flagLangEN != "" {
+		translate(audit.WithTask(ctx, entry.id), client, span, &p)
 	}
 
-	if entry.category != "" {
-		p.Categoria = entry.category
-		if len(subcats) == 0 {
-			subcats = []string{entry.category}
-		}
-	} else if len(subcats) > 0 {
-		p.Categoria = subcats[len(subcats)-1]
-	} else {
-		p.Categoria = "General"
-		subcats = []string{"General"}
+	if p.Nombre == "" || p.Precio == 0 {
+		scrapeMetrics.ParseFailures.Inc()
+		warnBudget.Warning()
+		parseSpan.Event("nombre o precio faltante")
+		log.Printf("[WARN]   %s — no se pudo leer nombre o precio", entry.url)
 	}
-	p.Subcategorias = subcats
+	p.SetUnitPrice()
 
-	return p, nil
+	if variantMode == producto.Expandir {
+		return expandVariants(audit.WithTask(ctx, entry.id), client, span, body, p), retries, nil
+	}
+	return []Product{p}, retries, nil
 }
 
-func worker(id int, client *http.Client, jobs <-chan productEntry, results chan<- Product, wg *sync.WaitGroup, delay time.Duration) {
-	defer wg.Done()
-	for entry := range jobs {
-		p, err := scrapeProduct(client, entry)
-		if err != nil {
-			log.Printf("[W%d]     ERROR %s: %v", id, entry.url, err)
-			continue
-		}
-		log.Printf("[W%d]     OK  %q — $%.2f | %s | %s", id, p.Nombre, p.Precio, p.Stock, p.Categoria)
-		results <- p
-		time.Sleep(delay)
+// pageName reads the product's name from its page: itemprop="name" first,
+// then <h1>.
+func pageName(body string) string {
+	if m := reItempName.FindStringSubmatch(body); m != nil {
+		return html.UnescapeString(strings.TrimSpace(m[1]))
+	}
+	if m := reH1.FindStringSubmatch(body); m != nil {
+		// Strip HTML tags inside h1
+		name := regexp.MustCompile(`<[^>]+>`).ReplaceAllString(m[1], "")
+		return html.UnescapeString(strings.TrimSpace(name))
 	}
+	return ""
 }
 
-func writeJSON(products []Product, fpath string) error {
-	data, err := json.MarshalIndent(products, "", "    ")
+// translate fills the NombreEN and DescripcionEN of p from its page in the
+// -lang-en language, which Odoo serves under the language's prefix
+// (/en/shop/...). A page that fails leaves p without them.
+func translate(ctx context.Context, client *http.Client, span *tracing.Span, p *Product) {
+	u, err := url.Parse(p.Link)
 	if err != nil {
-		return err
+		return
+	}
+	u.Path = "/" + flagLangEN + u.Path
+	body, _, err := fetchHTML(ctx, client, span, u.String())
+	if err != nil {
+		log.Printf("[WARN]   %s: sin traducción (%v)", p.Link, err)
+		return
+	}
+	p.NombreEN = pageName(body)
+	p.DescripcionEN = extraer.DescripcionPagina(body)
+	if p.NombreEN == "" || p.DescripcionEN == "" {
+		if ld := extraer.JSONLD(body); len(ld) > 0 {
+			if p.NombreEN == "" {
+				p.NombreEN = ld[0].Nombre
+			}
+			if p.DescripcionEN == "" {
+				p.DescripcionEN = ld[0].Descripcion
+			}
+		}
 	}
-	return os.WriteFile(fpath, data, 0644)
 }
 
-func resolveOutput() string {
-	output := flagOutput
-	if !filepath.IsAbs(output) {
-		wd, _ := os.Getwd()
-		output = filepath.Join(wd, output)
-	}
+// variantMode is -expand-variants or -parents-only.
+var variantMode producto.Variantes
+
+// maxVariants caps the combinations priced per product, so a product with
+// many attributes does not turn into hundreds of requests.
+const maxVariants = 50
 
-	// Decode percent-encoded path segments (e.g. from runtime.Caller)
-	if decoded, err := url.PathUnescape(output); err == nil {
-		output = decoded
+var (
+	reVariantValue = regexp.MustCompile(`<(?:input|option)\b[^>]*\bdata-value_id="(\d+)"[^>]*>`)
+	reValueName    = regexp.MustCompile(`\bdata-value_name="([^"]*)"`)
+	reAttrName     = regexp.MustCompile(`\bdata-attribute_name="([^"]*)"`)
+	reTemplateID   = regexp.MustCompile(`-(\d+)/?$`)
+)
+
+// variantAttr is one attribute of a product page's variant picker and the
+// values it offers.
+type variantAttr struct {
+	name   string
+	ids    []int
+	values []string
+}
+
+// variantAttrs reads the attributes that make variants from the variant
+// picker of an Odoo product page (radios or selects whose values carry
+// data-value_id); attributes marked no_variant only add options to the order.
+func variantAttrs(body string) []variantAttr {
+	var attrs []variantAttr
+	index := make(map[string]int)
+	seen := make(map[int]bool)
+	for _, m := range reVariantValue.FindAllStringSubmatch(body, -1) {
+		tag := m[0]
+		id, _ := strconv.Atoi(m[1])
+		if seen[id] || strings.Contains(tag, "no_variant") {
+			continue
+		}
+		seen[id] = true
+		name, value := "", ""
+		if n := reAttrName.FindStringSubmatch(tag); n != nil {
+			name = html.UnescapeString(n[1])
+		}
+		if v := reValueName.FindStringSubmatch(tag); v != nil {
+			value = html.UnescapeString(v[1])
+		}
+		i, ok := index[name]
+		if !ok {
+			i = len(attrs)
+			index[name] = i
+			attrs = append(attrs, variantAttr{name: name})
+		}
+		attrs[i].ids = append(attrs[i].ids, id)
+		attrs[i].values = append(attrs[i].values, value)
 	}
+	return attrs
+}
 
-	return output
+// combinationInfo is what Odoo answers for a combination of attribute
+// values. FreeQty is only there with website_sale_stock, for stored products.
+type combinationInfo struct {
+	Price              float64  `json:"price"`
+	ListPrice          float64  `json:"list_price"`
+	HasDiscountedPrice bool     `json:"has_discounted_price"`
+	Possible           bool     `json:"is_combination_possible"`
+	FreeQty            *float64 `json:"free_qty"`
 }
 
-func run(numWorkers int, delay time.Duration, outputPath string) error {
-	client := &http.Client{Timeout: 30 * time.Second}
+// combinationRoutes are the JSON-RPC routes that price a combination: the
+// one of Odoo 17 and later, then the one of Odoo 14 to 16. combinationRoute
+// remembers the one the store answered.
+var (
+	combinationRoutes = []string{"/website_sale/get_combination_info", "/sale/get_combination_info_website"}
+	combinationRoute  atomic.Int32
+)
 
-	// Phase 1: discover categories
-	log.Printf("[CATS]   Obteniendo categorías...")
-	cats, err := fetchCategories(client)
+// fetchCombination asks the store for the price of template's variant with
+// the given attribute values.
+func fetchCombination(ctx context.Context, client *http.Client, span *tracing.Span, template int, combination []int) (combinationInfo, error) {
+	payload, err := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"method":  "call",
+		"params": map[string]any{
+			"product_template_id": template,
+			"product_id":          false,
+			"combination":         combination,
+			"add_qty":             1,
+		},
+	})
 	if err != nil {
-		return fmt.Errorf("error obteniendo categorías: %w", err)
+		return combinationInfo{}, fmt.Errorf("error serializando JSON: %w", err)
 	}
-	log.Printf("[CATS]   %d categorías:", len(cats))
-	for name, u := range cats {
-		log.Printf("[CATS]     %s → %s", name, u)
+	if err := storeBlock.Err(); err != nil {
+		return combinationInfo{}, err
 	}
-	fmt.Println()
+	var lastErr error
+	for i := range combinationRoutes {
+		route := (int(combinationRoute.Load()) + i) % len(combinationRoutes)
+		rawURL := absURL(combinationRoutes[route])
+		req, err := http.NewRequestWithContext(ctx, "POST", rawURL, bytes.NewReader(payload))
+		if err != nil {
+			return combinationInfo{}, err
+		}
+		req.Header.Set("User-Agent", "MyShopCatalogScraper/1.0")
+		req.Header.Set("Content-Type", "application/json")
+		reqSpan := tracer.StartClient(span, "POST", "url.full", rawURL)
+		reqStart := time.Now()
+		resp, err := client.Do(req)
+		if err != nil {
+			scrapeMetrics.ObserveRequest(0, time.Since(reqStart))
+			reqSpan.End(err)
+			return combinationInfo{}, err
+		}
+		var answer struct {
+			Result *combinationInfo `json:"result"`
+			Error  *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&answer)
+		resp.Body.Close()
+		scrapeMetrics.ObserveRequest(resp.StatusCode, time.Since(reqStart))
+		reqSpan.SetAttr("http.response.status_code", resp.StatusCode)
+		switch {
+		case resp.StatusCode == http.StatusNotFound:
+			lastErr = fmt.Errorf("%s: HTTP 404", combinationRoutes[route])
+		case resp.StatusCode != http.StatusOK:
+			lastErr = fmt.Errorf("%s: HTTP %d", combinationRoutes[route], resp.StatusCode)
+		case err != nil:
+			lastErr = fmt.Errorf("error parsing JSON: %w", err)
+		case answer.Error != nil:
+			lastErr = fmt.Errorf("%s: %s", combinationRoutes[route], answer.Error.Message)
+		case answer.Result == nil:
+			lastErr = fmt.Errorf("%s: respuesta sin resultado", combinationRoutes[route])
+		default:
+			reqSpan.End(nil)
+			combinationRoute.Store(int32(route))
+			return *answer.Result, nil
+		}
+		reqSpan.End(lastErr)
+	}
+	return combinationInfo{}, lastErr
+}
 
-	// Phase 2: collect product URLs per category
-	log.Printf("[LIST]   Recolectando URLs de productos...")
-	seen := make(map[string]bool)
-	var allEntries []productEntry
-	for name, u := range cats {
-		entries := collectFromCategory(client, name, u, delay)
-		for _, e := range entries {
-			if seen[e.url] {
-				continue
+// expandVariants returns the variants of parent, parsed from its page body,
+// each priced by the store: one product per possible combination of the
+// attributes' values. A product without variants, or whose variants cannot
+// be priced, stays as the parent.
+func expandVariants(ctx context.Context, client *http.Client, span *tracing.Span, body string, parent Product) []Product {
+	attrs := variantAttrs(body)
+	if len(attrs) == 0 {
+		return []Product{parent}
+	}
+	m := reTemplateID.FindStringSubmatch(parent.Link)
+	if m == nil {
+		log.Printf("[WARN]   %s — sin id de plantilla; se conserva el producto padre", parent.Link)
+		return []Product{parent}
+	}
+	template, _ := strconv.Atoi(m[1])
+
+	// Every combination of one value per attribute, up to maxVariants
+	combos := [][]int{nil}
+	for _, a := range attrs {
+		var next [][]int
+		for _, c := range combos {
+			for j := range a.ids {
+				if len(next) < maxVariants {
+					next = append(next, append(slices.Clone(c), j))
+				}
 			}
-			seen[e.url] = true
-			allEntries = append(allEntries, e)
 		}
-		time.Sleep(delay)
+		combos = next
+	}
+	if len(combos) == 1 {
+		return []Product{parent}
 	}
-	log.Printf("[LIST]   %d URLs únicas", len(allEntries))
-	fmt.Println()
-
-	// Phase 3: scrape detail pages with worker pool
-	log.Printf("[START]  %d workers scraping detalle...", numWorkers)
-	jobs := make(chan productEntry, len(allEntries))
-	results := make(chan Product, len(allEntries))
-	var wg sync.WaitGroup
 
-	for i := range numWorkers {
-		wg.Add(1)
-		go worker(i+1, client, jobs, results, &wg, delay)
+	var out []Product
+	for _, c := range combos {
+		ids := make([]int, len(c))
+		values := make([]producto.Atributo, len(c))
+		idText := make([]string, len(c))
+		for i, j := range c {
+			ids[i] = attrs[i].ids[j]
+			values[i] = producto.Atributo{Nombre: attrs[i].name, Valor: attrs[i].values[j]}
+			idText[i] = strconv.Itoa(ids[i])
+		}
+		info, err := fetchCombination(ctx, client, span, template, ids)
+		if err != nil {
+			log.Printf("[WARN]   %s — no se pudieron obtener los precios de sus variantes (%v); se conserva el producto padre", parent.Link, err)
+			return []Product{parent}
+		}
+		if !info.Possible {
+			continue
+		}
+		// Odoo selects a variant from #attr=, which canonical links drop, so
+		// the ids go in the query, which Odoo ignores
+		v := parent.ComoVariante(values, canonurl.Clean(parent.Link+"?attr="+strings.Join(idText, ",")))
+		v.Precio = info.Price
+		v.PrecioOriginal = max(info.ListPrice, info.Price)
+		v.EnOferta = info.HasDiscountedPrice && info.ListPrice > info.Price
+		if info.FreeQty != nil {
+			v.Stock = "Disponible"
+			if *info.FreeQty <= 0 {
+				v.Stock = "Agotado"
+			}
+		}
+		v.SetUnitPrice()
+		out = append(out, v)
 	}
-	for _, e := range allEntries {
-		jobs <- e
+	if len(out) == 0 {
+		return []Product{parent}
 	}
-	close(jobs)
+	return out
+}
 
-	go func() {
-		wg.Wait()
-		close(results)
-	}()
+// readThreshold reads the site's free-shipping threshold from the first
+// product page fetched.
+var readThreshold sync.Once
 
-	var products []Product
-	counts := make(map[string]int)
-	for p := range results {
-		products = append(products, p)
-		counts[p.Categoria]++
+// siteThreshold sets shipping's threshold from the one the site announces in
+// a page's banners, unless catalogo.json sets it.
+func siteThreshold(body string) {
+	if shipping.GratisDesde > 0 {
+		return
 	}
+	if v := envio.Umbral(body, priceFormat); v > 0 {
+		shipping.GratisDesde = v
+		log.Printf("[ENVIO]  El sitio anuncia envío gratis desde $%.2f", v)
+	}
+}
 
-	sort.Slice(products, func(i, j int) bool {
-		if products[i].Categoria != products[j].Categoria {
-			return products[i].Categoria < products[j].Categoria
-		}
-		return products[i].Nombre < products[j].Nombre
-	})
+// productSection is the part of a product page about the product: from its
+// details block to the footer, leaving out the header banners that announce
+// site-wide promotions ("hasta 12 MSI") on every page.
+func productSection(body string) string {
+	if i := strings.Index(body, `id="product_details"`); i >= 0 {
+		body = body[i:]
+	}
+	if i := strings.Index(body, "<footer"); i >= 0 {
+		body = body[:i]
+	}
+	return body
+}
 
-	fmt.Println()
-	log.Printf("[RESUMEN] ─────────────────────────────")
-	for cat, n := range counts {
-		log.Printf("[RESUMEN] %s: %d productos", cat, n)
+// parsePriceStock fills the price, list price, currency, offer flag and
+// stock of p from a product detail page.
+func parsePriceStock(body string, p *Product) {
+	// Price — the machine-readable microdata one, or else as shown
+	precio, _, err := extraer.PrecioPagina(body, priceFormat)
+	warnPrice(err)
+	p.Precio = precio
+
+	// Currency — next to the price in the microdata
+	if moneda := extraer.Moneda(body); moneda != "" {
+		p.Moneda = moneda
 	}
-	log.Printf("[RESUMEN] ─────────────────────────────")
-	log.Printf("[RESUMEN] Total: %d productos", len(products))
 
-	return writeJSON(products, outputPath)
+	// Original/list price, shown crossed out when on sale
+	listPrice, _, err := extraer.PrecioLista(body, priceFormat)
+	warnPrice(err)
+	if listPrice > p.Precio {
+		p.PrecioOriginal = listPrice
+		p.EnOferta = true
+	} else {
+		p.PrecioOriginal = p.Precio
+		p.EnOferta = false
+	}
+
+	// Stock — check for add-to-cart button vs "no existe" message
+	switch {
+	case reCombNoExist.MatchString(body):
+		p.Stock = "Agotado"
+	case reAddToCart.MatchString(body):
+		p.Stock = "Disponible"
+	default:
+		p.Stock = "Desconocido"
+	}
 }
 
-func main() {
-	flag.Parse()
-	log.SetFlags(log.Ltime)
+// errPanic marks a task whose processing panicked.
+var errPanic = errors.New("panic")
 
-	output := resolveOutput()
+// panics counts the products whose scraping panicked during the run.
+var panics atomic.Int32
 
-	log.Printf("[CONFIG] Output:  %s", output)
-	log.Printf("[CONFIG] Workers: %d", flagWorkers)
-	log.Printf("[CONFIG] Delay:   %v", flagDelay)
-	fmt.Println()
+// productFilter drops the products -match-name, -min-price, -max-price,
+// -only-on-sale and -in-stock-only leave out; filtered counts them. Names
+// and prices come from the product pages, so a filtered run still fetches
+// every one.
+var (
+	productFilter producto.Filtro
+	filtered      atomic.Int32
+)
 
-	start := time.Now()
-	if err := run(flagWorkers, flagDelay, output); err != nil {
-		log.Fatalf("[FATAL]  %v", err)
-	}
+// blocklist drops the products named in the -blocklist file; blocked counts
+// them.
+var (
+	blocklist *producto.Bloqueo
+	blocked   atomic.Int32
+)
+
+// watch cancels worker tasks stuck for longer than -stuck-timeout; stuck
+// counts them.
+var (
+	watch *watchdog.Watchdog
+	stuck atomic.Int32
+)
+
+// resolver follows product link redirects when -resolve-redirects is set;
+// nil only cleans the links.
+var resolver *canonurl.Resolver
 
+// safeScrapeProduct is scrapeProduct with a panic returned as an error
+// wrapping errPanic instead of killing the worker.
+func safeScrapeProduct(ctx context.Context, client *http.Client, span *tracing.Span, entry productEntry) (products []Product, retries int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v\n%s", errPanic, r, debug.Stack())
+		}
+	}()
+	return scrapeProduct(ctx, client, span, entry)
+}
+
+// jobQueue holds the product entries waiting for a worker: a channel, or a
+// file with -disk-queue.
+type jobQueue interface {
+	push(e productEntry) error
+	pop() (productEntry, bool)
+	// done marks a popped entry as finished.
+	done(e productEntry)
+	len() int
+	// end makes pop return false once the queue is empty.
+	end()
+}
+
+type chanQueue chan productEntry
+
+// newChanQueue queues entries with room for one requeue each, so workers
+// never block on push.
+func newChanQueue(entries []productEntry) chanQueue {
+	q := make(chanQueue, 2*len(entries))
+	for _, e := range entries {
+		q <- e
+	}
+	return q
+}
+
+func (q chanQueue) push(e productEntry) error { q <- e; return nil }
+func (q chanQueue) pop() (productEntry, bool) { e, ok := <-q; return e, ok }
+func (q chanQueue) done(productEntry)         {}
+func (q chanQueue) len() int                  { return len(q) }
+func (q chanQueue) end()                      { close(q) }
+
+// queuedEntry is a product entry as stored in the disk queue.
+type queuedEntry struct {
+	URL        string   `json:"url"`
+	Imagen64   string   `json:"imagen64,omitempty"`
+	Categoria  string   `json:"categoria"`
+	Categorias []string `json:"categorias,omitempty"`
+	Reencolada bool     `json:"reencolada,omitempty"`
+}
+
+type diskQueue struct {
+	q *diskq.Queue[queuedEntry]
+}
+
+func (d diskQueue) push(e productEntry) error {
+	return d.q.Push(queuedEntry{URL: e.url, Imagen64: e.imagen64, Categoria: e.category, Categorias: e.categories, Reencolada: e.requeued})
+}
+
+func (d diskQueue) pop() (productEntry, bool) {
+	qe, qid, ok := d.q.Pop()
+	if !ok {
+		return productEntry{}, false
+	}
+	return productEntry{id: taskSeq.Next(), url: qe.URL, imagen64: qe.Imagen64, category: qe.Categoria, categories: qe.Categorias, requeued: qe.Reencolada, qid: qid}, true
+}
+
+func (d diskQueue) done(e productEntry) { d.q.Done(e.qid) }
+func (d diskQueue) len() int            { return d.q.Len() }
+func (d diskQueue) end()                { d.q.End() }
+
+// worker scrapes the product pages it receives from jobs. A product that
+// panics is put back in jobs once; one that still fails after its retries
+// goes to retryLater, when not nil. tasks tracks the entries still to finish.
+func worker(id int, client *http.Client, jobs jobQueue, results chan<- Product, wg, tasks *sync.WaitGroup, delay time.Duration, stats *timing.Stats, retryLater *entryList) {
+	defer wg.Done()
+	for {
+		waitStart := time.Now()
+		entry, ok := jobs.pop()
+		stats.Idle(id, time.Since(waitStart))
+		if !ok {
+			return
+		}
+		finish := func() {
+			jobs.done(entry)
+			tasks.Done()
+		}
+		// A blocked store gets no more requests: drain the queue
+		if storeBlock.Err() != nil {
+			finish()
+			continue
+		}
+
+		start := time.Now()
+		span := tracer.Start(nil, "product", "url.full", entry.url, "catalogo.categoria", entry.category, "catalogo.worker", id, "catalogo.tarea", entry.id)
+		ctx, end := watch.Begin(context.Background(), id, entry.id+" "+entry.url)
+		products, retries, err := safeScrapeProduct(ctx, client, span, entry)
+		end()
+		span.End(err)
+		stats.Page(id, entry.category, time.Since(start), retries)
+
+		if errors.Is(err, errPanic) {
+			panics.Add(1)
+			log.Printf("[PANIC]  W%d %s %s: %v", id, entry.id, entry.url, err)
+			if !entry.requeued {
+				log.Printf("[QUEUE]  Reencolando %s tras el panic", entry.url)
+				retry := entry
+				retry.requeued = true
+				tasks.Add(1)
+				if err := jobs.push(retry); err != nil {
+					log.Printf("[QUEUE]  No se pudo reencolar %s: %v", entry.url, err)
+					tasks.Done()
+				}
+				finish()
+				continue
+			}
+		}
+
+		if err != nil && retryLater != nil {
+			log.Printf("[W%d]     %s ERROR %s (se reintentará al final): %v", id, entry.id, entry.url, err)
+			retryLater.add(entry)
+			finish()
+			continue
+		}
+
+		warnBudget.Request(err != nil)
+		if err != nil {
+			log.Printf("[W%d]     %s ERROR %s: %v", id, entry.id, entry.url, err)
+			runStatus.Error()
+			finish()
+			continue
+		}
+		for _, p := range products {
+			log.Printf("[W%d]     %s OK  %q — $%.2f | %s | %s", id, entry.id, p.Nombre, p.Precio, p.Stock, p.Categoria)
+			switch {
+			case blocklist.Bloquea(p.Nombre):
+				blocked.Add(1)
+			case !productFilter.Acepta(p):
+				filtered.Add(1)
+			default:
+				results <- p
+			}
+		}
+		finish()
+		time.Sleep(delay)
+		stats.Delay(id, delay)
+	}
+}
+
+// linkSample is -check-links: how many product links checkLinks requests.
+var linkSample int
+
+// checkLinks requests the links of products, or a sample of them, before
+// the output is written (-check-links). Broken ones, usually products the
+// store removed but still lists, count as warnings; the ones that moved
+// are recorded under their new address.
+func checkLinks(client *http.Client, products []Product) {
+	if linkSample == 0 {
+		return
+	}
+	runStatus.Phase("enlaces")
+	inf := enlaces.Revisar(context.Background(), client, products, linkSample, flagDetailWork, flagDelay)
+	for _, p := range inf.Problemas {
+		warnBudget.Warning()
+		if p.Final != "" {
+			log.Printf("[LINK]   %s → %s: %s", p.Link, p.Final, p.Motivo)
+		} else {
+			log.Printf("[LINK]   %s: %s", p.Link, p.Motivo)
+		}
+	}
+	log.Printf("[LINK]   %d enlaces revisados: %d movidos, %d con problemas", inf.Revisados, inf.Movidos, len(inf.Problemas))
+}
+
+// listedProducts sends the products -shallow read from the listing cards
+// of entries to results, past the blocklist and product filter like the
+// workers' ones.
+func listedProducts(entries []productEntry, results chan<- Product) {
+	for _, e := range entries {
+		if e.listed == nil {
+			continue
+		}
+		p := *e.listed
+		p.Categoria, p.Subcategorias = entryCategories(e, nil)
+		if flagVerbose {
+			log.Printf("[SHALLOW] %q — $%.2f | %s", p.Nombre, p.Precio, p.Categoria)
+		}
+		switch {
+		case blocklist.Bloquea(p.Nombre):
+			blocked.Add(1)
+		case !productFilter.Acepta(p):
+			filtered.Add(1)
+		default:
+			results <- p
+		}
+	}
+}
+
+// runWatch re-checks only the products listed in the watch file (price and
+// stock) and updates them in the existing output, leaving the rest untouched.
+func runWatch(watchPath, outputPath string) error {
+	links, err := producto.ReadLinks(watchPath)
+	if err != nil {
+		return err
+	}
+	return refreshOutput("WATCH", links, outputPath)
+}
+
+// refreshOutput re-fetches the detail pages of the given links (every product
+// in the output when links is nil), parsing only price and stock, and
+// rewrites the output. Category discovery and listing pages are skipped.
+func refreshOutput(tag string, links []string, outputPath string) error {
+	products, err := producto.ReadJSON(outputPath)
+	if err != nil {
+		return fmt.Errorf("-%s necesita la salida de una corrida completa: %w", strings.ToLower(tag), err)
+	}
+	if links == nil {
+		for _, p := range products {
+			links = append(links, p.Link)
+		}
+	}
+
+	client := auditLog.Client(httpTransport, 30*time.Second)
+	runStatus.Phase(strings.ToLower(tag))
+	runStatus.Products(len(products))
+	prefix := fmt.Sprintf("[%s]", tag)
+	log.Printf("%-8s Revisando %d productos", prefix, len(links))
+	stats := producto.Refresh(products, links, flagDetailWork, flagDelay, func(p Product) (Product, error) {
+		// The page shows the parent's default variant, not this one
+		if p.Variante != "" {
+			return p, nil
+		}
+		body, _, err := fetchHTML(audit.WithTask(context.Background(), taskSeq.Next()), client, nil, p.Link)
+		warnBudget.Request(err != nil)
+		if err != nil {
+			runStatus.Error()
+			log.Printf("[ERROR]  %s: %v", p.Link, err)
+			return p, err
+		}
+		parsePriceStock(body, &p)
+		log.Printf("%-8s %q — $%.2f | %s", prefix, p.Nombre, p.Precio, p.Stock)
+		return p, nil
+	})
+	log.Printf("%-8s %d actualizados, %d sin cambios, %d fallidos, %d fuera del catálogo",
+		prefix, stats.Actualizados, stats.SinCambios, stats.Fallidos, stats.Desconocidos)
+	if err := storeBlock.Err(); err != nil {
+		return err
+	}
+	if err := warnBudget.Check(); err != nil {
+		return err
+	}
+
+	products = prepareOutput(products)
+	if err := writeJSON(products, outputPath); err != nil {
+		return err
+	}
+	writeMeta(products, outputPath)
+	return nil
+}
+
+// savePartial writes the products gathered by a run that failed with err to
+// the partial output, so hours of scraping are not lost, and returns err.
+func savePartial(products []Product, outputPath string, err error) error {
+	if len(products) == 0 {
+		return err
+	}
+	fpath := producto.PartialPath(outputPath)
+	if werr := writeJSON(products, fpath); werr != nil {
+		log.Printf("[WARN]   No se pudo escribir la salida parcial: %v", werr)
+		return err
+	}
+	log.Printf("[PARCIAL] %d productos escritos en %s", len(products), fpath)
+	return err
+}
+
+func writeJSON(products []Product, fpath string) (err error) {
+	span := tracer.Start(nil, "write json", "file.path", fpath, "catalogo.productos", len(products))
+	defer func() { span.End(err) }()
+
+	data, err := outputFields.Marshal(products, outputSchema)
+	if err != nil {
+		return err
+	}
+	span.SetAttr("file.size", len(data))
+	return os.WriteFile(fpath, data, 0644)
+}
+
+func resolveOutput() string {
+	output := filepath.FromSlash(flagOutput)
+	if !filepath.IsAbs(output) {
+		wd, _ := os.Getwd()
+		output = filepath.Join(wd, output)
+	}
+	return sampleOutput(output)
+}
+
+// scrapeAll runs numWorkers workers over the entries in jobs until all are
+// done, sending each product to results.
+func scrapeAll(client *http.Client, jobs jobQueue, numWorkers int, delay time.Duration, stats *timing.Stats, results chan<- Product, retryLater *entryList) {
+	var wg, tasks sync.WaitGroup
+
+	tasks.Add(jobs.len())
+	for i := range numWorkers {
+		wg.Add(1)
+		go worker(i+1, client, jobs, results, &wg, &tasks, delay, stats, retryLater)
+	}
+	go func() {
+		tasks.Wait()
+		jobs.end()
+	}()
+	wg.Wait()
+}
+
+// listEntries discovers the categories and collects the product URLs in them.
+func listEntries(client *http.Client, outputPath string, delay time.Duration, stats *timing.Stats) ([]productEntry, map[string]string, []Product, error) {
+	// Phase 1: discover categories
+	runStatus.Phase("categorias")
+	log.Printf("[CATS]   Obteniendo categorías...")
+	cats, err := loadCategories(client, outputPath)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error obteniendo categorías: %w", err)
+	}
+	cats, previous, err := selectCategories(cats, outputPath)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	runStatus.Categories(len(cats))
+	log.Printf("[CATS]   %d categorías:", len(cats))
+	names := categorias.Ordenadas(cats)
+	for _, name := range names {
+		log.Printf("[CATS]     %s → %s", name, cats[name])
+	}
+	fmt.Println()
+
+	// Phase 2: collect product URLs per category
+	runStatus.Phase("listado")
+	log.Printf("[LIST]   Recolectando URLs de productos...")
+	seen := make(map[string]int)
+	var allEntries []productEntry
+	addEntries := func(entries []productEntry) {
+		for _, e := range entries {
+			key := canonurl.Key(e.url)
+			if i, ok := seen[key]; ok {
+				if !slices.Contains(allEntries[i].categories, e.category) {
+					allEntries[i].categories = append(allEntries[i].categories, e.category)
+				}
+				continue
+			}
+			seen[key] = len(allEntries)
+			e.id = taskSeq.Next()
+			e.categories = []string{e.category}
+			allEntries = append(allEntries, e)
+		}
+	}
+	// -list-workers categories are listed at a time; their entries are added
+	// in category order all the same
+	listed := make([][]productEntry, len(names))
+	failedPages := make([]int, len(names))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range flagListWork {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				entries, failedPage := collectFromCategory(client, names[i], cats[names[i]], 1, flagFinalRetryWorkers > 0, delay, stats)
+				listed[i], failedPages[i] = entries, failedPage
+				if failedPage == 0 {
+					runStatus.CategoryDone()
+				}
+				time.Sleep(delay)
+			}
+		}()
+	}
+	for i := range names {
+		if storeBlock.Err() != nil {
+			break
+		}
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	var failedCats []failedListing
+	for i, name := range names {
+		addEntries(listed[i])
+		if failedPages[i] > 0 {
+			failedCats = append(failedCats, failedListing{name: name, url: cats[name], page: failedPages[i]})
+		}
+	}
+	if err := storeBlock.Err(); err != nil {
+		return nil, nil, nil, err
+	}
+	// Categories cut short by a failed page resume from it after a cool-down
+	if len(failedCats) > 0 {
+		log.Printf("[RETRY]  %d categorías con páginas fallidas; reintentando en %v", len(failedCats), flagFinalRetryCooldown)
+		time.Sleep(flagFinalRetryCooldown)
+		for _, c := range failedCats {
+			entries, _ := collectFromCategory(client, c.name, c.url, c.page, false, delay, stats)
+			addEntries(entries)
+			runStatus.CategoryDone()
+			time.Sleep(delay)
+		}
+	}
+	if err := storeBlock.Err(); err != nil {
+		return nil, nil, nil, err
+	}
+	log.Printf("[LIST]   %d URLs únicas", len(allEntries))
+	fmt.Println()
+
+	return allEntries, cats, previous, nil
+}
+
+// categoryFilter is the category selection of -categories,
+// -exclude-categories, -only-category-slug and -start-at-category.
+func categoryFilter() categorias.Filtro {
+	return categorias.ParseFiltro(flagCategories, flagExcludeCats).SoloSlug(flagOnlyCatSlug).Desde(flagStartAtCat)
+}
+
+// selectCategories applies categoryFilter to cats. A filtered run keeps the
+// products of the other categories from the previous output, which it also
+// returns; an unfiltered run returns none.
+func selectCategories(cats map[string]string, outputPath string) (map[string]string, []Product, error) {
+	filter := categoryFilter()
+	if !filter.Activo() {
+		return cats, nil, nil
+	}
+	selected, unknown := filter.Aplicar(cats)
+	for _, name := range unknown {
+		log.Printf("[WARN]   Ninguna categoría coincide con %q", name)
+	}
+	if len(selected) == 0 {
+		return nil, nil, fmt.Errorf("ninguna categoría pasa los filtros de categorías")
+	}
+	log.Printf("[CATS]   %d de %d categorías seleccionadas", len(selected), len(cats))
+	previous, err := producto.ReadJSON(outputPath)
+	if err != nil {
+		log.Printf("[WARN]   Sin salida anterior: la salida tendrá solo las categorías seleccionadas")
+	}
+	return selected, previous, nil
+}
+
+func run(numWorkers int, delay time.Duration, outputPath string) error {
+	client := auditLog.Client(httpTransport, 30*time.Second)
+	stats := timing.New()
+
+	dq, err := openQueue(outputPath)
+	if err != nil {
+		return err
+	}
+	if dq != nil {
+		defer dq.Close()
+	}
+
+	// Entries left in the disk queue by an interrupted run are resumed
+	// without listing the categories again
+	resumed := dq != nil && dq.Len() > 0
+	var allEntries []productEntry
+	var cats map[string]string
+	var previous []Product
+	if resumed {
+		log.Printf("[QUEUE]  Reanudando %d productos pendientes de una corrida interrumpida", dq.Len())
+		if categoryFilter().Activo() {
+			log.Printf("[WARN]   Al reanudar no se conservan los productos de las categorías no seleccionadas")
+		}
+	} else if allEntries, cats, previous, err = listEntries(client, outputPath, delay, stats); err != nil {
+		return err
+	}
+
+	sp, recovered, err := openSpill(outputPath)
+	if err != nil {
+		return err
+	}
+	defer sp.Close()
+
+	// Products recovered from an interrupted run's spill are not fetched again
+	var products []Product
+	if resumed {
+		products = recovered
+		if sp == nil {
+			log.Printf("[WARN]   Sin spill (-spill-interval 0): los productos ya scrapeados no se recuperan")
+		}
+	} else if len(recovered) > 0 {
+		byLink := make(map[string]Product, len(recovered))
+		for _, p := range recovered {
+			byLink[p.Link] = p
+		}
+		pending := allEntries[:0]
+		for _, e := range allEntries {
+			if p, ok := byLink[e.url]; ok {
+				products = append(products, p)
+				continue
+			}
+			pending = append(pending, e)
+		}
+		log.Printf("[SPILL]  %d productos ya recuperados; quedan %d por scrapear", len(products), len(pending))
+		allEntries = pending
+	}
+
+	// Phase 3: scrape detail pages with worker pool
+	runStatus.Phase("detalle")
+	if flagShallow {
+		log.Printf("[SHALLOW] %d productos armados del listado, sin páginas de detalle", len(allEntries))
+	} else {
+		log.Printf("[START]  %d workers scraping detalle...", numWorkers)
+	}
+	var jobs jobQueue
+	if dq != nil {
+		jobs = diskQueue{dq}
+		for _, e := range allEntries {
+			if err := jobs.push(e); err != nil {
+				return err
+			}
+		}
+	} else {
+		jobs = newChanQueue(allEntries)
+	}
+	results := make(chan Product, 100)
+
+	// Scrape, then give the products that exhausted their retries one more
+	// chance at low concurrency after a cool-down, before closing results
+	go func() {
+		defer close(results)
+		if flagShallow {
+			listedProducts(allEntries, results)
+			return
+		}
+		var retryLater *entryList
+		if flagFinalRetryWorkers > 0 {
+			retryLater = &entryList{}
+		}
+		scrapeAll(client, jobs, numWorkers, delay, stats, results, retryLater)
+		if retryLater == nil || len(retryLater.entries) == 0 || storeBlock.Err() != nil {
+			return
+		}
+
+		failed := retryLater.entries
+		runStatus.Phase("reintentos")
+		log.Printf("[RETRY]  %d productos fallidos; pasada final con %d worker(s) en %v", len(failed), flagFinalRetryWorkers, flagFinalRetryCooldown)
+		time.Sleep(flagFinalRetryCooldown)
+		for i := range failed {
+			failed[i].id = taskSeq.Next()
+		}
+		scrapeAll(client, newChanQueue(failed), flagFinalRetryWorkers, delay, stats, results, nil)
+	}()
+
+	counts := make(map[string]int)
+	for _, p := range products {
+		counts[p.Categoria]++
+	}
+	for p := range results {
+		sp.Add(p)
+		products = append(products, p)
+		counts[p.Categoria]++
+		runStatus.Products(len(products))
+	}
+	if previous != nil {
+		scraped := len(products)
+		products = categorias.Conservar(products, previous, cats)
+		log.Printf("[CATS]   %d productos de otras categorías conservados de la salida anterior", len(products)-scraped)
+	}
+
+	outputOrder.Ordenar(products)
+
+	fmt.Println()
+	log.Printf("[RESUMEN] ─────────────────────────────")
+	for cat, n := range counts {
+		log.Printf("[RESUMEN] %s: %d productos", cat, n)
+	}
+	log.Printf("[RESUMEN] ─────────────────────────────")
+	log.Printf("[RESUMEN] Total: %d productos", len(products))
+	if n := panics.Load(); n > 0 {
+		log.Printf("[RESUMEN] Panics recuperados: %d", n)
+	}
+	if n := stuck.Load(); n > 0 {
+		log.Printf("[RESUMEN] Tareas atascadas canceladas: %d", n)
+	}
+	if n := filtered.Load(); n > 0 {
+		log.Printf("[RESUMEN] Descartados por el filtro de productos: %d", n)
+	}
+	if n := blocked.Load(); n > 0 {
+		log.Printf("[RESUMEN] Excluidos por la lista de bloqueo: %d", n)
+	}
+	if lines := stats.Summary(); lines != nil {
+		log.Printf("[RESUMEN] ─────────────────────────────")
+		for _, line := range lines {
+			log.Printf("[RESUMEN] %s", line)
+		}
+	}
+
+	if err := storeBlock.Err(); err != nil {
+		return savePartial(products, outputPath, err)
+	}
+	checkLinks(client, products)
+	if err := warnBudget.Check(); err != nil {
+		return savePartial(products, outputPath, err)
+	}
+
+	runStatus.Phase("escritura")
+	products = prepareOutput(products)
+	unchanged := previousHash != "" && producto.Hash(outputFields.Recortar(products)) == previousHash
+	if unchanged {
+		log.Printf("[WRITE]  Sin cambios: se conserva la salida anterior")
+		signOutput(outputPath)
+	} else if err := writeJSON(products, outputPath); err != nil {
+		return savePartial(products, outputPath, err)
+	} else {
+		writeMeta(products, outputPath)
+	}
+	os.Remove(producto.PartialPath(outputPath))
+	if err := sp.Done(); err != nil {
+		log.Printf("[WARN]   No se pudo borrar el spill: %v", err)
+	}
+	if dq != nil {
+		if err := dq.Remove(); err != nil {
+			log.Printf("[WARN]   No se pudo borrar la cola: %v", err)
+		}
+	}
+
+	if flagWhatsApp != "" && !unchanged {
+		if err := producto.WriteWhatsAppCSV(products, flagWhatsApp, "MXN", "my-shop.mx"); err != nil {
+			return fmt.Errorf("error escribiendo CSV de WhatsApp: %w", err)
+		}
+		log.Printf("[WRITE]  CSV de WhatsApp escrito: %s", flagWhatsApp)
+	}
+
+	return nil
+}
+
+// reportChanges tells whether the output differs from the previous run's. It
+// also passes the answer to GitHub Actions as the step outputs "cambios" and
+// "hash", so the workflow only commits a catalog that changed.
+func reportChanges(output string) bool {
+	hash := ""
+	if current, err := producto.ReadJSON(output); err == nil {
+		hash = producto.Hash(current)
+	}
+	changed := hash == "" || hash != previousHash
+	if !changed {
+		log.Printf("[FIN]    Sin cambios respecto a la corrida anterior (hash %.12s)", hash)
+	}
+	if fpath := os.Getenv("GITHUB_OUTPUT"); fpath != "" {
+		f, err := os.OpenFile(fpath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err == nil {
+			fmt.Fprintf(f, "cambios=%t\nhash=%s\n", changed, hash)
+			f.Close()
+		}
+	}
+	return changed
+}
+
+// writeChangelog compares the freshly written output against the previous run
+// and writes CAMBIOS-<fecha>.md into the -cambios-dir directory.
+func writeChangelog(previous []Product, output string) error {
+	current, err := producto.ReadJSON(output)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	fpath := producto.ChangelogPath(flagCambios, now)
+	if err := producto.WriteChangelog(producto.Compare(previous, current), fpath, "my-shop.mx", now, runID); err != nil {
+		return err
+	}
+	log.Printf("[WRITE]  Changelog escrito: %s", fpath)
+	return nil
+}
+
+// writeHistory appends the run's row to -runs-history. Sample and
+// -changed-since runs, whose output is not the catalog, add none.
+func writeHistory(previous []Product, output string, elapsed time.Duration, runErr error) {
+	if flagSample > 0 || changedSince != nil {
+		return
+	}
+	fpath := flagHistory
+	if fpath == "" {
+		fpath = historial.Ruta(output)
+	}
+	c := historial.Corrida{Fecha: now(), Tienda: "myshop", ID: runID, Modo: runMode(), Errores: warnBudget.Errores(), Duracion: elapsed, Err: runErr}
+	if runErr == nil {
+		current, err := producto.ReadJSON(output)
+		if err != nil {
+			log.Printf("[ERROR]  Error escribiendo historial: %v", err)
+			return
+		}
+		c.Resumir(previous, current)
+	}
+	if err := historial.Agregar(fpath, c); err != nil {
+		log.Printf("[ERROR]  Error escribiendo historial: %v", err)
+	}
+}
+
+// writeFacets writes facets.json for the output when the catalog changed or
+// the file does not exist yet.
+func writeFacets(output string, changed bool) error {
+	fpath := flagFacets
+	if fpath == "" {
+		fpath = producto.FacetsPath(output)
+	}
+	if _, err := os.Stat(fpath); err == nil && !changed {
+		return nil
+	}
+	products, err := producto.ReadJSON(output)
+	if err != nil {
+		return err
+	}
+	if err := producto.WriteFacets(products, fpath, time.Now()); err != nil {
+		return err
+	}
+	log.Printf("[WRITE]  Facetas escritas: %s", fpath)
+	return nil
+}
+
+// writeSimilares writes similares.json for the output when the catalog
+// changed or the file does not exist yet.
+func writeSimilares(output string, changed bool) error {
+	if flagSimilaresN <= 0 {
+		return nil
+	}
+	fpath := flagSimilares
+	if fpath == "" {
+		fpath = match.SimilaresPath(output)
+	}
+	if _, err := os.Stat(fpath); err == nil && !changed {
+		return nil
+	}
+	products, err := producto.ReadJSON(output)
+	if err != nil {
+		return err
+	}
+	if err := match.WriteSimilares(products, flagSimilaresN, fpath, time.Now()); err != nil {
+		return err
+	}
+	log.Printf("[WRITE]  Similares escritos: %s", fpath)
+	return nil
+}
+
+// publishMetrics records the per-category product counts of the output and
+// writes or pushes the run's metrics, if configured.
+func publishMetrics(output string, ok bool, elapsed time.Duration) {
+	if flagMetricsFile == "" && flagPushgateway == "" {
+		return
+	}
+	if products, err := producto.ReadJSON(output); err == nil {
+		counts := make(map[string]int)
+		for _, p := range products {
+			counts[p.Categoria]++
+		}
+		for cat, n := range counts {
+			scrapeMetrics.Products.Set(float64(n), cat)
+		}
+	}
+	scrapeMetrics.RunInfo.Set(1, runID)
+	if err := scrapeMetrics.Publish(flagMetricsFile, flagPushgateway, "catalogo-myshop", ok, elapsed); err != nil {
+		log.Printf("[ERROR]  %v", err)
+	}
+}
+
+// runMode names the kind of run selected by the flags.
+func runMode() string {
+	switch {
+	case flagWatch != "":
+		return "watch"
+	case flagQuick:
+		return "quick"
+	}
+	return "full"
+}
+
+// shutdownTracer exports the spans still buffered, if tracing is enabled.
+func shutdownTracer() {
+	if err := tracer.Shutdown(); err != nil {
+		log.Printf("[ERROR]  %v", err)
+	}
+}
+
+// openSpill starts checkpointing collected products for a full run and
+// returns the ones recovered from an interrupted run, if any.
+// openQueue opens the disk queue when -disk-queue is set; it returns nil
+// otherwise.
+func openQueue(outputPath string) (*diskq.Queue[queuedEntry], error) {
+	if !flagDiskQueue {
+		return nil, nil
+	}
+	fpath := flagQueueFile
+	if fpath == "" {
+		fpath = diskq.DefaultPath(outputPath)
+	}
+	q, err := diskq.Open[queuedEntry](fpath)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[QUEUE]  Cola en disco: %s", fpath)
+	return q, nil
+}
+
+func openSpill(outputPath string) (*spill.Spill, []Product, error) {
+	if flagSpillInterval <= 0 {
+		return nil, nil, nil
+	}
+	fpath := flagSpillFile
+	if fpath == "" {
+		fpath = spill.DefaultPath(outputPath)
+	}
+	sp, recovered, err := spill.Open(fpath, flagSpillInterval)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(recovered) > 0 {
+		log.Printf("[SPILL]  %d productos recuperados de una corrida interrumpida (%s)", len(recovered), fpath)
+	}
+	return sp, recovered, nil
+}
+
+// setupLogging applies -quiet to the console and tees the full log into
+// -log-file when set, masking the secrets in both.
+func setupLogging() error {
+	var console io.Writer = os.Stderr
+	if flagQuiet {
+		console = logfile.Only(os.Stderr, "[RESUMEN]", "[FIN]", "[FATAL]", "[TLS]")
+	}
+	if flagLogFile == "" {
+		log.SetOutput(secretos.Filtrar(console))
+		return nil
+	}
+	f, err := logfile.Open(flagLogFile, int64(flagLogMaxMB)<<20, flagLogBackups)
+	if err != nil {
+		return err
+	}
+	// The file spans many runs, so its lines carry the date too
+	log.SetFlags(log.Ldate | log.Ltime | log.Lmsgprefix)
+	log.SetOutput(secretos.Filtrar(io.MultiWriter(console, f)))
+	return nil
+}
+
+// tagRules derive each product's EtiquetasDerivadas, from the -config file.
+var tagRules etiquetas.Reglas
+
+// converter adds the -convert-to prices; nil without the flag.
+var converter *divisas.Conversor
+
+// storeIVA says whether the store's prices include IVA, from the -config
+// file.
+var storeIVA impuestos.IVA
+
+// shipping is the store's free-shipping threshold and rates, from the
+// -config file.
+var shipping envio.Regla
+
+// displayPrice is the store's rounding policy for precioPublico, from the
+// -config file.
+var displayPrice redondeo.Politica
+
+// storeHooks is the store's transform hook, from the -config file.
+var storeHooks hooks.Hooks
+
+// imageRules rewrite the image URLs of the output, from the -config file.
+var imageRules imagenes.Reglas
+
+// storeZone is the store's time zone, from the -config file, for the
+// output's timestamps; previousOutput is the output found at start, whose
+// products keep their UltimaActualizacion when unchanged.
+var (
+	storeZone      *time.Location
+	previousOutput []Product
+)
+
+// now is the current time in the store's zone, to the second.
+func now() time.Time {
+	return time.Now().In(storeZone).Truncate(time.Second)
+}
+
+// writeMeta writes the output's productos.meta.json after it was written,
+// and signs it.
+func writeMeta(products []Product, outputPath string) {
+	m := producto.Meta{Tienda: "myshop", GeneradoEn: now(), Productos: len(products)}
+	if err := producto.WriteMeta(outputPath, m); err != nil {
+		log.Printf("[WARN]   No se pudo escribir %s: %v", producto.MetaPath(outputPath), err)
+	}
+	signOutput(outputPath)
+}
+
+// signKey is the -sign key; nil leaves the output unsigned.
+var signKey ed25519.PrivateKey
+
+// signOutput writes the output's signature with -sign. One that cannot be
+// written is removed rather than left stale, so the site rejects the
+// output instead of trusting an old signature.
+func signOutput(outputPath string) {
+	if signKey == nil {
+		return
+	}
+	if err := firma.Firmar(signKey, outputPath); err != nil {
+		log.Printf("[WARN]   No se pudo firmar la salida: %v", err)
+		os.Remove(firma.Ruta(outputPath))
+	}
+}
+
+// changedSince is the -changed-since snapshot; when set, the output holds
+// only what changed since it.
+var changedSince []Product
+
+// prepareOutput applies the derived tags, the prices with and without IVA,
+// the shipping estimate, the display price, the transform hook,
+// -price-cents, -convert-to, the time of each product's last change and
+// -changed-since to the products about to be written as the output.
+func prepareOutput(products []Product) []Product {
+	tagRules.Aplicar(products)
+	storeIVA.Aplicar(products)
+	shipping.Aplicar(products)
+	displayPrice.Aplicar(products)
+	if transformed, err := storeHooks.Transformar(context.Background(), products); err != nil {
+		log.Printf("[WARN]   %v; se escriben los productos sin transformar", err)
+	} else {
+		products = transformed
+	}
+	imageRules.Aplicar(products)
+	divisas.Centavos(products, flagPriceCents)
+	producto.Sellar(products, previousOutput, outputFields, now())
+	if err := converter.Aplicar(context.Background(), products); err != nil {
+		log.Printf("[WARN]   -convert-to: %v", err)
+	}
+	if changedSince == nil {
+		return products
+	}
+	delta := producto.Cambiados(changedSince, outputFields.Recortar(products))
+	log.Printf("[DELTA]  %d de %d productos nuevos o cambiados desde %s", len(delta), len(products), flagSnapshot)
+	return delta
+}
+
+// outputFields are the product fields -fields keeps in the output; nil is
+// all of them.
+var outputFields producto.Campos
+
+// outputSchema names the output's fields (-schema); nil is the Spanish
+// schema.
+var outputSchema producto.Esquema
+
+// outputOrder is the order of the output's products (-sort).
+var outputOrder producto.Orden
+
+// sampleOutput is where a -sample run writes when -output is not given:
+// productos.sample.json next to the real output, which a smoke test must not
+// replace.
+func sampleOutput(output string) string {
+	explicit := false
+	flag.Visit(func(f *flag.Flag) { explicit = explicit || f.Name == "output" })
+	if flagSample <= 0 || explicit {
+		return output
+	}
+	return strings.TrimSuffix(output, ".json") + ".sample.json"
+}
+
+// politeness are the -politeness presets for my-shop.mx, whose HTML
+// product pages are heavier and served by Odoo itself, so each preset is
+// gentler than BuyTiti's.
+var politeness = cortesia.Presets{
+	"gentle":     {"workers": "1", "list-workers": "1", "delay": "3s", "backoff": "10s", "max-bandwidth": "256KB/s"},
+	"normal":     {"workers": "3", "list-workers": "1", "delay": "500ms", "backoff": "2s", "max-bandwidth": ""},
+	"aggressive": {"workers": "6", "list-workers": "2", "delay": "200ms", "backoff": "1s", "max-bandwidth": ""},
+}
+
+func main() {
+	flag.Parse()
+	if err := politeness.Aplicar(flag.CommandLine, flagPoliteness); err != nil {
+		log.Fatalf("[FATAL]  -politeness: %v", err)
+	}
+	if flagDetailWork <= 0 {
+		flagDetailWork = flagWorkers
+	}
+	if flagListWork < 1 || flagDetailWork < 1 {
+		log.Fatalf("[FATAL]  -list-workers y -detail-workers deben ser al menos 1")
+	}
+	rate, err := budget.ParseRate(flagMaxErrorRate)
+	if err != nil {
+		log.Fatalf("[FATAL]  -max-error-rate: %v", err)
+	}
+	warnBudget.MaxWarnings, warnBudget.MaxErrorRate = flagMaxWarnings, rate
+	if linkSample, err = enlaces.ParseMuestra(flagCheckLinks); err != nil {
+		log.Fatalf("[FATAL]  -check-links: %v", err)
+	}
+	productFilter, err = producto.NewFiltro(flagMatchName, flagMinPrice, flagMaxPrice, flagOnlyOnSale)
+	if err != nil {
+		log.Fatalf("[FATAL]  %v", err)
+	}
+	productFilter.SoloDisponibles = flagInStock && !flagOutOfStock
+	if outputFields, err = producto.ParseCampos(flagFields); err != nil {
+		log.Fatalf("[FATAL]  -fields: %v", err)
+	}
+	if outputSchema, err = producto.ParseEsquema(flagSchema); err != nil {
+		log.Fatalf("[FATAL]  -schema: %v", err)
+	}
+	if outputOrder, err = producto.ParseOrden(flagSort); err != nil {
+		log.Fatalf("[FATAL]  -sort: %v", err)
+	}
+	if flagSnapshot != "" {
+		if changedSince, err = producto.ReadJSON(flagSnapshot); err != nil {
+			log.Fatalf("[FATAL]  -changed-since: %v", err)
+		}
+	}
+	if priceFormat, err = producto.ParseFormato(flagPriceLocale); err != nil {
+		log.Fatalf("[FATAL]  -price-locale: %v", err)
+	}
+	if tagRules, err = etiquetas.Leer(flagConfig); err != nil {
+		log.Fatalf("[FATAL]  %v", err)
+	}
+	if storeZone, err = tienda.LeerZona(flagConfig, "myshop"); err != nil {
+		log.Fatalf("[FATAL]  %v", err)
+	}
+	if storeIVA, err = impuestos.Leer(flagConfig, "myshop"); err != nil {
+		log.Fatalf("[FATAL]  %v", err)
+	}
+	if shipping, err = envio.Leer(flagConfig, "myshop"); err != nil {
+		log.Fatalf("[FATAL]  %v", err)
+	}
+	if displayPrice, err = redondeo.Leer(flagConfig, "myshop"); err != nil {
+		log.Fatalf("[FATAL]  %v", err)
+	}
+	if storeHooks, err = hooks.Leer(flagConfig, "myshop"); err != nil {
+		log.Fatalf("[FATAL]  %v", err)
+	}
+	if imageRules, err = imagenes.Leer(flagConfig, "myshop"); err != nil {
+		log.Fatalf("[FATAL]  %v", err)
+	}
+	if flagSign != "" {
+		if signKey, err = firma.LeerPrivada(flagSign); err != nil {
+			log.Fatalf("[FATAL]  -sign: %v", err)
+		}
+	}
+	tlsTransport, err := transporte.TLS(flagCACert, flagInsecure)
+	if err != nil {
+		log.Fatalf("[FATAL]  -ca-cert: %v", err)
+	}
+	bandwidth, err := transporte.ParseAnchoBanda(flagBandwidth)
+	if err != nil {
+		log.Fatalf("[FATAL]  -max-bandwidth: %v", err)
+	}
+	limiter := transporte.NewLimitador(bandwidth)
+	domains, err := transporte.LeerDominios(flagConfig, "myshop", siteDomain)
+	if err != nil {
+		log.Fatalf("[FATAL]  %v", err)
+	}
+	// A link or redirect on a scraped page must not send the scraper to an
+	// arbitrary host
+	guarded := transporte.Restringir(tlsTransport, domains, func(req *http.Request) {
+		log.Printf("[DOMINIO] Rechazada la petición a %s: fuera de %s", req.URL, strings.Join(domains, ", "))
+	})
+	httpTransport = transporte.Limitar(guarded, limiter)
+	if flagFixtures != "" {
+		if recorder, err = fixtures.Grabar(httpTransport, flagFixtures, flagFixturesN); err != nil {
+			log.Fatalf("[FATAL]  -record-fixtures: %v", err)
+		}
+		httpTransport = recorder
+	}
+	if flagConvertTo != "" {
+		fxTransport := transporte.Limitar(tlsTransport, limiter)
+		fx, err := divisas.ParseFuente(flagFXSource, &http.Client{Timeout: 30 * time.Second, Transport: fxTransport})
+		if err != nil {
+			log.Fatalf("[FATAL]  -fx-source: %v", err)
+		}
+		if converter, err = divisas.NewConversor(context.Background(), flagConvertTo, fx); err != nil {
+			log.Fatalf("[FATAL]  -convert-to: %v", err)
+		}
+		log.Printf("[FX]     1 %s = %.4f %s (%s)", converter.Moneda, converter.TipoCambio, divisas.Base, converter.Fuente)
+	}
+	if variantMode, err = producto.ModoVariantes(flagExpandVars, flagParentsOnly); err != nil {
+		log.Fatalf("[FATAL]  %v", err)
+	}
+	if flagShallow && (flagExpandVars || flagLangEN != "" || flagDiskQueue) {
+		log.Fatalf("[FATAL]  -shallow solo lee el listado: no admite -expand-variants, -lang-en ni -disk-queue")
+	}
+	if flagBlocklist != "" {
+		if blocklist, err = producto.LeerBloqueo(flagBlocklist); err != nil {
+			log.Fatalf("[FATAL]  %v", err)
+		}
+	}
+	runID = flagRunID
+	if runID == "" {
+		runID = runid.FromEnv()
+	}
+	log.SetFlags(log.Ltime | log.Lmsgprefix)
+	log.SetPrefix(runid.Short(runID) + " ")
+	if err := setupLogging(); err != nil {
+		log.Fatalf("[FATAL]  %v", err)
+	}
+
+	output := resolveOutput()
+
+	log.Printf("[CONFIG] Corrida: %s", runID)
+	log.Printf("[CONFIG] Output:  %s", output)
+	log.Printf("[CONFIG] Workers: %d de listado, %d de detalle", flagListWork, flagDetailWork)
+	log.Printf("[CONFIG] Delay:   %v", flagDelay)
+	log.Printf("[CONFIG] Preset:  %s", flagPoliteness)
+	if flagCACert != "" {
+		log.Printf("[CONFIG] CA:      %s", flagCACert)
+	}
+	if flagBandwidth != "" {
+		log.Printf("[CONFIG] Límite:  %s", flagBandwidth)
+	}
+	if flagInsecure {
+		log.Printf("[TLS]    ¡ATENCIÓN! -insecure-skip-verify: los certificados TLS NO se verifican; cualquiera en la red puede suplantar al sitio y alterar los precios. Úsalo solo para pruebas")
+	}
+	fmt.Println()
+
+	// -dump-categories only discovers the categories, without the output's
+	// lock: it neither reads nor writes the catalog
+	if flagDumpCats != "" {
+		if err := dumpCategories(auditLog.Client(httpTransport, 30*time.Second), flagDumpCats); err != nil {
+			log.Fatalf("[FATAL]  %v", err)
+		}
+		return
+	}
+
+	// Spread scheduled runs over a window instead of hitting the site at the exact cron minute
+	if flagJitter > 0 {
+		wait := rand.N(flagJitter)
+		log.Printf("[JITTER] Esperando %v antes de empezar", wait.Round(time.Second))
+		time.Sleep(wait)
+	}
+
+	// Refuse to start if another run (e.g. an overlapping cron) writes the same output
+	lock, err := lockfile.Acquire(output + ".lock")
+	if errors.Is(err, lockfile.ErrLocked) {
+		log.Fatalf("[FATAL]  Ya hay otra corrida escribiendo %s: %v", output, err)
+	} else if err != nil {
+		log.Fatalf("[FATAL]  %v", err)
+	}
+	defer lock.Release()
+
+	if flagAuditLog != "" {
+		if auditLog, err = audit.Open(flagAuditLog, runID); err != nil {
+			log.Fatalf("[FATAL]  %v", err)
+		}
+		defer auditLog.Close()
+		log.Printf("[CONFIG] Audit log: %s", flagAuditLog)
+	}
+	runStatus = status.Start(flagStatusFile, "myshop", runID, flagStatusInterval)
+
+	// Snapshot of the previous output, compared against at the end of the run
+	previous, prevErr := producto.ReadJSON(output)
+	if prevErr == nil {
+		previousOutput = previous
+		previousHash = producto.Hash(previous)
+	} else if flagCambios != "" {
+		log.Printf("[WARN]   Sin salida anterior para el changelog: %v", prevErr)
+	}
+
+	tracer = tracing.New(flagOTLP, "catalogo-myshop")
+	runSpan := tracer.StartRun("scrape", "catalogo.run_id", runID, "catalogo.modo", runMode(), "catalogo.workers", flagDetailWork)
+	watch = watchdog.New(flagStuckTimeout, func(worker int, label string, running time.Duration) {
+		stuck.Add(1)
+		log.Printf("[STUCK]  W%d lleva %v en %s; cancelando la tarea", worker, running.Round(time.Second), label)
+	})
+	if flagResolveRedirects {
+		resolver = canonurl.NewResolver(auditLog.Client(httpTransport, 30*time.Second))
+	}
+	start := time.Now()
+	switch {
+	case flagWatch != "":
+		err = runWatch(flagWatch, output)
+	case flagQuick:
+		err = refreshOutput("QUICK", nil, output)
+	default:
+		err = run(flagDetailWork, flagDelay, output)
+	}
+	watch.Stop()
+	runSpan.End(err)
+	shutdownTracer()
+	runStatus.Finish(err)
+	if err != nil {
+		publishMetrics(output, false, time.Since(start))
+		writeHistory(previous, output, time.Since(start), err)
+		log.Fatalf("[FATAL]  %v", err)
+	}
+	publishMetrics(output, true, time.Since(start))
+	writeHistory(previous, output, time.Since(start), nil)
+
+	changed := reportChanges(output)
+	// facets.json and similares.json sit next to the real output
+	if flagSample > 0 {
+		log.Printf("[SAMPLE] Muestra: sin changelog, facets ni similares")
+	} else if changedSince != nil {
+		log.Printf("[DELTA]  Salida con solo los cambios: sin changelog, facets ni similares")
+	} else {
+		if changed && flagCambios != "" && previous != nil {
+			if err := writeChangelog(previous, output); err != nil {
+				log.Printf("[ERROR]  Error escribiendo changelog: %v", err)
+			}
+		}
+		if err := writeFacets(output, changed); err != nil {
+			log.Printf("[ERROR]  Error escribiendo facets: %v", err)
+		}
+		if err := writeSimilares(output, changed); err != nil {
+			log.Printf("[ERROR]  Error escribiendo similares: %v", err)
+		}
+	}
+
+	if recorder != nil {
+		log.Printf("[FIN]    %d fixtures grabados en %s", recorder.Grabados(), flagFixtures)
+	}
 	log.Printf("[FIN]    Escrito en: %s", output)
 	log.Printf("[FIN]    Tiempo total: %v", time.Since(start).Round(time.Millisecond))
 }
@@ -0,0 +1,177 @@
+// ========== Búsqueda en el navegador ==========
+// Busca en el índice que escribe `catalogo index -web indice-web.json`, sin
+// descargar los catálogos. El análisis de texto replica al de Go
+// (catalogo/texto y catalogo/indice): si cambia allá, hay que cambiarlo aquí.
+
+const UNACCENT = { 'á': 'a', 'é': 'e', 'í': 'i', 'ó': 'o', 'ú': 'u', 'ü': 'u', 'ñ': 'n',
+    'à': 'a', 'è': 'e', 'ì': 'i', 'ò': 'o', 'ù': 'u', 'ç': 'c' };
+const SLASH_ABBREV = { p: 'para ', c: 'con ', s: 'sin ' };
+const GLUED = /^(\d+(?:\.\d+)?)(ml|l|lt|lts|g|gr|grs|kg|m|mt|mts|cm|mm|pz|pzs|pza|pzas|piezas|pack)$/;
+const LETTER_OR_DIGIT = /[\p{L}\p{Nd}]/u;
+const DIGIT = /\p{Nd}/u;
+
+const BM25_K1 = 1.2;
+const BM25_B = 0.75;
+const PREFIX_WEIGHT = 0.5;
+
+function unescapeEntities(s) {
+    return s
+        .replace(/&#(\d+);/g, (_, n) => String.fromCodePoint(Number(n)))
+        .replace(/&#x([0-9a-f]+);/gi, (_, n) => String.fromCodePoint(parseInt(n, 16)))
+        .replace(/&quot;/g, '"').replace(/&#39;/g, "'").replace(/&lt;/g, '<').replace(/&gt;/g, '>')
+        .replace(/&amp;/g, '&');
+}
+
+// Same as texto.Words
+function words(s, abbreviations) {
+    s = unescapeEntities(s).toLowerCase().replace(/[áéíóúüñàèìòùç]/g, c => UNACCENT[c]);
+    s = s.replace(/\b([pcs])\/\s*/g, (_, c) => SLASH_ABBREV[c]);
+
+    const chars = Array.from(s);
+    let clean = '';
+    chars.forEach((c, i) => {
+        if (LETTER_OR_DIGIT.test(c)) {
+            clean += c;
+        } else if ((c === '.' || c === ',') && i > 0 && i + 1 < chars.length && DIGIT.test(chars[i - 1]) && DIGIT.test(chars[i + 1])) {
+            clean += '.';
+        } else {
+            clean += ' ';
+        }
+    });
+
+    const expand = w => abbreviations[w] || w;
+    const out = [];
+    clean.split(/\s+/).filter(Boolean).forEach(w => {
+        const m = w.match(GLUED);
+        // Except "5g", which names a network, not five grams
+        if (m && (m[2] !== 'g' || m[1].length > 1)) {
+            out.push(m[1], expand(m[2]));
+        } else {
+            out.push(expand(w));
+        }
+    });
+    return out;
+}
+
+// Same as indice.stem
+function stem(w) {
+    if (w.length <= 3 || /[0-9]/.test(w)) return w;
+    if (w.endsWith('ces')) return w.slice(0, -3) + 'z';
+    if (w.endsWith('s')) w = w.slice(0, -1);
+    if (w.length > 3 && 'aeo'.includes(w[w.length - 1])) w = w.slice(0, -1);
+    return w;
+}
+
+// Crea un buscador a partir del índice ya parseado.
+function crearBuscador(indice) {
+    if (indice.formato !== 1) {
+        throw new Error(`Formato de índice ${indice.formato} no soportado`);
+    }
+    const abbreviations = indice.analizador.abreviaturas;
+    const stopwords = new Set(indice.analizador.vacias);
+    const sorted = Object.keys(indice.terminos).sort();
+    const avgLength = indice.largos.reduce((a, b) => a + b, 0) / (indice.largos.length || 1);
+    const precioAt = indice.guardados.indexOf('precio');
+
+    const synonyms = indice.analizador.sinonimos || {};
+    const terms = s => words(s, abbreviations).filter(w => !stopwords.has(w)).map(stem).map(t => synonyms[t] || t);
+
+    function withPrefix(t) {
+        let lo = 0, hi = sorted.length;
+        while (lo < hi) {
+            const mid = (lo + hi) >> 1;
+            if (sorted[mid] < t) lo = mid + 1; else hi = mid;
+        }
+        const out = [];
+        for (let i = lo; i < sorted.length && sorted[i].startsWith(t); i++) out.push(sorted[i]);
+        return out;
+    }
+
+    function result(doc, score) {
+        const d = { puntaje: score };
+        indice.guardados.forEach((name, i) => { d[name] = indice.docs[doc][i]; });
+        return d;
+    }
+
+    // Devuelve hasta `limite` productos con todos los términos de `q`, los
+    // más relevantes primero. La última palabra también cuenta como prefijo
+    // mientras se escribe.
+    function buscar(q, limite = 20) {
+        const qterms = terms(q);
+        if (qterms.length === 0) return [];
+        const qwords = words(q, abbreviations);
+        const prefix = !q.endsWith(' ') && !stopwords.has(qwords[qwords.length - 1]);
+
+        const n = indice.docs.length;
+        const scores = new Map();
+        const hits = new Map();
+        qterms.forEach((t, i) => {
+            const variants = prefix && i === qterms.length - 1 ? withPrefix(t) : [t];
+            const seen = new Set();
+            variants.forEach(v => {
+                const postings = indice.terminos[v] || [];
+                const df = postings.length / 2;
+                let idf = Math.log(1 + (n - df + 0.5) / (df + 0.5));
+                if (v !== t) idf *= PREFIX_WEIGHT;
+                for (let j = 0; j < postings.length; j += 2) {
+                    const doc = postings[j], tf = postings[j + 1];
+                    const norm = 1 - BM25_B + BM25_B * indice.largos[doc] / avgLength;
+                    scores.set(doc, (scores.get(doc) || 0) + idf * tf * (BM25_K1 + 1) / (tf + BM25_K1 * norm));
+                    if (!seen.has(doc)) {
+                        seen.add(doc);
+                        hits.set(doc, (hits.get(doc) || 0) + 1);
+                    }
+                }
+            });
+        });
+
+        const results = [];
+        scores.forEach((score, doc) => {
+            if (hits.get(doc) === qterms.length) results.push([doc, Math.round(score * 1000) / 1000]);
+        });
+        results.sort((a, b) => {
+            if (a[1] !== b[1]) return b[1] - a[1];
+            if (precioAt >= 0) {
+                const pa = indice.docs[a[0]][precioAt], pb = indice.docs[b[0]][precioAt];
+                if (pa !== pb) return pa - pb;
+            }
+            return a[0] - b[0];
+        });
+        return results.slice(0, limite).map(([doc, score]) => result(doc, score));
+    }
+
+    return { buscar, productos: indice.docs.length, creado: indice.creado };
+}
+
+// Crea un sugeridor para autocompletar a partir de las sugerencias de
+// `catalogo index -sugerencias`, con el mismo orden que /api/sugerir.
+function crearSugeridor(datos, abbreviations = {}) {
+    const entries = datos.sugerencias.map(s => ({ ...s, words: words(s.texto, abbreviations) }));
+
+    // Devuelve hasta `limite` nombres y categorías con una palabra que
+    // empieza con cada palabra de `q`.
+    function sugerir(q, limite = 8) {
+        const qwords = words(q, abbreviations);
+        if (qwords.length === 0) return [];
+        const found = entries
+            .filter(e => qwords.every(p => e.words.some(w => w.startsWith(p))))
+            .map(e => ({ e, starts: e.words[0].startsWith(qwords[0]) }));
+        found.sort((a, b) => {
+            if (a.starts !== b.starts) return a.starts ? -1 : 1;
+            if (a.e.tipo !== b.e.tipo) return a.e.tipo === 'categoria' ? -1 : 1;
+            if (a.e.productos !== b.e.productos) return b.e.productos - a.e.productos;
+            if (a.e.texto.length !== b.e.texto.length) return a.e.texto.length - b.e.texto.length;
+            return a.e.texto < b.e.texto ? -1 : 1;
+        });
+        return found.slice(0, limite).map(({ e }) => ({ texto: e.texto, tipo: e.tipo, productos: e.productos }));
+    }
+
+    return { sugerir };
+}
+
+// Descarga el índice de `url` y crea su buscador.
+async function cargarBuscador(url) {
+    const response = await fetch(url);
+    if (!response.ok) throw new Error('No se pudo cargar el índice de búsqueda');
+    return crearBuscador(await response.json());
+}
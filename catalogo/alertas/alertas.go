@@ -0,0 +1,176 @@
+// Package alertas evaluates a watch list of products with target prices
+// against every store's catalog and reports the offers that reach them.
+package alertas
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"catalogo/canonurl"
+	"catalogo/match"
+)
+
+// Item is one entry of watchlist.yaml: a product, named as match.Ref does,
+// and its target price.
+type Item struct {
+	Nombre string `json:"nombre"`
+	match.Ref
+	PrecioObjetivo float64 `json:"precioObjetivo"`
+}
+
+// Label names the item in alerts: its nombre, or the identifier it uses.
+func (it Item) Label() string {
+	if it.Nombre != "" {
+		return it.Nombre
+	}
+	return it.Ref.String()
+}
+
+func (it Item) validate() error {
+	if it.Ref.Empty() {
+		return errors.New("falta link, sku, ean o buscar")
+	}
+	if it.PrecioObjetivo <= 0 {
+		return errors.New("falta precioObjetivo")
+	}
+	return nil
+}
+
+// Load reads a watch list: YAML, or JSON when the name ends in .json.
+func Load(fpath string) ([]Item, error) {
+	data, err := os.ReadFile(fpath)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo watchlist: %w", err)
+	}
+	var items []Item
+	if strings.EqualFold(filepath.Ext(fpath), ".json") {
+		err = json.Unmarshal(data, &items)
+	} else {
+		items, err = parseYAML(string(data))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing watchlist %s: %w", fpath, err)
+	}
+	for i, it := range items {
+		if err := it.validate(); err != nil {
+			return nil, fmt.Errorf("watchlist %s, producto %d (%s): %w", fpath, i+1, it.Label(), err)
+		}
+	}
+	return items, nil
+}
+
+// Alerta is an in-stock offer at or below an item's target price.
+type Alerta struct {
+	Item           string    `json:"item"`
+	Tienda         string    `json:"tienda"`
+	Nombre         string    `json:"nombre"`
+	Link           string    `json:"link"`
+	Precio         float64   `json:"precio"`
+	PrecioObjetivo float64   `json:"precioObjetivo"`
+	Stock          string    `json:"stock"`
+	Desde          time.Time `json:"desde"`
+}
+
+func (a Alerta) key() string {
+	return a.Item + "\x00" + a.Tienda + "\x00" + canonurl.Key(a.Link)
+}
+
+// Evaluar returns the alerts items raise in catalogs, cheapest first within
+// each item.
+func Evaluar(items []Item, catalogs []match.Catalog, now time.Time) []Alerta {
+	var out []Alerta
+	for _, it := range items {
+		start := len(out)
+		for _, cat := range catalogs {
+			for _, p := range cat.Productos {
+				if p.Agotado() || p.Precio <= 0 || p.Precio > it.PrecioObjetivo || !it.Matches(cat.Tienda, p) {
+					continue
+				}
+				out = append(out, Alerta{
+					Item:           it.Label(),
+					Tienda:         cat.Tienda,
+					Nombre:         p.Nombre,
+					Link:           p.Link,
+					Precio:         p.Precio,
+					PrecioObjetivo: it.PrecioObjetivo,
+					Stock:          p.Stock,
+					Desde:          now,
+				})
+			}
+		}
+		sort.SliceStable(out[start:], func(i, j int) bool { return out[start+i].Precio < out[start+j].Precio })
+	}
+	return out
+}
+
+// Nuevas carries the Desde of the alerts already in prev over to curr and
+// returns the ones worth notifying: not in prev, or cheaper than then.
+func Nuevas(prev, curr []Alerta) []Alerta {
+	before := make(map[string]Alerta, len(prev))
+	for _, a := range prev {
+		before[a.key()] = a
+	}
+	var fresh []Alerta
+	for i, a := range curr {
+		old, ok := before[a.key()]
+		if ok {
+			curr[i].Desde = old.Desde
+		}
+		if !ok || a.Precio < old.Precio {
+			fresh = append(fresh, curr[i])
+		}
+	}
+	return fresh
+}
+
+// ReadJSON loads the alerts written by a previous evaluation. A missing file
+// is no alerts.
+func ReadJSON(fpath string) ([]Alerta, error) {
+	data, err := os.ReadFile(fpath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo %s: %w", fpath, err)
+	}
+	var alerts []Alerta
+	if err := json.Unmarshal(data, &alerts); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", fpath, err)
+	}
+	return alerts, nil
+}
+
+// WriteJSON writes the current alerts to fpath.
+func WriteJSON(alerts []Alerta, fpath string) error {
+	if alerts == nil {
+		alerts = []Alerta{}
+	}
+	data, err := json.MarshalIndent(alerts, "", "    ")
+	if err != nil {
+		return fmt.Errorf("error serializando JSON: %w", err)
+	}
+	if err := os.WriteFile(fpath, data, 0644); err != nil {
+		return fmt.Errorf("error escribiendo %s: %w", fpath, err)
+	}
+	return nil
+}
+
+// Message is a plain-Spanish summary of alerts for a chat notification.
+func Message(alerts []Alerta) string {
+	var b strings.Builder
+	if len(alerts) == 1 {
+		b.WriteString("1 producto llegó a su precio objetivo:\n")
+	} else {
+		fmt.Fprintf(&b, "%d productos llegaron a su precio objetivo:\n", len(alerts))
+	}
+	for _, a := range alerts {
+		fmt.Fprintf(&b, "- %s en %s: $%.2f (objetivo $%.2f) %s\n", a.Nombre, a.Tienda, a.Precio, a.PrecioObjetivo, a.Link)
+	}
+	return b.String()
+}
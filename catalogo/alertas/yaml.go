@@ -0,0 +1,101 @@
+package alertas
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseYAML reads the subset of YAML a watch list needs, to avoid a YAML
+// dependency: a list of flat mappings with scalar values, optionally under a
+// top-level "productos:" key, with # comments and quoted strings.
+func parseYAML(src string) ([]Item, error) {
+	var items []Item
+	var cur *Item
+	for n, line := range strings.Split(src, "\n") {
+		line = stripComment(strings.TrimRight(line, " \t\r"))
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+		if trimmed == "productos:" && !strings.HasPrefix(line, " ") {
+			continue
+		}
+		if rest, ok := strings.CutPrefix(trimmed, "-"); ok && (rest == "" || rest[0] == ' ') {
+			items = append(items, Item{})
+			cur = &items[len(items)-1]
+			if trimmed = strings.TrimSpace(rest); trimmed == "" {
+				continue
+			}
+		}
+		if cur == nil {
+			return nil, fmt.Errorf("línea %d: se esperaba un elemento de lista (\"- \")", n+1)
+		}
+		key, value, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			return nil, fmt.Errorf("línea %d: se esperaba \"clave: valor\"", n+1)
+		}
+		if err := setField(cur, strings.TrimSpace(key), unquote(strings.TrimSpace(value))); err != nil {
+			return nil, fmt.Errorf("línea %d: %w", n+1, err)
+		}
+	}
+	return items, nil
+}
+
+func setField(it *Item, key, value string) error {
+	switch key {
+	case "nombre":
+		it.Nombre = value
+	case "tienda":
+		it.Tienda = value
+	case "link":
+		it.Link = value
+	case "sku":
+		it.SKU = value
+	case "ean":
+		it.EAN = value
+	case "buscar":
+		it.Buscar = value
+	case "precioObjetivo":
+		v, err := strconv.ParseFloat(strings.TrimPrefix(value, "$"), 64)
+		if err != nil {
+			return fmt.Errorf("precioObjetivo inválido %q", value)
+		}
+		it.PrecioObjetivo = v
+	default:
+		return fmt.Errorf("clave desconocida %q", key)
+	}
+	return nil
+}
+
+// stripComment drops a # comment that starts the line or follows a space,
+// outside quotes, so "#" inside links survives.
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' && s[len(s)-1] == '"') {
+		if u, err := strconv.Unquote(s); err == nil {
+			return u
+		}
+	}
+	if len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'' {
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'")
+	}
+	return s
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"catalogo/alertas"
+	"catalogo/match"
+	"catalogo/producto"
+	"catalogo/secretos"
+)
+
+// alertFlags are the price alert options shared by daemon, run and alerts.
+type alertFlags struct {
+	watchlist string
+	output    string
+	webhook   string
+}
+
+func (f *alertFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.watchlist, "alertas", "watchlist.yaml", "Watchlist con precios objetivo, evaluada en todas las tiendas tras cada corrida (se ignora si no existe)")
+	fs.StringVar(&f.output, "alertas-salida", "alertas-precios.json", "Archivo con las alertas vigentes")
+	fs.StringVar(&f.webhook, "alertas-webhook", "", "URL a la que enviar por POST las alertas nuevas (JSON con \"text\" y \"alertas\")")
+}
+
+// open returns the price alerts of cfg's stores, or nil when the watch list
+// does not exist.
+func (f *alertFlags) open(cfg *Config) (*priceAlerts, error) {
+	if _, err := os.Stat(f.watchlist); errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	// Fail at startup rather than on the first evaluation
+	items, err := alertas.Load(f.watchlist)
+	if err != nil {
+		return nil, err
+	}
+	// Chat webhook URLs carry their token
+	secretos.Registrar(f.webhook)
+	log.Printf("[ALERTA] Watchlist %s: %d productos", f.watchlist, len(items))
+	return &priceAlerts{flags: *f, stores: cfg.Tiendas}, nil
+}
+
+// priceAlerts evaluates the watch list against the latest output of every
+// store. A nil priceAlerts does nothing.
+type priceAlerts struct {
+	flags  alertFlags
+	stores []Store
+
+	// mu serializes evaluations, which read and rewrite the output file
+	mu sync.Mutex
+}
+
+// evaluate reloads the watch list, so edits apply without a restart, checks
+// it against every store's catalog and notifies the alerts that are new or
+// cheaper than last time.
+func (a *priceAlerts) evaluate() {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.evaluateLocked(); err != nil {
+		log.Printf("[ERROR]  Alertas de precio: %v", err)
+	}
+}
+
+func (a *priceAlerts) evaluateLocked() error {
+	items, err := alertas.Load(a.flags.watchlist)
+	if err != nil {
+		return err
+	}
+	var catalogs []match.Catalog
+	for _, s := range a.stores {
+		products, err := producto.ReadJSON(s.Salida)
+		if err != nil {
+			log.Printf("[WARN]   Alertas: sin catálogo de %s: %v", s.ID, err)
+			continue
+		}
+		catalogs = append(catalogs, match.Catalog{Tienda: s.ID, Productos: products})
+	}
+
+	prev, err := alertas.ReadJSON(a.flags.output)
+	if err != nil {
+		return err
+	}
+	curr := alertas.Evaluar(items, catalogs, time.Now())
+	fresh := alertas.Nuevas(prev, curr)
+	if err := alertas.WriteJSON(curr, a.flags.output); err != nil {
+		return err
+	}
+	for _, al := range fresh {
+		log.Printf("[ALERTA] %s en %s: $%.2f (objetivo $%.2f) %s", al.Nombre, al.Tienda, al.Precio, al.PrecioObjetivo, al.Link)
+	}
+	log.Printf("[ALERTA] %d alertas vigentes, %d nuevas", len(curr), len(fresh))
+	if len(fresh) == 0 || a.flags.webhook == "" {
+		return nil
+	}
+	return notifyWebhook(a.flags.webhook, fresh)
+}
+
+// notifyWebhook posts alerts to url with a "text" summary, which chat
+// webhooks display, and the alerts themselves for other consumers.
+func notifyWebhook(url string, alerts []alertas.Alerta) error {
+	body, err := json.Marshal(map[string]any{
+		"text":    alertas.Message(alerts),
+		"alertas": alerts,
+	})
+	if err != nil {
+		return fmt.Errorf("error serializando JSON: %w", err)
+	}
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error notificando alertas: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("error notificando alertas: HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// runAlerts evaluates the watch list once against the stores' current
+// catalogs.
+func runAlerts(args []string) error {
+	fset := flag.NewFlagSet("alerts", flag.ContinueOnError)
+	configPath := fset.String("config", "catalogo.json", "Ruta del archivo de configuración")
+	var af alertFlags
+	af.register(fset)
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	alerts, err := af.open(cfg)
+	if err != nil {
+		return err
+	}
+	if alerts == nil {
+		return fmt.Errorf("no existe la watchlist %s", af.watchlist)
+	}
+	alerts.mu.Lock()
+	defer alerts.mu.Unlock()
+	return alerts.evaluateLocked()
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"strings"
+
+	"catalogo/match"
+	"catalogo/taxonomia"
+)
+
+// runAlign reports how each store's categories map to the canonical
+// taxonomy, with the evidence for the ones that do not map yet.
+func runAlign(args []string) error {
+	fset := flag.NewFlagSet("align", flag.ContinueOnError)
+	taxPath := fset.String("taxonomia", "taxonomia.json", "Archivo con las categorías canónicas y el mapeo de cada tienda")
+	matches := fset.String("matches", "", "Archivos de coincidencias separados por coma, usados como evidencia para las categorías sin mapear")
+	output := fset.String("o", "reporte-categorias.md", "Reporte en Markdown a escribir")
+	jsonOut := fset.String("json", "", "Escribir también el reporte en JSON en este archivo")
+	files, err := parseInterspersed(fset, args)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("uso: catalogo align [-taxonomia taxonomia.json] [-matches matches.json] [-o reporte-categorias.md] <tienda.json> [...]")
+	}
+
+	tax, err := taxonomia.Load(*taxPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		log.Printf("[WARN]   No existe %s; todas las categorías aparecerán sin mapear", *taxPath)
+	} else if err != nil {
+		return err
+	}
+
+	catalogs := make([]match.Catalog, len(files))
+	for i, fpath := range files {
+		if catalogs[i], err = loadCatalog(fpath); err != nil {
+			return err
+		}
+	}
+	var pairs []match.Pair
+	for fpath := range strings.SplitSeq(*matches, ",") {
+		if fpath = strings.TrimSpace(fpath); fpath == "" {
+			continue
+		}
+		result, err := match.ReadResult(fpath)
+		if err != nil {
+			return err
+		}
+		pairs = append(pairs, result.Coincidencias...)
+	}
+
+	report := taxonomia.Alinear(tax, catalogs, pairs)
+	for _, rt := range report.Tiendas {
+		unmapped := 0
+		for _, f := range rt.Filas {
+			if f.Canonica == "" {
+				unmapped++
+			}
+		}
+		log.Printf("[ALIGN]  %s: %d categorías, %d sin mapear (%d de %d productos)",
+			rt.Tienda, len(rt.Filas), unmapped, rt.SinMapear, rt.Productos)
+	}
+
+	if err := taxonomia.WriteMarkdown(report, *output); err != nil {
+		return err
+	}
+	log.Printf("[ALIGN]  Escrito en %s", *output)
+	if *jsonOut != "" {
+		data, err := json.MarshalIndent(report, "", "    ")
+		if err != nil {
+			return fmt.Errorf("error serializando JSON: %w", err)
+		}
+		if err := os.WriteFile(*jsonOut, data, 0644); err != nil {
+			return fmt.Errorf("error escribiendo %s: %w", *jsonOut, err)
+		}
+		log.Printf("[ALIGN]  Escrito en %s", *jsonOut)
+	}
+	return nil
+}
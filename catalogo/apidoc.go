@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"reflect"
+
+	"catalogo/indice"
+	"catalogo/openapi"
+	"catalogo/producto"
+	"catalogo/unificado"
+)
+
+// apiDoc describes the JSON endpoints of newServeMux. A new endpoint goes
+// here too, so the spec and the TypeScript client know about it.
+func apiDoc() *openapi.Documento {
+	d := openapi.Nuevo("catalogo", readBuildInfo().Version, "API de catalogo serve y catalogo daemon: las tiendas, sus catálogos y la búsqueda.")
+	d.Fijar(reflect.TypeFor[producto.Conversion](), &openapi.Esquema{
+		Type:        "object",
+		Description: "Precios en otra moneda; precio<MONEDA> y precioOriginal<MONEDA> llevan el código de la moneda, como precioUSD.",
+		Properties: map[string]*openapi.Esquema{
+			"moneda":     {Type: "string"},
+			"tipoCambio": {Type: "number", Format: "double"},
+			"fuente":     {Type: "string"},
+		},
+		Required:             []string{"moneda", "tipoCambio", "fuente"},
+		AdditionalProperties: &openapi.Esquema{Type: "number", Format: "double"},
+	})
+
+	limite := func(def int) openapi.Parametro {
+		return openapi.Parametro{Name: "limite", In: "query", Description: fmt.Sprintf("Máximo de resultados (%d por omisión, hasta 200)", def), Schema: &openapi.Esquema{Type: "integer"}}
+	}
+	q := openapi.Parametro{Name: "q", In: "query", Description: "Texto a buscar", Schema: &openapi.Esquema{Type: "string"}}
+	noIndex := openapi.Respuesta{Description: "El índice de búsqueda no existe o no se pudo leer"}
+
+	d.Agregar("GET", "/api/tiendas", &openapi.Operacion{
+		OperationID: "tiendas",
+		Summary:     "Las tiendas de catalogo.json con el tamaño y la fecha de su catálogo y, en el daemon, el estado de sus corridas",
+		Responses:   map[string]openapi.Respuesta{"200": d.JSON(reflect.TypeFor[[]storeInfo](), "Las tiendas")},
+	})
+	d.Agregar("GET", "/api/tiendas/{id}/productos", &openapi.Operacion{
+		OperationID: "productos",
+		Summary:     "El productos.json publicado de una tienda",
+		Parameters:  []openapi.Parametro{{Name: "id", In: "path", Required: true, Description: "ID de la tienda en catalogo.json", Schema: &openapi.Esquema{Type: "string"}}},
+		Responses: map[string]openapi.Respuesta{
+			"200": d.JSON(reflect.TypeFor[[]producto.Product](), "Los productos de la tienda"),
+			"404": {Description: "Tienda desconocida"},
+			"503": {Description: "El catálogo de la tienda no existe o no se pudo leer"},
+		},
+	})
+	d.Agregar("GET", "/api/buscar", &openapi.Operacion{
+		OperationID: "buscar",
+		Summary:     "Busca en el índice de catalogo index, los más relevantes primero (también en /search)",
+		Parameters:  []openapi.Parametro{q, limite(20)},
+		Responses: map[string]openapi.Respuesta{
+			"200": d.JSON(reflect.TypeFor[[]indice.Resultado](), "Los productos que coinciden"),
+			"400": {Description: "limite inválido"},
+			"503": noIndex,
+		},
+	})
+	d.Agregar("GET", "/api/sugerir", &openapi.Operacion{
+		OperationID: "sugerir",
+		Summary:     "Nombres de productos y categorías que completan q, para autocompletar (también en /suggest)",
+		Parameters:  []openapi.Parametro{q, limite(8)},
+		Responses: map[string]openapi.Respuesta{
+			"200": d.JSON(reflect.TypeFor[[]indice.Sugerencia](), "Las sugerencias"),
+			"400": {Description: "limite inválido"},
+			"503": noIndex,
+		},
+	})
+	d.Agregar("GET", "/api/unificado", &openapi.Operacion{
+		OperationID: "unificado",
+		Summary:     "El catálogo unificado de catalogo combine; con categoria, solo esa categoría, leyendo solo sus partes si está partido",
+		Parameters:  []openapi.Parametro{{Name: "categoria", In: "query", Description: "Categoría a devolver (todas por omisión)", Schema: &openapi.Esquema{Type: "string"}}},
+		Responses: map[string]openapi.Respuesta{
+			"200": d.JSON(reflect.TypeFor[[]unificado.Producto](), "Los productos unificados"),
+			"503": {Description: "El catálogo unificado no existe o no se pudo leer"},
+		},
+	})
+	d.Agregar("GET", "/api/openapi.json", &openapi.Operacion{
+		OperationID: "openapi",
+		Summary:     "Este documento",
+		Responses:   map[string]openapi.Respuesta{"200": {Description: "El documento OpenAPI 3"}},
+	})
+	d.Agregar("GET", "/metrics", &openapi.Operacion{
+		OperationID: "metrics",
+		Summary:     "Métricas de los catálogos, del daemon y de las últimas corridas, en formato de Prometheus",
+		Responses:   map[string]openapi.Respuesta{"200": openapi.Texto("text/plain", "Las métricas")},
+	})
+	return d
+}
+
+func (s *server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	writeJSONResponse(w, apiDoc())
+}
+
+// runOpenAPI writes the API's OpenAPI document and, with -ts, the
+// TypeScript client generated from it.
+func runOpenAPI(args []string) error {
+	fs := flag.NewFlagSet("openapi", flag.ContinueOnError)
+	output := fs.String("o", "openapi.json", "Archivo donde escribir el documento OpenAPI")
+	tsPath := fs.String("ts", "", "Archivo donde escribir además el cliente de TypeScript")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	d := apiDoc()
+	data, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(*output, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("error escribiendo %s: %w", *output, err)
+	}
+	log.Printf("[API]    Documento OpenAPI escrito: %s", *output)
+	if *tsPath != "" {
+		if err := os.WriteFile(*tsPath, []byte(d.TypeScript()), 0644); err != nil {
+			return fmt.Errorf("error escribiendo %s: %w", *tsPath, err)
+		}
+		log.Printf("[API]    Cliente de TypeScript escrito: %s", *tsPath)
+	}
+	return nil
+}
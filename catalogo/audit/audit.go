@@ -0,0 +1,146 @@
+// Package audit records every HTTP request a scraper makes as one JSON line
+// (NDJSON): when, what was requested, how the site answered, which retry
+// attempt it was and which run and task made it. It is the evidence to show a supplier exactly what our
+// crawler did.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"catalogo/secretos"
+)
+
+// Entry is one line of the audit log.
+type Entry struct {
+	Fecha      time.Time `json:"fecha"`
+	Corrida    string    `json:"corrida"`
+	Tarea      string    `json:"tarea,omitempty"`
+	Metodo     string    `json:"metodo"`
+	URL        string    `json:"url"`
+	Status     int       `json:"status,omitempty"`
+	LatenciaMs int64     `json:"latencia_ms"`
+	Bytes      int64     `json:"bytes"`
+	Intento    int       `json:"intento"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Log appends entries to an NDJSON file. It is safe for concurrent use.
+type Log struct {
+	mu      sync.Mutex
+	f       *os.File
+	enc     *json.Encoder
+	corrida string
+}
+
+// Open opens (appending to) the audit log at fpath. Entries are tagged with
+// the run ID corrida.
+func Open(fpath, corrida string) (*Log, error) {
+	f, err := os.OpenFile(fpath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error abriendo audit log: %w", err)
+	}
+	return &Log{f: f, enc: json.NewEncoder(f), corrida: corrida}, nil
+}
+
+// Record writes one entry.
+func (l *Log) Record(e Entry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.enc.Encode(e)
+}
+
+// Close closes the file. A nil Log is a no-op.
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Close()
+}
+
+type (
+	attemptKey struct{}
+	taskKey    struct{}
+)
+
+// WithAttempt tags a request context with its attempt number (1 for the
+// first try), recorded as "intento".
+func WithAttempt(ctx context.Context, attempt int) context.Context {
+	return context.WithValue(ctx, attemptKey{}, attempt)
+}
+
+// WithTask tags a request context with the ID of the task that makes it.
+func WithTask(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, taskKey{}, id)
+}
+
+// Client returns a client over base (http.DefaultTransport when nil) whose
+// requests are recorded in l. With a nil Log it returns a plain client.
+func (l *Log) Client(base http.RoundTripper, timeout time.Duration) *http.Client {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if l == nil {
+		return &http.Client{Timeout: timeout, Transport: base}
+	}
+	return &http.Client{Timeout: timeout, Transport: &transport{base: base, log: l}}
+}
+
+// transport records each round trip once its response body is closed, so
+// the latency and size cover the whole download.
+type transport struct {
+	base http.RoundTripper
+	log  *Log
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	e := Entry{Fecha: time.Now(), Corrida: t.log.corrida, Metodo: req.Method, URL: secretos.Ocultar(req.URL.String()), Intento: 1}
+	if n, ok := req.Context().Value(attemptKey{}).(int); ok {
+		e.Intento = n
+	}
+	e.Tarea, _ = req.Context().Value(taskKey{}).(string)
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		e.LatenciaMs = time.Since(e.Fecha).Milliseconds()
+		e.Error = secretos.Ocultar(err.Error())
+		t.log.Record(e)
+		return nil, err
+	}
+	e.Status = resp.StatusCode
+	resp.Body = &countingBody{ReadCloser: resp.Body, entry: e, log: t.log}
+	return resp, nil
+}
+
+type countingBody struct {
+	io.ReadCloser
+	entry Entry
+	log   *Log
+	once  sync.Once
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.entry.Bytes += int64(n)
+	if err != nil && err != io.EOF {
+		b.entry.Error = secretos.Ocultar(err.Error())
+	}
+	return n, err
+}
+
+func (b *countingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		b.entry.LatenciaMs = time.Since(b.entry.Fecha).Milliseconds()
+		b.log.Record(b.entry)
+	})
+	return err
+}
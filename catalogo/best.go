@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"catalogo/unificado"
+)
+
+// runBest writes mejores-precios.json: where to buy each product that more
+// than one store sells.
+func runBest(args []string) error {
+	fs := flag.NewFlagSet("best", flag.ContinueOnError)
+	from := fs.String("from", "catalogo-unificado.json", "Catálogo unificado generado con catalogo combine")
+	output := fs.String("o", "mejores-precios.json", "Archivo de recomendaciones a escribir")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	products, err := unificado.ReadJSON(*from)
+	if err != nil {
+		return err
+	}
+	recs := unificado.MejoresPrecios(products)
+	var total float64
+	for _, r := range recs {
+		total += r.AhorroMaximo
+	}
+	log.Printf("[BEST]   %d productos en más de una tienda con stock; ahorro máximo acumulado $%.2f", len(recs), total)
+
+	data, err := json.MarshalIndent(recs, "", "    ")
+	if err != nil {
+		return fmt.Errorf("error serializando JSON: %w", err)
+	}
+	if err := os.WriteFile(*output, data, 0644); err != nil {
+		return fmt.Errorf("error escribiendo %s: %w", *output, err)
+	}
+	log.Printf("[BEST]   Escrito en %s", *output)
+	return nil
+}
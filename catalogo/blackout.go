@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// blackoutWindow is a daily time range (optionally limited to some weekdays)
+// during which a store must not be scraped, e.g. "12:00-14:00" or
+// "lun-vie 23:00-02:00". Times are in the daemon's local time zone.
+type blackoutWindow struct {
+	spec       string
+	days       [7]bool
+	start, end int // minutes since midnight; end < start crosses midnight
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"dom": time.Sunday, "lun": time.Monday, "mar": time.Tuesday, "mie": time.Wednesday,
+	"mié": time.Wednesday, "jue": time.Thursday, "vie": time.Friday, "sab": time.Saturday, "sáb": time.Saturday,
+}
+
+func parseBlackout(spec string) (blackoutWindow, error) {
+	w := blackoutWindow{spec: spec}
+	fields := strings.Fields(strings.ToLower(spec))
+	var hours string
+	switch len(fields) {
+	case 1:
+		hours = fields[0]
+		for d := range w.days {
+			w.days[d] = true
+		}
+	case 2:
+		if err := parseWeekdays(fields[0], &w.days); err != nil {
+			return w, fmt.Errorf("blackout %q: %w", spec, err)
+		}
+		hours = fields[1]
+	default:
+		return w, fmt.Errorf("blackout %q: formato esperado \"[días] HH:MM-HH:MM\"", spec)
+	}
+
+	from, to, ok := strings.Cut(hours, "-")
+	if !ok {
+		return w, fmt.Errorf("blackout %q: falta el rango HH:MM-HH:MM", spec)
+	}
+	var err error
+	if w.start, err = parseClock(from); err != nil {
+		return w, fmt.Errorf("blackout %q: %w", spec, err)
+	}
+	if w.end, err = parseClock(to); err != nil {
+		return w, fmt.Errorf("blackout %q: %w", spec, err)
+	}
+	if w.start == w.end {
+		return w, fmt.Errorf("blackout %q: el rango está vacío", spec)
+	}
+	return w, nil
+}
+
+// parseWeekdays parses "lun", "lun,mie" or "lun-vie" (ranges may wrap, e.g. "sab-dom").
+func parseWeekdays(s string, days *[7]bool) error {
+	for part := range strings.SplitSeq(s, ",") {
+		a, b, isRange := strings.Cut(part, "-")
+		from, ok := weekdayNames[a]
+		if !ok {
+			return fmt.Errorf("día desconocido %q", a)
+		}
+		to := from
+		if isRange {
+			if to, ok = weekdayNames[b]; !ok {
+				return fmt.Errorf("día desconocido %q", b)
+			}
+		}
+		for d := from; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == to {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("hora inválida %q", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// until reports whether t falls inside the window and, if so, when it ends.
+func (w blackoutWindow) until(t time.Time) (time.Time, bool) {
+	m := t.Hour()*60 + t.Minute()
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	today := t.Weekday()
+	yesterday := (today + 6) % 7
+
+	if w.start < w.end {
+		if w.days[today] && m >= w.start && m < w.end {
+			return midnight.Add(time.Duration(w.end) * time.Minute), true
+		}
+		return time.Time{}, false
+	}
+	// Window crossing midnight: the evening part belongs to today's window,
+	// the early-morning part to yesterday's.
+	if w.days[today] && m >= w.start {
+		return midnight.AddDate(0, 0, 1).Add(time.Duration(w.end) * time.Minute), true
+	}
+	if w.days[yesterday] && m < w.end {
+		return midnight.Add(time.Duration(w.end) * time.Minute), true
+	}
+	return time.Time{}, false
+}
+
+// blackoutUntil reports whether s is in a maintenance window at t and when
+// the last overlapping window ends.
+func (s Store) blackoutUntil(t time.Time) (time.Time, bool) {
+	var end time.Time
+	in := false
+	for changed := true; changed; {
+		changed = false
+		for _, w := range s.blackouts {
+			probe := t
+			if in {
+				probe = end
+			}
+			if e, ok := w.until(probe); ok && e.After(end) {
+				end, in, changed = e, true, true
+			}
+		}
+	}
+	return end, in
+}
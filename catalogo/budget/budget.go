@@ -0,0 +1,79 @@
+// Package budget fails a run that degraded quietly: too many parse warnings
+// or too high a share of failed requests make Check return an error, so the
+// scraper exits non-zero instead of publishing a partial catalog.
+package budget
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Budget counts warnings and request outcomes against the configured limits.
+// It is safe for concurrent use.
+type Budget struct {
+	// MaxWarnings is the number of warnings tolerated; negative means no limit.
+	MaxWarnings int
+	// MaxErrorRate is the tolerated fraction of failed requests (0.05 = 5%);
+	// zero or negative means no limit.
+	MaxErrorRate float64
+
+	warnings atomic.Int64
+	requests atomic.Int64
+	failures atomic.Int64
+}
+
+// Warning counts one parse warning.
+func (b *Budget) Warning() {
+	b.warnings.Add(1)
+}
+
+// Request counts one page or product fetch, after its retries.
+func (b *Budget) Request(failed bool) {
+	b.requests.Add(1)
+	if failed {
+		b.failures.Add(1)
+	}
+}
+
+// Errores is the number of fetches that failed after their retries.
+func (b *Budget) Errores() int64 {
+	return b.failures.Load()
+}
+
+// Check returns an error describing the first limit exceeded, if any.
+func (b *Budget) Check() error {
+	if w := b.warnings.Load(); b.MaxWarnings >= 0 && w > int64(b.MaxWarnings) {
+		return fmt.Errorf("presupuesto de advertencias excedido: %d advertencias (máximo %d)", w, b.MaxWarnings)
+	}
+	requests, failures := b.requests.Load(), b.failures.Load()
+	if b.MaxErrorRate > 0 && requests > 0 {
+		if rate := float64(failures) / float64(requests); rate > b.MaxErrorRate {
+			return fmt.Errorf("tasa de errores excedida: %d de %d requests fallaron (%.1f%%, máximo %.1f%%)",
+				failures, requests, rate*100, b.MaxErrorRate*100)
+		}
+	}
+	return nil
+}
+
+// ParseRate parses a rate written as a percentage ("5%") or a fraction
+// ("0.05"). The empty string means no limit.
+func ParseRate(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	pct := strings.HasSuffix(s, "%")
+	v, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("tasa inválida %q (ej. 5%% o 0.05)", s)
+	}
+	if pct {
+		v /= 100
+	}
+	if v > 1 {
+		return 0, fmt.Errorf("tasa inválida %q: mayor a 100%%", s)
+	}
+	return v, nil
+}
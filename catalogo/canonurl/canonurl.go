@@ -0,0 +1,121 @@
+// Package canonurl normalizes product links so the same product is not seen
+// twice because of tracking parameters, session ids or cosmetic differences
+// in how a store prints its URLs.
+package canonurl
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// dropParams are query parameters that only track the visitor or the
+// session; utm_* is handled separately.
+var dropParams = map[string]bool{
+	"gclid":      true,
+	"fbclid":     true,
+	"msclkid":    true,
+	"srsltid":    true,
+	"mc_cid":     true,
+	"mc_eid":     true,
+	"_ga":        true,
+	"_gl":        true,
+	"sid":        true,
+	"sessionid":  true,
+	"session_id": true,
+	"phpsessid":  true,
+	"jsessionid": true,
+}
+
+// Clean removes tracking and session parameters and the fragment from raw,
+// lowercases its scheme and host and drops a default port. The path is kept
+// as the store publishes it, so a cleaned link still opens without a
+// redirect. Links that do not parse are returned unchanged.
+func Clean(raw string) string {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Host == "" {
+		return raw
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if port := u.Port(); (u.Scheme == "https" && port == "443") || (u.Scheme == "http" && port == "80") {
+		u.Host = u.Hostname()
+	}
+	u.Fragment, u.RawFragment = "", ""
+	// Path parameters such as ;jsessionid=... are session ids too
+	if i := strings.Index(strings.ToLower(u.Path), ";jsessionid="); i >= 0 {
+		u.Path, u.RawPath = u.Path[:i], ""
+	}
+
+	q := u.Query()
+	for k := range q {
+		lk := strings.ToLower(k)
+		if dropParams[lk] || strings.HasPrefix(lk, "utm_") {
+			q.Del(k)
+		}
+	}
+	// Encode sorts by key, which also makes the order canonical
+	u.RawQuery = q.Encode()
+	u.ForceQuery = false
+	return u.String()
+}
+
+// Key is the identity of a link for dedup and diffs: Clean plus no trailing
+// slash, so two spellings of the same product page compare equal.
+func Key(raw string) string {
+	s := Clean(raw)
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return s
+	}
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = ""
+	return u.String()
+}
+
+// Resolver follows the redirects of a link once and remembers where it
+// ended, so moved products are recorded under their final address. A nil
+// Resolver resolves nothing.
+type Resolver struct {
+	client *http.Client
+
+	mu    sync.Mutex
+	cache map[string]string
+}
+
+// NewResolver returns a Resolver that uses client for its HEAD requests.
+func NewResolver(client *http.Client) *Resolver {
+	return &Resolver{client: client, cache: make(map[string]string)}
+}
+
+// Resolve returns the cleaned address raw redirects to, or the cleaned raw
+// itself when it does not redirect or the request fails.
+func (r *Resolver) Resolve(ctx context.Context, raw string) string {
+	link := Clean(raw)
+	if r == nil {
+		return link
+	}
+	key := Key(link)
+	r.mu.Lock()
+	final, ok := r.cache[key]
+	r.mu.Unlock()
+	if ok {
+		return final
+	}
+
+	final = link
+	if req, err := http.NewRequestWithContext(ctx, http.MethodHead, link, nil); err == nil {
+		if resp, err := r.client.Do(req); err == nil {
+			resp.Body.Close()
+			if resp.StatusCode < 400 {
+				final = Clean(resp.Request.URL.String())
+			}
+		}
+	}
+	r.mu.Lock()
+	r.cache[key] = final
+	r.mu.Unlock()
+	return final
+}
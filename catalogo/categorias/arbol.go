@@ -0,0 +1,96 @@
+package categorias
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"catalogo/texto"
+)
+
+// Nodo is one of a store's categories as "catalogo categories" exports them,
+// with its subcategories.
+type Nodo struct {
+	ID     string `json:"id"`
+	Slug   string `json:"slug"`
+	Nombre string `json:"nombre"`
+	// Padre is the ID of the parent category, empty for a root one.
+	Padre string `json:"padre,omitempty"`
+	// Productos is the store's count of products in the category, nil when
+	// the store does not say.
+	Productos *int   `json:"productos,omitempty"`
+	URL       string `json:"url,omitempty"`
+	Hijas     []Nodo `json:"hijas,omitempty"`
+}
+
+// Arbol is the file "catalogo categories" writes.
+type Arbol struct {
+	Tienda     string    `json:"tienda"`
+	GeneradoEn time.Time `json:"generadoEn"`
+	// Total counts every category, at any depth.
+	Total      int    `json:"total"`
+	Categorias []Nodo `json:"categorias"`
+}
+
+// NewArbol nests the flat list of a store's categories under their parents.
+// A category whose parent is not in the list is a root. Siblings are in the
+// scrapers' order: alphabetical, without case or accents.
+func NewArbol(tienda string, flat []Nodo) Arbol {
+	ids := make(map[string]bool, len(flat))
+	for _, n := range flat {
+		ids[n.ID] = true
+	}
+	children := make(map[string][]Nodo)
+	for _, n := range flat {
+		parent := n.Padre
+		if !ids[parent] {
+			parent = ""
+		}
+		children[parent] = append(children[parent], n)
+	}
+	var build func(parent string) []Nodo
+	build = func(parent string) []Nodo {
+		nodes := children[parent]
+		sort.Slice(nodes, func(i, j int) bool {
+			a, b := texto.Normalize(nodes[i].Nombre), texto.Normalize(nodes[j].Nombre)
+			if a != b {
+				return a < b
+			}
+			return nodes[i].ID < nodes[j].ID
+		})
+		for i := range nodes {
+			if nodes[i].ID != "" {
+				nodes[i].Hijas = build(nodes[i].ID)
+			}
+		}
+		return nodes
+	}
+	return Arbol{Tienda: tienda, GeneradoEn: time.Now(), Total: len(flat), Categorias: build("")}
+}
+
+// Escribir writes the tree to fpath as indented JSON.
+func (a Arbol) Escribir(fpath string) error {
+	data, err := json.MarshalIndent(a, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(fpath, data, 0644); err != nil {
+		return fmt.Errorf("error escribiendo %s: %w", fpath, err)
+	}
+	return nil
+}
+
+// LeerArbol reads a tree written by Escribir.
+func LeerArbol(fpath string) (Arbol, error) {
+	var a Arbol
+	data, err := os.ReadFile(fpath)
+	if err != nil {
+		return a, fmt.Errorf("error leyendo %s: %w", fpath, err)
+	}
+	if err := json.Unmarshal(data, &a); err != nil {
+		return a, fmt.Errorf("error parsing %s: %w", fpath, err)
+	}
+	return a, nil
+}
@@ -0,0 +1,90 @@
+// Package categorias caches the categories a scraper discovered, so
+// scheduled runs can skip full category discovery.
+package categorias
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Cache is the on-disk format: category name → slug or URL, as each scraper
+// uses it.
+type Cache struct {
+	Actualizado time.Time         `json:"actualizado"`
+	Categorias  map[string]string `json:"categorias"`
+}
+
+// DefaultPath returns the cache location used when none is configured: next
+// to the scraper's output file.
+func DefaultPath(output string) string {
+	return filepath.Join(filepath.Dir(output), "categorias.cache.json")
+}
+
+// Load reads the cache at fpath regardless of its age.
+func Load(fpath string) (*Cache, error) {
+	data, err := os.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+	var c Cache
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("caché de categorías inválida %s: %w", fpath, err)
+	}
+	if len(c.Categorias) == 0 {
+		return nil, fmt.Errorf("caché de categorías vacía: %s", fpath)
+	}
+	return &c, nil
+}
+
+// Save writes cats to the cache at fpath.
+func Save(fpath string, cats map[string]string) error {
+	data, err := json.MarshalIndent(Cache{Actualizado: time.Now(), Categorias: cats}, "", "    ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fpath, data, 0644)
+}
+
+// Cached returns the cached categories when the cache is younger than ttl and
+// refresh is false; otherwise it calls fetch and caches a non-empty result.
+// If fetch fails or finds nothing, it falls back to the cache however old it
+// is, so one flaky request at startup does not cancel the whole run.
+func Cached(fpath string, ttl time.Duration, refresh bool, fetch func() (map[string]string, error)) (map[string]string, error) {
+	if !refresh && ttl > 0 {
+		if c, err := Load(fpath); err == nil {
+			if age := time.Since(c.Actualizado); age < ttl {
+				log.Printf("[CATS]   Usando caché de categorías (%d, de hace %v)", len(c.Categorias), age.Round(time.Minute))
+				return c.Categorias, nil
+			}
+		}
+	}
+
+	cats, err := fetch()
+	if err != nil || len(cats) == 0 {
+		if c, cerr := Load(fpath); cerr == nil {
+			reason := "no se encontraron categorías"
+			if err != nil {
+				reason = err.Error()
+			}
+			log.Printf("[WARN]   ************************************************************")
+			log.Printf("[WARN]   Falló el descubrimiento de categorías: %s", reason)
+			log.Printf("[WARN]   Usando las %d categorías de la caché (de hace %v); pueden estar desactualizadas",
+				len(c.Categorias), time.Since(c.Actualizado).Round(time.Minute))
+			log.Printf("[WARN]   ************************************************************")
+			return c.Categorias, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(cats) > 0 {
+		if err := Save(fpath, cats); err != nil {
+			log.Printf("[WARN]   No se pudo guardar la caché de categorías: %v", err)
+		}
+	}
+	return cats, nil
+}
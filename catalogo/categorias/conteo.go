@@ -0,0 +1,52 @@
+package categorias
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+// Conteo counts the products a store's listing returned for each category
+// during a run, to check them against the counts the store reports for its
+// categories: a category short of products points at a pagination bug or
+// pages that failed. Its zero value is ready to use and it is safe for
+// concurrent use.
+type Conteo struct {
+	mu sync.Mutex
+	n  map[string]int
+}
+
+// Sumar adds n products listed in categoria.
+func (c *Conteo) Sumar(categoria string, n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.n == nil {
+		c.n = make(map[string]int)
+	}
+	c.n[categoria] += n
+}
+
+// Diferencia is a category whose listed products differ from the count the
+// store reports.
+type Diferencia struct {
+	Categoria  string
+	Listados   int
+	Reportados int
+}
+
+// Comparar returns the categories of reportados, by name, whose listed
+// products differ from the reported count by more than tolerancia, a
+// fraction of that count (0.02 is 2%), sorted by name.
+func (c *Conteo) Comparar(reportados map[string]int, tolerancia float64) []Diferencia {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var out []Diferencia
+	for name, reported := range reportados {
+		listed := c.n[name]
+		if math.Abs(float64(listed-reported)) > tolerancia*float64(reported) {
+			out = append(out, Diferencia{Categoria: name, Listados: listed, Reportados: reported})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Categoria < out[j].Categoria })
+	return out
+}
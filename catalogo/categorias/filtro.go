@@ -0,0 +1,158 @@
+package categorias
+
+import (
+	"net/url"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"catalogo/canonurl"
+	"catalogo/producto"
+	"catalogo/texto"
+)
+
+// Filtro narrows a run to some of the store's categories, named in the
+// scrapers' -categories and -exclude-categories flags by name or slug,
+// without case or accents, or picked by -only-category-slug and
+// -start-at-category.
+type Filtro struct {
+	incluir []string
+	excluir []string
+	slug    string
+	desde   string
+}
+
+// ParseFiltro reads the comma-separated lists of categories to include (all
+// when empty) and to exclude.
+func ParseFiltro(include, exclude string) Filtro {
+	return Filtro{incluir: splitNames(include), excluir: splitNames(exclude)}
+}
+
+func splitNames(list string) []string {
+	var out []string
+	for name := range strings.SplitSeq(list, ",") {
+		if n := texto.Normalize(name); n != "" {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// SoloSlug limits f to the category with exactly this slug.
+func (f Filtro) SoloSlug(slug string) Filtro {
+	f.slug = texto.Normalize(slug)
+	return f
+}
+
+// Desde limits f to the category with this name or slug and the ones after
+// it in Ordenadas, to resume a run that stopped there.
+func (f Filtro) Desde(name string) Filtro {
+	f.desde = texto.Normalize(name)
+	return f
+}
+
+// Activo reports whether f leaves any category out.
+func (f Filtro) Activo() bool {
+	return len(f.incluir) > 0 || len(f.excluir) > 0 || f.slug != "" || f.desde != ""
+}
+
+// Ordenadas returns the names of cats in the order the scrapers visit them:
+// alphabetical, without case or accents.
+func Ordenadas(cats map[string]string) []string {
+	names := make([]string, 0, len(cats))
+	for name := range cats {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := texto.Normalize(names[i]), texto.Normalize(names[j])
+		if a != b {
+			return a < b
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// Aplicar returns the categories of cats (name → slug or URL) that f lets
+// through, and the names in f that match no category, most likely typos.
+func (f Filtro) Aplicar(cats map[string]string) (map[string]string, []string) {
+	matched := make(map[string]bool)
+	matches := func(names []string, name, value string) bool {
+		found := false
+		for _, n := range names {
+			if n == texto.Normalize(name) || n == texto.Normalize(slug(value)) {
+				matched[n] = true
+				found = true
+			}
+		}
+		return found
+	}
+	// The start category is where the sorted names reach it
+	start := -1
+	names := Ordenadas(cats)
+	if f.desde != "" {
+		for i, name := range names {
+			if matches([]string{f.desde}, name, cats[name]) {
+				start = i
+				break
+			}
+		}
+	}
+	out := make(map[string]string)
+	for i, name := range names {
+		value := cats[name]
+		if f.slug != "" {
+			if texto.Normalize(slug(value)) != f.slug {
+				continue
+			}
+			matched[f.slug] = true
+		}
+		if f.desde != "" && (start < 0 || i < start) {
+			continue
+		}
+		excluded := matches(f.excluir, name, value)
+		if (len(f.incluir) == 0 || matches(f.incluir, name, value)) && !excluded {
+			out[name] = value
+		}
+	}
+	var unknown []string
+	for _, n := range slices.Concat(f.incluir, f.excluir, []string{f.slug, f.desde}) {
+		if n != "" && !matched[n] {
+			unknown = append(unknown, n)
+		}
+	}
+	return out, unknown
+}
+
+// slug is the last path segment of a category URL, or the value itself when
+// it already is a slug.
+func slug(value string) string {
+	if !strings.Contains(value, "/") {
+		return value
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return value
+	}
+	return path.Base(strings.TrimSuffix(u.Path, "/"))
+}
+
+// Conservar merges a filtered run's products with the previous output's
+// products of the categories it did not visit, so a run over some
+// categories updates them without dropping the rest of the catalog.
+// Products the run found again are not repeated.
+func Conservar(scraped, previous []producto.Product, visited map[string]string) []producto.Product {
+	seen := make(map[string]bool, len(scraped))
+	for _, p := range scraped {
+		seen[canonurl.Key(p.Link)] = true
+	}
+	out := scraped
+	for _, p := range previous {
+		if _, ok := visited[p.Categoria]; ok || seen[canonurl.Key(p.Link)] {
+			continue
+		}
+		out = append(out, p)
+	}
+	return out
+}
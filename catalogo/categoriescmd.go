@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"catalogo/categorias"
+	"catalogo/runid"
+)
+
+// runCategories exports a store's category tree: its scraper discovers the
+// categories and writes them, without scraping any product.
+func runCategories(args []string) error {
+	fs := flag.NewFlagSet("categories", flag.ContinueOnError)
+	configPath := fs.String("config", "catalogo.json", "Ruta del archivo de configuración")
+	id := fs.String("store", "", "ID de la tienda cuyas categorías exportar")
+	output := fs.String("o", "categorias.json", "Archivo JSON a escribir")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	s := cfg.store(*id)
+	if s == nil {
+		return fmt.Errorf("tienda desconocida: %q", *id)
+	}
+	// The scraper runs in its own directory
+	out, err := filepath.Abs(*output)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := runScraper(ctx, *s, runid.New(), "-dump-categories", out); err != nil {
+		return err
+	}
+	tree, err := categorias.LeerArbol(out)
+	if err != nil {
+		return err
+	}
+	log.Printf("[CATS]   %s: %d categorías (%d de primer nivel) en %s", s.ID, tree.Total, len(tree.Categorias), *output)
+	return nil
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"catalogo/match"
+	"catalogo/texto"
+	"catalogo/transporte"
+	"catalogo/unificado"
+)
+
+// runCombine merges several store catalogs into catalogo-unificado.json,
+// folding together the products linked by catalogo match.
+func runCombine(args []string) error {
+	fs := flag.NewFlagSet("combine", flag.ContinueOnError)
+	output := fs.String("o", "catalogo-unificado.json", "Archivo del catálogo unificado a escribir")
+	matches := fs.String("matches", "matches.json", "Archivos de coincidencias separados por coma, generados con catalogo match")
+	nombreMostrar := fs.String("nombre-mostrar", unificado.NombreMostrarPredeterminado, "Criterios separados por coma para distinguir productos con el mismo nombre ("+strings.Join(unificado.CriteriosNombre, ", ")+"); vacío lo desactiva")
+	shardSize := fs.String("shard-size", "", "Tamaño máximo del catálogo en un solo archivo (ej. 20MB); uno mayor se escribe en partes con un manifiesto. Vacío nunca lo parte")
+	files, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(files) < 2 {
+		return fmt.Errorf("uso: catalogo combine [-matches matches.json] [-nombre-mostrar color,paquete,tienda] [-shard-size 20MB] [-o catalogo-unificado.json] <tienda-a.json> <tienda-b.json> [...]")
+	}
+	criterios, err := unificado.ParseCriterios(*nombreMostrar)
+	if err != nil {
+		return fmt.Errorf("-nombre-mostrar: %w", err)
+	}
+	maxBytes, err := transporte.ParseAnchoBanda(*shardSize)
+	if err != nil {
+		return fmt.Errorf("-shard-size: %w", err)
+	}
+
+	catalogs := make([]match.Catalog, len(files))
+	for i, fpath := range files {
+		if catalogs[i], err = loadCatalog(fpath); err != nil {
+			return err
+		}
+		log.Printf("[COMBINE] %s: %d productos", catalogs[i].Tienda, len(catalogs[i].Productos))
+	}
+
+	var pairs []match.Pair
+	for fpath := range strings.SplitSeq(*matches, ",") {
+		if fpath = strings.TrimSpace(fpath); fpath == "" {
+			continue
+		}
+		result, err := match.ReadResult(fpath)
+		if err != nil {
+			return err
+		}
+		pairs = append(pairs, result.Coincidencias...)
+	}
+
+	products := unificado.Combine(catalogs, pairs)
+	unificado.NombresMostrar(products, criterios)
+	shared, renamed := 0, 0
+	for _, p := range products {
+		if len(p.Ofertas) > 1 {
+			shared++
+		}
+		if p.NombreMostrar != "" {
+			renamed++
+		}
+	}
+	log.Printf("[COMBINE] %d productos, %d en más de una tienda", len(products), shared)
+	if renamed > 0 {
+		log.Printf("[COMBINE] %d productos con nombre repetido llevan nombreMostrar", renamed)
+	}
+
+	data, err := json.MarshalIndent(products, "", "    ")
+	if err != nil {
+		return fmt.Errorf("error serializando JSON: %w", err)
+	}
+	if maxBytes > 0 && len(data) > int(maxBytes) {
+		m, err := unificado.EscribirPartes(products, *output, int(maxBytes))
+		if err != nil {
+			return err
+		}
+		log.Printf("[COMBINE] %d bytes superan -shard-size: escrito en %d partes, manifiesto en %s", len(data), len(m.Partes), unificado.ManifiestoPath(*output))
+		return nil
+	}
+	if err := os.WriteFile(*output, data, 0644); err != nil {
+		return fmt.Errorf("error escribiendo %s: %w", *output, err)
+	}
+	if err := unificado.QuitarPartes(*output); err != nil {
+		return err
+	}
+	log.Printf("[COMBINE] Escrito en %s", *output)
+	return nil
+}
+
+// unifiedCache serves the unified catalog written by catalogo combine. A
+// sharded catalog is loaded lazily: only the parts the manifest names for
+// the category asked for, each kept in memory until its file changes on
+// disk, like the stores' catalogs in catalogCache.
+type unifiedCache struct {
+	path string
+
+	mu    sync.Mutex
+	files map[string]cachedUnified
+}
+
+type cachedUnified struct {
+	modTime  time.Time
+	products []unificado.Producto
+	manifest unificado.Manifiesto
+}
+
+// file returns the products of fpath, a single catalog or one part, read
+// again only when it changed.
+func (c *unifiedCache) file(fpath string) ([]unificado.Producto, error) {
+	info, err := os.Stat(fpath)
+	if err != nil {
+		return nil, err
+	}
+	if e, ok := c.files[fpath]; ok && e.modTime.Equal(info.ModTime()) {
+		return e.products, nil
+	}
+	products, err := unificado.ReadJSON(fpath)
+	if err != nil {
+		return nil, err
+	}
+	c.files[fpath] = cachedUnified{modTime: info.ModTime(), products: products}
+	return products, nil
+}
+
+// manifest returns the manifest of the sharded catalog, and false when the
+// catalog is a single file.
+func (c *unifiedCache) manifest() (unificado.Manifiesto, bool, error) {
+	fpath := unificado.ManifiestoPath(c.path)
+	info, err := os.Stat(fpath)
+	if err != nil {
+		if _, single := os.Stat(c.path); single == nil {
+			return unificado.Manifiesto{}, false, nil
+		}
+		return unificado.Manifiesto{}, false, fmt.Errorf("catálogo unificado no disponible, genéralo con catalogo combine: %w", err)
+	}
+	if e, ok := c.files[fpath]; ok && e.modTime.Equal(info.ModTime()) {
+		return e.manifest, true, nil
+	}
+	m, err := unificado.LeerManifiesto(fpath)
+	if err != nil {
+		return m, false, err
+	}
+	c.files[fpath] = cachedUnified{modTime: info.ModTime(), manifest: m}
+	return m, true, nil
+}
+
+// load returns the products of categoria, compared without case or
+// accents, or all of them when categoria is "".
+func (c *unifiedCache) load(categoria string) ([]unificado.Producto, error) {
+	if c.path == "" {
+		return nil, fmt.Errorf("catálogo unificado desactivado (sin -unificado)")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m, sharded, err := c.manifest()
+	if err != nil {
+		return nil, err
+	}
+	files := []string{c.path}
+	if sharded {
+		files = nil
+		for _, f := range m.Archivos(categoria) {
+			files = append(files, filepath.Join(filepath.Dir(c.path), f))
+		}
+	}
+	out := []unificado.Producto{}
+	for _, f := range files {
+		products, err := c.file(f)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range products {
+			if categoria == "" || texto.Equal(p.Categoria, categoria) {
+				out = append(out, p)
+			}
+		}
+	}
+	return out, nil
+}
+
+// handleUnified answers /api/unificado?categoria=... with the unified
+// catalog, or only one of its categories.
+func (s *server) handleUnified(w http.ResponseWriter, r *http.Request) {
+	products, err := s.unified.load(r.URL.Query().Get("categoria"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	writeJSONResponse(w, products)
+}
@@ -0,0 +1,189 @@
+// Package compras turns a shopping list into draft purchase orders, one per
+// store, buying each line from the store that sells it cheapest with stock.
+package compras
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"catalogo/producto"
+	"catalogo/texto"
+	"catalogo/unificado"
+)
+
+// Partida is one line of a store's order.
+type Partida struct {
+	Item   string `json:"item"`
+	Nombre string `json:"nombre"`
+	Link   string `json:"link"`
+	// Cantidad is the pieces the list asked for; Paquetes the listings to
+	// order, fewer when the store sells packs.
+	Cantidad int     `json:"cantidad"`
+	Paquetes int     `json:"paquetes"`
+	Precio   float64 `json:"precio"`
+	Subtotal float64 `json:"subtotal"`
+	// Coincidencias is set when the line matched more than one product and
+	// the cheapest of them was taken.
+	Coincidencias int `json:"coincidencias,omitempty"`
+}
+
+// Orden is the draft purchase order for one store.
+type Orden struct {
+	Tienda   string    `json:"tienda"`
+	Partidas []Partida `json:"partidas"`
+	Total    float64   `json:"total"`
+}
+
+// Pendiente is a list line no store can supply.
+type Pendiente struct {
+	Item     string `json:"item"`
+	Cantidad int    `json:"cantidad"`
+	Motivo   string `json:"motivo"`
+}
+
+// Borrador is the content of ordenes-compra.json.
+type Borrador struct {
+	Generado   time.Time   `json:"generado"`
+	Ordenes    []Orden     `json:"ordenes"`
+	Pendientes []Pendiente `json:"pendientes,omitempty"`
+	Total      float64     `json:"total"`
+}
+
+// Armar picks, for every line of lista, the in-stock offer in products that
+// costs least for the quantity asked, and groups the picks by store. Packs
+// are rounded up, so 12 pieces from a store selling packs of 10 are two
+// packs; that is what the order would cost.
+func Armar(lista []Linea, products []unificado.Producto, now time.Time) Borrador {
+	b := Borrador{Generado: now}
+	byStore := make(map[string]int)
+	for _, l := range lista {
+		var (
+			best    Partida
+			tienda  string
+			matched int
+		)
+		for _, p := range products {
+			if !l.matches(p) {
+				continue
+			}
+			matched++
+			for _, o := range p.Ofertas {
+				if (l.Tienda != "" && o.Tienda != l.Tienda) || !o.Disponible() || o.Precio <= 0 {
+					continue
+				}
+				packs := paquetes(o, l.Cantidad)
+				subtotal := math.Round(float64(packs)*o.Precio*100) / 100
+				if tienda != "" && (subtotal > best.Subtotal || (subtotal == best.Subtotal && o.Tienda >= tienda)) {
+					continue
+				}
+				tienda = o.Tienda
+				best = Partida{
+					Item:     l.Label(),
+					Nombre:   p.Nombre,
+					Link:     o.Link,
+					Cantidad: l.Cantidad,
+					Paquetes: packs,
+					Precio:   o.Precio,
+					Subtotal: subtotal,
+				}
+			}
+		}
+
+		switch {
+		case matched == 0:
+			b.Pendientes = append(b.Pendientes, Pendiente{Item: l.Label(), Cantidad: l.Cantidad, Motivo: "no se encontró en el catálogo"})
+			continue
+		case tienda == "":
+			b.Pendientes = append(b.Pendientes, Pendiente{Item: l.Label(), Cantidad: l.Cantidad, Motivo: "ninguna tienda lo tiene con stock"})
+			continue
+		}
+		if matched > 1 {
+			best.Coincidencias = matched
+		}
+		g, ok := byStore[tienda]
+		if !ok {
+			g = len(b.Ordenes)
+			byStore[tienda] = g
+			b.Ordenes = append(b.Ordenes, Orden{Tienda: tienda})
+		}
+		b.Ordenes[g].Partidas = append(b.Ordenes[g].Partidas, best)
+		b.Ordenes[g].Total += best.Subtotal
+	}
+
+	sort.Slice(b.Ordenes, func(i, j int) bool { return b.Ordenes[i].Tienda < b.Ordenes[j].Tienda })
+	for i := range b.Ordenes {
+		b.Ordenes[i].Total = math.Round(b.Ordenes[i].Total*100) / 100
+		b.Total += b.Ordenes[i].Total
+	}
+	b.Total = math.Round(b.Total*100) / 100
+	return b
+}
+
+// matches reports whether p is the product l names: by its identifiers in
+// any of p's stores, or else by its exact name.
+func (l Linea) matches(p unificado.Producto) bool {
+	if l.Ref.Empty() {
+		return texto.Normalize(l.Nombre) == texto.Normalize(p.Nombre)
+	}
+	for _, o := range p.Ofertas {
+		if l.Ref.Matches(o.Tienda, producto.Product{Nombre: p.Nombre, Link: o.Link}) {
+			return true
+		}
+	}
+	return false
+}
+
+// paquetes is how many listings of o cover the pieces asked for.
+func paquetes(o unificado.Oferta, piezas int) int {
+	if o.Unidad != producto.UnidadPieza || o.CantidadPaquete <= 1 {
+		return piezas
+	}
+	return int(math.Ceil(float64(piezas) / o.CantidadPaquete))
+}
+
+// WriteJSON writes b to fpath.
+func WriteJSON(b Borrador, fpath string) error {
+	data, err := json.MarshalIndent(b, "", "    ")
+	if err != nil {
+		return fmt.Errorf("error serializando JSON: %w", err)
+	}
+	if err := os.WriteFile(fpath, data, 0644); err != nil {
+		return fmt.Errorf("error escribiendo %s: %w", fpath, err)
+	}
+	return nil
+}
+
+// WriteCSV writes b as one spreadsheet: the lines of every store followed by
+// its total, the grand total, and the lines no store can supply.
+func WriteCSV(b Borrador, fpath string) error {
+	f, err := os.Create(fpath)
+	if err != nil {
+		return fmt.Errorf("error escribiendo %s: %w", fpath, err)
+	}
+	defer f.Close()
+
+	money := func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+	w := csv.NewWriter(f)
+	w.Write([]string{"tienda", "item", "nombre", "link", "cantidad", "paquetes", "precio", "subtotal"})
+	for _, o := range b.Ordenes {
+		for _, p := range o.Partidas {
+			w.Write([]string{o.Tienda, p.Item, p.Nombre, p.Link, strconv.Itoa(p.Cantidad), strconv.Itoa(p.Paquetes), money(p.Precio), money(p.Subtotal)})
+		}
+		w.Write([]string{o.Tienda, "TOTAL", "", "", "", "", "", money(o.Total)})
+	}
+	w.Write([]string{"", "TOTAL GENERAL", "", "", "", "", "", money(b.Total)})
+	for _, p := range b.Pendientes {
+		w.Write([]string{"", p.Item, "SIN PROVEEDOR: " + p.Motivo, "", strconv.Itoa(p.Cantidad), "", "", ""})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("error escribiendo %s: %w", fpath, err)
+	}
+	return f.Close()
+}
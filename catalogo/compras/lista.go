@@ -0,0 +1,140 @@
+package compras
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"catalogo/match"
+)
+
+// Linea is one line of the shopping list: a product and how many pieces of
+// it to buy. The product is named as match.Ref does, or, with no identifier,
+// by the exact Nombre of a product in catalogo-unificado.json.
+type Linea struct {
+	Nombre string `json:"nombre,omitempty"`
+	match.Ref
+	Cantidad int `json:"cantidad"`
+}
+
+// Label names the line in orders: its nombre, or the identifier it uses.
+func (l Linea) Label() string {
+	if l.Nombre != "" {
+		return l.Nombre
+	}
+	return l.Ref.String()
+}
+
+func (l Linea) validate() error {
+	if l.Ref.Empty() && l.Nombre == "" {
+		return errors.New("falta nombre, link, sku, ean o buscar")
+	}
+	if l.Cantidad <= 0 {
+		return errors.New("la cantidad debe ser mayor que cero")
+	}
+	return nil
+}
+
+// LoadLista reads a shopping list: CSV with a header naming the columns
+// (nombre, tienda, link, sku, ean, buscar, cantidad), or JSON when the name
+// ends in .json. A missing or empty cantidad in the CSV means one.
+func LoadLista(fpath string) ([]Linea, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo lista de compras: %w", err)
+	}
+	defer f.Close()
+
+	var lines []Linea
+	if strings.EqualFold(filepath.Ext(fpath), ".json") {
+		err = json.NewDecoder(f).Decode(&lines)
+	} else {
+		lines, err = readCSV(f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing lista de compras %s: %w", fpath, err)
+	}
+	for i, l := range lines {
+		if err := l.validate(); err != nil {
+			return nil, fmt.Errorf("lista de compras %s, línea %d (%s): %w", fpath, i+1, l.Label(), err)
+		}
+	}
+	return lines, nil
+}
+
+func readCSV(r io.Reader) ([]Linea, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Spreadsheets may save the CSV with a byte order mark
+	for i, h := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+		if err := setField(&Linea{}, header[i], ""); err != nil {
+			return nil, err
+		}
+	}
+
+	var lines []Linea
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return lines, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		l := Linea{Cantidad: 1}
+		for i, v := range rec {
+			if i >= len(header) {
+				break
+			}
+			if err := setField(&l, header[i], strings.TrimSpace(v)); err != nil {
+				row, _ := cr.FieldPos(0)
+				return nil, fmt.Errorf("línea %d: %w", row, err)
+			}
+		}
+		lines = append(lines, l)
+	}
+}
+
+func setField(l *Linea, key, value string) error {
+	switch key {
+	case "nombre", "producto":
+		l.Nombre = value
+	case "tienda":
+		l.Tienda = value
+	case "link":
+		l.Link = value
+	case "sku":
+		l.SKU = value
+	case "ean":
+		l.EAN = value
+	case "buscar":
+		l.Buscar = value
+	case "cantidad":
+		if value == "" {
+			return nil
+		}
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("cantidad inválida %q", value)
+		}
+		l.Cantidad = v
+	default:
+		return fmt.Errorf("columna desconocida %q", key)
+	}
+	return nil
+}
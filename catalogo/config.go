@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"catalogo/envio"
+	"catalogo/etiquetas"
+	"catalogo/hooks"
+	"catalogo/imagenes"
+	"catalogo/impuestos"
+	"catalogo/indice"
+	"catalogo/redondeo"
+	"catalogo/texto"
+	"catalogo/tienda"
+)
+
+// Store describes how to run one store's scraper and where its catalog lives.
+// Relative paths are resolved against the directory of the config file.
+type Store struct {
+	ID       string   `json:"id"`
+	Nombre   string   `json:"nombre"`
+	Dir      string   `json:"dir"`
+	Comando  []string `json:"comando"`
+	Args     []string `json:"args"`
+	Salida   string   `json:"salida"`
+	Schedule string   `json:"schedule"`
+	// Host identifies the site being scraped; two stores with the same host
+	// never run at the same time. Defaults to the store id.
+	Host string `json:"host"`
+	// Offset delays every scheduled run (e.g. "30m") to stagger stores that
+	// share a schedule.
+	Offset string `json:"offset"`
+	// Jitter adds a random delay within this window to every scheduled run,
+	// overriding the daemon's -jitter.
+	Jitter string `json:"jitter"`
+	// Workers is passed to the scraper as -workers and counted against the
+	// daemon's global worker budget.
+	Workers int `json:"workers"`
+	// Watchlist is a file of product links re-checked (price and stock only)
+	// every WatchInterval between full runs.
+	Watchlist     string `json:"watchlist"`
+	WatchInterval string `json:"watchInterval"`
+	// Timeout cancels a run that takes longer; Reintentos re-runs a failed
+	// scrape up to that many times, EsperaReintento apart. All three
+	// override the daemon's flags.
+	Timeout         string `json:"timeout"`
+	Reintentos      int    `json:"reintentos"`
+	EsperaReintento string `json:"esperaReintento"`
+	// Blackout lists maintenance windows during which runs are deferred,
+	// e.g. ["12:00-14:00", "sab-dom 00:00-06:00"].
+	Blackout []string `json:"blackout"`
+	// IVA says whether the prices the store shows include the tax
+	// ("preciosConIVA", true by default) and at what rate ("tasaIVA"), for
+	// the scrapers' precioConIVA and precioSinIVA.
+	impuestos.IVA
+	// Envio is the store's free-shipping threshold and shipping rates.
+	Envio envio.Regla `json:"envio"`
+	// ZonaHoraria is the IANA time zone of the timestamps the scraper
+	// writes, America/Mexico_City by default.
+	ZonaHoraria string `json:"zonaHoraria"`
+	// PrecioPublico rounds the prices the sites show.
+	PrecioPublico redondeo.Politica `json:"precioPublico"`
+	// Dominios are domains the scraper may request besides its site's own,
+	// such as an image CDN; it refuses any other.
+	Dominios []string `json:"dominios"`
+	// Hooks are commands run before and after each run and over the
+	// products the scraper writes.
+	Hooks hooks.Hooks `json:"hooks"`
+	// Imagenes rewrite the image URLs the scraper writes, e.g. to our
+	// image proxy.
+	Imagenes imagenes.Reglas `json:"imagenes"`
+
+	offset        time.Duration
+	jitter        time.Duration
+	watchInterval time.Duration
+	timeout       time.Duration
+	retryDelay    time.Duration
+	blackouts     []blackoutWindow
+}
+
+// Config is the content of catalogo.json.
+type Config struct {
+	Tiendas []Store `json:"tiendas"`
+	// Busqueda boosts or demotes results of the serve mode's search.
+	Busqueda indice.Impulsos `json:"busqueda"`
+	// Etiquetas are the rules the scrapers derive business tags with.
+	Etiquetas etiquetas.Reglas `json:"etiquetas"`
+}
+
+// defaultWorkers matches the scrapers' own -workers default, used for the
+// budget when a store doesn't set one.
+const defaultWorkers = 3
+
+// defaultComando runs the scraper from source, as the GitHub workflows do.
+var defaultComando = []string{"go", "run", "."}
+
+// loadConfig reads the config file and resolves relative paths.
+func loadConfig(fpath string) (*Config, error) {
+	data, err := os.ReadFile(fpath)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo config: %w", err)
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(texto.SinBOM(data), &cfg); err != nil {
+		return nil, fmt.Errorf("error parsing config %s: %w", fpath, err)
+	}
+	if len(cfg.Tiendas) == 0 {
+		return nil, fmt.Errorf("config %s no define tiendas", fpath)
+	}
+
+	base, err := filepath.Abs(filepath.Dir(fpath))
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	for i := range cfg.Tiendas {
+		s := &cfg.Tiendas[i]
+		if s.ID == "" {
+			return nil, fmt.Errorf("tienda #%d sin id", i+1)
+		}
+		// Ids are looked up without case or accents, so those must differ
+		if seen[texto.Normalize(s.ID)] {
+			return nil, fmt.Errorf("tienda %q duplicada", s.ID)
+		}
+		seen[texto.Normalize(s.ID)] = true
+		if s.Nombre == "" {
+			s.Nombre = s.ID
+		}
+		if s.Host == "" {
+			s.Host = s.ID
+		}
+		if s.offset, err = parseStoreDuration(s.Offset); err != nil {
+			return nil, fmt.Errorf("tienda %s: offset: %w", s.ID, err)
+		}
+		if s.jitter, err = parseStoreDuration(s.Jitter); err != nil {
+			return nil, fmt.Errorf("tienda %s: jitter: %w", s.ID, err)
+		}
+		if s.watchInterval, err = parseStoreDuration(s.WatchInterval); err != nil {
+			return nil, fmt.Errorf("tienda %s: watchInterval: %w", s.ID, err)
+		}
+		if s.timeout, err = parseStoreDuration(s.Timeout); err != nil {
+			return nil, fmt.Errorf("tienda %s: timeout: %w", s.ID, err)
+		}
+		if s.retryDelay, err = parseStoreDuration(s.EsperaReintento); err != nil {
+			return nil, fmt.Errorf("tienda %s: esperaReintento: %w", s.ID, err)
+		}
+		if s.Reintentos < 0 {
+			return nil, fmt.Errorf("tienda %s: reintentos negativo", s.ID)
+		}
+		if err := s.IVA.Validate(); err != nil {
+			return nil, fmt.Errorf("tienda %s: %w", s.ID, err)
+		}
+		if err := s.Envio.Validate(); err != nil {
+			return nil, fmt.Errorf("tienda %s: %w", s.ID, err)
+		}
+		if _, err := tienda.Zona(s.ZonaHoraria); err != nil {
+			return nil, fmt.Errorf("tienda %s: %w", s.ID, err)
+		}
+		if err := s.PrecioPublico.Validate(); err != nil {
+			return nil, fmt.Errorf("tienda %s: %w", s.ID, err)
+		}
+		if err := s.Hooks.Validate(); err != nil {
+			return nil, fmt.Errorf("tienda %s: %w", s.ID, err)
+		}
+		if err := s.Imagenes.Validate(); err != nil {
+			return nil, fmt.Errorf("tienda %s: %w", s.ID, err)
+		}
+		for _, spec := range s.Blackout {
+			w, err := parseBlackout(spec)
+			if err != nil {
+				return nil, fmt.Errorf("tienda %s: %w", s.ID, err)
+			}
+			s.blackouts = append(s.blackouts, w)
+		}
+		if len(s.Comando) == 0 {
+			s.Comando = defaultComando
+		}
+		s.Dir = resolvePath(base, s.Dir)
+		s.Salida = resolvePath(base, s.Salida)
+		s.Watchlist = resolvePath(base, s.Watchlist)
+		s.Hooks.Dir = base
+	}
+	if err := cfg.Etiquetas.Validate(); err != nil {
+		return nil, fmt.Errorf("config %s: %w", fpath, err)
+	}
+	if err := cfg.Busqueda.Validate(); err != nil {
+		return nil, fmt.Errorf("config %s: %w", fpath, err)
+	}
+	return &cfg, nil
+}
+
+// store returns the store with the given id, compared without case or
+// accents, or nil.
+func (c *Config) store(id string) *Store {
+	for i := range c.Tiendas {
+		if texto.Equal(c.Tiendas[i].ID, id) {
+			return &c.Tiendas[i]
+		}
+	}
+	return nil
+}
+
+// parseStoreDuration parses an optional, non-negative duration like "15m".
+func parseStoreDuration(v string) (time.Duration, error) {
+	if v == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("duración inválida %q", v)
+	}
+	return d, nil
+}
+
+func resolvePath(base, p string) string {
+	// Configurations are shared between Windows and Unix machines
+	p = filepath.FromSlash(p)
+	if p == "" || filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(base, p)
+}
+
+// workers returns the number of workers the store's scraper will use.
+func (s Store) workers() int {
+	if s.Workers > 0 {
+		return s.Workers
+	}
+	return defaultWorkers
+}
@@ -0,0 +1,46 @@
+// Package cortesia holds the scrapers' politeness presets (-politeness):
+// named bundles of workers, delay, retry backoff and bandwidth tuned for
+// each store, so running against a site does not start with guessing the
+// numbers. "gentle" is the safe choice for a store not yet known.
+package cortesia
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// Nombres are the presets every scraper has, from the gentlest.
+var Nombres = []string{"gentle", "normal", "aggressive"}
+
+// Predeterminado is the preset without -politeness: the scrapers' own
+// defaults.
+const Predeterminado = "normal"
+
+// Preset is the value a preset gives each flag it covers, by flag name,
+// as it would be written on the command line.
+type Preset map[string]string
+
+// Presets are a scraper's presets by name.
+type Presets map[string]Preset
+
+// Aplicar sets the flags of fs that the preset name covers, except those
+// given on the command line, which win over any preset. It is called after
+// fs is parsed.
+func (ps Presets) Aplicar(fs *flag.FlagSet, name string) error {
+	preset, ok := ps[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return fmt.Errorf("preset desconocido %q (válidos: %s)", name, strings.Join(Nombres, ", "))
+	}
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	for flagName, value := range preset {
+		if explicit[flagName] {
+			continue
+		}
+		if err := fs.Set(flagName, value); err != nil {
+			return fmt.Errorf("preset %s: -%s=%s: %w", name, flagName, value, err)
+		}
+	}
+	return nil
+}
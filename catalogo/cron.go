@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// schedule is a parsed 5-field cron expression (minute hour day-of-month
+// month day-of-week). Each field is a set of allowed values.
+type schedule struct {
+	expr   string
+	minute [60]bool
+	hour   [24]bool
+	dom    [32]bool
+	month  [13]bool
+	dow    [7]bool
+	// domStar/dowStar mirror cron semantics: when both day fields are
+	// restricted, a day matches if either of them does.
+	domStar, dowStar bool
+}
+
+var cronAliases = map[string]string{
+	"@yearly":  "0 0 1 1 *",
+	"@monthly": "0 0 1 * *",
+	"@weekly":  "0 0 * * 0",
+	"@daily":   "0 0 * * *",
+	"@hourly":  "0 * * * *",
+}
+
+// parseSchedule parses expressions like "0 3 * * *", "*/15 8-20 * * 1-5" or "@daily".
+func parseSchedule(expr string) (*schedule, error) {
+	spec := strings.TrimSpace(expr)
+	if alias, ok := cronAliases[spec]; ok {
+		spec = alias
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("schedule %q: se esperaban 5 campos, hay %d", expr, len(fields))
+	}
+
+	s := &schedule{expr: expr, domStar: fields[2] == "*", dowStar: fields[4] == "*"}
+	if err := parseCronField(fields[0], 0, 59, s.minute[:]); err != nil {
+		return nil, fmt.Errorf("schedule %q minuto: %w", expr, err)
+	}
+	if err := parseCronField(fields[1], 0, 23, s.hour[:]); err != nil {
+		return nil, fmt.Errorf("schedule %q hora: %w", expr, err)
+	}
+	if err := parseCronField(fields[2], 1, 31, s.dom[:]); err != nil {
+		return nil, fmt.Errorf("schedule %q día del mes: %w", expr, err)
+	}
+	if err := parseCronField(fields[3], 1, 12, s.month[:]); err != nil {
+		return nil, fmt.Errorf("schedule %q mes: %w", expr, err)
+	}
+	// Day of week accepts 7 as an alias for Sunday.
+	var dow [8]bool
+	if err := parseCronField(fields[4], 0, 7, dow[:]); err != nil {
+		return nil, fmt.Errorf("schedule %q día de la semana: %w", expr, err)
+	}
+	copy(s.dow[:], dow[:7])
+	s.dow[0] = s.dow[0] || dow[7]
+	return s, nil
+}
+
+// parseCronField fills set for a comma-separated list of "*", "n", "a-b",
+// optionally followed by "/step".
+func parseCronField(field string, lo, hi int, set []bool) error {
+	for part := range strings.SplitSeq(field, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return fmt.Errorf("paso inválido en %q", part)
+			}
+			rng, step = part[:i], n
+		}
+
+		start, end := lo, hi
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			a, b, _ := strings.Cut(rng, "-")
+			var err1, err2 error
+			start, err1 = strconv.Atoi(a)
+			end, err2 = strconv.Atoi(b)
+			if err1 != nil || err2 != nil {
+				return fmt.Errorf("rango inválido %q", rng)
+			}
+		default:
+			n, err := strconv.Atoi(rng)
+			if err != nil {
+				return fmt.Errorf("valor inválido %q", rng)
+			}
+			start = n
+			end = n
+			if step > 1 {
+				end = hi
+			}
+		}
+		if start < lo || end > hi || start > end {
+			return fmt.Errorf("%q fuera de rango %d-%d", rng, lo, hi)
+		}
+		for v := start; v <= end; v += step {
+			set[v] = true
+		}
+	}
+	return nil
+}
+
+// Next returns the first time strictly after t that matches the schedule,
+// evaluated in t's location. The search runs on the wall clock, so across
+// daylight saving changes a time the clock repeats fires once, on its
+// first occurrence, and one the clock skips fires when the clock jumps
+// (2:30 on a day that goes from 2:00 to 3:00 fires at 3:00).
+func (s *schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	w := wallUTC(t).Add(time.Minute)
+	// Five years covers any satisfiable expression (e.g. Feb 29).
+	limit := w.AddDate(5, 0, 0)
+	for w.Before(limit) {
+		if !s.month[w.Month()] {
+			w = time.Date(w.Year(), w.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !s.dayMatches(w) {
+			w = time.Date(w.Year(), w.Month(), w.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !s.hour[w.Hour()] {
+			w = w.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+		if !s.minute[w.Minute()] {
+			w = w.Add(time.Minute)
+			continue
+		}
+		if next := wallTime(w, loc); next.After(t) {
+			return next
+		}
+		w = w.Add(time.Minute)
+	}
+	return time.Time{}
+}
+
+// wallTime is the instant the clock in loc shows w's date and time, or,
+// when the clock skips it, the instant right after the jump.
+func wallTime(w time.Time, loc *time.Location) time.Time {
+	t := time.Date(w.Year(), w.Month(), w.Day(), w.Hour(), w.Minute(), 0, 0, loc)
+	for wallUTC(t).Before(w) {
+		t = t.Add(time.Minute)
+	}
+	return t
+}
+
+// wallUTC is the date and time t's clock shows, as a UTC time.
+func wallUTC(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC)
+}
+
+func (s *schedule) dayMatches(t time.Time) bool {
+	dom, dow := s.dom[t.Day()], s.dow[t.Weekday()]
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+func (s *schedule) String() string {
+	return s.expr
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestParseScheduleErrores(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"0 3 * *", "se esperaban 5 campos"},
+		{"0 3 * * * *", "se esperaban 5 campos"},
+		{"60 3 * * *", "minuto"},
+		{"0 24 * * *", "hora"},
+		{"0 3 0 * *", "día del mes"},
+		{"0 3 * 13 *", "mes"},
+		{"0 3 * * 8", "día de la semana"},
+		{"5-1 * * * *", "fuera de rango"},
+		{"*/0 * * * *", "paso inválido"},
+		{"a * * * *", "valor inválido"},
+		{"1-x * * * *", "rango inválido"},
+		{"@cada-rato", "se esperaban 5 campos"},
+	}
+	for _, tt := range tests {
+		_, err := parseSchedule(tt.expr)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("parseSchedule(%q) = %v, se esperaba un error con %q", tt.expr, err, tt.want)
+		}
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	at := func(s string) time.Time {
+		v, err := time.Parse("2006-01-02 15:04", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	tests := []struct {
+		expr, from string
+		want       []string
+	}{
+		{"0 3 * * *", "2025-06-10 02:59", []string{"2025-06-10 03:00", "2025-06-11 03:00"}},
+		{"0 3 * * *", "2025-06-10 03:00", []string{"2025-06-11 03:00"}},
+		{"@hourly", "2025-06-10 23:30", []string{"2025-06-11 00:00", "2025-06-11 01:00"}},
+		{"@monthly", "2025-12-15 00:00", []string{"2026-01-01 00:00"}},
+
+		// Ranges, steps and lists
+		{"*/15 8-9 * * *", "2025-06-10 07:50", []string{"2025-06-10 08:00", "2025-06-10 08:15", "2025-06-10 08:30", "2025-06-10 08:45", "2025-06-10 09:00"}},
+		{"*/15 8-9 * * *", "2025-06-10 09:45", []string{"2025-06-11 08:00"}},
+		{"10-20/5 * * * *", "2025-06-10 00:00", []string{"2025-06-10 00:10", "2025-06-10 00:15", "2025-06-10 00:20", "2025-06-10 01:10"}},
+		{"5/20 * * * *", "2025-06-10 00:00", []string{"2025-06-10 00:05", "2025-06-10 00:25", "2025-06-10 00:45", "2025-06-10 01:05"}},
+		{"0 6,18 * * *", "2025-06-10 07:00", []string{"2025-06-10 18:00", "2025-06-11 06:00"}},
+		{"0 0 * 2-3 *", "2025-01-31 12:00", []string{"2025-02-01 00:00"}},
+
+		// Day of week: 2025-06-10 is a Tuesday; 7 is Sunday too
+		{"0 9 * * 1-5", "2025-06-13 10:00", []string{"2025-06-16 09:00"}},
+		{"0 9 * * 7", "2025-06-10 00:00", []string{"2025-06-15 09:00"}},
+		{"0 9 * * 0,6", "2025-06-10 00:00", []string{"2025-06-14 09:00", "2025-06-15 09:00", "2025-06-21 09:00"}},
+
+		// Both day fields restricted: either one matches
+		{"0 0 1 * 1", "2025-06-10 00:00", []string{"2025-06-16 00:00", "2025-06-23 00:00", "2025-06-30 00:00", "2025-07-01 00:00", "2025-07-07 00:00"}},
+		// Only one restricted: it alone decides
+		{"0 0 13 * *", "2025-06-10 00:00", []string{"2025-06-13 00:00", "2025-07-13 00:00"}},
+		{"0 0 * * 5", "2025-06-10 00:00", []string{"2025-06-13 00:00", "2025-06-20 00:00"}},
+
+		// Days some months lack
+		{"0 0 31 * *", "2025-04-01 00:00", []string{"2025-05-31 00:00", "2025-07-31 00:00"}},
+		{"0 0 29 2 *", "2025-03-01 00:00", []string{"2028-02-29 00:00"}},
+	}
+	for _, tt := range tests {
+		s, err := parseSchedule(tt.expr)
+		if err != nil {
+			t.Fatalf("parseSchedule(%q): %v", tt.expr, err)
+		}
+		next := at(tt.from)
+		for _, w := range tt.want {
+			next = s.Next(next)
+			if !next.Equal(at(w)) {
+				t.Errorf("%q desde %s: %s, se esperaba %s", tt.expr, tt.from, next.Format("2006-01-02 15:04"), w)
+				break
+			}
+		}
+	}
+
+	if s, _ := parseSchedule("0 0 30 2 *"); !s.Next(at("2025-01-01 00:00")).IsZero() {
+		t.Errorf("\"0 0 30 2 *\" nunca se cumple y Next no devolvió el tiempo cero")
+	}
+}
+
+// TestScheduleNextHorarioVerano runs schedules across daylight saving
+// changes: a time the clock repeats fires once, and one it skips fires when
+// the clock jumps.
+func TestScheduleNextHorarioVerano(t *testing.T) {
+	tests := []struct {
+		zona, expr, from string
+		want             []string
+	}{
+		// New York: 2025-03-09 02:00 EST → 03:00 EDT
+		{"America/New_York", "30 2 * * *", "2025-03-08 12:00", []string{"2025-03-09 03:00 EDT", "2025-03-10 02:30 EDT"}},
+		{"America/New_York", "0 3 * * *", "2025-03-08 12:00", []string{"2025-03-09 03:00 EDT", "2025-03-10 03:00 EDT"}},
+		{"America/New_York", "0 * * * *", "2025-03-09 00:30", []string{"2025-03-09 01:00 EST", "2025-03-09 03:00 EDT", "2025-03-09 04:00 EDT"}},
+		// New York: 2025-11-02 02:00 EDT → 01:00 EST
+		{"America/New_York", "30 1 * * *", "2025-11-01 12:00", []string{"2025-11-02 01:30 EDT", "2025-11-03 01:30 EST"}},
+		{"America/New_York", "0 3 * * *", "2025-11-01 12:00", []string{"2025-11-02 03:00 EST", "2025-11-03 03:00 EST"}},
+		{"America/New_York", "0 * * * *", "2025-11-02 00:30", []string{"2025-11-02 01:00 EDT", "2025-11-02 02:00 EST", "2025-11-02 03:00 EST"}},
+		// Mexico City, the stores' default zone, before it dropped daylight
+		// saving: 2022-04-03 02:00 CST → 03:00 CDT, 2022-10-30 02:00 CDT → 01:00 CST
+		{"America/Mexico_City", "30 2 * * *", "2022-04-02 12:00", []string{"2022-04-03 03:00 CDT", "2022-04-04 02:30 CDT"}},
+		{"America/Mexico_City", "30 1 * * *", "2022-10-29 12:00", []string{"2022-10-30 01:30 CDT", "2022-10-31 01:30 CST"}},
+		// and after: no changes
+		{"America/Mexico_City", "30 2 * * *", "2025-04-05 12:00", []string{"2025-04-06 02:30 CST", "2025-04-07 02:30 CST"}},
+	}
+	for _, tt := range tests {
+		loc, err := time.LoadLocation(tt.zona)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := parseSchedule(tt.expr)
+		if err != nil {
+			t.Fatalf("parseSchedule(%q): %v", tt.expr, err)
+		}
+		next, err := time.ParseInLocation("2006-01-02 15:04", tt.from, loc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, w := range tt.want {
+			next = s.Next(next)
+			if got := next.Format("2006-01-02 15:04 MST"); got != w {
+				t.Errorf("%s %q desde %s: %s, se esperaba %s", tt.zona, tt.expr, tt.from, got, w)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,589 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"catalogo/metrics"
+	"catalogo/runid"
+	"catalogo/secretos"
+	"catalogo/status"
+)
+
+// storeStatus is the daemon's view of one store, exposed on /api/tiendas.
+type storeStatus struct {
+	ID            string    `json:"id"`
+	Nombre        string    `json:"nombre"`
+	Schedule      string    `json:"schedule"`
+	Ejecutando    bool      `json:"ejecutando"`
+	Corridas      int       `json:"corridas"`
+	UltimaCorrida string    `json:"ultimaCorrida,omitempty"`
+	UltimoInicio  time.Time `json:"ultimoInicio,omitzero"`
+	UltimoFin     time.Time `json:"ultimoFin,omitzero"`
+	UltimoError   string    `json:"ultimoError,omitempty"`
+	Proxima       time.Time `json:"proxima,omitzero"`
+	UltimoWatch   time.Time `json:"ultimoWatch,omitzero"`
+	ErrorWatch    string    `json:"errorWatch,omitempty"`
+}
+
+// daemonState is shared between the scheduler goroutines and the HTTP handlers.
+type daemonState struct {
+	mu     sync.Mutex
+	stores map[string]*storeStatus
+
+	// metricsDir receives one <id>.prom file per store from the scrapers'
+	// -metrics-file; empty disables it.
+	metricsDir  string
+	metrics     *metrics.Registry
+	runsTotal   *metrics.Counter
+	runDuration *metrics.Gauge
+	lastSuccess *metrics.Gauge
+
+	// alerts is evaluated after every successful run; nil disables it.
+	alerts *priceAlerts
+}
+
+func newDaemonState(metricsDir string) *daemonState {
+	reg := metrics.NewRegistry(nil)
+	return &daemonState{
+		stores:      make(map[string]*storeStatus),
+		metricsDir:  metricsDir,
+		metrics:     reg,
+		runsTotal:   reg.Counter("catalogo_daemon_runs_total", "Corridas ejecutadas por el daemon, por resultado.", "tienda", "resultado"),
+		runDuration: reg.Gauge("catalogo_daemon_run_duration_seconds", "Duración de la última corrida.", "tienda"),
+		lastSuccess: reg.Gauge("catalogo_daemon_last_success_timestamp_seconds", "Momento de la última corrida exitosa (unix).", "tienda"),
+	}
+}
+
+// recordRun updates the daemon metrics after a run of store id.
+func (d *daemonState) recordRun(id string, err error, elapsed time.Duration) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	} else {
+		d.lastSuccess.Set(float64(time.Now().Unix()), id)
+	}
+	d.runsTotal.Inc(id, result)
+	d.runDuration.Set(elapsed.Seconds(), id)
+}
+
+// scraperMetricsFile is where the scraper of store id writes its metrics.
+func (d *daemonState) scraperMetricsFile(id string) string {
+	if d.metricsDir == "" {
+		return ""
+	}
+	return filepath.Join(d.metricsDir, id+".prom")
+}
+
+// update applies fn to the status of store id under the lock.
+func (d *daemonState) update(id string, fn func(*storeStatus)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	fn(d.stores[id])
+}
+
+// snapshot returns a copy of the status of store id, if the daemon tracks it.
+func (d *daemonState) snapshot(id string) (storeStatus, bool) {
+	if d == nil {
+		return storeStatus{}, false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	st, ok := d.stores[id]
+	if !ok {
+		return storeStatus{}, false
+	}
+	return *st, true
+}
+
+func runDaemon(args []string) error {
+	fs := flag.NewFlagSet("daemon", flag.ContinueOnError)
+	configPath := fs.String("config", "catalogo.json", "Ruta del archivo de configuración")
+	defaultSchedule := fs.String("schedule", "0 3 * * *", "Expresión cron para las tiendas sin schedule propio")
+	addr := fs.String("addr", ":8080", "Dirección HTTP de los endpoints de serve/dashboard (vacío = desactivado)")
+	var policy runPolicy
+	policy.register(fs)
+	jitter := fs.Duration("jitter", 0, "Retraso aleatorio máximo añadido a cada corrida programada (ej. 15m)")
+	watchInterval := fs.Duration("watch-interval", 30*time.Minute, "Cada cuánto revisar la watchlist de las tiendas que la definen")
+	metricsDir := fs.String("metrics-dir", defaultMetricsDir(), "Directorio donde los scrapers dejan sus métricas para /metrics (vacío = desactivado)")
+	indexPath := fs.String("indice", "indice-busqueda.idx", "Índice generado con catalogo index, usado por /api/buscar")
+	unifiedPath := fs.String("unificado", "catalogo-unificado.json", "Catálogo unificado de catalogo combine, en un archivo o en partes, usado por /api/unificado")
+	var af alertFlags
+	af.register(fs)
+	var guard leakGuard
+	guard.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	alerts, err := af.open(cfg)
+	if err != nil {
+		return err
+	}
+	policy.apply(cfg)
+	for i := range cfg.Tiendas {
+		if cfg.Tiendas[i].jitter == 0 {
+			cfg.Tiendas[i].jitter = *jitter
+		}
+		if cfg.Tiendas[i].watchInterval == 0 {
+			cfg.Tiendas[i].watchInterval = *watchInterval
+		}
+	}
+
+	state := newDaemonState(*metricsDir)
+	state.alerts = alerts
+	guard.instrument(state.metrics)
+	orch, err := newOrchestrator(policy, cfg.Tiendas)
+	if err != nil {
+		return err
+	}
+	schedules := make(map[string]*schedule)
+	for _, s := range cfg.Tiendas {
+		expr := s.Schedule
+		if expr == "" {
+			expr = *defaultSchedule
+		}
+		sched, err := parseSchedule(expr)
+		if err != nil {
+			return fmt.Errorf("tienda %s: %w", s.ID, err)
+		}
+		schedules[s.ID] = sched
+		state.stores[s.ID] = &storeStatus{ID: s.ID, Nombre: s.Nombre, Schedule: expr}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *addr != "" {
+		srv := &http.Server{Addr: *addr, Handler: newServeMux(cfg, state, *metricsDir, *indexPath, *unifiedPath)}
+		go func() {
+			log.Printf("[SERVE]  Escuchando en %s", *addr)
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("[ERROR]  Servidor HTTP: %v", err)
+			}
+		}()
+		defer func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			srv.Shutdown(shutdownCtx)
+		}()
+	}
+
+	log.Printf("[DAEMON] %d tiendas programadas", len(cfg.Tiendas))
+	for {
+		loopCtx, cancel := context.WithCancel(ctx)
+		loops := startLoops(loopCtx, cfg, schedules, orch, state)
+		restart := guard.watch(ctx, loops, state)
+		cancel()
+		<-loops
+		if !restart {
+			break
+		}
+		log.Printf("[DAEMON] Ciclos de corridas reiniciados")
+	}
+	log.Printf("[DAEMON] Detenido")
+	return nil
+}
+
+// startLoops starts the schedule and watch loops of every store and returns
+// a channel closed once all of them have returned, after ctx is cancelled.
+func startLoops(ctx context.Context, cfg *Config, schedules map[string]*schedule, orch *orchestrator, state *daemonState) <-chan struct{} {
+	var wg sync.WaitGroup
+	for _, s := range cfg.Tiendas {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			scheduleLoop(ctx, s, schedules[s.ID], orch, state)
+		}()
+		if s.Watchlist != "" {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				watchLoop(ctx, s, orch, state)
+			}()
+		}
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	return done
+}
+
+func defaultMetricsDir() string {
+	return filepath.Join(os.TempDir(), "catalogo-metrics")
+}
+
+// runOnce runs the selected stores (all when ids is empty) one time, through
+// the same orchestration rules the daemon uses.
+func runOnce(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	configPath := fs.String("config", "catalogo.json", "Ruta del archivo de configuración")
+	ids := fs.String("tiendas", "", "IDs de tiendas separados por coma (vacío = todas)")
+	metricsDir := fs.String("metrics-dir", "", "Directorio donde los scrapers dejan sus métricas Prometheus (vacío = desactivado)")
+	var policy runPolicy
+	policy.register(fs)
+	var af alertFlags
+	af.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	alerts, err := af.open(cfg)
+	if err != nil {
+		return err
+	}
+	policy.apply(cfg)
+	stores := cfg.Tiendas
+	if *ids != "" {
+		stores = nil
+		for id := range strings.SplitSeq(*ids, ",") {
+			s := cfg.store(strings.TrimSpace(id))
+			if s == nil {
+				return fmt.Errorf("tienda desconocida: %q", id)
+			}
+			stores = append(stores, *s)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	state := newDaemonState(*metricsDir)
+	state.alerts = alerts
+	orch, err := newOrchestrator(policy, stores)
+	if err != nil {
+		return err
+	}
+	var wg sync.WaitGroup
+	var failed atomic.Int32
+	for _, s := range stores {
+		state.stores[s.ID] = &storeStatus{ID: s.ID, Nombre: s.Nombre}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := runStore(ctx, s, orch, state); err != nil {
+				failed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := failed.Load(); n > 0 {
+		return fmt.Errorf("%d de %d tiendas fallaron", n, len(stores))
+	}
+	return nil
+}
+
+// scheduleLoop sleeps until the next scheduled time (plus the store's offset
+// and a random jitter) and runs the store's scraper, until ctx is cancelled.
+func scheduleLoop(ctx context.Context, s Store, sched *schedule, orch *orchestrator, state *daemonState) {
+	for {
+		next := sched.Next(time.Now().Add(-s.offset))
+		if next.IsZero() {
+			log.Printf("[DAEMON] %s: schedule %q nunca se cumple", s.ID, sched)
+			return
+		}
+		next = next.Add(s.offset)
+		if s.jitter > 0 {
+			next = next.Add(rand.N(s.jitter))
+		}
+		state.update(s.ID, func(st *storeStatus) { st.Proxima = next })
+		log.Printf("[DAEMON] %s: próxima corrida %s", s.ID, next.Format(time.DateTime))
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		runStore(ctx, s, orch, state)
+	}
+}
+
+// runStore runs one scrape of s, retrying failed attempts per the store's
+// policy. The store gives up its queue slot while waiting to retry.
+func runStore(ctx context.Context, s Store, orch *orchestrator, state *daemonState) error {
+	var err error
+	for attempt := range s.Reintentos + 1 {
+		if attempt > 0 {
+			log.Printf("[RETRY]  %s: reintento %d/%d en %v", s.ID, attempt, s.Reintentos, s.retryDelay)
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(s.retryDelay):
+			}
+		}
+		if err = runStoreOnce(ctx, s, orch, state); err == nil || ctx.Err() != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// runStoreOnce waits for the orchestrator to allow it, runs one scrape of s
+// within the store's timeout and records the outcome in state.
+func runStoreOnce(ctx context.Context, s Store, orch *orchestrator, state *daemonState) error {
+	release, err := acquireOutsideBlackout(ctx, s, orch)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	id := runid.New()
+	state.update(s.ID, func(st *storeStatus) {
+		st.Ejecutando = true
+		st.UltimoInicio = start
+		st.UltimaCorrida = id
+	})
+	log.Printf("[RUN]    %s: iniciando corrida %s", s.ID, id)
+
+	extra := orch.bandwidthArgs(s)
+	if f := state.scraperMetricsFile(s.ID); f != "" {
+		extra = append(extra, "-metrics-file", f)
+	}
+	// postRun gets the scraper's status file, so the scraper writes one
+	// even when the store's args don't ask for it
+	statusFile := s.statusFile()
+	if len(s.Hooks.PostRun) > 0 && statusFile == "" {
+		statusFile = filepath.Join(os.TempDir(), "catalogo-status-"+id+".json")
+		extra = append(extra, "-status-file", statusFile)
+		defer os.Remove(statusFile)
+	}
+	env := []string{runid.EnvVar + "=" + id, "CATALOGO_TIENDA=" + s.ID, "CATALOGO_SALIDA=" + s.Salida}
+	if err = s.Hooks.Pre(ctx, env); err == nil {
+		err = runScraper(ctx, s, id, extra...)
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("timeout de %v excedido: %w", s.timeout, err)
+		}
+	}
+	state.recordRun(s.ID, err, time.Since(start))
+	// The hook reports the run even when the daemon is stopping or the
+	// run timed out
+	postStatus := postRunStatus(statusFile, s, id, start, err)
+	if herr := s.Hooks.Post(context.WithoutCancel(ctx), env, postStatus); herr != nil {
+		log.Printf("[HOOK]   %s (corrida %s): %v", s.ID, runid.Short(id), herr)
+	}
+
+	state.update(s.ID, func(st *storeStatus) {
+		st.Ejecutando = false
+		st.UltimoFin = time.Now()
+		st.Corridas++
+		st.UltimoError = ""
+		if err != nil {
+			st.UltimoError = err.Error()
+		}
+	})
+	if err != nil {
+		log.Printf("[ERROR]  %s (corrida %s): %v", s.ID, runid.Short(id), err)
+		return err
+	}
+	log.Printf("[RUN]    %s: corrida %s terminada en %v", s.ID, runid.Short(id), time.Since(start).Round(time.Second))
+	state.alerts.evaluate()
+	return nil
+}
+
+// acquireOutsideBlackout waits for the orchestrator, deferring the run while
+// the store is inside one of its maintenance windows. The window is checked
+// again after acquiring, since queueing may have taken us into one.
+func acquireOutsideBlackout(ctx context.Context, s Store, orch *orchestrator) (func(), error) {
+	for {
+		if err := waitBlackout(ctx, s); err != nil {
+			return nil, err
+		}
+		release, err := orch.acquire(ctx, s)
+		if err != nil {
+			return nil, err
+		}
+		if _, in := s.blackoutUntil(time.Now()); !in {
+			return release, nil
+		}
+		release()
+	}
+}
+
+// waitBlackout blocks until s is outside its maintenance windows.
+func waitBlackout(ctx context.Context, s Store) error {
+	end, in := s.blackoutUntil(time.Now())
+	if !in {
+		return nil
+	}
+	log.Printf("[BLACKOUT] %s: ventana de mantenimiento, corrida diferida hasta %s", s.ID, end.Format("15:04"))
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(time.Until(end)):
+		return nil
+	}
+}
+
+// watchLoop re-checks the store's watchlist every watchInterval, skipping
+// ticks while a full run of the store is in progress.
+func watchLoop(ctx context.Context, s Store, orch *orchestrator, state *daemonState) {
+	ticker := time.NewTicker(s.watchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if st, _ := state.snapshot(s.ID); st.Ejecutando {
+			continue
+		}
+		if _, in := s.blackoutUntil(time.Now()); in {
+			continue
+		}
+		release, err := orch.acquire(ctx, s)
+		if err != nil {
+			return
+		}
+		id := runid.New()
+		log.Printf("[WATCH]  %s: revisando watchlist (corrida %s)", s.ID, id)
+		err = runScraper(ctx, s, id, append(orch.bandwidthArgs(s), "-watch", s.Watchlist)...)
+		release()
+
+		state.update(s.ID, func(st *storeStatus) {
+			st.UltimoWatch = time.Now()
+			st.ErrorWatch = ""
+			if err != nil {
+				st.ErrorWatch = err.Error()
+			}
+		})
+		if err != nil {
+			log.Printf("[ERROR]  %s watch: %v", s.ID, err)
+		}
+	}
+}
+
+// runScraper executes the store's scraper command with any extra flags as run
+// runID, forwarding its output with the store id as prefix.
+func runScraper(ctx context.Context, s Store, runID string, extra ...string) error {
+	args := append(append([]string{}, s.Comando[1:]...), s.Args...)
+	args = append(args, extra...)
+	if s.Workers > 0 {
+		args = append(args, "-workers", strconv.Itoa(s.Workers))
+	}
+	if s.Salida != "" {
+		args = append(args, "-output", s.Salida)
+	}
+
+	cmd := exec.CommandContext(ctx, s.Comando[0], args...)
+	cmd.Dir = s.Dir
+	cmd.Env = append(os.Environ(), runid.EnvVar+"="+runID)
+	configureProcess(cmd)
+
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	cmd.Stderr = cmd.Stdout
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("error iniciando scraper: %w", err)
+	}
+	forwardOutput(s.ID, out)
+
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("scraper terminó con error: %w", err)
+	}
+	return nil
+}
+
+// statusFile is the -status-file the store's args give its scraper, or "".
+func (s Store) statusFile() string {
+	fpath := s.argValue("status-file")
+	if fpath == "" || filepath.IsAbs(fpath) {
+		return fpath
+	}
+	return filepath.Join(s.Dir, fpath)
+}
+
+// argValue is the value the store's args give the scraper's flag name, the
+// last one if repeated, or "".
+func (s Store) argValue(name string) string {
+	var value string
+	for i, a := range s.Args {
+		n, v, hasValue := strings.Cut(strings.TrimLeft(a, "-"), "=")
+		if n != name || !strings.HasPrefix(a, "-") {
+			continue
+		}
+		if !hasValue && i+1 < len(s.Args) {
+			v = s.Args[i+1]
+		}
+		value = v
+	}
+	return value
+}
+
+// postRunStatus is the status JSON the store's postRun hook receives: the
+// scraper's status file, completed with the run's outcome when the scraper
+// could not finish it.
+func postRunStatus(fpath string, s Store, id string, start time.Time, runErr error) []byte {
+	var st status.Status
+	if fpath != "" {
+		if data, err := os.ReadFile(fpath); err == nil {
+			json.Unmarshal(data, &st)
+		}
+	}
+	if st.Corrida != id {
+		st = status.Status{Tienda: s.ID, Corrida: id, Fase: "inicio", Iniciado: start}
+	}
+	if st.Terminado == nil {
+		now := time.Now()
+		st.Terminado, st.Actualizado, st.Fase = &now, now, "terminado"
+	}
+	if runErr != nil {
+		st.Fase = "fallido"
+		if st.Error == "" {
+			st.Error = secretos.Ocultar(runErr.Error())
+		}
+	}
+	data, _ := json.MarshalIndent(st, "", "    ")
+	return data
+}
+
+// forwardOutput copies the child's log lines to our stderr, prefixed by store.
+func forwardOutput(id string, r io.Reader) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		fmt.Fprintf(os.Stderr, "%-8s │ %s\n", id, sc.Text())
+	}
+}
@@ -0,0 +1,100 @@
+// Package desafio recognizes the bot-challenge and CAPTCHA pages anti-bot
+// services answer with instead of a store's page (Cloudflare's "Just a
+// moment...", DataDome, PerimeterX, ...), so a scraper stops with a clear
+// error instead of parsing them as products without name, price or stock.
+package desafio
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// firmas are the marks of each service's challenge page. Some also show up
+// in the store's own pages (Cloudflare's bot-management script, a
+// reCAPTCHA on the contact form), so they only count on error responses.
+var firmas = []struct {
+	servicio string
+	marcas   []string
+	enError  bool
+}{
+	{"Cloudflare", []string{"cf_chl_opt", "cf-chl-bypass", "<title>Just a moment...</title>", "Attention Required! | Cloudflare"}, false},
+	{"Cloudflare", []string{"/cdn-cgi/challenge-platform/"}, true},
+	{"DataDome", []string{"captcha-delivery.com"}, false},
+	{"PerimeterX", []string{"px-captcha", "_pxCaptcha"}, false},
+	{"Sucuri", []string{"sucuri_cloudproxy_js", "Sucuri WebSite Firewall"}, false},
+	{"Imperva", []string{"_Incapsula_Resource", "Incapsula incident ID"}, false},
+	{"AWS WAF", []string{"awsWafCookieDomainList", "gokuProps"}, false},
+	{"hCaptcha", []string{"hcaptcha.com/1/api.js"}, true},
+	{"reCAPTCHA", []string{"google.com/recaptcha/", "recaptcha/api.js"}, true},
+}
+
+// Detectar names the service whose challenge a response is, or "" when it
+// looks like the store's own.
+func Detectar(status int, header http.Header, body []byte) string {
+	if strings.EqualFold(header.Get("cf-mitigated"), "challenge") {
+		return "Cloudflare"
+	}
+	enError := status == http.StatusForbidden || status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable
+	for _, f := range firmas {
+		if f.enError && !enError {
+			continue
+		}
+		for _, m := range f.marcas {
+			if bytes.Contains(body, []byte(m)) {
+				return f.servicio
+			}
+		}
+	}
+	return ""
+}
+
+// ErrBloqueado is what every Error wraps, for errors.Is.
+var ErrBloqueado = errors.New("tienda bloqueada")
+
+// Error is a challenge page a store answered with.
+type Error struct {
+	Servicio string
+	URL      string
+	Status   int
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%v: %s respondió con un desafío anti-bot de %s (HTTP %d); se detiene la corrida en vez de leerlo como productos", ErrBloqueado, e.URL, e.Servicio, e.Status)
+}
+
+func (e *Error) Unwrap() error { return ErrBloqueado }
+
+// Bloqueo is a store's state during a run: once a challenge marks it, every
+// further request to the store is refused with the same error, since more
+// requests only get the scraper blocked for longer. Its zero value is an
+// unblocked store and it is safe for concurrent use.
+type Bloqueo struct {
+	mu  sync.Mutex
+	err *Error
+}
+
+// Marcar records the challenge e and returns the store's error: e itself
+// when it is the first, with primero set, or the first one otherwise.
+func (b *Bloqueo) Marcar(e *Error) (err error, primero bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		return b.err, false
+	}
+	b.err = e
+	return e, true
+}
+
+// Err is the challenge that blocked the store, or nil.
+func (b *Bloqueo) Err() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err == nil {
+		return nil
+	}
+	return b.err
+}
@@ -0,0 +1,262 @@
+// Package diskq is a FIFO queue kept in an append-only NDJSON file instead of
+// memory, for crawls too large to hold every pending task in a channel. The
+// position of the oldest unfinished item is saved next to it, so a run that
+// dies can pick up where it left off; items being worked on at the time are
+// delivered again.
+package diskq
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// DefaultPath is the queue file used for output.
+func DefaultPath(output string) string {
+	return output + ".queue.ndjson"
+}
+
+// Queue is a disk-backed FIFO of T values, encoded as JSON. It is safe for
+// concurrent use.
+type Queue[T any] struct {
+	path string
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	w        *os.File
+	r        *os.File
+	br       *bufio.Reader
+	pos      *os.File
+	size     int64 // end of the data file
+	read     int64 // offset of the next item to pop
+	unread   int
+	inflight map[int64]bool
+	ended    bool
+	err      error
+}
+
+// Open opens the queue at fpath, creating it if needed. Items left unfinished
+// by a previous run are queued again; Len reports how many there are.
+func Open[T any](fpath string) (*Queue[T], error) {
+	w, err := os.OpenFile(fpath, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error abriendo cola: %w", err)
+	}
+	pos, err := os.OpenFile(fpath+".pos", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		w.Close()
+		return nil, fmt.Errorf("error abriendo cola: %w", err)
+	}
+	q := &Queue[T]{path: fpath, w: w, pos: pos, inflight: make(map[int64]bool)}
+	q.cond = sync.NewCond(&q.mu)
+	if err := q.recover(); err != nil {
+		q.Close()
+		return nil, err
+	}
+	return q, nil
+}
+
+// recover restores the saved position, counts the items after it and drops a
+// line cut short by a crash.
+func (q *Queue[T]) recover() error {
+	var buf [8]byte
+	if n, _ := q.pos.ReadAt(buf[:], 0); n == len(buf) {
+		q.read = int64(binary.LittleEndian.Uint64(buf[:]))
+	}
+
+	// Scan in chunks: the file may be larger than we want in memory
+	chunk := make([]byte, 64*1024)
+	var off int64
+	lines := 0
+	for {
+		n, err := q.w.Read(chunk)
+		for i, c := range chunk[:n] {
+			if c != '\n' {
+				continue
+			}
+			if off+int64(i) >= q.read {
+				q.unread++
+			}
+			lines++
+			q.size = off + int64(i) + 1
+		}
+		off += int64(n)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error leyendo cola: %w", err)
+		}
+	}
+	if q.read > q.size {
+		// The position outlived the data it pointed into: deliver it all again
+		q.read, q.unread = 0, lines
+	}
+	if err := q.w.Truncate(q.size); err != nil {
+		return fmt.Errorf("error leyendo cola: %w", err)
+	}
+	if _, err := q.w.Seek(q.size, io.SeekStart); err != nil {
+		return err
+	}
+
+	var err error
+	if q.r, err = os.Open(q.path); err != nil {
+		return fmt.Errorf("error abriendo cola: %w", err)
+	}
+	if _, err := q.r.Seek(q.read, io.SeekStart); err != nil {
+		return err
+	}
+	q.br = bufio.NewReader(q.r)
+	return nil
+}
+
+// Len returns the number of items waiting to be popped.
+func (q *Queue[T]) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.unread
+}
+
+// Push appends v to the queue.
+func (q *Queue[T]) Push(v T) error {
+	line, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("error serializando item: %w", err)
+	}
+	line = append(line, '\n')
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.err != nil {
+		return q.err
+	}
+	if q.w == nil {
+		return errors.New("cola cerrada")
+	}
+	if _, err := q.w.Write(line); err != nil {
+		q.err = fmt.Errorf("error escribiendo cola: %w", err)
+		return q.err
+	}
+	q.size += int64(len(line))
+	q.unread++
+	q.cond.Signal()
+	return nil
+}
+
+// Pop blocks until an item is available and returns it with the ID to pass
+// to Done. It returns false once End was called and the queue is empty, or
+// the file can no longer be read.
+func (q *Queue[T]) Pop() (T, int64, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for {
+		var v T
+		for q.unread == 0 && !q.ended && q.err == nil {
+			q.cond.Wait()
+		}
+		if q.unread == 0 || q.err != nil || q.r == nil {
+			return v, 0, false
+		}
+
+		line, err := q.br.ReadBytes('\n')
+		if err != nil {
+			q.err = fmt.Errorf("error leyendo cola: %w", err)
+			q.cond.Broadcast()
+			return v, 0, false
+		}
+		id := q.read
+		q.read += int64(len(line))
+		q.unread--
+		if err := json.Unmarshal(line, &v); err != nil {
+			// A corrupt item is skipped rather than blocking the rest
+			q.commit()
+			continue
+		}
+		q.inflight[id] = true
+		return v, id, true
+	}
+}
+
+// Done marks the item popped with id as finished, so a restart does not
+// deliver it again.
+func (q *Queue[T]) Done(id int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.inflight, id)
+	q.commit()
+}
+
+// commit saves the offset of the oldest unfinished item and, once every item
+// is finished, empties the file so it does not grow for the whole run.
+func (q *Queue[T]) commit() {
+	if q.err != nil || q.pos == nil {
+		return
+	}
+	off := q.read
+	for id := range q.inflight {
+		off = min(off, id)
+	}
+	if off == q.size && q.size > 0 {
+		if err := q.w.Truncate(0); err == nil {
+			q.w.Seek(0, io.SeekStart)
+			q.r.Seek(0, io.SeekStart)
+			q.br.Reset(q.r)
+			q.size, q.read, off = 0, 0, 0
+		}
+	}
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], uint64(off))
+	if _, err := q.pos.WriteAt(buf[:], 0); err != nil {
+		q.err = fmt.Errorf("error escribiendo posición de la cola: %w", err)
+		q.cond.Broadcast()
+	}
+}
+
+// End signals that no more items will be pushed: Pop returns false once the
+// queue is empty.
+func (q *Queue[T]) End() {
+	q.mu.Lock()
+	q.ended = true
+	q.cond.Broadcast()
+	q.mu.Unlock()
+}
+
+// Err returns the first read or write error, if any.
+func (q *Queue[T]) Err() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.err
+}
+
+// Close closes the queue, keeping its files for the next run to resume.
+func (q *Queue[T]) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.ended = true
+	q.cond.Broadcast()
+	var errs []error
+	for _, f := range []*os.File{q.w, q.r, q.pos} {
+		if f != nil {
+			errs = append(errs, f.Close())
+		}
+	}
+	q.w, q.r, q.pos = nil, nil, nil
+	return errors.Join(errs...)
+}
+
+// Remove closes the queue and deletes its files, once the run is complete.
+func (q *Queue[T]) Remove() error {
+	q.Close()
+	var errs []error
+	for _, fpath := range []string{q.path, q.path + ".pos"} {
+		if err := os.Remove(fpath); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
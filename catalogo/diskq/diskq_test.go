@@ -0,0 +1,212 @@
+package diskq
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+type item struct {
+	N int `json:"n"`
+}
+
+func abrir(t *testing.T, fpath string) *Queue[item] {
+	t.Helper()
+	q, err := Open[item](fpath)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	return q
+}
+
+func push(t *testing.T, q *Queue[item], ns ...int) {
+	t.Helper()
+	for _, n := range ns {
+		if err := q.Push(item{n}); err != nil {
+			t.Fatalf("Push(%d): %v", n, err)
+		}
+	}
+}
+
+// vaciar pops and finishes every item left once pushing has ended.
+func vaciar(t *testing.T, q *Queue[item]) []int {
+	t.Helper()
+	q.End()
+	var got []int
+	for {
+		v, id, ok := q.Pop()
+		if !ok {
+			break
+		}
+		got = append(got, v.N)
+		q.Done(id)
+	}
+	if err := q.Err(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	return got
+}
+
+func appendFile(t *testing.T, fpath, data string) {
+	t.Helper()
+	f, err := os.OpenFile(fpath, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReabrir(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "q.ndjson")
+	q := abrir(t, fpath)
+	push(t, q, 1, 2, 3, 4, 5)
+	q.Pop()
+	_, id2, _ := q.Pop()
+	q.Pop()
+	// 2 finishes, 1 and 3 are still being worked on when the run dies
+	q.Done(id2)
+	q.Close()
+
+	q = abrir(t, fpath)
+	if n := q.Len(); n != 5 {
+		t.Errorf("Len tras reabrir = %d, se esperaban 5", n)
+	}
+	push(t, q, 6)
+	// Everything from the oldest unfinished item is delivered again
+	if got, want := vaciar(t, q), []int{1, 2, 3, 4, 5, 6}; !slices.Equal(got, want) {
+		t.Errorf("tras reabrir: %v, se esperaba %v", got, want)
+	}
+	q.Close()
+
+	// With every item finished the file is emptied and nothing replays
+	if fi, err := os.Stat(fpath); err != nil || fi.Size() != 0 {
+		t.Errorf("la cola terminada no quedó vacía: %v, %v", fi, err)
+	}
+	q = abrir(t, fpath)
+	if n := q.Len(); n != 0 {
+		t.Errorf("Len de una cola terminada = %d, se esperaba 0", n)
+	}
+	q.Close()
+}
+
+func TestReabrirTrasDone(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "q.ndjson")
+	q := abrir(t, fpath)
+	push(t, q, 1, 2, 3, 4)
+	for range 2 {
+		_, id, _ := q.Pop()
+		q.Done(id)
+	}
+	q.Close()
+
+	q = abrir(t, fpath)
+	defer q.Close()
+	if got, want := vaciar(t, q), []int{3, 4}; !slices.Equal(got, want) {
+		t.Errorf("tras reabrir: %v, se esperaba %v", got, want)
+	}
+}
+
+func TestColaTruncada(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "q.ndjson")
+	q := abrir(t, fpath)
+	push(t, q, 1, 2, 3)
+	q.Close()
+	// The run died halfway through writing an item
+	appendFile(t, fpath, `{"n":`)
+
+	q = abrir(t, fpath)
+	if n := q.Len(); n != 3 {
+		t.Errorf("Len con la última línea cortada = %d, se esperaban 3", n)
+	}
+	// The cut line is dropped, so a new item starts on a line of its own
+	push(t, q, 4)
+	q.Close()
+
+	q = abrir(t, fpath)
+	defer q.Close()
+	if got, want := vaciar(t, q), []int{1, 2, 3, 4}; !slices.Equal(got, want) {
+		t.Errorf("tras la línea cortada: %v, se esperaba %v", got, want)
+	}
+}
+
+func TestCommitTrasEscrituraParcial(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "q.ndjson")
+	q := abrir(t, fpath)
+	push(t, q, 1, 2, 3)
+	for range 2 {
+		_, id, _ := q.Pop()
+		q.Done(id)
+	}
+	q.Close()
+	// The position was saved at item 3, then a push was cut short
+	appendFile(t, fpath, `{"n":4`)
+
+	q = abrir(t, fpath)
+	if got, want := vaciar(t, q), []int{3}; !slices.Equal(got, want) {
+		t.Errorf("tras la escritura parcial: %v, se esperaba %v", got, want)
+	}
+	q.Close()
+
+	// Every item finished empties the file; a push cut short after that
+	// leaves nothing to deliver
+	appendFile(t, fpath, `{"n":5`)
+	q = abrir(t, fpath)
+	defer q.Close()
+	if n := q.Len(); n != 0 {
+		t.Errorf("Len = %d, se esperaba 0", n)
+	}
+	push(t, q, 6)
+	if got, want := vaciar(t, q), []int{6}; !slices.Equal(got, want) {
+		t.Errorf("tras vaciar la cola: %v, se esperaba %v", got, want)
+	}
+}
+
+func TestPosicionInvalida(t *testing.T) {
+	tests := []struct {
+		name string
+		pos  []byte
+	}{
+		// A position file cut short while being written
+		{"corta", []byte{3, 0, 0}},
+		// A position past the data left after dropping a cut line
+		{"fuera", binary.LittleEndian.AppendUint64(nil, 1<<20)},
+	}
+	for _, tt := range tests {
+		fpath := filepath.Join(t.TempDir(), "q.ndjson")
+		q := abrir(t, fpath)
+		push(t, q, 1, 2)
+		q.Close()
+		if err := os.WriteFile(fpath+".pos", tt.pos, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		// Without a usable position everything is delivered again
+		q = abrir(t, fpath)
+		if got, want := vaciar(t, q), []int{1, 2}; !slices.Equal(got, want) {
+			t.Errorf("%s: %v, se esperaba %v", tt.name, got, want)
+		}
+		q.Close()
+	}
+}
+
+func TestItemCorrupto(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "q.ndjson")
+	q := abrir(t, fpath)
+	push(t, q, 1)
+	q.Close()
+	appendFile(t, fpath, "no es json\n")
+
+	q = abrir(t, fpath)
+	defer q.Close()
+	push(t, q, 2)
+	if got, want := vaciar(t, q), []int{1, 2}; !slices.Equal(got, want) {
+		t.Errorf("con un item corrupto: %v, se esperaba %v", got, want)
+	}
+}
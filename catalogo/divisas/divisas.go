@@ -0,0 +1,288 @@
+// Package divisas converts catalog prices, in each product's currency, to
+// another one (-convert-to USD) at an exchange rate from Banxico, Open
+// Exchange Rates or a fixed value, so the catalog compares with foreign
+// stores.
+package divisas
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"catalogo/producto"
+	"catalogo/secretos"
+)
+
+// Base is the currency exchange rates are quoted in.
+const Base = producto.MonedaBase
+
+// Fuente gives exchange rates: how many pesos one unit of a currency costs.
+type Fuente interface {
+	TipoCambio(ctx context.Context, moneda string) (float64, error)
+	// Nombre identifies the source in the output ("banxico", "fixed").
+	Nombre() string
+}
+
+// ParseFuente reads the -fx-source flag: "banxico" (the FIX rate, with the
+// secret BANXICO_TOKEN), "openexchange" (the secret OPENEXCHANGERATES_APP_ID)
+// or "fixed:17.2" (pesos per unit, for offline runs and tests).
+func ParseFuente(spec string, client *http.Client) (Fuente, error) {
+	name, arg, _ := strings.Cut(strings.TrimSpace(spec), ":")
+	switch strings.ToLower(name) {
+	case "banxico":
+		token, err := secretos.Leer("BANXICO_TOKEN")
+		if err != nil {
+			return nil, err
+		}
+		if token == "" {
+			return nil, fmt.Errorf("-fx-source banxico necesita BANXICO_TOKEN (o BANXICO_TOKEN_FILE, BANXICO_TOKEN_COMMAND)")
+		}
+		return &banxico{token: token, http: client}, nil
+	case "openexchange":
+		appID, err := secretos.Leer("OPENEXCHANGERATES_APP_ID")
+		if err != nil {
+			return nil, err
+		}
+		if appID == "" {
+			return nil, fmt.Errorf("-fx-source openexchange necesita OPENEXCHANGERATES_APP_ID (o _FILE, _COMMAND)")
+		}
+		return &openExchange{appID: appID, http: client}, nil
+	case "fixed":
+		rate, err := strconv.ParseFloat(arg, 64)
+		if err != nil || rate <= 0 {
+			return nil, fmt.Errorf("tipo de cambio fijo inválido %q", arg)
+		}
+		return &fijo{valor: rate}, nil
+	}
+	return nil, fmt.Errorf("fuente de tipo de cambio desconocida %q (banxico, openexchange o fixed:<valor>)", spec)
+}
+
+// fijo is a rate given on the command line. It is the rate of the first
+// currency asked for, the -convert-to one; it knows no other.
+type fijo struct {
+	valor  float64
+	moneda string
+}
+
+func (f *fijo) TipoCambio(_ context.Context, moneda string) (float64, error) {
+	if f.moneda == "" {
+		f.moneda = moneda
+	}
+	if moneda != f.moneda {
+		return 0, fmt.Errorf("el tipo de cambio fijo es solo de %s", f.moneda)
+	}
+	return f.valor, nil
+}
+
+func (f *fijo) Nombre() string { return "fixed" }
+
+// seriesBanxico are the SIE series of Banxico's daily rates, per currency.
+var seriesBanxico = map[string]string{
+	"USD": "SF43718", // FIX
+	"EUR": "SF46410",
+}
+
+// banxico reads the latest value of a series from Banxico's SIE API.
+type banxico struct {
+	token string
+	http  *http.Client
+}
+
+func (b *banxico) Nombre() string { return "banxico" }
+
+func (b *banxico) TipoCambio(ctx context.Context, moneda string) (float64, error) {
+	serie, ok := seriesBanxico[moneda]
+	if !ok {
+		return 0, fmt.Errorf("banxico: sin serie para %s", moneda)
+	}
+	var resp struct {
+		Bmx struct {
+			Series []struct {
+				Datos []struct {
+					Fecha string `json:"fecha"`
+					Dato  string `json:"dato"`
+				} `json:"datos"`
+			} `json:"series"`
+		} `json:"bmx"`
+	}
+	url := "https://www.banxico.org.mx/SieAPIRest/service/v1/series/" + serie + "/datos/oportuno"
+	if err := getJSON(ctx, b.http, url, map[string]string{"Bmx-Token": b.token}, &resp); err != nil {
+		return 0, fmt.Errorf("banxico: %w", err)
+	}
+	if len(resp.Bmx.Series) == 0 || len(resp.Bmx.Series[0].Datos) == 0 {
+		return 0, fmt.Errorf("banxico: serie %s sin datos", serie)
+	}
+	dato := resp.Bmx.Series[0].Datos[0].Dato
+	rate, err := strconv.ParseFloat(strings.ReplaceAll(dato, ",", ""), 64)
+	if err != nil || rate <= 0 {
+		return 0, fmt.Errorf("banxico: dato inválido %q", dato)
+	}
+	return rate, nil
+}
+
+// openExchange reads the latest rates of openexchangerates.org, which are
+// per US dollar, and crosses them through the peso.
+type openExchange struct {
+	appID string
+	http  *http.Client
+}
+
+func (o *openExchange) Nombre() string { return "openexchange" }
+
+func (o *openExchange) TipoCambio(ctx context.Context, moneda string) (float64, error) {
+	var resp struct {
+		Rates map[string]float64 `json:"rates"`
+	}
+	url := "https://openexchangerates.org/api/latest.json?app_id=" + o.appID
+	if err := getJSON(ctx, o.http, url, nil, &resp); err != nil {
+		return 0, fmt.Errorf("openexchange: %w", err)
+	}
+	base, target := resp.Rates[Base], resp.Rates[moneda]
+	if base <= 0 || target <= 0 {
+		return 0, fmt.Errorf("openexchange: sin tipo de cambio para %s", moneda)
+	}
+	return base / target, nil
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("error parsing respuesta: %w", err)
+	}
+	return nil
+}
+
+// decimales are the ISO 4217 minor units of the currencies that do not use
+// two, the same minor unit the WooCommerce Store API reports per price.
+var decimales = map[string]int{
+	"JPY": 0, "KRW": 0, "CLP": 0, "PYG": 0, "ISK": 0,
+	"BHD": 3, "KWD": 3, "OMR": 3, "JOD": 3, "TND": 3,
+}
+
+// Decimales is the number of decimals of moneda's minor unit.
+func Decimales(moneda string) int {
+	if d, ok := decimales[moneda]; ok {
+		return d
+	}
+	return 2
+}
+
+// Redondear rounds v to the minor unit of moneda.
+func Redondear(v float64, moneda string) float64 {
+	f := math.Pow(10, float64(Decimales(moneda)))
+	return math.Round(v*f) / f
+}
+
+// Centavos sets PrecioCentavos and PrecioOriginalCentavos of every product,
+// in the minor unit of its currency, or clears them when on is false.
+func Centavos(products []producto.Product, on bool) {
+	for i := range products {
+		p := &products[i]
+		p.PrecioCentavos, p.PrecioOriginalCentavos = 0, 0
+		if on {
+			f := math.Pow(10, float64(Decimales(p.Divisa())))
+			p.PrecioCentavos = int64(math.Round(p.Precio * f))
+			p.PrecioOriginalCentavos = int64(math.Round(p.PrecioOriginal * f))
+		}
+	}
+}
+
+// Conversor converts products' prices to Moneda. Each rate is read once
+// per run, so every product of an output uses the same.
+type Conversor struct {
+	Moneda string
+	// TipoCambio is how many pesos one unit of Moneda costs.
+	TipoCambio float64
+	Fuente     string
+
+	fuente Fuente
+	// tasas are the rates of the products' currencies, or why one could
+	// not be read.
+	tasas map[string]tasa
+}
+
+type tasa struct {
+	valor float64
+	err   error
+}
+
+// NewConversor reads the rate of moneda (an ISO 4217 code) from f.
+func NewConversor(ctx context.Context, moneda string, f Fuente) (*Conversor, error) {
+	moneda = strings.ToUpper(strings.TrimSpace(moneda))
+	if len(moneda) != 3 {
+		return nil, fmt.Errorf("moneda inválida %q (código ISO 4217, como USD)", moneda)
+	}
+	c := &Conversor{Moneda: moneda, Fuente: f.Nombre(), fuente: f, tasas: make(map[string]tasa)}
+	rate, err := c.tasa(ctx, moneda)
+	if err != nil {
+		return nil, err
+	}
+	c.TipoCambio = rate
+	return c, nil
+}
+
+// tasa is how many pesos one unit of moneda costs.
+func (c *Conversor) tasa(ctx context.Context, moneda string) (float64, error) {
+	if moneda == Base {
+		return 1, nil
+	}
+	t, ok := c.tasas[moneda]
+	if !ok {
+		t.valor, t.err = c.fuente.TipoCambio(ctx, moneda)
+		c.tasas[moneda] = t
+	}
+	return t.valor, t.err
+}
+
+// Aplicar sets the Conversion of every product, converting from its Moneda.
+// Products whose currency has no rate are left without one and the error
+// is returned. A nil Conversor removes them, so an output never keeps
+// another run's rate.
+func (c *Conversor) Aplicar(ctx context.Context, products []producto.Product) error {
+	var first error
+	for i := range products {
+		p := &products[i]
+		p.Conversion = nil
+		if c == nil {
+			continue
+		}
+		from := p.Divisa()
+		rate, err := c.tasa(ctx, from)
+		if err != nil {
+			if first == nil {
+				first = fmt.Errorf("sin tipo de cambio de %s: %w", from, err)
+			}
+			continue
+		}
+		factor := rate / c.TipoCambio
+		p.Conversion = &producto.Conversion{
+			Moneda:         c.Moneda,
+			TipoCambio:     c.TipoCambio,
+			Fuente:         c.Fuente,
+			Precio:         Redondear(p.Precio*factor, c.Moneda),
+			PrecioOriginal: Redondear(p.PrecioOriginal*factor, c.Moneda),
+		}
+	}
+	return first
+}
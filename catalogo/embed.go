@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"catalogo/embeddings"
+	"catalogo/match"
+	"catalogo/secretos"
+)
+
+// runEmbed exports a vector per product of the given catalogs, or of every
+// store in the configuration, for semantic search; with -buscar it searches
+// the exported vectors instead.
+func runEmbed(args []string) error {
+	fset := flag.NewFlagSet("embed", flag.ContinueOnError)
+	configPath := fset.String("config", "catalogo.json", "Configuración con las tiendas cuando no se indican archivos")
+	apiURL := fset.String("url", "http://localhost:11434/v1/embeddings", "Endpoint de embeddings compatible con OpenAI (por defecto Ollama local)")
+	model := fset.String("modelo", "nomic-embed-text", "Modelo de embeddings")
+	keyEnv := fset.String("clave-env", "EMBEDDINGS_API_KEY", "Secreto con la API key del endpoint, si la pide: la variable de entorno, o <VAR>_FILE o <VAR>_COMMAND")
+	batch := fset.Int("lote", 64, "Textos por petición al endpoint")
+	timeout := fset.Duration("timeout", 2*time.Minute, "Tiempo máximo por petición")
+	output := fset.String("o", "embeddings.jsonl", "Archivo JSON Lines con un vector por producto (vacío = no escribirlo)")
+	qdrantURL := fset.String("qdrant", "", "URL de un servidor Qdrant en el que escribir también los vectores")
+	collection := fset.String("coleccion", "productos", "Colección de Qdrant")
+	qdrantKeyEnv := fset.String("qdrant-clave-env", "QDRANT_API_KEY", "Secreto con la API key de Qdrant, si la pide: la variable de entorno, o <VAR>_FILE o <VAR>_COMMAND")
+	query := fset.String("buscar", "", "En vez de exportar, buscar este texto en los vectores de -o")
+	limit := fset.Int("limite", 10, "Resultados de -buscar")
+	files, err := parseInterspersed(fset, args)
+	if err != nil {
+		return err
+	}
+
+	key, err := secretos.Leer(*keyEnv)
+	if err != nil {
+		return err
+	}
+	client := &embeddings.Cliente{
+		URL:    *apiURL,
+		Modelo: *model,
+		Clave:  key,
+		HTTP:   &http.Client{Timeout: *timeout},
+	}
+	ctx := context.Background()
+	prev, err := embeddings.ReadJSONL(*output)
+	if err != nil {
+		return err
+	}
+	if *query != "" {
+		return searchEmbeddings(ctx, client, prev, *query, *limit)
+	}
+
+	if len(files) == 0 {
+		cfg, err := loadConfig(*configPath)
+		if err != nil {
+			return err
+		}
+		for _, st := range cfg.Tiendas {
+			files = append(files, st.Salida)
+		}
+	}
+	catalogs := make([]match.Catalog, len(files))
+	for i, fpath := range files {
+		if catalogs[i], err = loadCatalog(fpath); err != nil {
+			return err
+		}
+	}
+
+	vectors, st, err := embeddings.Exportar(ctx, client, catalogs, prev, *batch)
+	if err != nil {
+		return err
+	}
+	log.Printf("[EMBED]  %d productos: %d vectores nuevos, %d reutilizados", st.Productos, st.Nuevos, st.Reutilizados)
+	if *output != "" {
+		if err := embeddings.WriteJSONL(vectors, *output); err != nil {
+			return err
+		}
+		log.Printf("[EMBED]  Escrito en %s", *output)
+	}
+	if *qdrantURL != "" && len(vectors) > 0 {
+		qdrantKey, err := secretos.Leer(*qdrantKeyEnv)
+		if err != nil {
+			return err
+		}
+		q := &embeddings.Qdrant{
+			URL:       *qdrantURL,
+			Coleccion: *collection,
+			Clave:     qdrantKey,
+			HTTP:      &http.Client{Timeout: *timeout},
+		}
+		if err := q.Preparar(ctx, len(vectors[0].Vector)); err != nil {
+			return err
+		}
+		if err := q.Upsert(ctx, vectors); err != nil {
+			return err
+		}
+		log.Printf("[EMBED]  %d vectores escritos en la colección %s de %s", len(vectors), *collection, *qdrantURL)
+	}
+	return nil
+}
+
+// searchEmbeddings prints the products whose vectors are closest to q's.
+func searchEmbeddings(ctx context.Context, client *embeddings.Cliente, vectors []embeddings.Vector, q string, limit int) error {
+	if len(vectors) == 0 {
+		return fmt.Errorf("no hay vectores exportados; corre catalogo embed primero")
+	}
+	qv, err := client.Embed(ctx, []string{q})
+	if err != nil {
+		return err
+	}
+	for _, r := range embeddings.Buscar(vectors, qv[0], limit) {
+		fmt.Printf("%.3f  %-10s $%-9.2f %s\n", r.Similitud, r.Tienda, r.Precio, r.Nombre)
+	}
+	return nil
+}
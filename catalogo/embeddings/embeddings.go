@@ -0,0 +1,302 @@
+// Package embeddings turns product names into vectors with an embedding API
+// and stores them, in a JSON Lines sidecar or a Qdrant collection, for
+// semantic search ("cables para iphone" finding "Cable Lightning").
+package embeddings
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"catalogo/canonurl"
+	"catalogo/match"
+	"catalogo/producto"
+)
+
+// Cliente calls an OpenAI-compatible embeddings endpoint (POST {"model",
+// "input"} → {"data": [{"embedding", "index"}]}), which OpenAI, Ollama
+// (/v1/embeddings), LM Studio and most hosted APIs serve.
+type Cliente struct {
+	URL    string
+	Modelo string
+	// Clave is sent as a bearer token when set.
+	Clave string
+	HTTP  *http.Client
+}
+
+type embedRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type embedResponse struct {
+	Data []struct {
+		Embedding []float32 `json:"embedding"`
+		Index     int       `json:"index"`
+	} `json:"data"`
+}
+
+// Embed returns the vector of each text, in order.
+func (c *Cliente) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	body, err := json.Marshal(embedRequest{Model: c.Modelo, Input: texts})
+	if err != nil {
+		return nil, fmt.Errorf("error serializando JSON: %w", err)
+	}
+	var headers map[string]string
+	if c.Clave != "" {
+		headers = map[string]string{"Authorization": "Bearer " + c.Clave}
+	}
+	var resp embedResponse
+	if err := doJSON(ctx, c.HTTP, http.MethodPost, c.URL, headers, body, &resp); err != nil {
+		return nil, fmt.Errorf("error pidiendo embeddings: %w", err)
+	}
+	out := make([][]float32, len(texts))
+	for _, d := range resp.Data {
+		if d.Index < 0 || d.Index >= len(out) {
+			return nil, fmt.Errorf("embeddings: índice %d fuera de rango", d.Index)
+		}
+		out[d.Index] = d.Embedding
+	}
+	for i, v := range out {
+		if len(v) == 0 {
+			return nil, fmt.Errorf("embeddings: sin vector para el texto %d", i)
+		}
+	}
+	return out, nil
+}
+
+// httpError is a non-2xx answer.
+type httpError struct {
+	Code int
+	Body string
+}
+
+func (e *httpError) Error() string { return fmt.Sprintf("HTTP %d: %s", e.Code, e.Body) }
+
+// doJSON sends body to url with the given headers and decodes the JSON
+// answer into out, if any.
+func doJSON(ctx context.Context, client *http.Client, method, url string, headers map[string]string, body []byte, out any) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 200))
+		return &httpError{resp.StatusCode, string(msg)}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Vector is one line of the sidecar: a product, the text that was embedded
+// and its vector. Huella fingerprints the text and model, so an unchanged
+// product is not sent to the API again.
+type Vector struct {
+	Tienda string    `json:"tienda"`
+	Link   string    `json:"link"`
+	Nombre string    `json:"nombre"`
+	Precio float64   `json:"precio"`
+	Huella string    `json:"huella"`
+	Vector []float32 `json:"vector,omitempty"`
+}
+
+// Texto is what gets embedded for p: its name, category and subcategories,
+// which is all the description the stores give.
+func Texto(p producto.Product) string {
+	parts := []string{strings.TrimSpace(p.Nombre)}
+	if p.Categoria != "" {
+		parts = append(parts, p.Categoria)
+	}
+	for _, s := range p.Subcategorias {
+		if s != p.Categoria {
+			parts = append(parts, s)
+		}
+	}
+	return strings.Join(parts, ". ")
+}
+
+func huella(modelo, text string) string {
+	h := sha256.Sum256([]byte(modelo + "\x00" + text))
+	return hex.EncodeToString(h[:8])
+}
+
+// Stats counts what Exportar did.
+type Stats struct {
+	Productos    int
+	Reutilizados int
+	Nuevos       int
+}
+
+// Exportar returns the vectors of every product in catalogs, reusing the
+// ones in prev whose text and model did not change and asking c for the
+// rest, lote texts per request.
+func Exportar(ctx context.Context, c *Cliente, catalogs []match.Catalog, prev []Vector, lote int) ([]Vector, Stats, error) {
+	if lote <= 0 {
+		lote = 64
+	}
+	known := make(map[string][]float32, len(prev))
+	for _, v := range prev {
+		known[v.Huella] = v.Vector
+	}
+	var out []Vector
+	var pending []int
+	var texts []string
+	var st Stats
+	for _, cat := range catalogs {
+		for _, p := range cat.Productos {
+			text := Texto(p)
+			v := Vector{Tienda: cat.Tienda, Link: p.Link, Nombre: p.Nombre, Precio: p.Precio, Huella: huella(c.Modelo, text)}
+			if vec, ok := known[v.Huella]; ok {
+				v.Vector = vec
+				st.Reutilizados++
+			} else {
+				pending = append(pending, len(out))
+				texts = append(texts, text)
+			}
+			out = append(out, v)
+		}
+	}
+	st.Productos = len(out)
+	for start := 0; start < len(texts); start += lote {
+		end := min(start+lote, len(texts))
+		vecs, err := c.Embed(ctx, texts[start:end])
+		if err != nil {
+			return nil, st, err
+		}
+		for i, vec := range vecs {
+			out[pending[start+i]].Vector = vec
+		}
+		st.Nuevos += end - start
+	}
+	return out, st, nil
+}
+
+// ReadJSONL loads a sidecar written by WriteJSONL. A missing file is no
+// vectors.
+func ReadJSONL(fpath string) ([]Vector, error) {
+	f, err := os.Open(fpath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo %s: %w", fpath, err)
+	}
+	defer f.Close()
+	var out []Vector
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		var v Vector
+		if err := json.Unmarshal(sc.Bytes(), &v); err != nil {
+			return nil, fmt.Errorf("error parsing %s, línea %d: %w", fpath, line, err)
+		}
+		out = append(out, v)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("error leyendo %s: %w", fpath, err)
+	}
+	return out, nil
+}
+
+// WriteJSONL writes one vector per line to fpath atomically (temp file +
+// rename).
+func WriteJSONL(vectors []Vector, fpath string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(fpath), ".embeddings-*")
+	if err != nil {
+		return fmt.Errorf("error escribiendo %s: %w", fpath, err)
+	}
+	defer os.Remove(tmp.Name())
+	tmp.Chmod(0644)
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, v := range vectors {
+		if err := enc.Encode(v); err != nil {
+			tmp.Close()
+			return fmt.Errorf("error serializando JSON: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error escribiendo %s: %w", fpath, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error escribiendo %s: %w", fpath, err)
+	}
+	if err := os.Rename(tmp.Name(), fpath); err != nil {
+		return fmt.Errorf("error escribiendo %s: %w", fpath, err)
+	}
+	return nil
+}
+
+// Resultado is a product found by Buscar and its cosine similarity to the
+// query.
+type Resultado struct {
+	Vector
+	Similitud float64 `json:"similitud"`
+}
+
+// Buscar returns the limit vectors most similar to q, most similar first.
+func Buscar(vectors []Vector, q []float32, limit int) []Resultado {
+	var out []Resultado
+	for _, v := range vectors {
+		if len(v.Vector) != len(q) {
+			continue
+		}
+		out = append(out, Resultado{Vector: v, Similitud: math.Round(cosine(v.Vector, q)*1000) / 1000})
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Similitud > out[j].Similitud })
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
+func cosine(a, b []float32) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(na*nb)
+}
+
+// pointID is the Qdrant point id of a product: a UUID derived from its
+// canonical link, so re-exporting a product overwrites its point.
+func pointID(link string) string {
+	h := sha256.Sum256([]byte(canonurl.Key(link)))
+	x := hex.EncodeToString(h[:16])
+	return x[0:8] + "-" + x[8:12] + "-" + x[12:16] + "-" + x[16:20] + "-" + x[20:32]
+}
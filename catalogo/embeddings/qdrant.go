@@ -0,0 +1,78 @@
+package embeddings
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Qdrant writes vectors to a collection of a Qdrant server through its
+// REST API.
+type Qdrant struct {
+	URL       string
+	Coleccion string
+	// Clave is sent as the api-key header when set.
+	Clave string
+	HTTP  *http.Client
+}
+
+// loteQdrant is how many points go in one upsert request.
+const loteQdrant = 256
+
+func (q *Qdrant) do(ctx context.Context, method, path string, body any) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return fmt.Errorf("error serializando JSON: %w", err)
+		}
+	}
+	var headers map[string]string
+	if q.Clave != "" {
+		headers = map[string]string{"api-key": q.Clave}
+	}
+	url := strings.TrimSuffix(q.URL, "/") + "/collections/" + q.Coleccion + path
+	return doJSON(ctx, q.HTTP, method, url, headers, data, nil)
+}
+
+// Preparar creates the collection, for vectors of dim dimensions compared by
+// cosine, unless it already exists.
+func (q *Qdrant) Preparar(ctx context.Context, dim int) error {
+	err := q.do(ctx, http.MethodGet, "", nil)
+	var he *httpError
+	if errors.As(err, &he) && he.Code == http.StatusNotFound {
+		body := map[string]any{"vectors": map[string]any{"size": dim, "distance": "Cosine"}}
+		err = q.do(ctx, http.MethodPut, "", body)
+	}
+	if err != nil {
+		return fmt.Errorf("error preparando la colección %s en qdrant: %w", q.Coleccion, err)
+	}
+	return nil
+}
+
+type point struct {
+	ID      string    `json:"id"`
+	Vector  []float32 `json:"vector"`
+	Payload Vector    `json:"payload"`
+}
+
+// Upsert writes vectors as points, with the product as payload. A product
+// keeps its point across exports, so re-exporting updates it in place.
+func (q *Qdrant) Upsert(ctx context.Context, vectors []Vector) error {
+	for start := 0; start < len(vectors); start += loteQdrant {
+		batch := vectors[start:min(start+loteQdrant, len(vectors))]
+		points := make([]point, len(batch))
+		for i, v := range batch {
+			payload := v
+			payload.Vector = nil
+			points[i] = point{ID: pointID(v.Link), Vector: v.Vector, Payload: payload}
+		}
+		if err := q.do(ctx, http.MethodPut, "/points?wait=true", map[string]any{"points": points}); err != nil {
+			return fmt.Errorf("error escribiendo en qdrant: %w", err)
+		}
+	}
+	return nil
+}
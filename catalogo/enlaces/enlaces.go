@@ -0,0 +1,195 @@
+// Package enlaces checks the product links of a scraper's output before it
+// is published (-check-links): a product the store removed can stay in its
+// listings for days, and its link then answers 404 or redirects to the home
+// page. A link that redirects to another page of the store is a product
+// that moved, and is recorded under its final address.
+package enlaces
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"catalogo/canonurl"
+	"catalogo/producto"
+)
+
+// Todos is the Muestra that checks every link.
+const Todos = -1
+
+// ParseMuestra reads -check-links: "all" checks every link, a number n a
+// random sample of n links and "" or "0" none.
+func ParseMuestra(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	switch s {
+	case "", "0":
+		return 0, nil
+	case "all":
+		return Todos, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("muestra inválida %q (all o un número de enlaces)", s)
+	}
+	return n, nil
+}
+
+// Inicios are the paths, without slashes, a store redirects removed
+// products to: the home page and Odoo's and WooCommerce's shop pages.
+var Inicios = []string{"", "shop", "tienda"}
+
+// Problema is a link that does not lead to its product.
+type Problema struct {
+	Link string
+	// Status is the final HTTP status, 0 when the request failed.
+	Status int
+	// Final is where the link redirected, "" when it did not.
+	Final  string
+	Motivo string
+}
+
+// Informe is what Revisar found.
+type Informe struct {
+	Revisados int
+	// Movidos counts the links updated to where they redirect.
+	Movidos   int
+	Problemas []Problema
+}
+
+// resultado is the answer to one link.
+type resultado struct {
+	key, link, final string
+	status           int
+	err              error
+}
+
+// Revisar requests muestra of the distinct links of products (every one
+// with Todos) with workers goroutines, each pausing delay between
+// requests, and updates the Link of the products whose link redirects to
+// another page of the same store. Links that answer an error, redirect to
+// the home page, off the store or to another listed product are reported.
+func Revisar(ctx context.Context, client *http.Client, products []producto.Product, muestra, workers int, delay time.Duration) Informe {
+	byKey := make(map[string][]int)
+	var keys []string
+	for i, p := range products {
+		if p.Link == "" {
+			continue
+		}
+		key := canonurl.Key(p.Link)
+		if byKey[key] == nil {
+			keys = append(keys, key)
+		}
+		byKey[key] = append(byKey[key], i)
+	}
+	if muestra >= 0 && muestra < len(keys) {
+		rand.Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+		keys = keys[:muestra]
+	}
+
+	jobs := make(chan string)
+	results := make(chan resultado)
+	var wg sync.WaitGroup
+	for range max(1, workers) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range jobs {
+				link := products[byKey[key][0]].Link
+				final, status, err := pedir(ctx, client, link)
+				results <- resultado{key: key, link: link, final: final, status: status, err: err}
+				time.Sleep(delay)
+			}
+		}()
+	}
+	go func() {
+		for _, key := range keys {
+			jobs <- key
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	var inf Informe
+	for r := range results {
+		inf.Revisados++
+		prob := Problema{Link: r.link, Status: r.status}
+		finalKey := canonurl.Key(r.final)
+		if r.err == nil && finalKey != r.key {
+			prob.Final = r.final
+		}
+		switch {
+		case r.err != nil:
+			prob.Motivo = r.err.Error()
+		case r.status >= 400:
+			prob.Motivo = fmt.Sprintf("responde %d", r.status)
+		case prob.Final == "":
+			continue
+		case !mismoSitio(r.link, r.final):
+			prob.Motivo = "redirige fuera de la tienda"
+		case esInicio(r.final):
+			prob.Motivo = "redirige al inicio"
+		case byKey[finalKey] != nil:
+			prob.Motivo = "redirige a otro producto del catálogo"
+		default:
+			for _, i := range byKey[r.key] {
+				products[i].Link = canonurl.Clean(r.final)
+			}
+			inf.Movidos++
+			continue
+		}
+		inf.Problemas = append(inf.Problemas, prob)
+	}
+	return inf
+}
+
+// pedir requests link with HEAD, or GET where the server does not take
+// HEAD, following redirects, and returns the final URL and status.
+func pedir(ctx context.Context, client *http.Client, link string) (string, int, error) {
+	var resp *http.Response
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		req, err := http.NewRequestWithContext(ctx, method, link, nil)
+		if err != nil {
+			return "", 0, err
+		}
+		if resp, err = client.Do(req); err != nil {
+			return "", 0, err
+		}
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusMethodNotAllowed && resp.StatusCode != http.StatusNotImplemented {
+			break
+		}
+	}
+	return resp.Request.URL.String(), resp.StatusCode, nil
+}
+
+func mismoSitio(a, b string) bool {
+	ua, errA := url.Parse(a)
+	ub, errB := url.Parse(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	return strings.TrimPrefix(strings.ToLower(ua.Hostname()), "www.") == strings.TrimPrefix(strings.ToLower(ub.Hostname()), "www.")
+}
+
+func esInicio(link string) bool {
+	u, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+	p := strings.Trim(u.Path, "/")
+	for _, inicio := range Inicios {
+		if strings.EqualFold(p, inicio) {
+			return true
+		}
+	}
+	return false
+}
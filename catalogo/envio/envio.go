@@ -0,0 +1,123 @@
+// Package envio estimates what shipping adds to each product: whether the
+// store ships it free, from its page's badge ("Envío gratis") or the store's
+// free-shipping threshold, and otherwise the cost from the store's rate
+// table in catalogo.json, so stores compare by landed cost.
+package envio
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"catalogo/producto"
+	"catalogo/texto"
+	"catalogo/tienda"
+)
+
+// Regla is a store's "envio" section of catalogo.json, e.g.
+//
+//	"envio": {"gratisDesde": 999,
+//	          "tarifas": [{"hasta": 300, "costo": 99}, {"costo": 149}]}
+type Regla struct {
+	// GratisDesde is the order amount from which shipping is free; zero is
+	// none, or the one the scraper reads from the site.
+	GratisDesde float64 `json:"gratisDesde"`
+	// Tarifas picks the estimated cost by price: the first rate whose Hasta
+	// the price does not exceed, or without Hasta.
+	Tarifas []Tarifa `json:"tarifas"`
+}
+
+// Tarifa is a price range of a Regla and its shipping cost.
+type Tarifa struct {
+	// Hasta is the range's top price, inclusive; zero is no top.
+	Hasta float64 `json:"hasta"`
+	Costo float64 `json:"costo"`
+}
+
+// Validate rejects negative amounts and rates out of order.
+func (r Regla) Validate() error {
+	if r.GratisDesde < 0 {
+		return errors.New("envio: gratisDesde negativo")
+	}
+	for i, t := range r.Tarifas {
+		if t.Hasta < 0 || t.Costo < 0 {
+			return fmt.Errorf("envio: tarifa #%d negativa", i+1)
+		}
+		if i > 0 && (t.Hasta != 0 && t.Hasta <= r.Tarifas[i-1].Hasta || r.Tarifas[i-1].Hasta == 0) {
+			return errors.New("envio: las tarifas deben ir de menor a mayor, con la abierta al final")
+		}
+	}
+	return nil
+}
+
+// costo is the estimated shipping of a product priced precio, if a rate
+// covers it.
+func (r Regla) costo(precio float64) (float64, bool) {
+	for _, t := range r.Tarifas {
+		if t.Hasta == 0 || precio <= t.Hasta {
+			return t.Costo, true
+		}
+	}
+	return 0, false
+}
+
+// Aplicar sets EnvioGratis of the products at or above GratisDesde (those
+// with the badge already have it) and CostoEnvio of the rest, when a rate
+// covers their price.
+func (r Regla) Aplicar(products []producto.Product) {
+	for i := range products {
+		p := &products[i]
+		if r.GratisDesde > 0 && p.Precio >= r.GratisDesde {
+			p.EnvioGratis = true
+		}
+		p.CostoEnvio = 0
+		if !p.EnvioGratis {
+			p.CostoEnvio, _ = r.costo(p.Precio)
+		}
+	}
+}
+
+var (
+	reTags     = regexp.MustCompile(`<[^>]*>`)
+	reInsignia = regexp.MustCompile(`\benvio (?:gratis|sin costo)\b`)
+	// reUmbral matches "envío gratis en compras mayores a $999", "envío
+	// gratis desde $1,500", "envío gratis a partir de 799 pesos".
+	reUmbral = regexp.MustCompile(`(?i)env[ií]o\s+(?:gratis|sin\s+costo)[^$\d<]{0,40}?(?:mayores?\s+(?:a|de)|desde|a\s+partir\s+de|arriba\s+de|\+)\s*(?:\$|MXN)?\s*(\d[\d,.]*)`)
+)
+
+// Insignia reports whether a product's page or description carries a
+// free-shipping badge. Announcements of the store's threshold ("envío gratis
+// en compras mayores a $999") are not one.
+func Insignia(page string) bool {
+	text := reUmbral.ReplaceAllString(reTags.ReplaceAllString(page, " "), " ")
+	return reInsignia.MatchString(texto.Normalize(text))
+}
+
+// Umbral reads the free-shipping threshold a site announces ("envío gratis
+// en compras mayores a $999"), written in f, or 0 when it announces none.
+func Umbral(page string, f producto.Formato) float64 {
+	m := reUmbral.FindStringSubmatch(reTags.ReplaceAllString(page, " "))
+	if m == nil {
+		return 0
+	}
+	v, err := f.Parse(m[1])
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+// Leer returns the "envio" section of the store id in the configuration
+// file fpath (catalogo.json). A missing file or store has none.
+func Leer(fpath, id string) (Regla, error) {
+	var s struct {
+		Envio Regla `json:"envio"`
+	}
+	if err := tienda.Leer(fpath, id, &s); err != nil {
+		return Regla{}, err
+	}
+	if err := s.Envio.Validate(); err != nil {
+		return Regla{}, fmt.Errorf("tienda %s: %w", id, err)
+	}
+	return s.Envio, nil
+}
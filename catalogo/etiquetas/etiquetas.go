@@ -0,0 +1,157 @@
+// Package etiquetas derives business tags from each product's price, store
+// and category ("gama": "premium", "envioGratis": "sí") with rules from the
+// "etiquetas" section of catalogo.json, so the catalog sites can filter by
+// them without a post-processing step.
+package etiquetas
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"catalogo/producto"
+	"catalogo/texto"
+)
+
+// Regla sets the tag Etiqueta of the products it applies to. A product gets
+// each tag from the first rule for it that applies, so specific rules (by
+// category) go before general ones. For example
+//
+//	"etiquetas": [
+//	    {"etiqueta": "gama", "categorias": ["Audio"],
+//	     "rangos": [{"hasta": 300, "valor": "económico"}, {"hasta": 1000, "valor": "medio"}, {"valor": "premium"}]},
+//	    {"etiqueta": "gama",
+//	     "rangos": [{"hasta": 100, "valor": "económico"}, {"hasta": 500, "valor": "medio"}, {"valor": "premium"}]},
+//	    {"etiqueta": "envioGratis", "precioMayorA": 999}
+//	]
+type Regla struct {
+	Etiqueta string `json:"etiqueta"`
+	// Tiendas and Categorias limit the rule to those store ids and
+	// categories, compared without case or accents; empty is any.
+	Tiendas    []string `json:"tiendas"`
+	Categorias []string `json:"categorias"`
+	// PrecioMayorA limits the rule to products whose price is above it.
+	PrecioMayorA float64 `json:"precioMayorA"`
+	// Rangos picks the value by price: the first range whose Hasta the
+	// price does not exceed, or without Hasta. Without Rangos the value is
+	// Valor, or "sí".
+	Rangos []Rango `json:"rangos"`
+	Valor  string  `json:"valor"`
+
+	tiendas    map[string]bool
+	categorias map[string]bool
+}
+
+// Rango is a price range of a Regla and the value it gives.
+type Rango struct {
+	// Hasta is the range's top price, inclusive; zero is no top.
+	Hasta float64 `json:"hasta"`
+	Valor string  `json:"valor"`
+}
+
+// Reglas are the rules of catalogo.json's "etiquetas" section.
+type Reglas []Regla
+
+// Validate rejects incomplete rules and prepares them for Aplicar.
+func (rs Reglas) Validate() error {
+	for i := range rs {
+		r := &rs[i]
+		if r.Etiqueta == "" {
+			return fmt.Errorf("etiquetas: regla #%d sin etiqueta", i+1)
+		}
+		if r.PrecioMayorA < 0 {
+			return fmt.Errorf("etiquetas: %s: precioMayorA negativo", r.Etiqueta)
+		}
+		for j, rg := range r.Rangos {
+			if rg.Valor == "" {
+				return fmt.Errorf("etiquetas: %s: rango #%d sin valor", r.Etiqueta, j+1)
+			}
+			if j > 0 && (rg.Hasta != 0 && rg.Hasta <= r.Rangos[j-1].Hasta || r.Rangos[j-1].Hasta == 0) {
+				return fmt.Errorf("etiquetas: %s: los rangos deben ir de menor a mayor, con el abierto al final", r.Etiqueta)
+			}
+		}
+		r.tiendas = normalized(r.Tiendas)
+		r.categorias = normalized(r.Categorias)
+	}
+	return nil
+}
+
+func normalized(names []string) map[string]bool {
+	if len(names) == 0 {
+		return nil
+	}
+	out := make(map[string]bool, len(names))
+	for _, n := range names {
+		out[texto.Normalize(n)] = true
+	}
+	return out
+}
+
+// value is the tag r gives p, if it applies.
+func (r *Regla) value(p producto.Product) (string, bool) {
+	if r.tiendas != nil && !r.tiendas[texto.Normalize(p.Tienda)] {
+		return "", false
+	}
+	if r.categorias != nil && !r.categorias[texto.Normalize(p.Categoria)] {
+		return "", false
+	}
+	if r.PrecioMayorA > 0 && p.Precio <= r.PrecioMayorA {
+		return "", false
+	}
+	for _, rg := range r.Rangos {
+		if rg.Hasta == 0 || p.Precio <= rg.Hasta {
+			return rg.Valor, true
+		}
+	}
+	if len(r.Rangos) > 0 {
+		return "", false
+	}
+	if r.Valor == "" {
+		return "sí", true
+	}
+	return r.Valor, true
+}
+
+// Aplicar sets the EtiquetasDerivadas of every product, replacing the ones
+// an earlier run derived. Rules need Validate first.
+func (rs Reglas) Aplicar(products []producto.Product) {
+	for i := range products {
+		p := &products[i]
+		p.EtiquetasDerivadas = nil
+		for j := range rs {
+			r := &rs[j]
+			if _, done := p.EtiquetasDerivadas[r.Etiqueta]; done {
+				continue
+			}
+			if v, ok := r.value(*p); ok {
+				if p.EtiquetasDerivadas == nil {
+					p.EtiquetasDerivadas = make(map[string]string)
+				}
+				p.EtiquetasDerivadas[r.Etiqueta] = v
+			}
+		}
+	}
+}
+
+// Leer loads and validates the rules in the configuration file fpath
+// (catalogo.json). A missing file, or one without rules, is no rules.
+func Leer(fpath string) (Reglas, error) {
+	data, err := os.ReadFile(fpath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo %s: %w", fpath, err)
+	}
+	var cfg struct {
+		Etiquetas Reglas `json:"etiquetas"`
+	}
+	if err := json.Unmarshal(texto.SinBOM(data), &cfg); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", fpath, err)
+	}
+	if err := cfg.Etiquetas.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg.Etiquetas, nil
+}
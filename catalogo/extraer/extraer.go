@@ -0,0 +1,165 @@
+// Package extraer reads the parts of a store's pages and API responses the
+// scrapers need: prices, image srcsets, breadcrumbs, descriptions and
+// schema.org JSON-LD.
+// They are pure functions of text the stores control, so they never panic
+// on bad input and are fuzzed (go test -fuzz) to keep it that way.
+package extraer
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"catalogo/producto"
+)
+
+// UnidadesMinimas reads a WooCommerce Store API price, an integer in the
+// currency's minor unit ("12990" with minorUnit 2 is 129.90), rounded to
+// cents. An empty price is 0 with no error. The Store API writes prices
+// this way whatever the store's locale, so a formatted price ("27.00",
+// "1.234,56") means the API changed and is rejected rather than read in
+// some locale.
+func UnidadesMinimas(s string, minorUnit int) (float64, error) {
+	s = strings.TrimFunc(s, unicode.IsSpace)
+	if s == "" {
+		return 0, nil
+	}
+	val, err := strconv.Atoi(s)
+	if err != nil || val < 0 || minorUnit < 0 || minorUnit > 4 {
+		return 0, fmt.Errorf("precio inválido %q (unidad mínima %d)", s, minorUnit)
+	}
+	return math.Round(float64(val)/math.Pow(10, float64(minorUnit))*100) / 100, nil
+}
+
+var (
+	rePrecio = regexp.MustCompile(`(?:\$|€|£|MXN|USD|EUR)(?:[\s\x{a0}\x{202f}]|&nbsp;|<[^>]*>)*(\d[\d,.\x{a0}\x{202f}]*)`)
+	// Odoo hides the machine-readable price in
+	// <span itemprop="price" style="display:none;">15.0</span>
+	rePrecioOculto = regexp.MustCompile(`itemprop="price"[^>]*>\s*([\d.]+)\s*<`)
+	// and renders the list price in a span with class "oe_default_price"
+	// (hidden with d-none when not on sale)
+	rePrecioLista = regexp.MustCompile(`oe_default_price[^>]*>.*?oe_currency_value">([\d,.\x{a0}\x{202f}]+)<`)
+	reMoneda      = regexp.MustCompile(`itemprop="priceCurrency"[^>]*content="([A-Za-z]{3})"|content="([A-Za-z]{3})"[^>]*itemprop="priceCurrency"`)
+	reMiga        = regexp.MustCompile(`<li[^>]*class="breadcrumb-item[^"]*"[^>]*>(?:<a[^>]*>)?([^<]+)`)
+	// Odoo writes the product's sales description in
+	// <div itemprop="description" class="text-muted">...</div>
+	reDescripcion = regexp.MustCompile(`(?s)itemprop="description"[^>]*>(.*?)</(?:div|p|span)>`)
+	reEtiqueta    = regexp.MustCompile(`(?s)<[^>]*>`)
+	reBloque      = regexp.MustCompile(`(?i)<(?:br|/p|/div|/li|/h\d)\b[^>]*>`)
+)
+
+// PrecioPagina reads the price of an Odoo product page: the machine-readable
+// microdata one, or else the first amount after a currency symbol, written
+// in f. ok is false when the page shows none; err when the one it shows does
+// not parse.
+func PrecioPagina(body string, f producto.Formato) (precio float64, ok bool, err error) {
+	if m := rePrecioOculto.FindStringSubmatch(body); m != nil {
+		precio, err = producto.FormatoMaquina.Parse(m[1])
+		return precio, true, err
+	}
+	if m := rePrecio.FindStringSubmatch(body); m != nil {
+		precio, err = f.Parse(m[1])
+		return precio, true, err
+	}
+	return 0, false, nil
+}
+
+// PrecioLista reads the list price an Odoo product page shows crossed out
+// when the product is on sale, written in f, like PrecioPagina.
+func PrecioLista(body string, f producto.Formato) (precio float64, ok bool, err error) {
+	m := rePrecioLista.FindStringSubmatch(body)
+	if m == nil {
+		return 0, false, nil
+	}
+	precio, err = f.Parse(m[1])
+	return precio, true, err
+}
+
+// Moneda reads the ISO 4217 currency of a page's price microdata
+// (<meta itemprop="priceCurrency" content="MXN"/>), uppercased, or "".
+func Moneda(body string) string {
+	if m := reMoneda.FindStringSubmatch(body); m != nil {
+		return strings.ToUpper(m[1] + m[2])
+	}
+	return ""
+}
+
+// Imagen is one candidate of a srcset attribute.
+type Imagen struct {
+	URL string
+	// Descriptor is its width or density ("100w", "2x"), "" when absent.
+	Descriptor string
+}
+
+// Srcset splits a srcset attribute into its candidates, skipping empty
+// ones.
+func Srcset(srcset string) []Imagen {
+	var imgs []Imagen
+	for entry := range strings.SplitSeq(srcset, ",") {
+		parts := strings.Fields(entry)
+		switch len(parts) {
+		case 1:
+			imgs = append(imgs, Imagen{URL: parts[0]})
+		case 2:
+			imgs = append(imgs, Imagen{URL: parts[0], Descriptor: parts[1]})
+		}
+	}
+	return imgs
+}
+
+// SrcsetURL is the URL of the srcset candidate with descriptor width
+// ("100w"), or "" when there is none.
+// e.g. SrcsetURL("...img-64x64.jpg 64w, ...img-100x100.jpg 100w", "64w") returns the 64w URL.
+func SrcsetURL(srcset, width string) string {
+	for _, img := range Srcset(srcset) {
+		if img.Descriptor == width {
+			return img.URL
+		}
+	}
+	return ""
+}
+
+// Migas reads the categories of an Odoo product page's breadcrumb: its
+// items without the home link ("Inicio", "Home") and without the last one,
+// the product itself.
+func Migas(body string) []string {
+	var crumbs []string
+	for _, m := range reMiga.FindAllStringSubmatch(body, -1) {
+		name := html.UnescapeString(strings.TrimSpace(m[1]))
+		if name != "" && !strings.EqualFold(name, "inicio") && !strings.EqualFold(name, "home") {
+			crumbs = append(crumbs, name)
+		}
+	}
+	if len(crumbs) > 0 {
+		crumbs = crumbs[:len(crumbs)-1]
+	}
+	return crumbs
+}
+
+// TextoPlano is the text of an HTML fragment, such as a Store API
+// description: without tags or entities, one line per paragraph or line
+// break, and without the surrounding blanks of each line.
+func TextoPlano(fragment string) string {
+	s := reBloque.ReplaceAllString(fragment, "\n")
+	s = html.UnescapeString(reEtiqueta.ReplaceAllString(s, ""))
+	var lines []string
+	for line := range strings.SplitSeq(s, "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// DescripcionPagina reads the description of an Odoo product page from its
+// microdata, as plain text, or "".
+func DescripcionPagina(body string) string {
+	if m := reDescripcion.FindStringSubmatch(body); m != nil {
+		return TextoPlano(m[1])
+	}
+	return ""
+}
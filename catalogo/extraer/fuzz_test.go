@@ -0,0 +1,108 @@
+package extraer
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"catalogo/producto"
+)
+
+func FuzzUnidadesMinimas(f *testing.F) {
+	f.Add("12990", 2)
+	f.Add(" 100 ", 0)
+	f.Add("-5", 2)
+	f.Add("99999999999999999999", 4)
+	f.Fuzz(func(t *testing.T, s string, minorUnit int) {
+		v, err := UnidadesMinimas(s, minorUnit)
+		if err == nil && (v < 0 || math.IsNaN(v) || math.IsInf(v, 0)) {
+			t.Fatalf("UnidadesMinimas(%q, %d) = %v", s, minorUnit, v)
+		}
+	})
+}
+
+func FuzzFormato(f *testing.F) {
+	for _, s := range []string{"$1,234.56", "1.234,56 €", "MXN 99", "1,23,4", ".5", "1e9", "12.345.678,9"} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		for _, fmt := range []producto.Formato{producto.FormatoMX, producto.FormatoEU, producto.FormatoMaquina} {
+			v, err := fmt.Parse(s)
+			if err == nil && (v < 0 || math.IsNaN(v) || math.IsInf(v, 0)) {
+				t.Fatalf("%s.Parse(%q) = %v", fmt.Nombre, s, v)
+			}
+		}
+	})
+}
+
+func FuzzPrecioPagina(f *testing.F) {
+	f.Add(`<span itemprop="price" style="display:none;">15.0</span>`)
+	f.Add(`<span class="oe_currency_value">$&nbsp;<b>1,299.00</b></span>`)
+	f.Add(`<span class="oe_default_price d-none"><span class="oe_currency_value">1,500.00</span></span>`)
+	f.Fuzz(func(t *testing.T, body string) {
+		for _, fn := range []func(string, producto.Formato) (float64, bool, error){PrecioPagina, PrecioLista} {
+			v, ok, err := fn(body, producto.FormatoMX)
+			if !ok && (v != 0 || err != nil) {
+				t.Fatalf("sin precio pero %v, %v", v, err)
+			}
+			if err == nil && (v < 0 || math.IsInf(v, 0)) {
+				t.Fatalf("precio %v de %q", v, body)
+			}
+		}
+		if m := Moneda(body); m != "" && len(m) != 3 {
+			t.Fatalf("Moneda(%q) = %q", body, m)
+		}
+	})
+}
+
+func FuzzSrcset(f *testing.F) {
+	f.Add("a-64x64.jpg 64w, a-100x100.jpg 100w", "100w")
+	f.Add(",, ,a.jpg 2x,b.jpg", "2x")
+	f.Fuzz(func(t *testing.T, srcset, width string) {
+		for _, img := range Srcset(srcset) {
+			if img.URL == "" || !strings.Contains(srcset, img.URL) || !strings.Contains(srcset, img.Descriptor) {
+				t.Fatalf("Srcset(%q) dio %+v", srcset, img)
+			}
+		}
+		if u := SrcsetURL(srcset, width); u != "" && !strings.Contains(srcset, u) {
+			t.Fatalf("SrcsetURL(%q, %q) = %q", srcset, width, u)
+		}
+	})
+}
+
+func FuzzMigas(f *testing.F) {
+	f.Add(`<li class="breadcrumb-item"><a href="/">Inicio</a></li><li class="breadcrumb-item"><a>Fundas</a></li><li class="breadcrumb-item active">Funda &amp; mica</li>`)
+	f.Fuzz(func(t *testing.T, body string) {
+		for _, c := range Migas(body) {
+			if c == "" || strings.EqualFold(c, "inicio") || strings.EqualFold(c, "home") {
+				t.Fatalf("Migas(%q) incluye %q", body, c)
+			}
+		}
+	})
+}
+
+func FuzzJSONLD(f *testing.F) {
+	f.Add(`<script type="application/ld+json">{"@type":"Product","name":"Funda","sku":"F-1","gtin13":7501234567890,"image":["a.jpg"],"offers":{"price":"129.90","priceCurrency":"mxn","availability":"https://schema.org/InStock"}}</script>`)
+	f.Add(`<script type="application/ld+json">{"@graph":[{"@type":["Thing","Product"],"offers":[{"lowPrice":10}]}]}</script>`)
+	f.Add(`<script type='application/ld+json'>[[[[[[[[[[[{"@type":"Product"}]]]]]]]]]]]</script>`)
+	f.Fuzz(func(t *testing.T, body string) {
+		for _, p := range JSONLD(body) {
+			if p.Precio < 0 || math.IsInf(p.Precio, 0) {
+				t.Fatalf("JSONLD(%q): precio %v", body, p.Precio)
+			}
+		}
+	})
+}
+
+func FuzzTextoPlano(f *testing.F) {
+	f.Add(`<p>Funda <strong>rígida</strong> &amp; mica</p><ul><li>Negro</li><li>Rojo</li></ul>`)
+	f.Add(`<div itemprop="description" class="text-muted">Cable<br/>1 m</div>`)
+	f.Fuzz(func(t *testing.T, body string) {
+		for line := range strings.SplitSeq(TextoPlano(body), "\n") {
+			if line != strings.TrimSpace(line) {
+				t.Fatalf("TextoPlano(%q): línea %q con blancos", body, line)
+			}
+		}
+		DescripcionPagina(body)
+	})
+}
@@ -0,0 +1,166 @@
+package extraer
+
+import (
+	"encoding/json"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"catalogo/producto"
+)
+
+// ProductoLD is what a schema.org Product in a page's JSON-LD says about
+// the product.
+type ProductoLD struct {
+	Nombre string
+	// Descripcion is the product's description, as plain text.
+	Descripcion string
+	SKU         string
+	// GTIN is the barcode, from gtin13, gtin12, gtin8 or gtin.
+	GTIN   string
+	Imagen string
+	// Precio and Moneda are those of the first offer with a price.
+	Precio float64
+	Moneda string
+	// Disponible is the offer's availability; nil when it does not say.
+	Disponible *bool
+}
+
+var reJSONLD = regexp.MustCompile(`(?is)<script[^>]*type=["']application/ld\+json["'][^>]*>(.*?)</script>`)
+
+// JSONLD reads the schema.org Products of the JSON-LD blocks of a page,
+// whether a block holds one object, an array or an @graph. Blocks that are
+// not valid JSON are skipped: one broken block does not hide the others.
+func JSONLD(body string) []ProductoLD {
+	var products []ProductoLD
+	for _, m := range reJSONLD.FindAllStringSubmatch(body, -1) {
+		var v any
+		if err := json.Unmarshal([]byte(strings.TrimSpace(m[1])), &v); err != nil {
+			continue
+		}
+		products = appendLD(products, v, 0)
+	}
+	return products
+}
+
+// maxProfundidad bounds how deep JSONLD looks for products, so a hostile
+// page cannot make it recurse without end.
+const maxProfundidad = 8
+
+func appendLD(products []ProductoLD, v any, depth int) []ProductoLD {
+	if depth > maxProfundidad {
+		return products
+	}
+	switch v := v.(type) {
+	case []any:
+		for _, item := range v {
+			products = appendLD(products, item, depth+1)
+		}
+	case map[string]any:
+		if esTipo(v["@type"], "Product") {
+			products = append(products, productoLD(v))
+		}
+		if g, ok := v["@graph"]; ok {
+			products = appendLD(products, g, depth+1)
+		}
+	}
+	return products
+}
+
+// esTipo reports whether an @type, a string or an array of them, is t.
+func esTipo(v any, t string) bool {
+	switch v := v.(type) {
+	case string:
+		return v == t || strings.HasSuffix(v, "/"+t)
+	case []any:
+		for _, item := range v {
+			if esTipo(item, t) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func productoLD(v map[string]any) ProductoLD {
+	p := ProductoLD{
+		Nombre:      html.UnescapeString(strings.TrimSpace(texto(v["name"]))),
+		Descripcion: TextoPlano(texto(v["description"])),
+		SKU:         texto(v["sku"]),
+		Imagen:      imagenLD(v["image"]),
+	}
+	for _, k := range []string{"gtin13", "gtin12", "gtin8", "gtin"} {
+		if p.GTIN = texto(v[k]); p.GTIN != "" {
+			break
+		}
+	}
+	offers := v["offers"]
+	if o, ok := offers.(map[string]any); ok {
+		offers = []any{o}
+	}
+	list, _ := offers.([]any)
+	for _, item := range list {
+		o, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		price := o["price"]
+		// AggregateOffer has a range instead
+		if price == nil {
+			price = o["lowPrice"]
+		}
+		precio, ok := numero(price)
+		if !ok {
+			continue
+		}
+		p.Precio = precio
+		p.Moneda = strings.ToUpper(texto(o["priceCurrency"]))
+		if a := texto(o["availability"]); a != "" {
+			disponible := strings.HasSuffix(a, "InStock") || strings.HasSuffix(a, "LimitedAvailability")
+			p.Disponible = &disponible
+		}
+		break
+	}
+	return p
+}
+
+// texto is v when it is a string, and its text when it is a number.
+func texto(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
+
+// numero is a JSON-LD price, a number or a machine-readable string, when
+// it is a valid non-negative one.
+func numero(v any) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, v >= 0
+	case string:
+		f, err := producto.FormatoMaquina.Parse(v)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// imagenLD is the first URL of a schema.org image: a URL, an array of them
+// or an ImageObject.
+func imagenLD(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []any:
+		if len(v) > 0 {
+			return imagenLD(v[0])
+		}
+	case map[string]any:
+		return texto(v["url"])
+	}
+	return ""
+}
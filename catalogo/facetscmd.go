@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"time"
+
+	"catalogo/match"
+	"catalogo/producto"
+)
+
+// runFacets writes facets.json and similares.json next to each of the
+// given catalogs, or of every store in the configuration when none are
+// given. The scrapers write them after each run too; this is for the site's
+// deploy, since the files are not kept in the repository.
+func runFacets(args []string) error {
+	fset := flag.NewFlagSet("facets", flag.ContinueOnError)
+	configPath := fset.String("config", "catalogo.json", "Configuración con las tiendas cuando no se indican archivos")
+	similaresN := fset.Int("similares-n", 5, "Alternativas con stock por producto en similares.json (0 = no escribirlo)")
+	files, err := parseInterspersed(fset, args)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		cfg, err := loadConfig(*configPath)
+		if err != nil {
+			return err
+		}
+		for _, st := range cfg.Tiendas {
+			files = append(files, st.Salida)
+		}
+	}
+
+	now := time.Now()
+	for _, fpath := range files {
+		products, err := producto.ReadJSON(fpath)
+		if err != nil {
+			return err
+		}
+		out := producto.FacetsPath(fpath)
+		if err := producto.WriteFacets(products, out, now); err != nil {
+			return err
+		}
+		log.Printf("[FACETS] Facetas escritas: %s", out)
+		if *similaresN > 0 {
+			out = match.SimilaresPath(fpath)
+			if err := match.WriteSimilares(products, *similaresN, out, now); err != nil {
+				return err
+			}
+			log.Printf("[FACETS] Similares escritos: %s", out)
+		}
+	}
+	return nil
+}
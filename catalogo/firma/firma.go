@@ -0,0 +1,109 @@
+// Package firma signs the scrapers' outputs (-sign) so the site that
+// publishes a catalog can check it is the file the scraper machine wrote,
+// not one changed on the way to the CDN. The signature is Ed25519 over the
+// file's bytes, written raw next to it as productos.json.sig; the key pair
+// comes from openssl:
+//
+//	openssl genpkey -algorithm ed25519 -out firma.pem
+//	openssl pkey -in firma.pem -pubout -out firma.pub.pem
+//
+// and the signature checks with "catalogo verify", openssl pkeyutl -verify
+// -rawin, or WebCrypto's Ed25519 in the browser.
+package firma
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Ext is appended to a file's path to name its signature.
+const Ext = ".sig"
+
+// Ruta is where the signature of the file fpath goes.
+func Ruta(fpath string) string {
+	return fpath + Ext
+}
+
+// LeerPrivada reads an Ed25519 private key in PKCS #8 PEM.
+func LeerPrivada(fpath string) (ed25519.PrivateKey, error) {
+	der, err := leerPEM(fpath, "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", fpath, err)
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s no es una clave Ed25519", fpath)
+	}
+	return priv, nil
+}
+
+// LeerPublica reads an Ed25519 public key in PKIX PEM.
+func LeerPublica(fpath string) (ed25519.PublicKey, error) {
+	der, err := leerPEM(fpath, "PUBLIC KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", fpath, err)
+	}
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s no es una clave Ed25519", fpath)
+	}
+	return pub, nil
+}
+
+func leerPEM(fpath, tipo string) ([]byte, error) {
+	data, err := os.ReadFile(fpath)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo %s: %w", fpath, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != tipo {
+		return nil, fmt.Errorf("%s no tiene un bloque PEM %q", fpath, tipo)
+	}
+	return block.Bytes, nil
+}
+
+// Firmar signs the file fpath with key and writes the signature to
+// Ruta(fpath).
+func Firmar(key ed25519.PrivateKey, fpath string) error {
+	data, err := os.ReadFile(fpath)
+	if err != nil {
+		return fmt.Errorf("error leyendo %s: %w", fpath, err)
+	}
+	sig := ed25519.Sign(key, data)
+	if err := os.WriteFile(Ruta(fpath), sig, 0644); err != nil {
+		return fmt.Errorf("error escribiendo %s: %w", Ruta(fpath), err)
+	}
+	return nil
+}
+
+// ErrFirmaInvalida is returned by Verificar for a file that does not match
+// its signature.
+var ErrFirmaInvalida = errors.New("la firma no corresponde al archivo")
+
+// Verificar checks the file fpath against its signature at Ruta(fpath).
+func Verificar(pub ed25519.PublicKey, fpath string) error {
+	data, err := os.ReadFile(fpath)
+	if err != nil {
+		return fmt.Errorf("error leyendo %s: %w", fpath, err)
+	}
+	sig, err := os.ReadFile(Ruta(fpath))
+	if err != nil {
+		return fmt.Errorf("error leyendo %s: %w", Ruta(fpath), err)
+	}
+	if !ed25519.Verify(pub, data, sig) {
+		return fmt.Errorf("%s: %w", fpath, ErrFirmaInvalida)
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+// Package fixtures records a few of the responses a scraper gets from its
+// store as test data: normalized so that recording the same pages twice
+// gives the same files (timestamps, nonces and session tokens replaced by
+// fixed values) and anonymized (emails and phone numbers), so the adapters'
+// regression tests can be refreshed when a site changes.
+package fixtures
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"catalogo/canonurl"
+	"catalogo/secretos"
+)
+
+// Indice is the file listing the recorded responses, in the fixtures
+// directory.
+const Indice = "fixtures.json"
+
+// Fixture is one recorded response, an entry of Indice.
+type Fixture struct {
+	URL     string `json:"url"`
+	Archivo string `json:"archivo"`
+	Status  int    `json:"status"`
+	Tipo    string `json:"tipo"`
+}
+
+// reemplazos normalize volatile and personal bits, in order.
+var reemplazos = []struct {
+	re  *regexp.Regexp
+	por string
+}{
+	// Timestamps: ISO 8601 and HTTP dates
+	{regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:\.\d+)?(?:Z|[+-]\d{2}:?\d{2})?`), "2000-01-01T00:00:00Z"},
+	{regexp.MustCompile(`(?:Mon|Tue|Wed|Thu|Fri|Sat|Sun), \d{2} \w{3} \d{4} \d{2}:\d{2}:\d{2} GMT`), "Sat, 01 Jan 2000 00:00:00 GMT"},
+	// Nonces and CSRF tokens, as attributes, JSON or JavaScript values and
+	// query parameters
+	{regexp.MustCompile(`(?i)((?:nonce|csrf_token|_wpnonce|wpnonce|csrftoken|session_id)["']?\s*[:=]\s*["']?)[A-Za-z0-9_\-+/=.]{6,}`), "${1}00000000"},
+	{regexp.MustCompile(`(?i)(name=["'](?:csrf_token|_wpnonce)["']\s+value=["'])[^"']+`), "${1}00000000"},
+	// Odoo's per-deploy asset bundles (/web/assets/1234-abcdef0/...)
+	{regexp.MustCompile(`/web/assets/[0-9a-f-]{6,}/`), "/web/assets/0000000/"},
+	{regexp.MustCompile(`([?&](?:v|ver|unique)=)[0-9a-f.]{4,}`), "${1}0"},
+	// Personal data
+	{regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`), "usuario@example.com"},
+	// Phone numbers only when written as one ("tel:", separators), so
+	// prices, SKUs and barcodes stay as they are
+	{regexp.MustCompile(`tel:\+?[\d\s().-]{8,}\d`), "tel:5500000000"},
+	{regexp.MustCompile(`(?:\+52[\s.-]?)?\b\(?\d{2,3}\)?[\s.-]\d{3,4}[\s.-]\d{4}\b`), "55 0000 0000"},
+}
+
+// Normalizar replaces in body the timestamps, nonces, session tokens,
+// emails and phone numbers with fixed values.
+func Normalizar(body []byte) []byte {
+	for _, r := range reemplazos {
+		body = r.re.ReplaceAll(body, []byte(r.por))
+	}
+	return body
+}
+
+// Grabadora is an http.RoundTripper that records the first N successful
+// GET responses through it in a directory. It is safe for concurrent use.
+type Grabadora struct {
+	base http.RoundTripper
+	dir  string
+	n    int
+
+	mu       sync.Mutex
+	grabados map[string]Fixture
+}
+
+// Grabar returns a Grabadora over base that records up to n responses in
+// dir, replacing the fixtures a previous recording left there.
+func Grabar(base http.RoundTripper, dir string, n int) (*Grabadora, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	prev, err := Leer(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range prev {
+		os.Remove(filepath.Join(dir, f.Archivo))
+	}
+	return &Grabadora{base: base, dir: dir, n: n, grabados: make(map[string]Fixture)}, nil
+}
+
+// Leer returns the fixtures recorded in dir, none when it has no Indice.
+func Leer(dir string) ([]Fixture, error) {
+	data, err := os.ReadFile(filepath.Join(dir, Indice))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var fixtures []Fixture
+	if err := json.Unmarshal(data, &fixtures); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", Indice, err)
+	}
+	return fixtures, nil
+}
+
+// Grabados is how many responses g has recorded.
+func (g *Grabadora) Grabados() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.grabados)
+}
+
+func (g *Grabadora) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := g.base.RoundTrip(req)
+	if err != nil || req.Method != http.MethodGet || resp.StatusCode != http.StatusOK || !g.reservar(req) {
+		return resp, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		g.liberar(req)
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err := g.guardar(req, resp, body); err != nil {
+		g.liberar(req)
+		return nil, fmt.Errorf("error grabando fixture: %w", err)
+	}
+	return resp, nil
+}
+
+// reservar claims one of the n places for req's URL, unless it is already
+// recorded or none is left.
+func (g *Grabadora) reservar(req *http.Request) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	key := clave(req)
+	if _, ok := g.grabados[key]; ok || len(g.grabados) >= g.n {
+		return false
+	}
+	g.grabados[key] = Fixture{}
+	return true
+}
+
+func (g *Grabadora) liberar(req *http.Request) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.grabados, clave(req))
+}
+
+func clave(req *http.Request) string {
+	return canonurl.Clean(req.URL.String())
+}
+
+// guardar writes the normalized body, named after its URL so that the same
+// page always lands in the same file, and rewrites Indice.
+func (g *Grabadora) guardar(req *http.Request, resp *http.Response, body []byte) error {
+	key := clave(req)
+	tipo, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	f := Fixture{
+		URL:     secretos.Ocultar(key),
+		Archivo: nombre(req, tipo),
+		Status:  resp.StatusCode,
+		Tipo:    tipo,
+	}
+	if err := os.WriteFile(filepath.Join(g.dir, f.Archivo), Normalizar(body), 0644); err != nil {
+		return err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.grabados[key] = f
+	fixtures := make([]Fixture, 0, len(g.grabados))
+	for _, f := range g.grabados {
+		if f.Archivo != "" {
+			fixtures = append(fixtures, f)
+		}
+	}
+	sort.Slice(fixtures, func(i, j int) bool { return fixtures[i].URL < fixtures[j].URL })
+	data, err := json.MarshalIndent(fixtures, "", "    ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(g.dir, Indice), append(data, '\n'), 0644)
+}
+
+var reNoNombre = regexp.MustCompile(`[^a-z0-9]+`)
+
+// nombre is the fixture file of req: its path, readable, and a hash of the
+// whole URL that tells apart pages and queries of the same path.
+func nombre(req *http.Request, tipo string) string {
+	slug := strings.Trim(reNoNombre.ReplaceAllString(strings.ToLower(req.URL.Path), "-"), "-")
+	if len(slug) > 60 {
+		slug = slug[len(slug)-60:]
+	}
+	if slug == "" {
+		slug = "index"
+	}
+	sum := sha256.Sum256([]byte(clave(req)))
+	ext := ".html"
+	switch {
+	case strings.Contains(tipo, "json"):
+		ext = ".json"
+	case strings.Contains(tipo, "xml"):
+		ext = ".xml"
+	case tipo != "" && !strings.Contains(tipo, "html"):
+		ext = ".txt"
+	}
+	return slug + "-" + hex.EncodeToString(sum[:4]) + ext
+}
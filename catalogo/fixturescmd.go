@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"catalogo/fixtures"
+	"catalogo/runid"
+)
+
+// runFixtures records test fixtures of a store: a short sample run of its
+// scraper that saves the first responses it gets, normalized, in testdata.
+func runFixtures(args []string) error {
+	if len(args) == 0 || args[0] != "record" {
+		return fmt.Errorf("uso: catalogo fixtures record -store <id> [-n 20] [-dir testdata]")
+	}
+	fs := flag.NewFlagSet("fixtures record", flag.ContinueOnError)
+	configPath := fs.String("config", "catalogo.json", "Ruta del archivo de configuración")
+	id := fs.String("store", "", "ID de la tienda cuyas respuestas grabar")
+	n := fs.Int("n", 20, "Respuestas a grabar")
+	dir := fs.String("dir", "", "Directorio de los fixtures (default: testdata en el directorio del scraper)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	s := cfg.store(*id)
+	if s == nil {
+		return fmt.Errorf("tienda desconocida: %q", *id)
+	}
+	if *n <= 0 {
+		return fmt.Errorf("-n debe ser positivo")
+	}
+	out := *dir
+	if out == "" {
+		out = filepath.Join(s.Dir, "testdata")
+	}
+	// The scraper runs in its own directory
+	if out, err = filepath.Abs(out); err != nil {
+		return err
+	}
+
+	// A one-product-per-category sample with one worker, so the responses
+	// recorded are the same from one recording to the next, written to a
+	// scratch output instead of the store's catalog
+	tmp, err := os.MkdirTemp("", "catalogo-fixtures-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	run := *s
+	run.Salida = filepath.Join(tmp, "productos.json")
+	run.Workers = 1
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	log.Printf("[FIXTURE] %s: grabando %d respuestas en %s", s.ID, *n, out)
+	if err := runScraper(ctx, run, runid.New(), "-sample", "1", "-record-fixtures", out, "-record-n", fmt.Sprint(*n)); err != nil {
+		return err
+	}
+	recorded, err := fixtures.Leer(out)
+	if err != nil {
+		return err
+	}
+	log.Printf("[FIXTURE] %s: %d fixtures en %s", s.ID, len(recorded), filepath.Join(out, fixtures.Indice))
+	return nil
+}
@@ -0,0 +1,3 @@
+module catalogo
+
+go 1.24.5
@@ -0,0 +1,108 @@
+// Package historial keeps runs-history.tsv, one row per scraper run next to
+// its output, as a long-term operational record that opens in a spreadsheet
+// or sort/awk: how many products each run found, what appeared and
+// disappeared, the average price, the errors and how long it took.
+package historial
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"catalogo/canonurl"
+	"catalogo/producto"
+)
+
+// Archivo is the history's name next to the output.
+const Archivo = "runs-history.tsv"
+
+// encabezado is the first line of a new history.
+var encabezado = []string{"fecha", "tienda", "corrida", "modo", "productos", "nuevos", "eliminados", "precio_promedio", "errores", "duracion_s", "resultado"}
+
+// Corrida is one row of the history.
+type Corrida struct {
+	Fecha   time.Time
+	Tienda  string
+	ID      string
+	Modo    string
+	Errores int64
+	// Duracion is the run's, without the startup before scraping.
+	Duracion time.Duration
+	// Err is why the run failed; its row has no product counts.
+	Err error
+
+	productos, nuevos, eliminados int
+	precioPromedio                float64
+}
+
+// Resumir counts the products of the run's output, those not in the
+// previous one and those that left it, and averages their prices, leaving
+// out products without one.
+func (c *Corrida) Resumir(previous, current []producto.Product) {
+	c.productos = len(current)
+	before := make(map[string]bool, len(previous))
+	for _, p := range previous {
+		before[canonurl.Key(p.Link)] = true
+	}
+	var sum float64
+	var priced int
+	for _, p := range current {
+		key := canonurl.Key(p.Link)
+		if !before[key] {
+			c.nuevos++
+		}
+		delete(before, key)
+		if p.Precio > 0 {
+			sum += p.Precio
+			priced++
+		}
+	}
+	c.eliminados = len(before)
+	if priced > 0 {
+		c.precioPromedio = math.Round(sum/float64(priced)*100) / 100
+	}
+}
+
+// Ruta is the history of the output at output.
+func Ruta(output string) string {
+	return filepath.Join(filepath.Dir(output), Archivo)
+}
+
+// Agregar appends c to the history at fpath, creating it with its header.
+// The row goes in a single write, so runs of several stores can share a
+// history.
+func Agregar(fpath string, c Corrida) error {
+	f, err := os.OpenFile(fpath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("error abriendo %s: %w", fpath, err)
+	}
+
+	var b strings.Builder
+	if info, err := f.Stat(); err == nil && info.Size() == 0 {
+		b.WriteString(strings.Join(encabezado, "\t") + "\n")
+	}
+	row := []string{c.Fecha.Format(time.RFC3339), campo(c.Tienda), campo(c.ID), campo(c.Modo)}
+	if c.Err != nil {
+		row = append(row, "", "", "", "")
+	} else {
+		row = append(row, fmt.Sprint(c.productos), fmt.Sprint(c.nuevos), fmt.Sprint(c.eliminados), fmt.Sprintf("%.2f", c.precioPromedio))
+	}
+	resultado := "ok"
+	if c.Err != nil {
+		resultado = "error"
+	}
+	row = append(row, fmt.Sprint(c.Errores), fmt.Sprintf("%.1f", c.Duracion.Seconds()), resultado)
+	b.WriteString(strings.Join(row, "\t") + "\n")
+
+	_, err = f.WriteString(b.String())
+	return errors.Join(err, f.Close())
+}
+
+// campo keeps a value from breaking the row.
+func campo(s string) string {
+	return strings.NewReplacer("\t", " ", "\n", " ", "\r", " ").Replace(s)
+}
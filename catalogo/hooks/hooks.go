@@ -0,0 +1,198 @@
+// Package hooks runs a store's hook commands from catalogo.json, so a team
+// can add its own enrichment without forking the scrapers: preRun before
+// each scheduled run (failing it skips the run), postRun after it with the
+// run's status JSON on stdin, and transform over the products about to be
+// written, e.g.
+//
+//	"hooks": {"preRun": ["./hooks/vpn-up.sh"],
+//	          "postRun": ["python3", "hooks/notificar.py"],
+//	          "transform": ["hooks/margen.wasm"]}
+//
+// A transform reads the products as JSON lines on stdin and writes one line
+// per product on stdout, the product as it should be written or null to
+// drop it. A command whose first element ends in .wasm runs as a WASI
+// module under the runtime in CATALOGO_WASM_RUNTIME ("wasmtime run" by
+// default).
+package hooks
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"catalogo/producto"
+	"catalogo/tienda"
+)
+
+// Timeout bounds each hook command; a transform gets it for all of a run's
+// products together.
+const Timeout = 5 * time.Minute
+
+// WasmRuntimeEnv names the variable with the command that runs .wasm hooks.
+const WasmRuntimeEnv = "CATALOGO_WASM_RUNTIME"
+
+// Hooks is a store's "hooks" section of catalogo.json. Each is a command
+// and its arguments, without a shell; relative paths are from Dir.
+type Hooks struct {
+	PreRun    []string `json:"preRun"`
+	PostRun   []string `json:"postRun"`
+	Transform []string `json:"transform"`
+	// Dir is where the commands run, the directory of catalogo.json.
+	Dir string `json:"-"`
+}
+
+// Validate rejects commands without a program.
+func (h Hooks) Validate() error {
+	for _, c := range []struct {
+		name string
+		cmd  []string
+	}{{"preRun", h.PreRun}, {"postRun", h.PostRun}, {"transform", h.Transform}} {
+		if len(c.cmd) > 0 && strings.TrimSpace(c.cmd[0]) == "" {
+			return fmt.Errorf("hooks: %s sin comando", c.name)
+		}
+	}
+	return nil
+}
+
+// Pre runs the preRun hook with env added to the environment. Its error
+// means the run must not go ahead.
+func (h Hooks) Pre(ctx context.Context, env []string) error {
+	if len(h.PreRun) == 0 {
+		return nil
+	}
+	if _, err := h.run(ctx, "preRun", h.PreRun, env, nil); err != nil {
+		return fmt.Errorf("hook preRun: %w", err)
+	}
+	return nil
+}
+
+// Post runs the postRun hook with env added to the environment and the
+// run's status JSON on stdin.
+func (h Hooks) Post(ctx context.Context, env []string, status []byte) error {
+	if len(h.PostRun) == 0 {
+		return nil
+	}
+	if _, err := h.run(ctx, "postRun", h.PostRun, env, status); err != nil {
+		return fmt.Errorf("hook postRun: %w", err)
+	}
+	return nil
+}
+
+// Transformar passes products through the transform hook and returns what
+// it wrote back. Without a transform it returns products as they are.
+func (h Hooks) Transformar(ctx context.Context, products []producto.Product) ([]producto.Product, error) {
+	if len(h.Transform) == 0 {
+		return products, nil
+	}
+	var in bytes.Buffer
+	enc := json.NewEncoder(&in)
+	for i := range products {
+		if err := enc.Encode(&products[i]); err != nil {
+			return nil, err
+		}
+	}
+	out, err := h.run(ctx, "transform", h.Transform, nil, in.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("hook transform: %w", err)
+	}
+
+	result := make([]producto.Product, 0, len(products))
+	n := 0
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		n++
+		if bytes.Equal(line, []byte("null")) {
+			continue
+		}
+		var p producto.Product
+		if err := json.Unmarshal(line, &p); err != nil {
+			return nil, fmt.Errorf("hook transform: línea %d: %w", n, err)
+		}
+		result = append(result, p)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("hook transform: %w", err)
+	}
+	if n != len(products) {
+		return nil, fmt.Errorf("hook transform: devolvió %d líneas para %d productos", n, len(products))
+	}
+	return result, nil
+}
+
+// run executes one hook and returns its stdout. Its stderr goes to the log,
+// a line at a time.
+func (h Hooks) run(ctx context.Context, name string, command, env []string, stdin []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, Timeout)
+	defer cancel()
+
+	args := comando(command)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = h.Dir
+	cmd.Env = append(os.Environ(), env...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	for _, line := range strings.Split(strings.TrimRight(stderr.String(), "\n"), "\n") {
+		if line != "" {
+			log.Printf("[HOOK]   %s: %s", name, line)
+		}
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("%s excedió %v", args[0], Timeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
+
+// comando is the command line of a hook, under the WASI runtime when it is
+// a .wasm module.
+func comando(command []string) []string {
+	if !strings.EqualFold(filepath.Ext(command[0]), ".wasm") {
+		return command
+	}
+	runtime := strings.Fields(os.Getenv(WasmRuntimeEnv))
+	if len(runtime) == 0 {
+		runtime = []string{"wasmtime", "run"}
+	}
+	return append(runtime, command...)
+}
+
+// Leer returns the "hooks" section of the store id in the configuration
+// file fpath (catalogo.json), to run in its directory. A missing file or
+// store has none.
+func Leer(fpath, id string) (Hooks, error) {
+	var s struct {
+		Hooks Hooks `json:"hooks"`
+	}
+	if err := tienda.Leer(fpath, id, &s); err != nil {
+		return Hooks{}, err
+	}
+	if err := s.Hooks.Validate(); err != nil {
+		return Hooks{}, fmt.Errorf("tienda %s: %w", id, err)
+	}
+	dir, err := filepath.Abs(filepath.Dir(fpath))
+	if err != nil {
+		return Hooks{}, err
+	}
+	s.Hooks.Dir = dir
+	return s.Hooks, nil
+}
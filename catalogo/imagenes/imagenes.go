@@ -0,0 +1,136 @@
+// Package imagenes rewrites the image URLs of the products a scraper writes
+// by a store's rules in catalogo.json, so the published catalog points at
+// our own image proxy, with its resize parameters, instead of the
+// supplier's CDN.
+package imagenes
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+
+	"catalogo/producto"
+	"catalogo/tienda"
+)
+
+// Regla rewrites the URLs Patron matches to Reemplazo, where $1, ${name},
+// etc. are Patron's groups, and then sets the Query parameters, e.g.
+//
+//	{"patron": "^https://buytiti\\.com/wp-content/uploads/(.*)$",
+//	 "reemplazo": "https://img.example.mx/buytiti/$1",
+//	 "query": {"w": "600", "fm": "webp"}}
+type Regla struct {
+	// Patron is a regular expression matched against the whole URL.
+	Patron string `json:"patron"`
+	// Reemplazo is the new URL; empty keeps the URL and only sets Query.
+	Reemplazo string            `json:"reemplazo"`
+	Query     map[string]string `json:"query"`
+	// Campo limits the rule to "imagen" or "imagen64"; empty is both.
+	Campo string `json:"campo"`
+
+	re *regexp.Regexp
+}
+
+// Reglas is a store's "imagenes" section of catalogo.json. Each URL takes
+// the first rule that matches it; URLs no rule matches are kept.
+type Reglas []Regla
+
+// Validate rejects rules whose pattern does not compile, that change
+// nothing or that name an unknown field.
+func (rs Reglas) Validate() error {
+	for i, r := range rs {
+		if _, err := regexp.Compile(r.Patron); err != nil {
+			return fmt.Errorf("imagenes: regla #%d: %w", i+1, err)
+		}
+		if r.Reemplazo == "" && len(r.Query) == 0 {
+			return fmt.Errorf("imagenes: regla #%d sin reemplazo ni query", i+1)
+		}
+		switch r.Campo {
+		case "", "imagen", "imagen64":
+		default:
+			return fmt.Errorf("imagenes: regla #%d con campo desconocido %q (imagen o imagen64)", i+1, r.Campo)
+		}
+	}
+	return nil
+}
+
+// Reescribir is u as the rules leave it for field campo ("imagen" or
+// "imagen64"). Setting Query is idempotent, so a URL rewritten in an
+// earlier run and matched again keeps the same parameters.
+func (rs Reglas) Reescribir(campo, u string) string {
+	if u == "" {
+		return u
+	}
+	for _, r := range rs {
+		if r.Campo != "" && r.Campo != campo {
+			continue
+		}
+		re := r.re
+		if re == nil {
+			re = regexp.MustCompile(r.Patron)
+		}
+		m := re.FindStringSubmatchIndex(u)
+		if m == nil {
+			continue
+		}
+		out := u
+		if r.Reemplazo != "" {
+			out = string(re.ExpandString(nil, r.Reemplazo, u, m))
+		}
+		return conQuery(out, r.Query)
+	}
+	return u
+}
+
+// conQuery sets params on the query of u, in key order.
+func conQuery(u string, params map[string]string) string {
+	if len(params) == 0 {
+		return u
+	}
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return u
+	}
+	q := parsed.Query()
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		q.Set(k, params[k])
+	}
+	parsed.RawQuery = q.Encode()
+	return parsed.String()
+}
+
+// Aplicar rewrites the Imagen and Imagen64 of every product.
+func (rs Reglas) Aplicar(products []producto.Product) {
+	if len(rs) == 0 {
+		return
+	}
+	for i := range products {
+		p := &products[i]
+		p.Imagen = rs.Reescribir("imagen", p.Imagen)
+		p.Imagen64 = rs.Reescribir("imagen64", p.Imagen64)
+	}
+}
+
+// Leer returns the "imagenes" rules of the store id in the configuration
+// file fpath (catalogo.json), compiled. A missing file or store has none.
+func Leer(fpath, id string) (Reglas, error) {
+	var s struct {
+		Reglas Reglas `json:"imagenes"`
+	}
+	if err := tienda.Leer(fpath, id, &s); err != nil {
+		return nil, err
+	}
+	if err := s.Reglas.Validate(); err != nil {
+		return nil, fmt.Errorf("tienda %s: %w", id, err)
+	}
+	for i := range s.Reglas {
+		s.Reglas[i].re = regexp.MustCompile(s.Reglas[i].Patron)
+	}
+	return s.Reglas, nil
+}
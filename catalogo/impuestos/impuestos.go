@@ -0,0 +1,73 @@
+// Package impuestos normalizes prices for IVA: each store says in
+// catalogo.json whether the prices it shows include it, and every product
+// gets both its price with and without it, so a retail store's prices compare
+// with a wholesaler's that shows them before tax.
+package impuestos
+
+import (
+	"fmt"
+
+	"catalogo/divisas"
+	"catalogo/producto"
+	"catalogo/tienda"
+)
+
+// TasaGeneral is Mexico's general IVA rate.
+const TasaGeneral = 0.16
+
+// IVA is how a store's prices stand with the tax, from its "preciosConIVA"
+// and "tasaIVA" in catalogo.json.
+type IVA struct {
+	// Incluido reports whether the prices shown include IVA; it does
+	// unless the store says "preciosConIVA": false.
+	Incluido *bool `json:"preciosConIVA"`
+	// Tasa is the rate, TasaGeneral when zero (0.08 in the border region).
+	Tasa float64 `json:"tasaIVA"`
+}
+
+// Validate rejects rates that are not a fraction.
+func (iva IVA) Validate() error {
+	if iva.Tasa < 0 || iva.Tasa >= 1 {
+		return fmt.Errorf("tasaIVA inválida %v (fracción, como 0.16)", iva.Tasa)
+	}
+	return nil
+}
+
+func (iva IVA) incluido() bool { return iva.Incluido == nil || *iva.Incluido }
+
+func (iva IVA) tasa() float64 {
+	if iva.Tasa == 0 {
+		return TasaGeneral
+	}
+	return iva.Tasa
+}
+
+// Aplicar sets PrecioConIVA and PrecioSinIVA of every product from Precio,
+// rounded to the minor unit of its currency.
+func (iva IVA) Aplicar(products []producto.Product) {
+	factor := 1 + iva.tasa()
+	for i := range products {
+		p := &products[i]
+		if iva.incluido() {
+			p.PrecioConIVA = p.Precio
+			p.PrecioSinIVA = divisas.Redondear(p.Precio/factor, p.Divisa())
+		} else {
+			p.PrecioConIVA = divisas.Redondear(p.Precio*factor, p.Divisa())
+			p.PrecioSinIVA = p.Precio
+		}
+	}
+}
+
+// Leer returns the IVA settings of the store id in the configuration
+// file fpath (catalogo.json). A missing file or store has the defaults:
+// prices with IVA at TasaGeneral.
+func Leer(fpath, id string) (IVA, error) {
+	var iva IVA
+	if err := tienda.Leer(fpath, id, &iva); err != nil {
+		return IVA{}, err
+	}
+	if err := iva.Validate(); err != nil {
+		return IVA{}, fmt.Errorf("tienda %s: %w", id, err)
+	}
+	return iva, nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"catalogo/indice"
+	"catalogo/match"
+)
+
+// runIndex builds the search index over the given catalogs, or over every
+// store in the configuration when none are given, and optionally the web
+// index the static site searches in the browser.
+func runIndex(args []string) error {
+	fset := flag.NewFlagSet("index", flag.ContinueOnError)
+	configPath := fset.String("config", "catalogo.json", "Configuración con las tiendas a indexar cuando no se indican archivos")
+	output := fset.String("o", "indice-busqueda.idx", "Archivo del índice a escribir (vacío = no escribirlo)")
+	synonyms := fset.String("sinonimos", "", "Archivo de sinónimos, un grupo por línea separado por \"=\" (audífonos=auriculares=headphones)")
+	stopwords := fset.String("vacias", "", "Archivo con palabras vacías adicionales a ignorar al indexar y al buscar")
+	suggestOut := fset.String("sugerencias", "", "Escribir también las sugerencias para autocompletar (JSON) en este archivo")
+	webOut := fset.String("web", "", "Escribir también el índice para buscar desde el navegador (JSON) en este archivo")
+	webFields := fset.String("web-campos", "nombre:3,categoria,subcategorias,tienda,link", "Campos en los que busca el índice web, con peso opcional")
+	webStored := fset.String("web-guardar", "nombre,tienda,link,imagen,precio,stock", "Atributos de cada producto que guarda el índice web para mostrar resultados")
+	files, err := parseInterspersed(fset, args)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		cfg, err := loadConfig(*configPath)
+		if err != nil {
+			return err
+		}
+		for _, st := range cfg.Tiendas {
+			files = append(files, st.Salida)
+		}
+	}
+
+	catalogs := make([]match.Catalog, len(files))
+	for i, fpath := range files {
+		if catalogs[i], err = loadCatalog(fpath); err != nil {
+			return err
+		}
+	}
+	var groups [][]string
+	if *synonyms != "" {
+		if groups, err = indice.LoadSinonimos(*synonyms); err != nil {
+			return err
+		}
+	}
+	var extra []string
+	if *stopwords != "" {
+		if extra, err = indice.LoadVacias(*stopwords); err != nil {
+			return err
+		}
+	}
+	an, err := indice.NuevoAnalizador(extra, groups)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if *output != "" {
+		ix := indice.Build(catalogs, an, now)
+		if err := ix.Save(*output); err != nil {
+			return err
+		}
+		log.Printf("[INDEX]  %d productos de %d tiendas indexados en %s", ix.Documentos(), len(catalogs), *output)
+	}
+	if *webOut != "" {
+		campos, err := indice.ParseCampos(*webFields)
+		if err != nil {
+			return err
+		}
+		var stored []string
+		for f := range strings.SplitSeq(*webStored, ",") {
+			if f = strings.TrimSpace(f); f != "" {
+				stored = append(stored, f)
+			}
+		}
+		web, err := indice.BuildWeb(catalogs, campos, stored, an, now)
+		if err != nil {
+			return err
+		}
+		if err := web.Save(*webOut); err != nil {
+			return err
+		}
+		log.Printf("[INDEX]  %d productos, %d términos en el índice web %s", len(web.Docs), len(web.Terminos), *webOut)
+	}
+	if *suggestOut != "" {
+		entries := indice.Sugerencias(catalogs)
+		if err := indice.WriteSugerencias(entries, *suggestOut, now); err != nil {
+			return err
+		}
+		log.Printf("[INDEX]  %d sugerencias escritas en %s", len(entries), *suggestOut)
+	}
+	return nil
+}
+
+// indexCache keeps the search index open until the file changes on disk, so
+// a new catalogo index is picked up without restarting the server.
+type indexCache struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	ix      *indice.Indice
+}
+
+func (c *indexCache) load() (*indice.Indice, error) {
+	if c.path == "" {
+		return nil, fmt.Errorf("búsqueda desactivada (sin -indice)")
+	}
+	info, err := os.Stat(c.path)
+	if err != nil {
+		return nil, fmt.Errorf("índice no disponible, genéralo con catalogo index: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ix != nil && c.modTime.Equal(info.ModTime()) {
+		return c.ix, nil
+	}
+	ix, err := indice.Open(c.path)
+	if err != nil {
+		return nil, err
+	}
+	c.ix, c.modTime = ix, info.ModTime()
+	return ix, nil
+}
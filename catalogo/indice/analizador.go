@@ -0,0 +1,179 @@
+package indice
+
+import (
+	"bufio"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"catalogo/texto"
+)
+
+// stopwords are Spanish words too common in product names to search by.
+var stopwords = map[string]bool{
+	"a": true, "al": true, "con": true, "de": true, "del": true, "el": true,
+	"en": true, "la": true, "las": true, "lo": true, "los": true, "o": true,
+	"para": true, "por": true, "sin": true, "su": true, "un": true, "una": true,
+	"y": true,
+}
+
+// Analizador turns text into index terms. It is stored in the index, so
+// queries are analyzed exactly as the products were.
+type Analizador struct {
+	// Abreviaturas is only filled in web indexes, for the browser to spell
+	// them out as texto does.
+	Abreviaturas map[string]string `json:"abreviaturas,omitempty"`
+	// Vacias are the stopwords, normalized.
+	Vacias []string `json:"vacias"`
+	// Sinonimos maps the term of every synonym to the term of the first
+	// word of its group.
+	Sinonimos map[string]string `json:"sinonimos,omitempty"`
+
+	vacias map[string]bool
+}
+
+// NuevoAnalizador returns an analyzer with the built-in stopwords plus
+// vacias, and the synonym groups sinonimos.
+func NuevoAnalizador(vacias []string, sinonimos [][]string) (*Analizador, error) {
+	set := maps.Clone(stopwords)
+	for _, v := range vacias {
+		for _, w := range texto.Words(v) {
+			set[w] = true
+		}
+	}
+	a := &Analizador{Vacias: slices.Sorted(maps.Keys(set))}
+	for _, group := range sinonimos {
+		var terms []string
+		for _, word := range group {
+			words := texto.Words(word)
+			if len(words) != 1 {
+				return nil, fmt.Errorf("sinónimo %q: debe ser una sola palabra", word)
+			}
+			if set[words[0]] {
+				return nil, fmt.Errorf("sinónimo %q: es una palabra vacía", word)
+			}
+			terms = append(terms, stem(words[0]))
+		}
+		for _, t := range terms[1:] {
+			if t == terms[0] {
+				continue
+			}
+			if a.Sinonimos == nil {
+				a.Sinonimos = make(map[string]string)
+			}
+			a.Sinonimos[t] = terms[0]
+		}
+	}
+	a.prepare()
+	return a, nil
+}
+
+// predeterminado is the analyzer with no configuration.
+var predeterminado, _ = NuevoAnalizador(nil, nil)
+
+func (a *Analizador) prepare() {
+	a.vacias = make(map[string]bool, len(a.Vacias))
+	for _, v := range a.Vacias {
+		a.vacias[v] = true
+	}
+}
+
+// Terminos splits s into the terms the index stores: texto's normalized
+// words, without accents or stopwords, reduced to a stem and then to the
+// first synonym of its group.
+func (a *Analizador) Terminos(s string) []string {
+	var out []string
+	for _, w := range texto.Words(s) {
+		if a.vacias[w] {
+			continue
+		}
+		t := stem(w)
+		if syn, ok := a.Sinonimos[t]; ok {
+			t = syn
+		}
+		out = append(out, t)
+	}
+	return out
+}
+
+// Terminos splits s into terms with the default analyzer.
+func Terminos(s string) []string {
+	return predeterminado.Terminos(s)
+}
+
+// LoadSinonimos reads a synonyms file: one group per line, its words joined
+// by "=" ("audífonos=auriculares=headphones"). Blank lines and lines
+// starting with # are skipped.
+func LoadSinonimos(fpath string) ([][]string, error) {
+	var groups [][]string
+	err := readLines(fpath, func(line string) error {
+		var group []string
+		for w := range strings.SplitSeq(line, "=") {
+			if w = strings.TrimSpace(w); w != "" {
+				group = append(group, w)
+			}
+		}
+		if len(group) < 2 {
+			return fmt.Errorf("se esperaba \"palabra=sinónimo\" en %q", line)
+		}
+		groups = append(groups, group)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo sinónimos: %w", err)
+	}
+	return groups, nil
+}
+
+// LoadVacias reads a stopwords file: words separated by spaces or lines.
+// Lines starting with # are skipped.
+func LoadVacias(fpath string) ([]string, error) {
+	var words []string
+	err := readLines(fpath, func(line string) error {
+		words = append(words, strings.Fields(line)...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo palabras vacías: %w", err)
+	}
+	return words, nil
+}
+
+func readLines(fpath string, fn func(line string) error) error {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := fn(line); err != nil {
+			return fmt.Errorf("%s línea %d: %w", fpath, n, err)
+		}
+	}
+	return sc.Err()
+}
+
+// stem is a light Spanish stemmer: enough to make plural and singular, and
+// masculine and feminine, meet ("fundas" and "funda", "cargadores" and
+// "cargador", "negro" and "negra"), not a full Snowball stemmer. Words with
+// digits are model codes and measures and are left alone.
+func stem(w string) string {
+	if len(w) <= 3 || strings.ContainsAny(w, "0123456789") {
+		return w
+	}
+	if strings.HasSuffix(w, "ces") {
+		return w[:len(w)-3] + "z"
+	}
+	w = strings.TrimSuffix(w, "s")
+	if len(w) > 3 && strings.ContainsRune("aeo", rune(w[len(w)-1])) {
+		w = w[:len(w)-1]
+	}
+	return w
+}
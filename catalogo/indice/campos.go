@@ -0,0 +1,118 @@
+package indice
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"catalogo/producto"
+)
+
+// Campo is a product field searched and the weight of its terms.
+type Campo struct {
+	Nombre string
+	Peso   int
+}
+
+// CamposPredeterminados are the fields Build indexes: a term in the name
+// says more than one in the category, and codes that only appear in the
+// link slug still find the product.
+var CamposPredeterminados = []Campo{
+	{"nombre", 3},
+	{"categoria", 1},
+	{"subcategorias", 1},
+	{"tienda", 1},
+	{"link", 1},
+}
+
+// ParseCampos reads a field list like "nombre:3,categoria,link". A field
+// without weight weighs 1.
+func ParseCampos(s string) ([]Campo, error) {
+	var out []Campo
+	for part := range strings.SplitSeq(s, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		name, weight, hasWeight := strings.Cut(part, ":")
+		c := Campo{Nombre: strings.TrimSpace(name), Peso: 1}
+		if hasWeight {
+			w, err := strconv.Atoi(strings.TrimSpace(weight))
+			if err != nil || w <= 0 {
+				return nil, fmt.Errorf("peso inválido en %q", part)
+			}
+			c.Peso = w
+		}
+		if _, err := textos(c.Nombre, "", producto.Product{}); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no se indicó ningún campo")
+	}
+	return out, nil
+}
+
+// textos is the text of field campo of p to index.
+func textos(campo, tienda string, p producto.Product) ([]string, error) {
+	switch campo {
+	case "nombre":
+		return []string{p.Nombre}, nil
+	case "categoria":
+		return []string{p.Categoria}, nil
+	case "subcategorias":
+		return p.Subcategorias, nil
+	case "tienda":
+		return []string{tienda}, nil
+	case "link":
+		return []string{slug(p.Link)}, nil
+	}
+	return nil, fmt.Errorf("campo desconocido %q (nombre, categoria, subcategorias, tienda, link)", campo)
+}
+
+// pesos is the weight of every term an finds in campos of p, and their sum.
+func pesos(an *Analizador, campos []Campo, tienda string, p producto.Product) (map[string]float32, float32) {
+	weights := make(map[string]float32)
+	var largo float32
+	for _, c := range campos {
+		texts, _ := textos(c.Nombre, tienda, p)
+		for _, s := range texts {
+			for _, t := range an.Terminos(s) {
+				weights[t] += float32(c.Peso)
+				largo += float32(c.Peso)
+			}
+		}
+	}
+	return weights, largo
+}
+
+// guardado is the value of p's attribute campo stored in a web index.
+func guardado(campo, tienda string, p producto.Product) (any, error) {
+	switch campo {
+	case "nombre":
+		return p.Nombre, nil
+	case "tienda":
+		return tienda, nil
+	case "link":
+		return p.Link, nil
+	case "imagen":
+		return p.Imagen, nil
+	case "categoria":
+		return p.Categoria, nil
+	case "subcategorias":
+		return p.Subcategorias, nil
+	case "precio":
+		return p.Precio, nil
+	case "precioOriginal":
+		return p.PrecioOriginal, nil
+	case "enOferta":
+		return p.EnOferta, nil
+	case "stock":
+		return p.Stock, nil
+	case "precioUnitario":
+		return p.PrecioUnitario, nil
+	case "unidad":
+		return p.Unidad, nil
+	}
+	return nil, fmt.Errorf("atributo desconocido %q", campo)
+}
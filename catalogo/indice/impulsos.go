@@ -0,0 +1,79 @@
+package indice
+
+import (
+	"fmt"
+	"strings"
+
+	"catalogo/texto"
+)
+
+// Impulsos are the boost rules of a search: factors that multiply the
+// relevance of a result, above 1 to favor it and below 1 to demote it. A
+// zero factor is no rule. They live in the "busqueda" section of
+// catalogo.json, e.g.
+//
+//	"busqueda": {
+//	    "disponible": 1.5,
+//	    "enOferta": 1.2,
+//	    "tiendas": {"buytiti": 1.1},
+//	    "categorias": {"Liquidaciones": 0.5}
+//	}
+type Impulsos struct {
+	// Disponible applies to products the store does not mark as sold out.
+	Disponible float64 `json:"disponible"`
+	// EnOferta applies to products on sale.
+	EnOferta float64 `json:"enOferta"`
+	// Tiendas applies per store id, compared like Categorias.
+	Tiendas map[string]float64 `json:"tiendas"`
+	// Categorias applies per category, compared without case or accents.
+	Categorias map[string]float64 `json:"categorias"`
+
+	tiendas    map[string]float64
+	categorias map[string]float64
+}
+
+// Validate rejects negative factors and prepares the rules for Factor.
+func (imp *Impulsos) Validate() error {
+	if imp.Disponible < 0 || imp.EnOferta < 0 {
+		return fmt.Errorf("busqueda: factor negativo")
+	}
+	imp.tiendas = make(map[string]float64, len(imp.Tiendas))
+	for t, f := range imp.Tiendas {
+		if f < 0 {
+			return fmt.Errorf("busqueda: factor negativo para la tienda %s", t)
+		}
+		imp.tiendas[texto.Normalize(t)] = f
+	}
+	imp.categorias = make(map[string]float64, len(imp.Categorias))
+	for c, f := range imp.Categorias {
+		if f < 0 {
+			return fmt.Errorf("busqueda: factor negativo para la categoría %s", c)
+		}
+		imp.categorias[texto.Normalize(c)] = f
+	}
+	return nil
+}
+
+// Factor is what d's relevance is multiplied by: the product of every rule
+// that applies to it, or 1. Store and category rules need Validate first. A nil
+// Impulsos boosts nothing.
+func (imp *Impulsos) Factor(d Documento) float64 {
+	if imp == nil {
+		return 1
+	}
+	f := 1.0
+	apply := func(w float64) {
+		if w > 0 {
+			f *= w
+		}
+	}
+	if !strings.EqualFold(strings.TrimSpace(d.Stock), "agotado") {
+		apply(imp.Disponible)
+	}
+	if d.EnOferta {
+		apply(imp.EnOferta)
+	}
+	apply(imp.tiendas[texto.Normalize(d.Tienda)])
+	apply(imp.categorias[texto.Normalize(d.Categoria)])
+	return f
+}
@@ -0,0 +1,269 @@
+// Package indice builds a full-text search index over the store catalogs and
+// persists it to one file, so the serve mode and other tools can search the
+// products without loading and scanning every productos.json.
+//
+// The index is its own gob format rather than a Bleve index: the module
+// depends only on the standard library, and the same analyzer and BM25
+// ranking have to run in the browser (buscador.js over the web index),
+// which a Bleve index cannot serve. Spanish analysis, accent folding and
+// read-only opening, what Bleve was wanted for, are covered here.
+package indice
+
+import (
+	"encoding/gob"
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"catalogo/match"
+	"catalogo/texto"
+)
+
+// formato is the version of the file layout; Open rejects other versions so
+// an index built by an older binary is rebuilt rather than misread.
+const formato = 4
+
+// pesoPrefijo scales the score of terms matched only as a prefix, so
+// "mica" ranks micas above micrófonos.
+const pesoPrefijo = 0.5
+
+// Documento is one product in the index, with what a result list shows.
+type Documento struct {
+	Tienda    string  `json:"tienda"`
+	Nombre    string  `json:"nombre"`
+	Link      string  `json:"link"`
+	Imagen    string  `json:"imagen"`
+	Categoria string  `json:"categoria"`
+	Precio    float64 `json:"precio"`
+	EnOferta  bool    `json:"enOferta"`
+	Stock     string  `json:"stock"`
+}
+
+type posting struct {
+	Doc  uint32
+	Peso float32
+}
+
+// archivo is the on-disk layout.
+type archivo struct {
+	Formato    int
+	Creado     time.Time
+	Analizador Analizador
+	Docs       []Documento
+	// Sugerencias feed the type-ahead of Sugerir
+	Sugerencias []Sugerencia
+	Largos      []float32
+	Terminos    map[string][]posting
+}
+
+// Indice is a search index, built with Build or loaded with Open. It is not
+// modified after that, so it is safe for concurrent searches.
+type Indice struct {
+	a        archivo
+	sorted   []string
+	avgLargo float64
+	sug      *Sugeridor
+}
+
+// Build indexes the products of catalogs by CamposPredeterminados, with
+// the default analyzer when an is nil.
+func Build(catalogs []match.Catalog, an *Analizador, now time.Time) *Indice {
+	if an == nil {
+		an = predeterminado
+	}
+	a := archivo{Formato: formato, Creado: now, Analizador: *an, Terminos: make(map[string][]posting)}
+	for _, cat := range catalogs {
+		for _, p := range cat.Productos {
+			doc := uint32(len(a.Docs))
+			a.Docs = append(a.Docs, Documento{
+				Tienda:    cat.Tienda,
+				Nombre:    p.Nombre,
+				Link:      p.Link,
+				Imagen:    p.Imagen,
+				Categoria: p.Categoria,
+				Precio:    p.Precio,
+				EnOferta:  p.EnOferta,
+				Stock:     p.Stock,
+			})
+			weights, largo := pesos(an, CamposPredeterminados, cat.Tienda, p)
+			for t, w := range weights {
+				a.Terminos[t] = append(a.Terminos[t], posting{doc, w})
+			}
+			a.Largos = append(a.Largos, largo)
+		}
+	}
+	a.Sugerencias = Sugerencias(catalogs)
+	return newIndice(a)
+}
+
+// slug is the last path segment of a product link, where stores put the
+// product's name and often its model code.
+func slug(link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	return path.Base(strings.TrimSuffix(u.Path, "/"))
+}
+
+func newIndice(a archivo) *Indice {
+	ix := &Indice{a: a}
+	ix.a.Analizador.prepare()
+	ix.sug = NuevoSugeridor(a.Sugerencias)
+	ix.sorted = make([]string, 0, len(a.Terminos))
+	for t := range a.Terminos {
+		ix.sorted = append(ix.sorted, t)
+	}
+	sort.Strings(ix.sorted)
+	var total float64
+	for _, l := range a.Largos {
+		total += float64(l)
+	}
+	if len(a.Largos) > 0 {
+		ix.avgLargo = total / float64(len(a.Largos))
+	}
+	return ix
+}
+
+// Creado is when the index was built.
+func (ix *Indice) Creado() time.Time { return ix.a.Creado }
+
+// Documentos is the number of products indexed.
+func (ix *Indice) Documentos() int { return len(ix.a.Docs) }
+
+// Sugerir completes q with product names and categories; see
+// Sugeridor.Sugerir.
+func (ix *Indice) Sugerir(q string, limit int) []Sugerencia {
+	return ix.sug.Sugerir(q, limit)
+}
+
+// Save writes the index to fpath atomically (temp file + rename), so a
+// server reading it never sees a half-written file.
+func (ix *Indice) Save(fpath string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(fpath), ".indice-*")
+	if err != nil {
+		return fmt.Errorf("error escribiendo índice: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	// CreateTemp makes the file private; other users may serve it
+	tmp.Chmod(0644)
+	if err := gob.NewEncoder(tmp).Encode(ix.a); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error serializando índice: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error escribiendo índice: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), fpath); err != nil {
+		return fmt.Errorf("error escribiendo índice: %w", err)
+	}
+	return nil
+}
+
+// Open loads an index written by Save. The file is only read.
+func Open(fpath string) (*Indice, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo índice: %w", err)
+	}
+	defer f.Close()
+	var a archivo
+	if err := gob.NewDecoder(f).Decode(&a); err != nil {
+		return nil, fmt.Errorf("error parsing índice %s: %w", fpath, err)
+	}
+	if a.Formato != formato {
+		return nil, fmt.Errorf("índice %s en formato %d, se esperaba %d; reconstrúyelo con catalogo index", fpath, a.Formato, formato)
+	}
+	return newIndice(a), nil
+}
+
+// Resultado is a product that matches a search and its relevance.
+type Resultado struct {
+	Documento
+	Puntaje float64 `json:"puntaje"`
+}
+
+// BM25 parameters, the usual defaults.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Search returns up to limit products that contain every term of q, most
+// relevant first (BM25, multiplied by the boosts of imp, which may be nil).
+// Unless q ends in a space, its last term also matches as a prefix, so a
+// search box can search while the user types.
+func (ix *Indice) Search(q string, limit int, imp *Impulsos) []Resultado {
+	an := &ix.a.Analizador
+	terms := an.Terminos(q)
+	if len(terms) == 0 {
+		return nil
+	}
+	// A trailing stopword is dropped from terms, so the term before it is
+	// complete
+	words := texto.Words(q)
+	prefix := !strings.HasSuffix(q, " ") && !an.vacias[words[len(words)-1]]
+
+	n := float64(len(ix.a.Docs))
+	scores := make(map[uint32]float64)
+	hits := make(map[uint32]int)
+	for i, t := range terms {
+		variants := []string{t}
+		if prefix && i == len(terms)-1 {
+			variants = ix.withPrefix(t)
+		}
+		seen := make(map[uint32]bool)
+		for _, v := range variants {
+			postings := ix.a.Terminos[v]
+			idf := math.Log(1 + (n-float64(len(postings))+0.5)/(float64(len(postings))+0.5))
+			if v != t {
+				idf *= pesoPrefijo
+			}
+			for _, p := range postings {
+				tf := float64(p.Peso)
+				norm := 1 - bm25B + bm25B*float64(ix.a.Largos[p.Doc])/ix.avgLargo
+				scores[p.Doc] += idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+				if !seen[p.Doc] {
+					seen[p.Doc] = true
+					hits[p.Doc]++
+				}
+			}
+		}
+	}
+
+	var out []Resultado
+	for doc, score := range scores {
+		if hits[doc] == len(terms) {
+			d := ix.a.Docs[doc]
+			out = append(out, Resultado{Documento: d, Puntaje: math.Round(score*imp.Factor(d)*1000) / 1000})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Puntaje != out[j].Puntaje {
+			return out[i].Puntaje > out[j].Puntaje
+		}
+		if out[i].Precio != out[j].Precio {
+			return out[i].Precio < out[j].Precio
+		}
+		return out[i].Link < out[j].Link
+	})
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
+// withPrefix returns the indexed terms that start with t.
+func (ix *Indice) withPrefix(t string) []string {
+	var out []string
+	for i := sort.SearchStrings(ix.sorted, t); i < len(ix.sorted) && strings.HasPrefix(ix.sorted[i], t); i++ {
+		out = append(out, ix.sorted[i])
+	}
+	return out
+}
@@ -0,0 +1,177 @@
+package indice
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"catalogo/match"
+	"catalogo/texto"
+)
+
+// Kinds of Sugerencia.
+const (
+	TipoProducto  = "producto"
+	TipoCategoria = "categoria"
+)
+
+// Sugerencia is a completion for what the user is typing: a product name or
+// a category, with how many products it covers.
+type Sugerencia struct {
+	Texto     string `json:"texto"`
+	Tipo      string `json:"tipo"`
+	Productos int    `json:"productos"`
+}
+
+// Sugeridor answers type-ahead queries over product names and categories.
+// Every word of every suggestion is kept in one sorted list, so the
+// suggestions with a word starting with the typed prefix are a binary
+// search away.
+type Sugeridor struct {
+	entradas []Sugerencia
+	words    [][]string
+	palabras []palabraRef
+}
+
+type palabraRef struct {
+	palabra string
+	entrada int
+}
+
+// Sugerencias collects the distinct product names, categories and
+// subcategories of catalogs. Names and categories compare without case,
+// accents or HTML entities.
+func Sugerencias(catalogs []match.Catalog) []Sugerencia {
+	var out []Sugerencia
+	seen := make(map[string]int)
+	add := func(text, kind string) {
+		text = strings.TrimSpace(html.UnescapeString(text))
+		if text == "" {
+			return
+		}
+		key := kind + "\x00" + texto.Normalize(text)
+		if i, ok := seen[key]; ok {
+			out[i].Productos++
+			return
+		}
+		seen[key] = len(out)
+		out = append(out, Sugerencia{Texto: text, Tipo: kind, Productos: 1})
+	}
+	for _, cat := range catalogs {
+		for _, p := range cat.Productos {
+			add(p.Nombre, TipoProducto)
+			add(p.Categoria, TipoCategoria)
+			for _, sub := range p.Subcategorias {
+				add(sub, TipoCategoria)
+			}
+		}
+	}
+	return out
+}
+
+// NuevoSugeridor indexes entradas for Sugerir.
+func NuevoSugeridor(entradas []Sugerencia) *Sugeridor {
+	s := &Sugeridor{entradas: entradas, words: make([][]string, len(entradas))}
+	for i, e := range entradas {
+		s.words[i] = texto.Words(e.Texto)
+		for _, w := range s.words[i] {
+			s.palabras = append(s.palabras, palabraRef{w, i})
+		}
+	}
+	sort.Slice(s.palabras, func(i, j int) bool { return s.palabras[i].palabra < s.palabras[j].palabra })
+	return s
+}
+
+// Sugerir returns up to limit suggestions that have, for every word of q, a
+// word starting with it. Suggestions that start with q come first, then
+// categories, then those covering more products, then the shortest.
+func (s *Sugeridor) Sugerir(q string, limit int) []Sugerencia {
+	if s == nil {
+		return nil
+	}
+	words := texto.Words(q)
+	if len(words) == 0 {
+		return nil
+	}
+	last := words[len(words)-1]
+
+	type candidate struct {
+		entrada int
+		starts  bool
+	}
+	var found []candidate
+	seen := make(map[int]bool)
+	for i := sort.Search(len(s.palabras), func(i int) bool { return s.palabras[i].palabra >= last }); i < len(s.palabras) && strings.HasPrefix(s.palabras[i].palabra, last); i++ {
+		e := s.palabras[i].entrada
+		if seen[e] || !hasPrefixes(s.words[e], words) {
+			continue
+		}
+		seen[e] = true
+		found = append(found, candidate{e, strings.HasPrefix(s.words[e][0], words[0])})
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		a, b := found[i], found[j]
+		ea, eb := s.entradas[a.entrada], s.entradas[b.entrada]
+		switch {
+		case a.starts != b.starts:
+			return a.starts
+		case ea.Tipo != eb.Tipo:
+			return ea.Tipo == TipoCategoria
+		case ea.Productos != eb.Productos:
+			return ea.Productos > eb.Productos
+		case len(ea.Texto) != len(eb.Texto):
+			return len(ea.Texto) < len(eb.Texto)
+		}
+		return ea.Texto < eb.Texto
+	})
+	if limit > 0 && len(found) > limit {
+		found = found[:limit]
+	}
+	out := make([]Sugerencia, len(found))
+	for i, c := range found {
+		out[i] = s.entradas[c.entrada]
+	}
+	return out
+}
+
+// hasPrefixes reports whether every prefix starts some word of words.
+func hasPrefixes(words, prefixes []string) bool {
+	for _, p := range prefixes {
+		ok := false
+		for _, w := range words {
+			if strings.HasPrefix(w, p) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteSugerencias writes entradas as JSON for the static site, most
+// products first.
+func WriteSugerencias(entradas []Sugerencia, fpath string, now time.Time) error {
+	sorted := make([]Sugerencia, len(entradas))
+	copy(sorted, entradas)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Productos > sorted[j].Productos })
+	data, err := json.Marshal(struct {
+		Formato     int          `json:"formato"`
+		Creado      time.Time    `json:"creado"`
+		Sugerencias []Sugerencia `json:"sugerencias"`
+	}{1, now, sorted})
+	if err != nil {
+		return fmt.Errorf("error serializando JSON: %w", err)
+	}
+	if err := os.WriteFile(fpath, data, 0644); err != nil {
+		return fmt.Errorf("error escribiendo %s: %w", fpath, err)
+	}
+	return nil
+}
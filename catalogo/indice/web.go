@@ -0,0 +1,83 @@
+package indice
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"catalogo/match"
+	"catalogo/texto"
+)
+
+// formatoWeb is the version of the web index layout, checked by
+// buscador.js.
+const formatoWeb = 1
+
+// Web is a search index for the static site, small enough to download
+// instead of the catalogs: each product keeps only the attributes listed in
+// Guardados, as an array in that order, and each term its postings as a flat
+// [doc, peso, doc, peso, ...] list.
+type Web struct {
+	Formato    int              `json:"formato"`
+	Creado     time.Time        `json:"creado"`
+	Analizador Analizador       `json:"analizador"`
+	Campos     []string         `json:"campos"`
+	Guardados  []string         `json:"guardados"`
+	Docs       [][]any          `json:"docs"`
+	Largos     []int            `json:"largos"`
+	Terminos   map[string][]int `json:"terminos"`
+}
+
+// BuildWeb indexes the products of catalogs by campos and stores the
+// attributes guardados of each. The analyzer travels in the index, with
+// texto's abbreviations, so the browser splits queries into the same terms;
+// nil is the default analyzer.
+func BuildWeb(catalogs []match.Catalog, campos []Campo, guardados []string, an *Analizador, now time.Time) (*Web, error) {
+	if an == nil {
+		an = predeterminado
+	}
+	w := &Web{
+		Formato:    formatoWeb,
+		Creado:     now,
+		Analizador: *an,
+		Guardados:  guardados,
+		Terminos:   make(map[string][]int),
+	}
+	w.Analizador.Abreviaturas = texto.Abbreviations()
+	for _, c := range campos {
+		w.Campos = append(w.Campos, c.Nombre)
+	}
+	for _, cat := range catalogs {
+		for _, p := range cat.Productos {
+			doc := len(w.Docs)
+			row := make([]any, len(guardados))
+			for i, g := range guardados {
+				v, err := guardado(g, cat.Tienda, p)
+				if err != nil {
+					return nil, err
+				}
+				row[i] = v
+			}
+			w.Docs = append(w.Docs, row)
+			weights, largo := pesos(an, campos, cat.Tienda, p)
+			for t, peso := range weights {
+				w.Terminos[t] = append(w.Terminos[t], doc, int(peso))
+			}
+			w.Largos = append(w.Largos, int(largo))
+		}
+	}
+	return w, nil
+}
+
+// Save writes w as compact JSON.
+func (w *Web) Save(fpath string) error {
+	data, err := json.Marshal(w)
+	if err != nil {
+		return fmt.Errorf("error serializando JSON: %w", err)
+	}
+	if err := os.WriteFile(fpath, data, 0644); err != nil {
+		return fmt.Errorf("error escribiendo %s: %w", fpath, err)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"runtime"
+	"strings"
+	"time"
+
+	"catalogo/metrics"
+)
+
+// leakGuard checks the daemon's own goroutines and heap every interval.
+// Above the warning thresholds it logs; above the restart ones it restarts
+// the scheduling loops once no store is running, which ends whatever
+// goroutines a run left behind that watch their context.
+type leakGuard struct {
+	interval          time.Duration
+	warnGoroutines    int
+	restartGoroutines int
+	warnHeapMB        int
+	restartHeapMB     int
+
+	goroutines *metrics.Gauge
+	heap       *metrics.Gauge
+	restarts   *metrics.Counter
+	// restarted is set after a restart until the process is back under the
+	// warning thresholds, so a leak a restart does not fix does not make
+	// the daemon restart its loops over and over.
+	restarted bool
+}
+
+func (g *leakGuard) register(fs *flag.FlagSet) {
+	fs.DurationVar(&g.interval, "leak-check", time.Minute, "Cada cuánto revisar las goroutines y el heap del daemon (0 = desactivado)")
+	fs.IntVar(&g.warnGoroutines, "warn-goroutines", 1000, "Goroutines a partir de las cuales advertir de una posible fuga (0 = sin límite)")
+	fs.IntVar(&g.restartGoroutines, "restart-goroutines", 5000, "Goroutines a partir de las cuales reiniciar los ciclos de corridas (0 = nunca)")
+	fs.IntVar(&g.warnHeapMB, "warn-heap-mb", 512, "Heap en MB a partir del cual advertir (0 = sin límite)")
+	fs.IntVar(&g.restartHeapMB, "restart-heap-mb", 2048, "Heap en MB a partir del cual reiniciar los ciclos de corridas (0 = nunca)")
+}
+
+// instrument exports the readings as metrics of reg.
+func (g *leakGuard) instrument(reg *metrics.Registry) {
+	g.goroutines = reg.Gauge("catalogo_daemon_goroutines", "Goroutines del daemon en la última revisión.")
+	g.heap = reg.Gauge("catalogo_daemon_heap_bytes", "Heap en uso del daemon en la última revisión.")
+	g.restarts = reg.Counter("catalogo_daemon_loop_restarts_total", "Reinicios de los ciclos de corridas por posible fuga.")
+}
+
+// over lists the readings at or above the thresholds of a level; a zero
+// threshold is none.
+func over(goroutines int, heapMB float64, maxGoroutines, maxHeapMB int) []string {
+	var reasons []string
+	if maxGoroutines > 0 && goroutines >= maxGoroutines {
+		reasons = append(reasons, fmt.Sprintf("%d goroutines (límite %d)", goroutines, maxGoroutines))
+	}
+	if maxHeapMB > 0 && heapMB >= float64(maxHeapMB) {
+		reasons = append(reasons, fmt.Sprintf("heap de %.0f MB (límite %d)", heapMB, maxHeapMB))
+	}
+	return reasons
+}
+
+// watch checks the process every interval until ctx is done or the loops
+// end on their own, both false, or until the loops should restart, true.
+func (g *leakGuard) watch(ctx context.Context, loops <-chan struct{}, state *daemonState) bool {
+	if g.interval <= 0 {
+		select {
+		case <-ctx.Done():
+		case <-loops:
+		}
+		return false
+	}
+	ticker := time.NewTicker(g.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-loops:
+			return false
+		case <-ticker.C:
+		}
+		if g.check(state) {
+			return true
+		}
+	}
+}
+
+// check takes one reading and reports whether to restart now.
+func (g *leakGuard) check(state *daemonState) bool {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	goroutines := runtime.NumGoroutine()
+	heapMB := float64(ms.HeapAlloc) / (1 << 20)
+	if g.goroutines != nil {
+		g.goroutines.Set(float64(goroutines))
+		g.heap.Set(float64(ms.HeapAlloc))
+	}
+
+	warn := over(goroutines, heapMB, g.warnGoroutines, g.warnHeapMB)
+	if len(warn) == 0 {
+		g.restarted = false
+		return false
+	}
+	restart := over(goroutines, heapMB, g.restartGoroutines, g.restartHeapMB)
+	switch {
+	case len(restart) == 0:
+		log.Printf("[LEAK]   Posible fuga: %s", strings.Join(warn, ", "))
+	case g.restarted:
+		log.Printf("[LEAK]   %s aún después de reiniciar los ciclos; reinicia el proceso", strings.Join(restart, ", "))
+	case state.running() != "":
+		log.Printf("[LEAK]   %s; se reiniciarán los ciclos al terminar la corrida de %s", strings.Join(restart, ", "), state.running())
+	default:
+		log.Printf("[LEAK]   %s; reiniciando los ciclos de corridas", strings.Join(restart, ", "))
+		g.restarted = true
+		if g.restarts != nil {
+			g.restarts.Inc()
+		}
+		return true
+	}
+	return false
+}
+
+// running is the ID of a store with a run in progress, or "".
+func (d *daemonState) running() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for id, st := range d.stores {
+		if st.Ejecutando {
+			return id
+		}
+	}
+	return ""
+}
@@ -0,0 +1,63 @@
+// Package lockfile prevents two scraper runs from writing the same output.
+// The lock is held by the OS on an open file, so a crashed run never leaves
+// a stale lock behind.
+package lockfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ErrLocked is returned by Acquire when another process holds the lock.
+var ErrLocked = errors.New("lock en uso por otro proceso")
+
+// Lock is an acquired lock file.
+type Lock struct {
+	f    *os.File
+	path string
+}
+
+// Acquire takes the lock at path without waiting. If another process holds
+// it, the returned error wraps ErrLocked and names that process' PID.
+func Acquire(path string) (*Lock, error) {
+	f, err := lockFile(path)
+	if errors.Is(err, ErrLocked) {
+		if pid := readPID(path); pid > 0 {
+			return nil, fmt.Errorf("%s: %w (PID %d)", path, ErrLocked, pid)
+		}
+		return nil, fmt.Errorf("%s: %w", path, ErrLocked)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error abriendo lock %s: %w", path, err)
+	}
+
+	// Record our PID so a blocked run can report who holds the lock.
+	if err := f.Truncate(0); err == nil {
+		f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	return &Lock{f: f, path: path}, nil
+}
+
+// Release unlocks and closes the lock file. The file itself is left in place:
+// removing it could let a waiting process lock a file nobody else sees.
+func (l *Lock) Release() error {
+	if l == nil || l.f == nil {
+		return nil
+	}
+	l.f.Truncate(0)
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
+
+func readPID(path string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	return pid
+}
@@ -0,0 +1,106 @@
+// Package logfile provides the log outputs of unattended runs: a file that
+// rotates by size, and a console filter that lets only the summary through so
+// cron mail stays short.
+package logfile
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// Rotating is an append-only log file that is renamed to path.1 (shifting
+// older backups to path.2 … path.N) once it grows past maxBytes.
+type Rotating struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64
+	backups  int
+	f        *os.File
+	size     int64
+}
+
+// Open opens path for appending. maxBytes <= 0 disables rotation.
+func Open(path string, maxBytes int64, backups int) (*Rotating, error) {
+	r := &Rotating{path: path, maxBytes: maxBytes, backups: backups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Rotating) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("error abriendo log: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f, r.size = f, info.Size()
+	return nil
+}
+
+// Write appends p, rotating first when p would push the file past maxBytes.
+func (r *Rotating) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.maxBytes > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxBytes {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *Rotating) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+	if r.backups > 0 {
+		os.Remove(fmt.Sprintf("%s.%d", r.path, r.backups))
+		for i := r.backups - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+		}
+		if err := os.Rename(r.path, r.path+".1"); err != nil {
+			return fmt.Errorf("error rotando log: %w", err)
+		}
+	} else if err := os.Remove(r.path); err != nil {
+		return fmt.Errorf("error rotando log: %w", err)
+	}
+	return r.open()
+}
+
+// Close closes the current file.
+func (r *Rotating) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.f.Close()
+}
+
+// Only returns a writer that forwards to w only the log lines containing one
+// of tags (e.g. "[RESUMEN]"). It expects one line per Write, as the log
+// package does.
+func Only(w io.Writer, tags ...string) io.Writer {
+	return &filter{w: w, tags: tags}
+}
+
+type filter struct {
+	w    io.Writer
+	tags []string
+}
+
+func (f *filter) Write(p []byte) (int, error) {
+	for _, tag := range f.tags {
+		if bytes.Contains(p, []byte(tag)) {
+			return f.w.Write(p)
+		}
+	}
+	return len(p), nil
+}
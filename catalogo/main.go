@@ -0,0 +1,85 @@
+// Command catalogo groups the tooling that runs on top of the store scrapers:
+// scheduling, serving and post-processing of the productos.json catalogs.
+//
+// Usage:
+//
+//	catalogo <comando> [flags]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"catalogo/secretos"
+)
+
+// command is one subcommand of the CLI. run receives the arguments that
+// follow the command name.
+type command struct {
+	name string
+	help string
+	run  func(args []string) error
+}
+
+var commands = []command{
+	{"alerts", "Evalúa la watchlist de precios objetivo contra los catálogos de todas las tiendas", runAlerts},
+	{"align", "Reporta cómo se mapean las categorías de cada tienda a la taxonomía canónica", runAlign},
+	{"best", "Recomienda la tienda más barata con stock para cada producto de catalogo-unificado.json", runBest},
+	{"categories", "Exporta el árbol de categorías de una tienda sin scrapear productos", runCategories},
+	{"combine", "Une los catálogos de varias tiendas en catalogo-unificado.json", runCombine},
+	{"daemon", "Ejecuta los scrapers según su schedule y sirve los catálogos entre corridas", runDaemon},
+	{"embed", "Exporta vectores de embeddings de los productos para búsqueda semántica", runEmbed},
+	{"facets", "Escribe facets.json y similares.json junto al catálogo de cada tienda para publicar el sitio", runFacets},
+	{"fixtures", "Graba respuestas reales de una tienda, normalizadas, como fixtures de prueba", runFixtures},
+	{"index", "Construye el índice de búsqueda sobre los catálogos de las tiendas", runIndex},
+	{"match", "Enlaza los productos que dos tiendas tienen en común", runMatch},
+	{"openapi", "Escribe el documento OpenAPI de la API de serve y el cliente de TypeScript", runOpenAPI},
+	{"order", "Arma borradores de órdenes de compra por tienda a partir de una lista de compras", runOrder},
+	{"query", "Filtra un catálogo con una expresión y muestra el resultado como tabla, JSON o CSV", runQuery},
+	{"rebuild", "Reconstruye productos.json a partir del spill o la salida parcial de una corrida interrumpida", runRebuild},
+	{"run", "Ejecuta una vez los scrapers de las tiendas indicadas", runOnce},
+	{"self-update", "Descarga e instala el binario del release más reciente", runSelfUpdate},
+	{"serve", "Sirve los catálogos y el dashboard por HTTP", runServe},
+	{"service", "Instala, desinstala o consulta el daemon como servicio del sistema", runService},
+	{"sitemap", "Escribe sitemap.xml y los sitemaps por categoría del sitio publicado", runSitemap},
+	{"verify", "Comprueba la firma de salidas escritas con -sign", runVerify},
+	{"version", "Muestra la versión, el commit y la plataforma del binario", runVersion},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Uso: catalogo <comando> [flags]\n\nComandos:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", c.name, c.help)
+	}
+	fmt.Fprintf(os.Stderr, "\nUsa \"catalogo <comando> -h\" para ver los flags de cada comando.\n")
+}
+
+func main() {
+	log.SetFlags(log.Ltime)
+	log.SetOutput(secretos.Filtrar(os.Stderr))
+
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	name, args := os.Args[1], os.Args[2:]
+	for _, c := range commands {
+		if c.name != name {
+			continue
+		}
+		if err := c.run(args); err != nil {
+			if err == flag.ErrHelp {
+				os.Exit(2)
+			}
+			log.Fatalf("[FATAL]  %v", err)
+		}
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "Comando desconocido: %q\n\n", name)
+	usage()
+	os.Exit(2)
+}
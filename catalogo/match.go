@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"catalogo/match"
+	"catalogo/producto"
+	"catalogo/transporte"
+)
+
+// runMatch links the products two catalogs have in common.
+func runMatch(args []string) error {
+	fs := flag.NewFlagSet("match", flag.ContinueOnError)
+	output := fs.String("o", "matches.json", "Archivo de coincidencias a escribir")
+	minScore := fs.Float64("min-score", 0.6, "Confianza mínima (0-1) para reportar una coincidencia")
+	overrides := fs.String("overrides", "", "Archivo CSV (accion,a,b) o JSON con pares confirmados, forzados y rechazados por link (default: <salida>.overrides.csv si existe)")
+	images := fs.Bool("imagenes", false, "Descargar las imágenes y usar su parecido para confirmar coincidencias por nombre")
+	bandwidth := fs.String("max-bandwidth", "", "Con -imagenes, límite de descarga de las imágenes (ej. 2MB/s; vacío = sin límite)")
+	interactive := fs.Bool("interactive", false, "Revisar en la terminal las coincidencias de baja confianza y guardar las decisiones en el archivo de overrides")
+	reviewBelow := fs.Float64("review-below", 0.85, "Con -interactive, confianza por debajo de la cual se revisa una coincidencia")
+	files, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(files) != 2 {
+		return fmt.Errorf("uso: catalogo match <tienda-a.json> <tienda-b.json> [-o matches.json]")
+	}
+
+	var catalogs [2]match.Catalog
+	for i, fpath := range files {
+		if catalogs[i], err = loadCatalog(fpath); err != nil {
+			return err
+		}
+		log.Printf("[MATCH]  %s: %d productos", catalogs[i].Tienda, len(catalogs[i].Productos))
+	}
+
+	opts := match.Options{MinScore: *minScore}
+	overridesPath := *overrides
+	if overridesPath == "" {
+		overridesPath = strings.TrimSuffix(*output, filepath.Ext(*output)) + ".overrides.csv"
+	}
+	if *overrides != "" || fileExists(overridesPath) {
+		if opts.Overrides, err = match.LoadOverrides(overridesPath); err != nil {
+			return err
+		}
+		log.Printf("[MATCH]  Overrides de %s: %d confirmados, %d forzados, %d rechazados", overridesPath,
+			len(opts.Overrides.Confirmar), len(opts.Overrides.Forzar), len(opts.Overrides.Excluir))
+	}
+	if *interactive && !strings.EqualFold(filepath.Ext(overridesPath), ".csv") {
+		return fmt.Errorf("-interactive guarda las decisiones en CSV; %s no lo es", overridesPath)
+	}
+	if *images {
+		rate, err := transporte.ParseAnchoBanda(*bandwidth)
+		if err != nil {
+			return err
+		}
+		hasher := match.NewImageHasher(&http.Client{
+			Timeout:   15 * time.Second,
+			Transport: transporte.Limitar(http.DefaultTransport, transporte.NewLimitador(rate)),
+		})
+		opts.ImageHash = hasher.Hash
+	}
+
+	pairs := match.Match(catalogs[0], catalogs[1], opts)
+	if *interactive {
+		if pairs, err = reviewPairs(pairs, opts.Overrides, *reviewBelow, overridesPath, os.Stdin, os.Stdout); err != nil {
+			return err
+		}
+	}
+	byMethod := make(map[string]int)
+	for _, p := range pairs {
+		byMethod[p.Metodo]++
+	}
+	log.Printf("[MATCH]  %d coincidencias (ean: %d, sku: %d, nombre: %d, nombre+imagen: %d, manual: %d)",
+		len(pairs), byMethod[match.MethodEAN], byMethod[match.MethodSKU], byMethod[match.MethodName],
+		byMethod[match.MethodImage], byMethod[match.MethodManual])
+
+	result := match.Result{
+		Generado:      time.Now(),
+		Tiendas:       []string{catalogs[0].Tienda, catalogs[1].Tienda},
+		Coincidencias: pairs,
+	}
+	data, err := json.MarshalIndent(result, "", "    ")
+	if err != nil {
+		return fmt.Errorf("error serializando JSON: %w", err)
+	}
+	if err := os.WriteFile(*output, data, 0644); err != nil {
+		return fmt.Errorf("error escribiendo %s: %w", *output, err)
+	}
+	log.Printf("[MATCH]  Escrito en %s", *output)
+	return nil
+}
+
+// loadCatalog reads a productos.json under the store named by its tienda
+// field, or by storeName for files written before the field existed.
+func loadCatalog(fpath string) (match.Catalog, error) {
+	products, err := producto.ReadJSON(fpath)
+	if err != nil {
+		return match.Catalog{}, err
+	}
+	name := storeName(fpath)
+	if len(products) > 0 && products[0].Tienda != "" {
+		name = products[0].Tienda
+	}
+	return match.Catalog{Tienda: name, Productos: products}, nil
+}
+
+// reviewPairs asks about each unreviewed pair below threshold, appends every
+// decision to the CSV at csvPath and returns pairs without the rejected ones.
+// Rejected products may pair with something else on the next run.
+func reviewPairs(pairs []match.Pair, overrides *match.Overrides, threshold float64, csvPath string, in io.Reader, out io.Writer) ([]match.Pair, error) {
+	var pending []int
+	for i, p := range pairs {
+		link := match.LinkPair{A: p.A.Link, B: p.B.Link}
+		if p.Metodo != match.MethodManual && p.Confianza < threshold && !overrides.Reviewed(link) {
+			pending = append(pending, i)
+		}
+	}
+	if len(pending) == 0 {
+		fmt.Fprintf(out, "No hay coincidencias por revisar con confianza menor a %.2f.\n", threshold)
+		return pairs, nil
+	}
+
+	scanner := bufio.NewScanner(in)
+	rejected := make(map[int]bool)
+	confirmed, skipped := 0, 0
+	for n, i := range pending {
+		p := &pairs[i]
+		fmt.Fprintf(out, "\n[%d/%d] confianza %.3f (%s)\n", n+1, len(pending), p.Confianza, p.Metodo)
+		fmt.Fprintf(out, "  %-8s $%-9.2f %s\n           %s\n", p.A.Tienda, p.A.Precio, p.A.Nombre, p.A.Link)
+		fmt.Fprintf(out, "  %-8s $%-9.2f %s\n           %s\n", p.B.Tienda, p.B.Precio, p.B.Nombre, p.B.Link)
+
+		var action string
+		for action == "" {
+			fmt.Fprint(out, "¿Mismo producto? [c]onfirmar / [r]echazar / [s]altar / [q] terminar: ")
+			if !scanner.Scan() {
+				fmt.Fprintln(out)
+				action = "q"
+				break
+			}
+			switch answer := strings.ToLower(strings.TrimSpace(scanner.Text())); answer {
+			case "c", "r", "s", "q":
+				action = answer
+			}
+		}
+		if action == "q" {
+			skipped += len(pending) - n
+			break
+		}
+
+		link := match.LinkPair{A: p.A.Link, B: p.B.Link}
+		switch action {
+		case "c":
+			if err := match.AppendCSV(csvPath, match.ActionConfirm, link); err != nil {
+				return nil, err
+			}
+			p.Confianza, p.Metodo = 1, match.MethodManual
+			confirmed++
+		case "r":
+			if err := match.AppendCSV(csvPath, match.ActionReject, link); err != nil {
+				return nil, err
+			}
+			rejected[i] = true
+		case "s":
+			skipped++
+		}
+	}
+	log.Printf("[MATCH]  Revisión: %d confirmadas, %d rechazadas, %d sin revisar; decisiones en %s",
+		confirmed, len(rejected), skipped, csvPath)
+
+	kept := pairs[:0]
+	for i, p := range pairs {
+		if !rejected[i] {
+			kept = append(kept, p)
+		}
+	}
+	slices.SortStableFunc(kept, func(x, y match.Pair) int { return cmp.Compare(y.Confianza, x.Confianza) })
+	return kept, nil
+}
+
+func fileExists(fpath string) bool {
+	_, err := os.Stat(fpath)
+	return err == nil
+}
+
+// storeName names a catalog after its file: catalogo-buytiti/productos.json
+// is "buytiti", otros.json is "otros".
+func storeName(fpath string) string {
+	base := strings.TrimSuffix(filepath.Base(fpath), filepath.Ext(fpath))
+	if base == "productos" {
+		base = filepath.Base(filepath.Dir(fpath))
+	}
+	return strings.TrimPrefix(base, "catalogo-")
+}
+
+// parseInterspersed parses flags that may come before, between or after the
+// positional arguments, which it returns.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
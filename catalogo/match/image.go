@@ -0,0 +1,121 @@
+package match
+
+import (
+	"fmt"
+	"image"
+	"math/bits"
+	"net/http"
+	"sync"
+
+	"catalogo/producto"
+
+	// Decoders for the formats stores serve
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// maxImageDistance is how many of the 64 hash bits two images may differ in
+// and still count as the same picture.
+const maxImageDistance = 6
+
+func hamming(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// AverageHash is the 64-bit average hash of img: the image shrunk to 8×8
+// grays, one bit per cell brighter than the mean. Resized or recompressed
+// copies of a picture hash the same or nearly so.
+func AverageHash(img image.Image) uint64 {
+	b := img.Bounds()
+	var cells [64]float64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			// Average the source pixels that fall in this cell
+			x0, x1 := b.Min.X+x*b.Dx()/8, b.Min.X+(x+1)*b.Dx()/8
+			y0, y1 := b.Min.Y+y*b.Dy()/8, b.Min.Y+(y+1)*b.Dy()/8
+			var sum float64
+			n := 0
+			for py := y0; py < max(y1, y0+1); py++ {
+				for px := x0; px < max(x1, x0+1); px++ {
+					r, g, bl, _ := img.At(px, py).RGBA()
+					sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(bl)
+					n++
+				}
+			}
+			cells[y*8+x] = sum / float64(n)
+		}
+	}
+	var mean float64
+	for _, c := range cells {
+		mean += c
+	}
+	mean /= 64
+	var h uint64
+	for i, c := range cells {
+		if c > mean {
+			h |= 1 << i
+		}
+	}
+	return h
+}
+
+// ImageHasher downloads product images and hashes them, once per URL. It is
+// safe for concurrent use.
+type ImageHasher struct {
+	client *http.Client
+
+	mu    sync.Mutex
+	cache map[string]imageHash
+}
+
+type imageHash struct {
+	hash uint64
+	ok   bool
+}
+
+// NewImageHasher returns a hasher that downloads through client.
+func NewImageHasher(client *http.Client) *ImageHasher {
+	return &ImageHasher{client: client, cache: make(map[string]imageHash)}
+}
+
+// Hash returns the hash of p's image. It reports false when the product has
+// no image or it cannot be downloaded or decoded (e.g. WebP).
+func (h *ImageHasher) Hash(p producto.Product) (uint64, bool) {
+	url := p.Imagen
+	if url == "" {
+		url = p.Imagen64
+	}
+	if url == "" {
+		return 0, false
+	}
+	h.mu.Lock()
+	c, ok := h.cache[url]
+	h.mu.Unlock()
+	if ok {
+		return c.hash, c.ok
+	}
+
+	hash, err := h.fetch(url)
+	c = imageHash{hash: hash, ok: err == nil}
+	h.mu.Lock()
+	h.cache[url] = c
+	h.mu.Unlock()
+	return c.hash, c.ok
+}
+
+func (h *ImageHasher) fetch(url string) (uint64, error) {
+	resp, err := h.client.Get(url)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	img, _, err := image.Decode(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	return AverageHash(img), nil
+}
@@ -0,0 +1,396 @@
+// Package match links products that are likely the same item in two stores'
+// catalogs. Pairs are found through shared barcodes (EAN/UPC), shared model
+// codes, name similarity and, optionally, image similarity, and each gets a
+// confidence score. A manual override file can confirm, force or forbid
+// pairs.
+package match
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"catalogo/canonurl"
+	"catalogo/producto"
+	"catalogo/texto"
+)
+
+// Methods recorded in Pair.Metodo.
+const (
+	MethodEAN    = "ean"
+	MethodSKU    = "sku"
+	MethodName   = "nombre"
+	MethodImage  = "nombre+imagen"
+	MethodManual = "manual"
+)
+
+// Offer identifies a product in one store.
+type Offer struct {
+	Tienda string  `json:"tienda"`
+	Nombre string  `json:"nombre"`
+	Link   string  `json:"link"`
+	Precio float64 `json:"precio"`
+	Stock  string  `json:"stock,omitempty"`
+}
+
+// Pair is a product found in both stores.
+type Pair struct {
+	Confianza float64 `json:"confianza"`
+	Metodo    string  `json:"metodo"`
+	A         Offer   `json:"a"`
+	B         Offer   `json:"b"`
+}
+
+// Catalog is a store's products under its name.
+type Catalog struct {
+	Tienda    string
+	Productos []producto.Product
+}
+
+// Options tunes Match.
+type Options struct {
+	// MinScore is the lowest confidence reported (0-1).
+	MinScore float64
+	// Overrides forces or forbids specific pairs; may be nil.
+	Overrides *Overrides
+	// ImageHash returns a perceptual hash of a product's image, or false when
+	// there is none; nil disables image comparison.
+	ImageHash func(p producto.Product) (uint64, bool)
+}
+
+// Match pairs each product of a with at most one product of b, best
+// candidates first, and returns the pairs sorted by confidence.
+func Match(a, b Catalog, opts Options) []Pair {
+	fa, fb := features(a.Productos), features(b.Productos)
+	idf := inverseFrequencies(fa, fb)
+
+	usedA := make(map[int]bool)
+	usedB := make(map[int]bool)
+	var pairs []Pair
+	offer := func(c Catalog, p producto.Product) Offer {
+		return Offer{Tienda: c.Tienda, Nombre: p.Nombre, Link: p.Link, Precio: p.Precio, Stock: p.Stock}
+	}
+
+	// Forced pairs go first and take both products out of the running
+	if forced := opts.Overrides.forced(); len(forced) > 0 {
+		byLinkA, byLinkB := indexByLink(a.Productos), indexByLink(b.Productos)
+		for _, o := range forced {
+			i, okA := byLinkA[canonurl.Key(o.A)]
+			j, okB := byLinkB[canonurl.Key(o.B)]
+			if !okA || !okB || usedA[i] || usedB[j] {
+				continue
+			}
+			usedA[i], usedB[j] = true, true
+			pairs = append(pairs, Pair{Confianza: 1, Metodo: MethodManual, A: offer(a, a.Productos[i]), B: offer(b, b.Productos[j])})
+		}
+	}
+
+	// Candidates share a barcode, a model code or one of the product's
+	// rarest name tokens
+	index := make(map[string][]int)
+	for j, f := range fb {
+		for _, key := range f.keys(idf) {
+			index[key] = append(index[key], j)
+		}
+	}
+
+	type candidate struct {
+		i, j   int
+		score  float64
+		method string
+	}
+	var candidates []candidate
+	for i, f := range fa {
+		if usedA[i] {
+			continue
+		}
+		seen := make(map[int]bool)
+		for _, key := range f.keys(idf) {
+			for _, j := range index[key] {
+				if seen[j] || usedB[j] {
+					continue
+				}
+				seen[j] = true
+				if opts.Overrides.excluded(a.Productos[i].Link, b.Productos[j].Link) {
+					continue
+				}
+				score, method := compare(f, fb[j], idf)
+				if method == MethodName && opts.ImageHash != nil {
+					if ha, ok := opts.ImageHash(a.Productos[i]); ok {
+						if hb, ok := opts.ImageHash(b.Productos[j]); ok && hamming(ha, hb) <= maxImageDistance {
+							score, method = score+(1-score)/2, MethodImage
+						}
+					}
+				}
+				if score >= opts.MinScore {
+					candidates = append(candidates, candidate{i, j, score, method})
+				}
+			}
+		}
+	}
+
+	slices.SortStableFunc(candidates, func(x, y candidate) int { return cmp.Compare(y.score, x.score) })
+	for _, c := range candidates {
+		if usedA[c.i] || usedB[c.j] {
+			continue
+		}
+		usedA[c.i], usedB[c.j] = true, true
+		pairs = append(pairs, Pair{
+			Confianza: math.Round(c.score*1000) / 1000,
+			Metodo:    c.method,
+			A:         offer(a, a.Productos[c.i]),
+			B:         offer(b, b.Productos[c.j]),
+		})
+	}
+	slices.SortStableFunc(pairs, func(x, y Pair) int { return cmp.Compare(y.Confianza, x.Confianza) })
+	return pairs
+}
+
+func indexByLink(products []producto.Product) map[string]int {
+	m := make(map[string]int, len(products))
+	for i, p := range products {
+		m[canonurl.Key(p.Link)] = i
+	}
+	return m
+}
+
+// compare scores two products: a shared barcode is conclusive, a shared
+// model code nearly so, and otherwise the names decide.
+func compare(a, b feature, idf map[string]float64) (float64, string) {
+	name := cosine(a.tokens, b.tokens, idf)
+	if intersects(a.eans, b.eans) {
+		return 1, MethodEAN
+	}
+	if intersects(a.codes, b.codes) {
+		return 0.9 + 0.1*name, MethodSKU
+	}
+	return name, MethodName
+}
+
+// --- Features ---
+
+type feature struct {
+	tokens []string
+	eans   []string
+	codes  []string
+}
+
+var (
+	reDigits = regexp.MustCompile(`\d{8,14}`)
+	// Model codes are a few letters and at least three digits: MR-918,
+	// CFJ-109, YYQ 313
+	reCode = regexp.MustCompile(`(?i)\b([a-z]{2,5})[- ]?(\d{3,6})([a-z]?)\b`)
+)
+
+// notCode are words that precede a number without making a model code
+// ("paquete de 100", "88 ml").
+var notCode = map[string]bool{
+	"de": true, "con": true, "para": true, "por": true, "pack": true, "paq": true,
+	"pzs": true, "pz": true, "piezas": true, "ml": true, "cm": true, "mm": true,
+	"gb": true, "mb": true, "tb": true, "mah": true, "kg": true, "gr": true,
+	"hz": true, "rpm": true, "ano": true, "anos": true,
+}
+
+var stopwords = map[string]bool{
+	"de": true, "del": true, "la": true, "el": true, "los": true, "las": true,
+	"con": true, "para": true, "por": true, "y": true, "en": true, "a": true,
+	"un": true, "una": true, "o": true, "al": true, "sin": true,
+}
+
+func features(products []producto.Product) []feature {
+	fs := make([]feature, len(products))
+	for i, p := range products {
+		text := p.Nombre + " " + slug(p.Link)
+		fs[i] = feature{
+			tokens: Tokens(p.Nombre),
+			eans:   eans(text),
+			codes:  codes(text),
+		}
+	}
+	return fs
+}
+
+// Identifiers returns the barcodes and model codes in a product's name and
+// link, normalized the way Match compares them.
+func Identifiers(p producto.Product) (eanCodes, modelCodes []string) {
+	text := p.Nombre + " " + slug(p.Link)
+	return eans(text), codes(text)
+}
+
+// NormalizeCode brings a model code or barcode written by hand ("SOP-1068",
+// "0750123456789") to the form Identifiers returns.
+func NormalizeCode(s string) string {
+	s = strings.TrimSpace(s)
+	if found := eans(s); len(found) == 1 && len(strings.Trim(s, "0123456789")) == 0 {
+		return found[0]
+	}
+	if found := codes(s); len(found) == 1 {
+		return found[0]
+	}
+	return strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(s))
+}
+
+// keys are the index entries a product is looked up by.
+func (f feature) keys(idf map[string]float64) []string {
+	var keys []string
+	for _, e := range f.eans {
+		keys = append(keys, "ean:"+e)
+	}
+	for _, c := range f.codes {
+		keys = append(keys, "sku:"+c)
+	}
+	// The three rarest tokens are enough to find a product with a similar
+	// name without comparing every pair
+	tokens := slices.Clone(f.tokens)
+	slices.SortFunc(tokens, func(x, y string) int { return cmp.Compare(idf[y], idf[x]) })
+	for _, t := range tokens[:min(3, len(tokens))] {
+		keys = append(keys, "tok:"+t)
+	}
+	return keys
+}
+
+// slug returns the last path segment of a product link, where stores often
+// put the model code.
+func slug(link string) string {
+	link = strings.TrimRight(link, "/")
+	if i := strings.LastIndexByte(link, '/'); i >= 0 {
+		link = link[i+1:]
+	}
+	return strings.ReplaceAll(link, "-", " ")
+}
+
+// Tokens normalizes a product name with texto.Words and drops stopwords and
+// repeated words.
+func Tokens(name string) []string {
+	var tokens []string
+	seen := make(map[string]bool)
+	for _, t := range texto.Words(name) {
+		if stopwords[t] || seen[t] {
+			continue
+		}
+		seen[t] = true
+		tokens = append(tokens, t)
+	}
+	return tokens
+}
+
+// eans returns the valid EAN-8/UPC-A/EAN-13/GTIN-14 codes in text.
+func eans(text string) []string {
+	var found []string
+	for _, d := range reDigits.FindAllString(text, -1) {
+		switch len(d) {
+		case 8, 12, 13, 14:
+			if validGTIN(d) {
+				found = append(found, strings.TrimLeft(d, "0"))
+			}
+		}
+	}
+	return found
+}
+
+// validGTIN checks the GS1 check digit.
+func validGTIN(d string) bool {
+	sum := 0
+	for i := len(d) - 2; i >= 0; i-- {
+		n := int(d[i] - '0')
+		if (len(d)-2-i)%2 == 0 {
+			n *= 3
+		}
+		sum += n
+	}
+	return (10-sum%10)%10 == int(d[len(d)-1]-'0')
+}
+
+// codes returns the model codes in text, normalized to uppercase without
+// separators.
+func codes(text string) []string {
+	var found []string
+	for _, m := range reCode.FindAllStringSubmatch(text, -1) {
+		if notCode[strings.ToLower(m[1])] {
+			continue
+		}
+		code := strings.ToUpper(m[1] + m[2] + m[3])
+		if !slices.Contains(found, code) {
+			found = append(found, code)
+		}
+	}
+	return found
+}
+
+func intersects(a, b []string) bool {
+	for _, x := range a {
+		if slices.Contains(b, x) {
+			return true
+		}
+	}
+	return false
+}
+
+// --- Name similarity ---
+
+// inverseFrequencies weighs each token by how rare it is across both
+// catalogs, so "funda" counts for less than "a52s".
+func inverseFrequencies(catalogs ...[]feature) map[string]float64 {
+	df := make(map[string]int)
+	n := 0
+	for _, fs := range catalogs {
+		for _, f := range fs {
+			n++
+			for _, t := range f.tokens {
+				df[t]++
+			}
+		}
+	}
+	idf := make(map[string]float64, len(df))
+	for t, c := range df {
+		idf[t] = math.Log(1 + float64(n)/float64(c))
+	}
+	return idf
+}
+
+// cosine is the IDF-weighted cosine similarity of two token sets.
+func cosine(a, b []string, idf map[string]float64) float64 {
+	var dot, na, nb float64
+	for _, t := range a {
+		w := idf[t] * idf[t]
+		na += w
+		if slices.Contains(b, t) {
+			dot += w
+		}
+	}
+	for _, t := range b {
+		nb += idf[t] * idf[t]
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(na*nb)
+}
+
+// --- Result ---
+
+// Result is the content of matches.json.
+type Result struct {
+	Generado      time.Time `json:"generado"`
+	Tiendas       []string  `json:"tiendas"`
+	Coincidencias []Pair    `json:"coincidencias"`
+}
+
+// ReadResult loads a matches.json.
+func ReadResult(fpath string) (*Result, error) {
+	data, err := os.ReadFile(fpath)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo %s: %w", fpath, err)
+	}
+	var r Result
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", fpath, err)
+	}
+	return &r, nil
+}
@@ -0,0 +1,153 @@
+package match
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"catalogo/canonurl"
+)
+
+// Actions of a matches.overrides.csv row.
+const (
+	ActionConfirm = "confirmar"
+	ActionReject  = "rechazar"
+	ActionForce   = "forzar"
+)
+
+// LinkPair names two products by their links, a in the first catalog and b
+// in the second.
+type LinkPair struct {
+	A string `json:"a"`
+	B string `json:"b"`
+}
+
+// Overrides is the manual override file: pairs a reviewer confirmed, pairs
+// to force and pairs to forbid. Confirmed and forced pairs are both kept
+// whatever their score; confirmed ones were proposed by the engine and
+// forced ones were not.
+type Overrides struct {
+	Confirmar []LinkPair `json:"confirmar"`
+	Forzar    []LinkPair `json:"forzar"`
+	Excluir   []LinkPair `json:"excluir"`
+}
+
+// LoadOverrides reads an override file: a JSON object, or a CSV with an
+// accion,a,b header when the name ends in .csv.
+func LoadOverrides(fpath string) (*Overrides, error) {
+	if strings.EqualFold(filepath.Ext(fpath), ".csv") {
+		return loadOverridesCSV(fpath)
+	}
+	data, err := os.ReadFile(fpath)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo overrides: %w", err)
+	}
+	var o Overrides
+	if err := json.Unmarshal(data, &o); err != nil {
+		return nil, fmt.Errorf("error parsing overrides %s: %w", fpath, err)
+	}
+	return &o, nil
+}
+
+func loadOverridesCSV(fpath string) (*Overrides, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo overrides: %w", err)
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = 3
+	r.Comment = '#'
+	var o Overrides
+	for line := 1; ; line++ {
+		rec, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return &o, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error parsing overrides %s: %w", fpath, err)
+		}
+		if line == 1 && strings.EqualFold(rec[0], "accion") {
+			continue
+		}
+		if err := o.Add(rec[0], LinkPair{A: rec[1], B: rec[2]}); err != nil {
+			return nil, fmt.Errorf("error parsing overrides %s, línea %d: %w", fpath, line, err)
+		}
+	}
+}
+
+// Add records a decision about pair. A later decision about the same pair
+// replaces any earlier one.
+func (o *Overrides) Add(action string, pair LinkPair) error {
+	var list *[]LinkPair
+	switch strings.ToLower(strings.TrimSpace(action)) {
+	case ActionConfirm:
+		list = &o.Confirmar
+	case ActionForce:
+		list = &o.Forzar
+	case ActionReject:
+		list = &o.Excluir
+	default:
+		return fmt.Errorf("acción desconocida %q (usa %s, %s o %s)", action, ActionConfirm, ActionReject, ActionForce)
+	}
+	o.Confirmar = slices.DeleteFunc(o.Confirmar, pair.equal)
+	o.Forzar = slices.DeleteFunc(o.Forzar, pair.equal)
+	o.Excluir = slices.DeleteFunc(o.Excluir, pair.equal)
+	*list = append(*list, pair)
+	return nil
+}
+
+func (p LinkPair) equal(q LinkPair) bool {
+	return canonurl.Key(p.A) == canonurl.Key(q.A) && canonurl.Key(p.B) == canonurl.Key(q.B)
+}
+
+// Reviewed reports whether the file already holds a decision about pair.
+func (o *Overrides) Reviewed(pair LinkPair) bool {
+	if o == nil {
+		return false
+	}
+	return slices.ContainsFunc(o.Confirmar, pair.equal) || slices.ContainsFunc(o.Forzar, pair.equal) ||
+		slices.ContainsFunc(o.Excluir, pair.equal)
+}
+
+// AppendCSV adds a decision to the CSV override file at fpath, creating it
+// with its header if needed.
+func AppendCSV(fpath, action string, pair LinkPair) error {
+	f, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("error abriendo overrides: %w", err)
+	}
+	w := csv.NewWriter(f)
+	if info, err := f.Stat(); err == nil && info.Size() == 0 {
+		w.Write([]string{"accion", "a", "b"})
+	}
+	w.Write([]string{action, pair.A, pair.B})
+	w.Flush()
+	if err := w.Error(); err != nil {
+		f.Close()
+		return fmt.Errorf("error escribiendo overrides: %w", err)
+	}
+	return f.Close()
+}
+
+// forced returns the pairs kept regardless of score.
+func (o *Overrides) forced() []LinkPair {
+	if o == nil {
+		return nil
+	}
+	return slices.Concat(o.Confirmar, o.Forzar)
+}
+
+func (o *Overrides) excluded(a, b string) bool {
+	if o == nil {
+		return false
+	}
+	return slices.ContainsFunc(o.Excluir, LinkPair{A: a, B: b}.equal)
+}
@@ -0,0 +1,63 @@
+package match
+
+import (
+	"slices"
+
+	"catalogo/canonurl"
+	"catalogo/producto"
+	"catalogo/texto"
+)
+
+// Ref names a product the way people write it in lists: by Link in one
+// store, or in every store by SKU, EAN or the words in Buscar. Tienda limits
+// any of them to one store. Every field set must match.
+type Ref struct {
+	Tienda string `json:"tienda,omitempty"`
+	Link   string `json:"link,omitempty"`
+	SKU    string `json:"sku,omitempty"`
+	EAN    string `json:"ean,omitempty"`
+	Buscar string `json:"buscar,omitempty"`
+}
+
+// Empty reports whether r names no product.
+func (r Ref) Empty() bool {
+	return r.Link == "" && r.SKU == "" && r.EAN == "" && r.Buscar == ""
+}
+
+// String is the identifier r uses, for messages.
+func (r Ref) String() string {
+	for _, s := range []string{r.SKU, r.EAN, r.Buscar, r.Link} {
+		if s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// Matches reports whether p, from store tienda, is the product r names.
+func (r Ref) Matches(tienda string, p producto.Product) bool {
+	if r.Empty() || (r.Tienda != "" && !texto.Equal(r.Tienda, tienda)) {
+		return false
+	}
+	if r.Link != "" && canonurl.Key(r.Link) != canonurl.Key(p.Link) {
+		return false
+	}
+	if r.SKU != "" || r.EAN != "" {
+		eans, codes := Identifiers(p)
+		if r.SKU != "" && !slices.Contains(codes, NormalizeCode(r.SKU)) {
+			return false
+		}
+		if r.EAN != "" && !slices.Contains(eans, NormalizeCode(r.EAN)) {
+			return false
+		}
+	}
+	if r.Buscar != "" {
+		words := texto.Words(p.Nombre)
+		for _, w := range texto.Words(r.Buscar) {
+			if !slices.Contains(words, w) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,127 @@
+package match
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"catalogo/canonurl"
+	"catalogo/producto"
+	"catalogo/texto"
+)
+
+// Weights of the parts of the similarity of two products in one catalog.
+const (
+	pesoNombre    = 0.6
+	pesoCategoria = 0.25
+	pesoPrecio    = 0.15
+)
+
+// minNombre is the lowest name similarity for a product to count as an
+// alternative at all; category and price only rank those.
+const minNombre = 0.2
+
+// Similares is the content of similares.json: for each product, the ones
+// most like it, most similar first, all by producto.Slug.
+type Similares struct {
+	Generado  time.Time           `json:"generado"`
+	Similares map[string][]string `json:"similares"`
+}
+
+// SimilaresPath is where a scraper writes similares.json: next to its
+// output.
+func SimilaresPath(output string) string {
+	return filepath.Join(filepath.Dir(output), "similares.json")
+}
+
+// Similar finds up to n alternatives in stock for every product of one
+// catalog, by name tokens (IDF-weighted cosine), same category and price
+// proximity. Products with no alternative are left out.
+func Similar(products []producto.Product, n int, now time.Time) Similares {
+	fs := features(products)
+	idf := inverseFrequencies(fs)
+	keys := make([]string, len(products))
+	cats := make([]string, len(products))
+	for i, p := range products {
+		keys[i] = canonurl.Key(p.Link)
+		cats[i] = texto.Normalize(p.Categoria)
+	}
+	byToken := make(map[string][]int)
+	for j, f := range fs {
+		if products[j].Agotado() {
+			continue
+		}
+		for _, t := range f.tokens {
+			byToken[t] = append(byToken[t], j)
+		}
+	}
+
+	type candidate struct {
+		j     int
+		score float64
+	}
+	out := Similares{Generado: now, Similares: make(map[string][]string)}
+	for i, f := range fs {
+		seen := make(map[int]bool)
+		var candidates []candidate
+		for _, t := range f.tokens {
+			for _, j := range byToken[t] {
+				if seen[j] || keys[j] == keys[i] {
+					continue
+				}
+				seen[j] = true
+				name := cosine(f.tokens, fs[j].tokens, idf)
+				if name < minNombre {
+					continue
+				}
+				score := pesoNombre*name + pesoPrecio*priceProximity(products[i].Precio, products[j].Precio)
+				if cats[i] != "" && cats[i] == cats[j] {
+					score += pesoCategoria
+				}
+				candidates = append(candidates, candidate{j, score})
+			}
+		}
+		if len(candidates) == 0 {
+			continue
+		}
+		slices.SortStableFunc(candidates, func(x, y candidate) int {
+			if c := cmp.Compare(y.score, x.score); c != 0 {
+				return c
+			}
+			return cmp.Compare(x.j, y.j)
+		})
+		ids := make([]string, 0, n)
+		for _, c := range candidates[:min(n, len(candidates))] {
+			ids = append(ids, producto.Slug(products[c.j].Link))
+		}
+		out.Similares[producto.Slug(products[i].Link)] = ids
+	}
+	return out
+}
+
+// priceProximity is 1 for equal prices and tends to 0 as one grows apart
+// from the other; 0 when either is unknown.
+func priceProximity(a, b float64) float64 {
+	if a <= 0 || b <= 0 {
+		return 0
+	}
+	return math.Min(a, b) / math.Max(a, b)
+}
+
+// WriteSimilares writes the alternatives of a catalog's products to fpath,
+// without indentation since the catalog page downloads it.
+func WriteSimilares(products []producto.Product, n int, fpath string, now time.Time) error {
+	data, err := json.Marshal(Similar(products, n, now))
+	if err != nil {
+		return fmt.Errorf("error serializando JSON: %w", err)
+	}
+	if err := os.WriteFile(fpath, data, 0644); err != nil {
+		return fmt.Errorf("error escribiendo %s: %w", fpath, err)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// Merge combines several text-format expositions (e.g. one file per store)
+// into one, grouping samples under a single HELP/TYPE header per family as
+// the format requires.
+func Merge(w io.Writer, inputs ...io.Reader) error {
+	type block struct {
+		header  []string
+		samples []string
+	}
+	var order []string
+	blocks := make(map[string]*block)
+	get := func(name string) *block {
+		b, ok := blocks[name]
+		if !ok {
+			b = &block{}
+			blocks[name] = b
+			order = append(order, name)
+		}
+		return b
+	}
+
+	for _, in := range inputs {
+		current := ""
+		sc := bufio.NewScanner(in)
+		sc.Buffer(make([]byte, 64*1024), 1024*1024)
+		for sc.Scan() {
+			line := sc.Text()
+			switch {
+			case strings.TrimSpace(line) == "":
+			case strings.HasPrefix(line, "# HELP ") || strings.HasPrefix(line, "# TYPE "):
+				fields := strings.Fields(line)
+				if len(fields) < 3 {
+					continue
+				}
+				current = fields[2]
+				b := get(current)
+				if len(b.header) < 2 && !containsPrefix(b.header, line[:7]) {
+					b.header = append(b.header, line)
+				}
+			case strings.HasPrefix(line, "#"):
+			default:
+				name := line
+				if i := strings.IndexAny(line, "{ "); i >= 0 {
+					name = line[:i]
+				}
+				// Histogram samples (_bucket, _sum, _count) belong to the
+				// family declared by the preceding TYPE line.
+				if current == "" || !strings.HasPrefix(name, current) {
+					current = name
+				}
+				get(current).samples = append(get(current).samples, line)
+			}
+		}
+		if err := sc.Err(); err != nil {
+			return err
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, name := range order {
+		b := blocks[name]
+		for _, l := range b.header {
+			bw.WriteString(l + "\n")
+		}
+		for _, l := range b.samples {
+			bw.WriteString(l + "\n")
+		}
+	}
+	return bw.Flush()
+}
+
+func containsPrefix(lines []string, prefix string) bool {
+	for _, l := range lines {
+		if strings.HasPrefix(l, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,284 @@
+// Package metrics is a small Prometheus client: counters, gauges and
+// histograms with labels, rendered in the text exposition format. Scrapers
+// write their registry to a file (read by the daemon's /metrics) or push it
+// to a Pushgateway at the end of one-shot runs.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets suits HTTP request latencies, in seconds.
+var DefaultBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Registry holds a set of metric families. Const labels are added to every series.
+type Registry struct {
+	mu          sync.Mutex
+	constLabels []labelPair
+	families    []*family
+}
+
+type labelPair struct{ name, value string }
+
+// NewRegistry creates a registry whose series all carry constLabels.
+func NewRegistry(constLabels map[string]string) *Registry {
+	r := &Registry{}
+	for name, value := range constLabels {
+		r.constLabels = append(r.constLabels, labelPair{name, value})
+	}
+	sort.Slice(r.constLabels, func(i, j int) bool { return r.constLabels[i].name < r.constLabels[j].name })
+	return r
+}
+
+type family struct {
+	name, help, typ string
+	labelNames      []string
+	buckets         []float64
+	series          map[string]*series
+}
+
+type series struct {
+	labels  []string
+	value   float64
+	buckets []uint64
+	sum     float64
+	count   uint64
+}
+
+func (r *Registry) register(name, help, typ string, buckets []float64, labelNames []string) *family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f := &family{name: name, help: help, typ: typ, labelNames: labelNames, buckets: buckets, series: make(map[string]*series)}
+	if len(labelNames) == 0 {
+		// Without labels the single series is known up front: expose it as
+		// zero instead of leaving the family empty.
+		f.get(nil)
+	}
+	r.families = append(r.families, f)
+	return f
+}
+
+// get returns the series for the label values, creating it. Callers hold r.mu.
+func (f *family) get(values []string) *series {
+	if len(values) != len(f.labelNames) {
+		panic(fmt.Sprintf("metrics: %s espera %d labels, recibió %d", f.name, len(f.labelNames), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labels: append([]string(nil), values...)}
+		if f.buckets != nil {
+			s.buckets = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+// Counter is a monotonically increasing metric family.
+type Counter struct {
+	r *Registry
+	f *family
+}
+
+// Counter registers a counter family.
+func (r *Registry) Counter(name, help string, labelNames ...string) *Counter {
+	return &Counter{r, r.register(name, help, "counter", nil, labelNames)}
+}
+
+// Add increments the series identified by labelValues by v.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	c.r.mu.Lock()
+	defer c.r.mu.Unlock()
+	c.f.get(labelValues).value += v
+}
+
+// Inc increments the series identified by labelValues by one.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Gauge is a metric family that can go up and down.
+type Gauge struct {
+	r *Registry
+	f *family
+}
+
+// Gauge registers a gauge family.
+func (r *Registry) Gauge(name, help string, labelNames ...string) *Gauge {
+	return &Gauge{r, r.register(name, help, "gauge", nil, labelNames)}
+}
+
+// Set sets the series identified by labelValues to v.
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.r.mu.Lock()
+	defer g.r.mu.Unlock()
+	g.f.get(labelValues).value = v
+}
+
+// Add adds v to the series identified by labelValues.
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.r.mu.Lock()
+	defer g.r.mu.Unlock()
+	g.f.get(labelValues).value += v
+}
+
+// Histogram counts observations into cumulative buckets.
+type Histogram struct {
+	r *Registry
+	f *family
+}
+
+// Histogram registers a histogram family with the given upper bounds.
+func (r *Registry) Histogram(name, help string, buckets []float64, labelNames ...string) *Histogram {
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+	return &Histogram{r, r.register(name, help, "histogram", b, labelNames)}
+}
+
+// Observe records v in the series identified by labelValues.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.r.mu.Lock()
+	defer h.r.mu.Unlock()
+	s := h.f.get(labelValues)
+	for i, le := range h.f.buckets {
+		if v <= le {
+			s.buckets[i]++
+		}
+	}
+	s.sum += v
+	s.count++
+}
+
+// WriteText renders every family in the Prometheus text exposition format.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var b bytes.Buffer
+	for _, f := range r.families {
+		fmt.Fprintf(&b, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+		fmt.Fprintf(&b, "# TYPE %s %s\n", f.name, f.typ)
+
+		keys := make([]string, 0, len(f.series))
+		for k := range f.series {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			s := f.series[k]
+			if f.typ != "histogram" {
+				fmt.Fprintf(&b, "%s%s %s\n", f.name, r.labels(f.labelNames, s.labels, "", ""), formatFloat(s.value))
+				continue
+			}
+			for i, le := range f.buckets {
+				fmt.Fprintf(&b, "%s_bucket%s %d\n", f.name, r.labels(f.labelNames, s.labels, "le", formatFloat(le)), s.buckets[i])
+			}
+			fmt.Fprintf(&b, "%s_bucket%s %d\n", f.name, r.labels(f.labelNames, s.labels, "le", "+Inf"), s.count)
+			fmt.Fprintf(&b, "%s_sum%s %s\n", f.name, r.labels(f.labelNames, s.labels, "", ""), formatFloat(s.sum))
+			fmt.Fprintf(&b, "%s_count%s %d\n", f.name, r.labels(f.labelNames, s.labels, "", ""), s.count)
+		}
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+func (r *Registry) labels(names, values []string, extraName, extraValue string) string {
+	var pairs []string
+	for _, c := range r.constLabels {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", c.name, escapeLabel(c.value)))
+	}
+	for i, n := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", n, escapeLabel(values[i])))
+	}
+	if extraName != "" {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", extraName, extraValue))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// escapeLabel makes the value valid UTF-8; %q takes care of quotes,
+// backslashes and newlines.
+func escapeLabel(s string) string {
+	return strings.ToValidUTF8(s, "�")
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// WriteFile writes the registry to fpath atomically (temp file + rename), so
+// a reader never sees a half-written file.
+func (r *Registry) WriteFile(fpath string) error {
+	if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(fpath), ".metrics-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := r.WriteText(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), fpath)
+}
+
+// Push replaces the metrics of job on a Prometheus Pushgateway.
+func (r *Registry) Push(gatewayURL, job string) error {
+	var b bytes.Buffer
+	if err := r.WriteText(&b); err != nil {
+		return err
+	}
+	url := strings.TrimSuffix(gatewayURL, "/") + "/metrics/job/" + job
+	req, err := http.NewRequest(http.MethodPut, url, &b)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error enviando métricas: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 200))
+		return fmt.Errorf("pushgateway HTTP %d: %s", resp.StatusCode, body)
+	}
+	return nil
+}
+
+// Handler serves the registry on /metrics.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteText(w)
+	})
+}
@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"fmt"
+	"time"
+)
+
+// Scrape bundles the metrics every store scraper reports, labelled with the
+// store id.
+type Scrape struct {
+	Registry        *Registry
+	Requests        *Counter
+	Retries         *Counter
+	RateLimited     *Counter
+	ParseFailures   *Counter
+	RequestDuration *Histogram
+	Products        *Gauge
+	RunDuration     *Gauge
+	LastSuccess     *Gauge
+	RunInfo         *Gauge
+}
+
+// NewScrape creates the scraper metrics for store tienda.
+func NewScrape(tienda string) *Scrape {
+	r := NewRegistry(map[string]string{"tienda": tienda})
+	return &Scrape{
+		Registry:        r,
+		Requests:        r.Counter("catalogo_requests_total", "Requests HTTP realizados, por código de respuesta (\"error\" si falló la red).", "code"),
+		Retries:         r.Counter("catalogo_request_retries_total", "Reintentos de requests HTTP."),
+		RateLimited:     r.Counter("catalogo_rate_limited_total", "Respuestas HTTP 429 recibidas."),
+		ParseFailures:   r.Counter("catalogo_parse_failures_total", "Respuestas o productos que no se pudieron interpretar."),
+		RequestDuration: r.Histogram("catalogo_request_duration_seconds", "Latencia de los requests HTTP.", DefaultBuckets),
+		Products:        r.Gauge("catalogo_products", "Productos en la salida, por categoría.", "categoria"),
+		RunDuration:     r.Gauge("catalogo_run_duration_seconds", "Duración de la última corrida."),
+		LastSuccess:     r.Gauge("catalogo_last_success_timestamp_seconds", "Momento de la última corrida exitosa (unix)."),
+		RunInfo:         r.Gauge("catalogo_run_info", "Corrida que produjo estas métricas (siempre 1).", "run_id"),
+	}
+}
+
+// ObserveRequest records one HTTP attempt: its status code (0 on network
+// error) and latency.
+func (s *Scrape) ObserveRequest(code int, d time.Duration) {
+	label := "error"
+	if code > 0 {
+		label = fmt.Sprint(code)
+	}
+	s.Requests.Inc(label)
+	s.RequestDuration.Observe(d.Seconds())
+	if code == 429 {
+		s.RateLimited.Inc()
+	}
+}
+
+// Publish records the outcome of the run and writes the registry to file
+// and/or pushes it to a Pushgateway, whichever is configured.
+func (s *Scrape) Publish(file, pushgateway, job string, ok bool, elapsed time.Duration) error {
+	s.RunDuration.Set(elapsed.Seconds())
+	if ok {
+		s.LastSuccess.Set(float64(time.Now().Unix()))
+	}
+	if file != "" {
+		if err := s.Registry.WriteFile(file); err != nil {
+			return fmt.Errorf("error escribiendo métricas: %w", err)
+		}
+	}
+	if pushgateway != "" {
+		if err := s.Registry.Push(pushgateway, job); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+// Package openapi describes the HTTP API of catalogo serve as an OpenAPI 3
+// document whose schemas are built from the Go types the handlers encode,
+// so the contract cannot drift from the JSON it describes, and writes a
+// TypeScript client from that document.
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Documento is an OpenAPI 3 document, with only the parts the API uses.
+type Documento struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       Info                             `json:"info"`
+	Paths      map[string]map[string]*Operacion `json:"paths"`
+	Components Componentes                      `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// Operacion is one method of a path. OperationID names the function of
+// the TypeScript client.
+type Operacion struct {
+	OperationID string               `json:"operationId"`
+	Summary     string               `json:"summary,omitempty"`
+	Parameters  []Parametro          `json:"parameters,omitempty"`
+	Responses   map[string]Respuesta `json:"responses"`
+}
+
+// Parametro is a path ("path") or query ("query") parameter.
+type Parametro struct {
+	Name        string   `json:"name"`
+	In          string   `json:"in"`
+	Description string   `json:"description,omitempty"`
+	Required    bool     `json:"required,omitempty"`
+	Schema      *Esquema `json:"schema"`
+}
+
+type Respuesta struct {
+	Description string               `json:"description"`
+	Content     map[string]Contenido `json:"content,omitempty"`
+}
+
+type Contenido struct {
+	Schema *Esquema `json:"schema"`
+}
+
+// Esquema is a JSON Schema as OpenAPI 3.0 writes it.
+type Esquema struct {
+	Ref                  string              `json:"$ref,omitempty"`
+	Type                 string              `json:"type,omitempty"`
+	Format               string              `json:"format,omitempty"`
+	Description          string              `json:"description,omitempty"`
+	Properties           map[string]*Esquema `json:"properties,omitempty"`
+	Required             []string            `json:"required,omitempty"`
+	Items                *Esquema            `json:"items,omitempty"`
+	AdditionalProperties *Esquema            `json:"additionalProperties,omitempty"`
+	Nullable             bool                `json:"nullable,omitempty"`
+}
+
+// Componentes holds the named schemas the operations refer to.
+type Componentes struct {
+	Schemas map[string]*Esquema `json:"schemas"`
+
+	fijos map[reflect.Type]*Esquema
+}
+
+const refPrefix = "#/components/schemas/"
+
+// Nuevo returns an empty document.
+func Nuevo(titulo, version, descripcion string) *Documento {
+	return &Documento{
+		OpenAPI:    "3.0.3",
+		Info:       Info{Title: titulo, Version: version, Description: descripcion},
+		Paths:      make(map[string]map[string]*Operacion),
+		Components: Componentes{Schemas: make(map[string]*Esquema), fijos: make(map[reflect.Type]*Esquema)},
+	}
+}
+
+// Fijar gives the type t, which writes its own JSON, the schema e, stored
+// under t's name.
+func (d *Documento) Fijar(t reflect.Type, e *Esquema) {
+	d.Components.fijos[t] = e
+}
+
+// Agregar adds the operation op on method (get, post...) of path.
+func (d *Documento) Agregar(method, path string, op *Operacion) {
+	if d.Paths[path] == nil {
+		d.Paths[path] = make(map[string]*Operacion)
+	}
+	d.Paths[path][strings.ToLower(method)] = op
+}
+
+// JSON is a response of description whose body is the JSON of t.
+func (d *Documento) JSON(t reflect.Type, description string) Respuesta {
+	return Respuesta{Description: description, Content: map[string]Contenido{
+		"application/json": {Schema: d.Esquema(t)},
+	}}
+}
+
+// Texto is a response of description with a body of contentType.
+func Texto(contentType, description string) Respuesta {
+	return Respuesta{Description: description, Content: map[string]Contenido{
+		contentType: {Schema: &Esquema{Type: "string"}},
+	}}
+}
+
+var (
+	timeType      = reflect.TypeFor[time.Time]()
+	marshalerType = reflect.TypeFor[json.Marshaler]()
+)
+
+// Esquema is the schema of the JSON encoding/json writes for t. Named
+// structs go to the components, under their name capitalized, and are
+// referred to.
+func (d *Documento) Esquema(t reflect.Type) *Esquema {
+	if t.Kind() == reflect.Pointer {
+		e := d.Esquema(t.Elem())
+		if e.Ref != "" {
+			return e
+		}
+		c := *e
+		c.Nullable = true
+		return &c
+	}
+	if t == timeType {
+		return &Esquema{Type: "string", Format: "date-time"}
+	}
+	if e, ok := d.Components.fijos[t]; ok {
+		name := nombre(t)
+		d.Components.Schemas[name] = e
+		return &Esquema{Ref: refPrefix + name}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Esquema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Esquema{Type: "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return &Esquema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Esquema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Esquema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Esquema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Esquema{Type: "string", Format: "byte"}
+		}
+		return &Esquema{Type: "array", Items: d.Esquema(t.Elem())}
+	case reflect.Map:
+		return &Esquema{Type: "object", AdditionalProperties: d.Esquema(t.Elem())}
+	case reflect.Struct:
+		if t.Implements(marshalerType) || reflect.PointerTo(t).Implements(marshalerType) {
+			// Writes its own JSON and was not given a schema with Fijar
+			return &Esquema{}
+		}
+		if t.Name() == "" {
+			return d.objeto(t)
+		}
+		name := nombre(t)
+		if _, ok := d.Components.Schemas[name]; !ok {
+			// Registered before its fields, so a type that refers to itself
+			// does not recurse forever
+			d.Components.Schemas[name] = &Esquema{}
+			*d.Components.Schemas[name] = *d.objeto(t)
+		}
+		return &Esquema{Ref: refPrefix + name}
+	}
+	// Interfaces and anything else: any JSON value
+	return &Esquema{}
+}
+
+// objeto is the schema of the fields of the struct t, with the fields of
+// the structs it embeds inline, as encoding/json writes them.
+func (d *Documento) objeto(t reflect.Type) *Esquema {
+	e := &Esquema{Type: "object", Properties: make(map[string]*Esquema)}
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if !f.IsExported() && !f.Anonymous || tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		ft := f.Type
+		if f.Anonymous && name == "" {
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct && !ft.Implements(marshalerType) {
+				inner := d.objeto(ft)
+				for k, v := range inner.Properties {
+					e.Properties[k] = v
+				}
+				e.Required = append(e.Required, inner.Required...)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		e.Properties[name] = d.Esquema(ft)
+		if !strings.Contains(opts, "omitempty") && !strings.Contains(opts, "omitzero") {
+			e.Required = append(e.Required, name)
+		}
+	}
+	return e
+}
+
+// nombre is the component name of t: its Go name, capitalized.
+func nombre(t reflect.Type) string {
+	r, size := utf8.DecodeRuneInString(t.Name())
+	return string(unicode.ToUpper(r)) + t.Name()[size:]
+}
@@ -0,0 +1,140 @@
+package openapi
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// tsHelper is the fetch every function of the client goes through.
+const tsHelper = `async function obtener<T>(base: string, ruta: string, consulta: Record<string, string | number | undefined> = {}): Promise<T> {
+  const url = new URL(ruta, base);
+  for (const [clave, valor] of Object.entries(consulta)) {
+    if (valor !== undefined) url.searchParams.set(clave, String(valor));
+  }
+  const resp = await fetch(url);
+  if (!resp.ok) throw new Error(` + "`${resp.status} ${await resp.text()}`" + `);
+  return (await resp.json()) as T;
+}
+`
+
+// TypeScript writes a client for the document: an interface per schema
+// and a function per operation that answers JSON, named by its
+// OperationID, taking the server's base URL, its path parameters and an
+// object with its query parameters.
+func (d *Documento) TypeScript() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "// Cliente de %s %s. Generado por \"catalogo openapi -ts\"; no editar.\n\n", d.Info.Title, d.Info.Version)
+	for _, name := range slices.Sorted(maps.Keys(d.Components.Schemas)) {
+		e := d.Components.Schemas[name]
+		if e.Description != "" {
+			fmt.Fprintf(&b, "/** %s */\n", e.Description)
+		}
+		fmt.Fprintf(&b, "export interface %s %s\n\n", name, tsObjeto(e, ""))
+	}
+	b.WriteString(tsHelper)
+	for _, path := range slices.Sorted(maps.Keys(d.Paths)) {
+		for _, method := range slices.Sorted(maps.Keys(d.Paths[path])) {
+			if method == "get" {
+				tsFuncion(&b, path, d.Paths[path][method])
+			}
+		}
+	}
+	return b.String()
+}
+
+func tsFuncion(b *strings.Builder, path string, op *Operacion) {
+	ok, found := op.Responses["200"]
+	if !found {
+		return
+	}
+	content, found := ok.Content["application/json"]
+	if !found {
+		return
+	}
+	args := []string{"base: string"}
+	ruta := path
+	var query []string
+	for _, p := range op.Parameters {
+		switch p.In {
+		case "path":
+			args = append(args, p.Name+": "+tsTipo(p.Schema, ""))
+			ruta = strings.ReplaceAll(ruta, "{"+p.Name+"}", "${encodeURIComponent("+p.Name+")}")
+		case "query":
+			query = append(query, p.Name+"?: "+tsTipo(p.Schema, ""))
+		}
+	}
+	call := "`" + ruta + "`"
+	if len(query) > 0 {
+		args = append(args, "consulta: { "+strings.Join(query, "; ")+" } = {}")
+		call += ", consulta"
+	}
+	if op.Summary != "" {
+		fmt.Fprintf(b, "\n/** %s */\n", op.Summary)
+	} else {
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(b, "export function %s(%s): Promise<%s> {\n", op.OperationID, strings.Join(args, ", "), tsTipo(content.Schema, ""))
+	fmt.Fprintf(b, "  return obtener(base, %s);\n}\n", call)
+}
+
+// tsTipo is the TypeScript type of e, indented by indent when it spans
+// several lines.
+func tsTipo(e *Esquema, indent string) string {
+	var t string
+	switch {
+	case e.Ref != "":
+		t = strings.TrimPrefix(e.Ref, refPrefix)
+	case e.Type == "string":
+		t = "string"
+	case e.Type == "integer", e.Type == "number":
+		t = "number"
+	case e.Type == "boolean":
+		t = "boolean"
+	case e.Type == "array":
+		t = tsTipo(e.Items, indent) + "[]"
+		if strings.Contains(t, " ") {
+			t = "Array<" + strings.TrimSuffix(t, "[]") + ">"
+		}
+	case e.Type == "object" && len(e.Properties) == 0 && e.AdditionalProperties != nil:
+		t = "Record<string, " + tsTipo(e.AdditionalProperties, indent) + ">"
+	case e.Type == "object":
+		t = tsObjeto(e, indent)
+	default:
+		t = "unknown"
+	}
+	if e.Nullable {
+		t += " | null"
+	}
+	return t
+}
+
+// tsObjeto is the TypeScript object type of e, its properties in name
+// order, optional unless required. Extra properties beside the named ones,
+// such as the prices of a Conversion named after its currency, take an
+// index signature.
+func tsObjeto(e *Esquema, indent string) string {
+	var b strings.Builder
+	b.WriteString("{\n")
+	for _, name := range slices.Sorted(maps.Keys(e.Properties)) {
+		p := e.Properties[name]
+		opt := "?"
+		if slices.Contains(e.Required, name) {
+			opt = ""
+		}
+		if p.Description != "" {
+			fmt.Fprintf(&b, "%s  /** %s */\n", indent, p.Description)
+		}
+		fmt.Fprintf(&b, "%s  %s%s: %s;\n", indent, name, opt, tsTipo(p, indent+"  "))
+	}
+	if e.AdditionalProperties != nil {
+		t := tsTipo(e.AdditionalProperties, indent+"  ")
+		if len(e.Properties) > 0 {
+			t = "unknown"
+		}
+		fmt.Fprintf(&b, "%s  [clave: string]: %s;\n", indent, t)
+	}
+	b.WriteString(indent + "}")
+	return b.String()
+}
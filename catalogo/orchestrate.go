@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"catalogo/transporte"
+)
+
+// runPolicy holds the orchestration flags shared by "daemon" and "run".
+type runPolicy struct {
+	sequential    bool
+	maxConcurrent int
+	maxWorkers    int
+	maxBandwidth  string
+	timeout       time.Duration
+	retries       int
+	retryDelay    time.Duration
+}
+
+func (p *runPolicy) register(fs *flag.FlagSet) {
+	fs.BoolVar(&p.sequential, "secuencial", false, "Ejecutar una sola tienda a la vez (equivale a -max-concurrent 1)")
+	fs.IntVar(&p.maxConcurrent, "max-concurrent", 0, "Máximo de tiendas ejecutándose a la vez; el resto espera en cola (0 = sin límite)")
+	fs.IntVar(&p.maxWorkers, "max-workers", 0, "Workers totales permitidos entre todas las tiendas en ejecución (0 = sin límite)")
+	fs.StringVar(&p.maxBandwidth, "max-bandwidth", "", "Ancho de banda de descarga total entre todas las tiendas en ejecución (ej. 4MB/s), repartido en partes iguales entre las que pueden correr a la vez (vacío = sin límite)")
+	fs.DurationVar(&p.timeout, "timeout", 0, "Tiempo máximo por corrida de cada tienda (0 = sin límite)")
+	fs.IntVar(&p.retries, "retries", 0, "Reintentos de una corrida fallida")
+	fs.DurationVar(&p.retryDelay, "retry-delay", 5*time.Minute, "Espera entre reintentos de una corrida fallida")
+}
+
+// apply fills the per-store settings the config file leaves unset.
+func (p *runPolicy) apply(cfg *Config) {
+	for i := range cfg.Tiendas {
+		s := &cfg.Tiendas[i]
+		if s.timeout == 0 {
+			s.timeout = p.timeout
+		}
+		if s.Reintentos == 0 {
+			s.Reintentos = p.retries
+		}
+		if s.retryDelay == 0 {
+			s.retryDelay = p.retryDelay
+		}
+	}
+}
+
+// orchestrator decides when a store's scrape may start: never two scrapes of
+// the same host at once, at most maxConcurrent scrapes overall (queued in
+// arrival order), and never more workers running than the global budget allows.
+// It also splits the global bandwidth budget among the scrapes.
+type orchestrator struct {
+	slots  chan struct{}
+	budget *workerBudget
+	// bandwidth is each scrape's share of -max-bandwidth, in bytes per
+	// second; 0 without a limit.
+	bandwidth float64
+
+	mu    sync.Mutex
+	hosts map[string]chan struct{}
+}
+
+func newOrchestrator(p runPolicy, stores []Store) (*orchestrator, error) {
+	o := &orchestrator{hosts: make(map[string]chan struct{})}
+	maxConcurrent := p.maxConcurrent
+	if p.sequential {
+		maxConcurrent = 1
+	}
+	if maxConcurrent > 0 {
+		o.slots = make(chan struct{}, maxConcurrent)
+	}
+	if p.maxWorkers > 0 {
+		o.budget = newWorkerBudget(p.maxWorkers)
+	}
+
+	total, err := transporte.ParseAnchoBanda(p.maxBandwidth)
+	if err != nil {
+		return nil, fmt.Errorf("-max-bandwidth: %w", err)
+	}
+	if total > 0 {
+		// At most one scrape per host runs at a time, and at most
+		// maxConcurrent overall: that many equal shares never add up to
+		// more than the budget
+		hosts := make(map[string]bool)
+		for _, s := range stores {
+			hosts[s.Host] = true
+		}
+		n := len(hosts)
+		if maxConcurrent > 0 {
+			n = min(n, maxConcurrent)
+		}
+		o.bandwidth = total / float64(max(n, 1))
+		log.Printf("[ANCHO]  %s repartidos entre %d corridas simultáneas: %.0f bytes/s cada una", p.maxBandwidth, max(n, 1), o.bandwidth)
+	}
+	return o, nil
+}
+
+// bandwidthArgs are the flags that hold s's scraper to its share of the
+// bandwidth budget: -max-bandwidth with the share, unless the store's own
+// args already ask for less.
+func (o *orchestrator) bandwidthArgs(s Store) []string {
+	if o.bandwidth == 0 {
+		return nil
+	}
+	if own, err := transporte.ParseAnchoBanda(s.argValue("max-bandwidth")); err == nil && own > 0 && own <= o.bandwidth {
+		return nil
+	}
+	return []string{"-max-bandwidth", strconv.FormatFloat(o.bandwidth, 'f', 0, 64)}
+}
+
+// acquire blocks until s may run and returns the function that releases
+// everything it took. It fails only if ctx is cancelled while waiting.
+func (o *orchestrator) acquire(ctx context.Context, s Store) (release func(), err error) {
+	var releases []func()
+	release = func() {
+		for i := len(releases) - 1; i >= 0; i-- {
+			releases[i]()
+		}
+	}
+
+	// The host first: a store waiting for its host must not hold one of
+	// the run slots, which would keep stores of other hosts waiting too
+	host := o.hostLock(s.Host)
+	if err := lockChan(ctx, host, s.ID+": esperando a que termine la corrida en curso de "+s.Host); err != nil {
+		return nil, err
+	}
+	releases = append(releases, func() { <-host })
+
+	if o.slots != nil {
+		if err := lockChan(ctx, o.slots, s.ID+": en cola, todas las ranuras de ejecución ocupadas"); err != nil {
+			release()
+			return nil, err
+		}
+		releases = append(releases, func() { <-o.slots })
+	}
+
+	if o.budget != nil {
+		n := min(s.workers(), o.budget.max)
+		if err := o.budget.acquire(ctx, s.ID, n); err != nil {
+			release()
+			return nil, err
+		}
+		releases = append(releases, func() { o.budget.release(n) })
+	}
+
+	return release, nil
+}
+
+func (o *orchestrator) hostLock(host string) chan struct{} {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	ch, ok := o.hosts[host]
+	if !ok {
+		ch = make(chan struct{}, 1)
+		o.hosts[host] = ch
+	}
+	return ch
+}
+
+// lockChan takes a slot of a channel used as a semaphore, logging if it has
+// to wait. Blocked senders are served in arrival order.
+func lockChan(ctx context.Context, ch chan struct{}, waitMsg string) error {
+	select {
+	case ch <- struct{}{}:
+		return nil
+	default:
+	}
+	log.Printf("[WAIT]   %s", waitMsg)
+	select {
+	case ch <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// workerBudget is a weighted semaphore over scraper workers shared by all
+// stores, so concurrent scrapes from the same IP stay under one request budget.
+type workerBudget struct {
+	max int
+
+	mu      sync.Mutex
+	free    int
+	changed chan struct{}
+}
+
+func newWorkerBudget(max int) *workerBudget {
+	return &workerBudget{max: max, free: max, changed: make(chan struct{})}
+}
+
+func (b *workerBudget) acquire(ctx context.Context, id string, n int) error {
+	logged := false
+	for {
+		b.mu.Lock()
+		if n <= b.free {
+			b.free -= n
+			b.mu.Unlock()
+			return nil
+		}
+		changed := b.changed
+		free := b.free
+		b.mu.Unlock()
+
+		if !logged {
+			log.Printf("[WAIT]   %s: necesita %d workers, libres %d de %d", id, n, free, b.max)
+			logged = true
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (b *workerBudget) release(n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.free += n
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"time"
+
+	"catalogo/compras"
+	"catalogo/unificado"
+)
+
+// runOrder drafts one purchase order per store for a shopping list, buying
+// each line where it is cheapest with stock.
+func runOrder(args []string) error {
+	fs := flag.NewFlagSet("order", flag.ContinueOnError)
+	lista := fs.String("lista", "lista-compras.csv", "Lista de compras en CSV (columnas nombre, tienda, link, sku, ean, buscar, cantidad) o JSON")
+	from := fs.String("from", "catalogo-unificado.json", "Catálogo unificado generado con catalogo combine")
+	output := fs.String("o", "ordenes-compra.csv", "Borrador de órdenes de compra en CSV a escribir")
+	jsonOut := fs.String("json", "", "Escribir también el borrador en JSON en este archivo")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	lines, err := compras.LoadLista(*lista)
+	if err != nil {
+		return err
+	}
+	products, err := unificado.ReadJSON(*from)
+	if err != nil {
+		return err
+	}
+
+	draft := compras.Armar(lines, products, time.Now())
+	for _, o := range draft.Ordenes {
+		log.Printf("[ORDEN]  %s: %d partidas, total $%.2f", o.Tienda, len(o.Partidas), o.Total)
+		for _, p := range o.Partidas {
+			if p.Coincidencias > 1 {
+				log.Printf("[WARN]   \"%s\" coincide con %d productos; se tomó el más barato (%s)", p.Item, p.Coincidencias, p.Nombre)
+			}
+		}
+	}
+	for _, p := range draft.Pendientes {
+		log.Printf("[WARN]   Sin proveedor para \"%s\": %s", p.Item, p.Motivo)
+	}
+	log.Printf("[ORDEN]  %d de %d líneas asignadas, total $%.2f", len(lines)-len(draft.Pendientes), len(lines), draft.Total)
+
+	if err := compras.WriteCSV(draft, *output); err != nil {
+		return err
+	}
+	log.Printf("[ORDEN]  Escrito en %s", *output)
+	if *jsonOut != "" {
+		if err := compras.WriteJSON(draft, *jsonOut); err != nil {
+			return err
+		}
+		log.Printf("[ORDEN]  Escrito en %s", *jsonOut)
+	}
+	return nil
+}
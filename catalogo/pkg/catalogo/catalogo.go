@@ -0,0 +1,157 @@
+// Package catalogo lets other Go programs scrape a store and receive its
+// products as values, instead of running the scraper binary themselves and
+// parsing its productos.json:
+//
+//	store, err := catalogo.Leer("catalogo.json", "buytiti")
+//	...
+//	products, err := catalogo.Scrape(ctx, store)
+//	...
+//	for p := range products {
+//		fmt.Println(p.Nombre, p.Precio)
+//	}
+//
+// Each store's scraper is its own program, as in the daemon: Scrape runs it
+// with the store's command and args and an output of its own, so a run
+// never touches the published catalog, and hands over what it wrote.
+package catalogo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"catalogo/producto"
+	"catalogo/runid"
+	"catalogo/tienda"
+)
+
+// Product is a product as the scrapers write it.
+type Product = producto.Product
+
+// DefaultComando runs the scraper from source, as catalogo daemon does.
+var DefaultComando = []string{"go", "run", "."}
+
+// StoreConfig is how to run one store's scraper: the fields of its entry
+// in catalogo.json, plus options of a single run.
+type StoreConfig struct {
+	ID string `json:"id"`
+	// Dir is where the scraper's command runs, such as
+	// catalogo-buytiti/scraper.
+	Dir string `json:"dir"`
+	// Comando is the scraper's command, DefaultComando when empty.
+	Comando []string `json:"comando"`
+	Args    []string `json:"args"`
+	Workers int      `json:"workers"`
+
+	// Config is the catalogo.json the scraper reads its store's settings
+	// from; empty leaves the scraper's default.
+	Config string `json:"-"`
+	// Sample scrapes only the first Sample products of each category.
+	Sample int `json:"-"`
+	// Categorias scrapes only these categories, by name or slug.
+	Categorias []string `json:"-"`
+	// Log receives the scraper's log; nil discards it.
+	Log io.Writer `json:"-"`
+}
+
+// Leer returns the entry of the store id in the configuration file fpath
+// (catalogo.json), with Dir resolved against the file's directory and
+// Config set to it.
+func Leer(fpath, id string) (StoreConfig, error) {
+	var s StoreConfig
+	if err := tienda.Leer(fpath, id, &s); err != nil {
+		return StoreConfig{}, err
+	}
+	if s.ID == "" {
+		return StoreConfig{}, fmt.Errorf("la tienda %s no está en %s", id, fpath)
+	}
+	base, err := filepath.Abs(filepath.Dir(fpath))
+	if err != nil {
+		return StoreConfig{}, err
+	}
+	if s.Dir = filepath.FromSlash(s.Dir); !filepath.IsAbs(s.Dir) {
+		s.Dir = filepath.Join(base, s.Dir)
+	}
+	s.Config = filepath.Join(base, filepath.Base(fpath))
+	return s, nil
+}
+
+// Scrape runs the scraper of s once and returns its products. It returns
+// when the run has finished: a run that fails is its error, with nothing
+// on the channel. The channel then yields every product and is closed, or
+// closed early when ctx is done; cancelling ctx during the run stops the
+// scraper.
+func Scrape(ctx context.Context, s StoreConfig) (<-chan Product, error) {
+	if s.ID == "" {
+		return nil, errors.New("StoreConfig sin ID")
+	}
+	comando := s.Comando
+	if len(comando) == 0 {
+		comando = DefaultComando
+	}
+
+	dir, err := os.MkdirTemp("", "catalogo-"+s.ID+"-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	output := filepath.Join(dir, "productos.json")
+
+	args := append(append([]string{}, comando[1:]...), s.Args...)
+	args = append(args, "-output", output)
+	if s.Config != "" {
+		config, err := filepath.Abs(s.Config)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "-config", config)
+	}
+	if s.Workers > 0 {
+		args = append(args, "-workers", strconv.Itoa(s.Workers))
+	}
+	if s.Sample > 0 {
+		args = append(args, "-sample", strconv.Itoa(s.Sample))
+	}
+	if len(s.Categorias) > 0 {
+		args = append(args, "-categories", strings.Join(s.Categorias, ","))
+	}
+
+	logw := s.Log
+	if logw == nil {
+		logw = io.Discard
+	}
+	cmd := exec.CommandContext(ctx, comando[0], args...)
+	cmd.Dir = s.Dir
+	cmd.Env = append(os.Environ(), runid.EnvVar+"="+runid.New())
+	cmd.Stdout, cmd.Stderr = logw, logw
+	configureProcess(cmd)
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("scraper de %s: %w", s.ID, err)
+	}
+
+	products, err := producto.ReadJSON(output)
+	if err != nil {
+		return nil, fmt.Errorf("scraper de %s: %w", s.ID, err)
+	}
+	ch := make(chan Product)
+	go func() {
+		defer close(ch)
+		for _, p := range products {
+			select {
+			case ch <- p:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
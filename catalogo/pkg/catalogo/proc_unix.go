@@ -0,0 +1,19 @@
+//go:build !windows
+
+package catalogo
+
+import (
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// configureProcess runs the scraper in its own process group so cancelling
+// reaches the compiled binary spawned by "go run", not only the go tool.
+func configureProcess(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+	}
+	cmd.WaitDelay = 30 * time.Second
+}
@@ -0,0 +1,151 @@
+// Cliente de catalogo (devel). Generado por "catalogo openapi -ts"; no editar.
+
+/** Precios en otra moneda; precio<MONEDA> y precioOriginal<MONEDA> llevan el código de la moneda, como precioUSD. */
+export interface Conversion {
+  fuente: string;
+  moneda: string;
+  tipoCambio: number;
+  [clave: string]: unknown;
+}
+
+export interface Oferta {
+  cantidadPaquete?: number;
+  costoEnvio?: number;
+  enOferta: boolean;
+  envioGratis?: boolean;
+  link: string;
+  moneda?: string;
+  precio: number;
+  precioConIVA?: number;
+  precioOriginal: number;
+  precioUnitario?: number;
+  stock: string;
+  tienda: string;
+  unidad?: string;
+}
+
+export interface Product {
+  cantidadPaquete?: number;
+  categoria: string;
+  conversion?: Conversion;
+  costoEnvio?: number;
+  descripcionEN?: string;
+  enOferta: boolean;
+  envioGratis?: boolean;
+  etiquetasDerivadas?: Record<string, string>;
+  imagen: string;
+  imagen64: string;
+  link: string;
+  mesesSinIntereses?: number;
+  moneda?: string;
+  nombre: string;
+  nombreEN?: string;
+  precio: number;
+  precioCentavos?: number;
+  precioConIVA?: number;
+  precioOriginal: number;
+  precioOriginalCentavos?: number;
+  precioPublico?: number;
+  precioSinIVA?: number;
+  precioUnitario?: number;
+  stock: string;
+  subcategorias: string[];
+  tienda?: string;
+  ultimaActualizacion?: string;
+  unidad?: string;
+  variante?: string;
+}
+
+export interface Producto {
+  categoria: string;
+  disponibleEn: number;
+  imagen: string;
+  imagen64: string;
+  moneda?: string;
+  nombre: string;
+  nombreMostrar?: string;
+  ofertas: Oferta[];
+  precioMinimo: number;
+  precioUnitario?: number;
+  subcategorias: string[];
+  tiendaMasBarata: string;
+  unidad?: string;
+  variante?: string;
+}
+
+export interface Resultado {
+  categoria: string;
+  enOferta: boolean;
+  imagen: string;
+  link: string;
+  nombre: string;
+  precio: number;
+  puntaje: number;
+  stock: string;
+  tienda: string;
+}
+
+export interface StoreInfo {
+  actualizado?: string;
+  daemon?: StoreStatus;
+  error?: string;
+  id: string;
+  nombre: string;
+  productos: number;
+}
+
+export interface StoreStatus {
+  corridas: number;
+  ejecutando: boolean;
+  errorWatch?: string;
+  id: string;
+  nombre: string;
+  proxima?: string;
+  schedule: string;
+  ultimaCorrida?: string;
+  ultimoError?: string;
+  ultimoFin?: string;
+  ultimoInicio?: string;
+  ultimoWatch?: string;
+}
+
+export interface Sugerencia {
+  productos: number;
+  texto: string;
+  tipo: string;
+}
+
+async function obtener<T>(base: string, ruta: string, consulta: Record<string, string | number | undefined> = {}): Promise<T> {
+  const url = new URL(ruta, base);
+  for (const [clave, valor] of Object.entries(consulta)) {
+    if (valor !== undefined) url.searchParams.set(clave, String(valor));
+  }
+  const resp = await fetch(url);
+  if (!resp.ok) throw new Error(`${resp.status} ${await resp.text()}`);
+  return (await resp.json()) as T;
+}
+
+/** Busca en el índice de catalogo index, los más relevantes primero (también en /search) */
+export function buscar(base: string, consulta: { q?: string; limite?: number } = {}): Promise<Resultado[]> {
+  return obtener(base, `/api/buscar`, consulta);
+}
+
+/** Nombres de productos y categorías que completan q, para autocompletar (también en /suggest) */
+export function sugerir(base: string, consulta: { q?: string; limite?: number } = {}): Promise<Sugerencia[]> {
+  return obtener(base, `/api/sugerir`, consulta);
+}
+
+/** Las tiendas de catalogo.json con el tamaño y la fecha de su catálogo y, en el daemon, el estado de sus corridas */
+export function tiendas(base: string): Promise<StoreInfo[]> {
+  return obtener(base, `/api/tiendas`);
+}
+
+/** El productos.json publicado de una tienda */
+export function productos(base: string, id: string): Promise<Product[]> {
+  return obtener(base, `/api/tiendas/${encodeURIComponent(id)}/productos`);
+}
+
+/** El catálogo unificado de catalogo combine; con categoria, solo esa categoría, leyendo solo sus partes si está partido */
+export function unificado(base: string, consulta: { categoria?: string } = {}): Promise<Producto[]> {
+  return obtener(base, `/api/unificado`, consulta);
+}
@@ -0,0 +1,150 @@
+// Package cliente lets other Go programs read the catalogs from a running
+// catalogo serve or catalogo daemon over its JSON API, the one described by
+// GET /api/openapi.json, instead of decoding the responses by hand:
+//
+//	c := cliente.New("http://localhost:8080")
+//	results, err := c.Buscar(ctx, "cable usb-c", 10)
+//
+// catalogo-api.ts, next to this file, is the same client for the frontend,
+// written by "catalogo openapi -ts".
+package cliente
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"catalogo/indice"
+	"catalogo/producto"
+	"catalogo/unificado"
+)
+
+// Tienda is one store as GET /api/tiendas lists it.
+type Tienda struct {
+	ID          string    `json:"id"`
+	Nombre      string    `json:"nombre"`
+	Productos   int       `json:"productos"`
+	Actualizado time.Time `json:"actualizado,omitzero"`
+	Error       string    `json:"error,omitempty"`
+	// Daemon is only set when the server is catalogo daemon.
+	Daemon *Daemon `json:"daemon,omitempty"`
+}
+
+// Daemon is the state of a store's runs in catalogo daemon.
+type Daemon struct {
+	ID            string    `json:"id"`
+	Nombre        string    `json:"nombre"`
+	Schedule      string    `json:"schedule"`
+	Ejecutando    bool      `json:"ejecutando"`
+	Corridas      int       `json:"corridas"`
+	UltimaCorrida string    `json:"ultimaCorrida,omitempty"`
+	UltimoInicio  time.Time `json:"ultimoInicio,omitzero"`
+	UltimoFin     time.Time `json:"ultimoFin,omitzero"`
+	UltimoError   string    `json:"ultimoError,omitempty"`
+	Proxima       time.Time `json:"proxima,omitzero"`
+	UltimoWatch   time.Time `json:"ultimoWatch,omitzero"`
+	ErrorWatch    string    `json:"errorWatch,omitempty"`
+}
+
+// Error is a response other than 200 OK.
+type Error struct {
+	Status  int
+	Mensaje string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("catalogo: %d %s", e.Status, e.Mensaje)
+}
+
+// Cliente calls the API at Base, such as "http://localhost:8080".
+type Cliente struct {
+	Base string
+	// HTTP is the client for the requests, http.DefaultClient when nil.
+	HTTP *http.Client
+}
+
+// New returns a Cliente for the server at base.
+func New(base string) *Cliente {
+	return &Cliente{Base: strings.TrimSuffix(base, "/")}
+}
+
+// Tiendas is GET /api/tiendas.
+func (c *Cliente) Tiendas(ctx context.Context) ([]Tienda, error) {
+	var out []Tienda
+	return out, c.get(ctx, "/api/tiendas", nil, &out)
+}
+
+// Productos is GET /api/tiendas/{id}/productos: the published catalog of
+// the store id.
+func (c *Cliente) Productos(ctx context.Context, id string) ([]producto.Product, error) {
+	var out []producto.Product
+	return out, c.get(ctx, "/api/tiendas/"+url.PathEscape(id)+"/productos", nil, &out)
+}
+
+// Buscar is GET /api/buscar: up to limite products matching q, the most
+// relevant first. A limite of 0 leaves the server's default.
+func (c *Cliente) Buscar(ctx context.Context, q string, limite int) ([]indice.Resultado, error) {
+	var out []indice.Resultado
+	return out, c.get(ctx, "/api/buscar", consulta(q, limite), &out)
+}
+
+// Sugerir is GET /api/sugerir: product names and categories that complete
+// q, for type-ahead.
+func (c *Cliente) Sugerir(ctx context.Context, q string, limite int) ([]indice.Sugerencia, error) {
+	var out []indice.Sugerencia
+	return out, c.get(ctx, "/api/sugerir", consulta(q, limite), &out)
+}
+
+// Unificado is GET /api/unificado: the unified catalog, or only the
+// products of categoria when it is not "".
+func (c *Cliente) Unificado(ctx context.Context, categoria string) ([]unificado.Producto, error) {
+	var out []unificado.Producto
+	var query url.Values
+	if categoria != "" {
+		query = url.Values{"categoria": {categoria}}
+	}
+	return out, c.get(ctx, "/api/unificado", query, &out)
+}
+
+func consulta(q string, limite int) url.Values {
+	v := url.Values{"q": {q}}
+	if limite > 0 {
+		v.Set("limite", strconv.Itoa(limite))
+	}
+	return v
+}
+
+func (c *Cliente) get(ctx context.Context, ruta string, query url.Values, out any) error {
+	u := c.Base + ruta
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	client := c.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+		return &Error{Status: resp.StatusCode, Mensaje: strings.TrimSpace(string(body))}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("error parsing %s: %w", ruta, err)
+	}
+	return nil
+}
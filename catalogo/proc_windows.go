@@ -0,0 +1,14 @@
+//go:build windows
+
+package main
+
+import (
+	"os/exec"
+	"time"
+)
+
+// configureProcess relies on the default kill on cancellation; Windows has
+// no process groups to signal.
+func configureProcess(cmd *exec.Cmd) {
+	cmd.WaitDelay = 30 * time.Second
+}
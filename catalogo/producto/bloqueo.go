@@ -0,0 +1,95 @@
+package producto
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"catalogo/texto"
+)
+
+// Bloqueo is a blocklist of products the catalog never carries, read from
+// the file of the scrapers' -blocklist flag. Each line is a keyword or
+// phrase, compared without case or accents against the start of the words of
+// the name ("reacondicionado" also blocks "Reacondicionados"), or a regular
+// expression between slashes (/\bxiaomi\b/), compared without case. Blank
+// lines and lines starting with # are ignored.
+type Bloqueo struct {
+	palabras []string
+	patrones []*regexp.Regexp
+}
+
+// LeerBloqueo loads the blocklist in fpath.
+func LeerBloqueo(fpath string) (*Bloqueo, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo %s: %w", fpath, err)
+	}
+	defer f.Close()
+	b := &Bloqueo{}
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		entry := strings.TrimSpace(sc.Text())
+		switch {
+		case entry == "" || strings.HasPrefix(entry, "#"):
+		case len(entry) > 2 && strings.HasPrefix(entry, "/") && strings.HasSuffix(entry, "/"):
+			re, err := regexp.Compile("(?i)" + entry[1:len(entry)-1])
+			if err != nil {
+				return nil, fmt.Errorf("error parsing %s, línea %d: %w", fpath, line, err)
+			}
+			b.patrones = append(b.patrones, re)
+		default:
+			if n := texto.Normalize(entry); n != "" {
+				b.palabras = append(b.palabras, " "+n)
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("error leyendo %s: %w", fpath, err)
+	}
+	return b, nil
+}
+
+// Len is how many entries b has.
+func (b *Bloqueo) Len() int {
+	if b == nil {
+		return 0
+	}
+	return len(b.palabras) + len(b.patrones)
+}
+
+// Bloquea reports whether a product named nombre is blocked. A nil Bloqueo
+// blocks nothing.
+func (b *Bloqueo) Bloquea(nombre string) bool {
+	if b == nil {
+		return false
+	}
+	n := " " + texto.Normalize(nombre)
+	for _, w := range b.palabras {
+		if strings.Contains(n, w) {
+			return true
+		}
+	}
+	for _, re := range b.patrones {
+		if re.MatchString(nombre) {
+			return true
+		}
+	}
+	return false
+}
+
+// Aplicar returns the products b does not block, reusing products' storage.
+func (b *Bloqueo) Aplicar(products []Product) []Product {
+	if b.Len() == 0 {
+		return products
+	}
+	out := products[:0]
+	for _, p := range products {
+		if !b.Bloquea(p.Nombre) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
@@ -0,0 +1,271 @@
+package producto
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"catalogo/canonurl"
+)
+
+// bigDropPct is the price drop (in percent) above which a product is listed
+// individually in the changelog instead of only being counted.
+const bigDropPct = 20.0
+
+// PriceChange pairs the previous and current version of a product whose price moved.
+type PriceChange struct {
+	Antes   Product `json:"antes"`
+	Despues Product `json:"despues"`
+}
+
+// Pct returns the relative price change in percent (negative when it got cheaper).
+func (c PriceChange) Pct() float64 {
+	if c.Antes.Precio == 0 {
+		return 0
+	}
+	return (c.Despues.Precio - c.Antes.Precio) / c.Antes.Precio * 100
+}
+
+// Diff is the set of changes between two runs of the same store, keyed by link.
+type Diff struct {
+	Nuevos        []Product     `json:"nuevos"`
+	Eliminados    []Product     `json:"eliminados"`
+	Precios       []PriceChange `json:"precios"`
+	Agotados      []Product     `json:"agotados"`
+	Reabastecidos []Product     `json:"reabastecidos"`
+}
+
+// Empty reports whether nothing changed between the two runs.
+func (d Diff) Empty() bool {
+	return len(d.Nuevos) == 0 && len(d.Eliminados) == 0 && len(d.Precios) == 0 &&
+		len(d.Agotados) == 0 && len(d.Reabastecidos) == 0
+}
+
+// Cambiados returns the products of curr that are not in snapshot, by link,
+// or differ from their version there in any field: the delta to apply to
+// snapshot, except for removals.
+func Cambiados(snapshot, curr []Product) []Product {
+	before := make(map[string][]byte, len(snapshot))
+	for _, p := range snapshot {
+		before[canonurl.Key(p.Link)] = firma(p)
+	}
+	var out []Product
+	for _, p := range curr {
+		if old, ok := before[canonurl.Key(p.Link)]; !ok || !bytes.Equal(old, firma(p)) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// firma is p's JSON, with no subcategories written the same whether read
+// from a file ([]) or built by a scraper (nil), and without the time of its
+// last change, which is not one.
+func firma(p Product) []byte {
+	if len(p.Subcategorias) == 0 {
+		p.Subcategorias = nil
+	}
+	p.UltimaActualizacion = time.Time{}
+	b, _ := json.Marshal(p)
+	return b
+}
+
+// Sellar sets the UltimaActualizacion of products: that of their version in
+// previous (by link) when it has the same data once trimmed to campos, the
+// fields previous was written with, or now otherwise.
+func Sellar(products, previous []Product, campos Campos, now time.Time) {
+	before := make(map[string]Product, len(previous))
+	for _, p := range previous {
+		before[canonurl.Key(p.Link)] = p
+	}
+	trimmed := campos.Recortar(products)
+	for i := range products {
+		old, ok := before[canonurl.Key(products[i].Link)]
+		if ok && !old.UltimaActualizacion.IsZero() && bytes.Equal(firma(old), firma(trimmed[i])) {
+			products[i].UltimaActualizacion = old.UltimaActualizacion
+		} else {
+			products[i].UltimaActualizacion = now
+		}
+	}
+}
+
+// Compare computes the changes from prev to curr.
+func Compare(prev, curr []Product) Diff {
+	var d Diff
+	before := make(map[string]Product, len(prev))
+	for _, p := range prev {
+		before[canonurl.Key(p.Link)] = p
+	}
+	now := make(map[string]bool, len(curr))
+	for _, p := range curr {
+		key := canonurl.Key(p.Link)
+		now[key] = true
+		old, ok := before[key]
+		if !ok {
+			d.Nuevos = append(d.Nuevos, p)
+			continue
+		}
+		if old.Precio != p.Precio {
+			d.Precios = append(d.Precios, PriceChange{Antes: old, Despues: p})
+		}
+		switch {
+		case !old.Agotado() && p.Agotado():
+			d.Agotados = append(d.Agotados, p)
+		case old.Agotado() && !p.Agotado():
+			d.Reabastecidos = append(d.Reabastecidos, p)
+		}
+	}
+	for _, p := range prev {
+		if !now[canonurl.Key(p.Link)] {
+			d.Eliminados = append(d.Eliminados, p)
+		}
+	}
+	return d
+}
+
+// ChangelogPath returns dir/CAMBIOS-<fecha>.md for the given day.
+func ChangelogPath(dir string, fecha time.Time) string {
+	return filepath.Join(dir, fmt.Sprintf("CAMBIOS-%s.md", fecha.Format("2006-01-02")))
+}
+
+// WriteChangelog writes a plain-Spanish Markdown summary of d, meant to be
+// pasted as-is into the team chat. corrida, the ID of the run that produced
+// it, goes in a footer when set.
+func WriteChangelog(d Diff, fpath, tienda string, fecha time.Time, corrida string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Cambios en %s — %s\n\n", tienda, fecha.Format("02/01/2006"))
+
+	if d.Empty() {
+		b.WriteString("Sin cambios desde la última actualización.\n")
+		writeFooter(&b, corrida)
+		return os.WriteFile(fpath, []byte(b.String()), 0644)
+	}
+
+	var bajas, bajasFuertes, subidas []PriceChange
+	for _, c := range d.Precios {
+		switch {
+		case c.Pct() <= -bigDropPct:
+			bajasFuertes = append(bajasFuertes, c)
+		case c.Pct() < 0:
+			bajas = append(bajas, c)
+		default:
+			subidas = append(subidas, c)
+		}
+	}
+
+	fmt.Fprintf(&b, "**Resumen:** %s, %s, %s, %s y %s.\n",
+		plural(len(d.Nuevos), "producto nuevo", "productos nuevos"),
+		plural(len(d.Eliminados), "eliminado", "eliminados"),
+		plural(len(d.Precios), "cambio de precio", "cambios de precio"),
+		plural(len(d.Agotados), "agotado", "agotados"),
+		plural(len(d.Reabastecidos), "de vuelta en stock", "de vuelta en stock"))
+
+	if len(d.Nuevos) > 0 {
+		b.WriteString("\n## Productos nuevos\n\n")
+		for _, c := range countByCategory(d.Nuevos) {
+			fmt.Fprintf(&b, "- %s en %s\n", plural(c.n, "producto nuevo", "productos nuevos"), c.categoria)
+		}
+	}
+
+	if len(d.Eliminados) > 0 {
+		b.WriteString("\n## Productos que ya no aparecen\n\n")
+		for _, c := range countByCategory(d.Eliminados) {
+			fmt.Fprintf(&b, "- %s de %s\n", plural(c.n, "producto", "productos"), c.categoria)
+		}
+	}
+
+	if len(d.Precios) > 0 {
+		b.WriteString("\n## Precios\n\n")
+		if len(bajasFuertes) > 0 {
+			sort.Slice(bajasFuertes, func(i, j int) bool { return bajasFuertes[i].Pct() < bajasFuertes[j].Pct() })
+			fmt.Fprintf(&b, "- %s de precio más de %.0f%%:\n",
+				plural(len(bajasFuertes), "producto bajó", "productos bajaron"), bigDropPct)
+			for _, c := range limit(bajasFuertes, 20) {
+				fmt.Fprintf(&b, "  - %s: $%.2f → $%.2f (%.0f%%)\n", c.Despues.Nombre, c.Antes.Precio, c.Despues.Precio, c.Pct())
+			}
+			if len(bajasFuertes) > 20 {
+				fmt.Fprintf(&b, "  - …y %d más\n", len(bajasFuertes)-20)
+			}
+		}
+		if len(bajas) > 0 {
+			fmt.Fprintf(&b, "- %s de precio (menos de %.0f%%)\n",
+				plural(len(bajas), "producto bajó", "productos bajaron"), bigDropPct)
+		}
+		if len(subidas) > 0 {
+			fmt.Fprintf(&b, "- %s de precio\n", plural(len(subidas), "producto subió", "productos subieron"))
+		}
+	}
+
+	if len(d.Agotados) > 0 || len(d.Reabastecidos) > 0 {
+		b.WriteString("\n## Disponibilidad\n\n")
+		if len(d.Agotados) > 0 {
+			fmt.Fprintf(&b, "- %s:\n", plural(len(d.Agotados), "producto se agotó", "productos se agotaron"))
+			writeNames(&b, d.Agotados)
+		}
+		if len(d.Reabastecidos) > 0 {
+			fmt.Fprintf(&b, "- %s a estar disponibles:\n", plural(len(d.Reabastecidos), "producto volvió", "productos volvieron"))
+			writeNames(&b, d.Reabastecidos)
+		}
+	}
+	writeFooter(&b, corrida)
+
+	if err := os.WriteFile(fpath, []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("error escribiendo changelog: %w", err)
+	}
+	return nil
+}
+
+func writeFooter(b *strings.Builder, corrida string) {
+	if corrida != "" {
+		fmt.Fprintf(b, "\n_Corrida %s_\n", corrida)
+	}
+}
+
+type categoryCount struct {
+	categoria string
+	n         int
+}
+
+// countByCategory groups products by category, most populated first.
+func countByCategory(products []Product) []categoryCount {
+	counts := make(map[string]int)
+	for _, p := range products {
+		counts[p.Categoria]++
+	}
+	out := make([]categoryCount, 0, len(counts))
+	for cat, n := range counts {
+		out = append(out, categoryCount{cat, n})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].n != out[j].n {
+			return out[i].n > out[j].n
+		}
+		return out[i].categoria < out[j].categoria
+	})
+	return out
+}
+
+func writeNames(b *strings.Builder, products []Product) {
+	for _, p := range limit(products, 20) {
+		fmt.Fprintf(b, "  - %s (%s)\n", p.Nombre, p.Categoria)
+	}
+	if len(products) > 20 {
+		fmt.Fprintf(b, "  - …y %d más\n", len(products)-20)
+	}
+}
+
+func limit[T any](s []T, n int) []T {
+	return s[:min(n, len(s))]
+}
+
+func plural(n int, singular, pluralForm string) string {
+	if n == 1 {
+		return "1 " + singular
+	}
+	return fmt.Sprintf("%d %s", n, pluralForm)
+}
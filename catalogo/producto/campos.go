@@ -0,0 +1,157 @@
+package producto
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Campos is a selection of Product's JSON fields, set by the scrapers'
+// -fields flag, for outputs slimmer than the full schema. A nil Campos is
+// every field.
+type Campos []string
+
+// camposProduct maps each JSON field name of Product to its struct field
+// index, and lists the names in schema order.
+var camposProduct, ordenProduct = func() (map[string]int, []string) {
+	t := reflect.TypeFor[Product]()
+	idx := make(map[string]int, t.NumField())
+	var order []string
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		idx[name] = i
+		order = append(order, name)
+	}
+	return idx, order
+}()
+
+// ParseCampos reads a comma-separated list of field names
+// ("nombre,precio,link"), kept in schema order whatever the order given.
+func ParseCampos(list string) (Campos, error) {
+	want := make(map[string]bool)
+	for name := range strings.SplitSeq(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, ok := camposProduct[name]; !ok {
+			return nil, fmt.Errorf("campo desconocido %q (válidos: %s)", name, strings.Join(ordenProduct, ", "))
+		}
+		want[name] = true
+	}
+	if len(want) == 0 {
+		return nil, nil
+	}
+	var c Campos
+	for _, name := range ordenProduct {
+		if want[name] {
+			c = append(c, name)
+		}
+	}
+	return c, nil
+}
+
+// Recortar returns copies of products with the fields outside c zeroed: what
+// reading back an output written with c gives, so hashes compare alike.
+func (c Campos) Recortar(products []Product) []Product {
+	if c == nil {
+		return products
+	}
+	out := make([]Product, len(products))
+	for i, p := range products {
+		src := reflect.ValueOf(p)
+		dst := reflect.ValueOf(&out[i]).Elem()
+		for _, name := range c {
+			j := camposProduct[name]
+			dst.Field(j).Set(src.Field(j))
+		}
+	}
+	return out
+}
+
+// Marshal encodes products as indented JSON with only the fields in c,
+// named as in e.
+func (c Campos) Marshal(products []Product, e Esquema) ([]byte, error) {
+	if c == nil && e == nil {
+		return json.MarshalIndent(products, "", "    ")
+	}
+	if c == nil {
+		c = ordenProduct
+	}
+	rows := make([]fila, len(products))
+	for i, p := range products {
+		data, err := json.Marshal(p)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &rows[i].valores); err != nil {
+			return nil, err
+		}
+		rows[i].campos = c
+		rows[i].esquema = e
+	}
+	return json.MarshalIndent(rows, "", "    ")
+}
+
+// fila is one product as a JSON object with only some fields, in order and
+// named as in esquema.
+type fila struct {
+	campos  Campos
+	esquema Esquema
+	valores map[string]json.RawMessage
+}
+
+func (f fila) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for _, name := range f.campos {
+		v, ok := f.valores[name]
+		if !ok {
+			continue // omitted when empty
+		}
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+		key, _ := json.Marshal(f.esquema.nombre(name))
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(v)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// Textos returns the fields of p in c as text, for tables and CSV: numbers
+// as written in JSON, lists joined with "; " and objects as JSON.
+func (c Campos) Textos(p Product) []string {
+	if c == nil {
+		c = ordenProduct
+	}
+	v := reflect.ValueOf(p)
+	out := make([]string, len(c))
+	for i, name := range c {
+		f := v.Field(camposProduct[name])
+		switch {
+		case f.Kind() == reflect.String:
+			out[i] = f.String()
+		case f.Type() == tipoTime:
+			if !f.IsZero() {
+				out[i] = f.Interface().(time.Time).Format(time.RFC3339)
+			}
+		case f.Kind() == reflect.Slice && f.Type().Elem().Kind() == reflect.String:
+			out[i] = strings.Join(f.Interface().([]string), "; ")
+		case f.Kind() == reflect.Map, f.Kind() == reflect.Pointer:
+			if !f.IsZero() {
+				data, _ := json.Marshal(f.Interface())
+				out[i] = string(data)
+			}
+		default:
+			data, _ := json.Marshal(f.Interface())
+			out[i] = string(data)
+		}
+	}
+	return out
+}
@@ -0,0 +1,423 @@
+package producto
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"catalogo/texto"
+)
+
+// Consulta is a filter over Product's JSON fields, the expression of
+// catalogo query:
+//
+//	categoria="Audio" and precio<300 and enOferta
+//	tienda in ("buytiti", "myshop") and not nombre~"usb"
+//
+// A comparison is a field, an operator (= != < <= > >= or ~, "contains")
+// and a value: text in double quotes, a number, true or false, or a date
+// ("2025-06-01") for ultimaActualizacion. "campo in (a, b)" is true when
+// the field equals any of the values. Text compares as texto.Equal
+// does, without case or accents, and a list such as subcategorias matches
+// when any of its items does. A field alone is true when it is not empty:
+// enOferta, envioGratis, imagen. and binds tighter than or; not and
+// parentheses work as usual.
+type Consulta struct {
+	raiz nodoConsulta
+}
+
+type nodoConsulta interface {
+	cumple(p reflect.Value) bool
+}
+
+type (
+	yConsulta  [2]nodoConsulta
+	oConsulta  [2]nodoConsulta
+	noConsulta struct{ n nodoConsulta }
+	// campoConsulta is a field alone, true when not empty.
+	campoConsulta struct{ campo int }
+	comparacion   struct {
+		campo int
+		op    string
+		texto string
+		num   float64
+		fecha time.Time
+	}
+)
+
+func (n yConsulta) cumple(p reflect.Value) bool  { return n[0].cumple(p) && n[1].cumple(p) }
+func (n oConsulta) cumple(p reflect.Value) bool  { return n[0].cumple(p) || n[1].cumple(p) }
+func (n noConsulta) cumple(p reflect.Value) bool { return !n.n.cumple(p) }
+func (n campoConsulta) cumple(p reflect.Value) bool {
+	return !p.Field(n.campo).IsZero()
+}
+
+func (n comparacion) cumple(p reflect.Value) bool {
+	v := p.Field(n.campo)
+	if v.Kind() != reflect.Slice {
+		return n.compara(v)
+	}
+	// A list != a value when none of its items equals it
+	item := n
+	if n.op == "!=" {
+		item.op = "="
+	}
+	for i := range v.Len() {
+		if item.compara(v.Index(i)) {
+			return n.op != "!="
+		}
+	}
+	return n.op == "!="
+}
+
+func (n comparacion) compara(v reflect.Value) bool {
+	var c int
+	switch {
+	case v.Type() == tipoTime:
+		c = v.Interface().(time.Time).Compare(n.fecha)
+	case v.Kind() == reflect.String:
+		if n.op == "~" {
+			return strings.Contains(texto.Normalize(v.String()), texto.Normalize(n.texto))
+		}
+		c = strings.Compare(texto.Normalize(v.String()), texto.Normalize(n.texto))
+	case v.Kind() == reflect.Bool:
+		c = compararBool(v.Bool(), n.num != 0)
+	case v.CanFloat():
+		c = compararNum(v.Float(), n.num)
+	case v.CanInt():
+		c = compararNum(float64(v.Int()), n.num)
+	}
+	switch n.op {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+func compararNum(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compararBool(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case b:
+		return -1
+	}
+	return 1
+}
+
+// Cumple reports whether p matches c. The zero Consulta matches every
+// product.
+func (c Consulta) Cumple(p Product) bool {
+	return c.raiz == nil || c.raiz.cumple(reflect.ValueOf(p))
+}
+
+// Filtrar returns the products that match c.
+func (c Consulta) Filtrar(products []Product) []Product {
+	var out []Product
+	for _, p := range products {
+		if c.Cumple(p) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// ParseConsulta reads a Consulta. An empty expression matches every
+// product.
+func ParseConsulta(expr string) (Consulta, error) {
+	toks, err := lexConsulta(expr)
+	if err != nil {
+		return Consulta{}, err
+	}
+	if len(toks) == 0 {
+		return Consulta{}, nil
+	}
+	ps := &parserConsulta{toks: toks}
+	raiz, err := ps.or()
+	if err != nil {
+		return Consulta{}, err
+	}
+	if t := ps.peek(); t.tipo != tokFin {
+		return Consulta{}, fmt.Errorf("consulta: sobra %q en la posición %d", t.texto, t.pos+1)
+	}
+	return Consulta{raiz: raiz}, nil
+}
+
+type tipoToken int
+
+const (
+	tokFin tipoToken = iota
+	tokPalabra
+	tokTexto
+	tokNumero
+	tokOp
+	tokAbre
+	tokCierra
+	tokComa
+)
+
+type tokenConsulta struct {
+	tipo  tipoToken
+	texto string
+	pos   int
+}
+
+// lexConsulta splits expr into words, quoted texts, numbers, operators
+// and parentheses.
+func lexConsulta(expr string) ([]tokenConsulta, error) {
+	var toks []tokenConsulta
+	r := []rune(expr)
+	for i := 0; i < len(r); {
+		c := r[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			toks = append(toks, tokenConsulta{tokAbre, "(", i})
+			i++
+		case c == ')':
+			toks = append(toks, tokenConsulta{tokCierra, ")", i})
+			i++
+		case c == ',':
+			toks = append(toks, tokenConsulta{tokComa, ",", i})
+			i++
+		case c == '"':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(r) && r[j] != '"'; j++ {
+				if r[j] == '\\' && j+1 < len(r) {
+					j++
+				}
+				b.WriteRune(r[j])
+			}
+			if j == len(r) {
+				return nil, fmt.Errorf("consulta: falta cerrar las comillas de la posición %d", i+1)
+			}
+			toks = append(toks, tokenConsulta{tokTexto, b.String(), i})
+			i = j + 1
+		case strings.ContainsRune("=!<>~", c):
+			op, size := string(c), 1
+			if i+1 < len(r) && r[i+1] == '=' && c != '~' {
+				if c != '=' {
+					op += "="
+				}
+				size = 2 // "==" is "="
+			}
+			if op == "!" {
+				return nil, fmt.Errorf("consulta: operador inválido \"!\" en la posición %d (¿!=?)", i+1)
+			}
+			toks = append(toks, tokenConsulta{tokOp, op, i})
+			i += size
+		case unicode.IsDigit(c) || c == '-' || c == '.':
+			j := i + 1
+			for j < len(r) && (unicode.IsDigit(r[j]) || r[j] == '.' || r[j] == '-' || r[j] == ':' || r[j] == 'T' || r[j] == 'Z') {
+				j++
+			}
+			toks = append(toks, tokenConsulta{tokNumero, string(r[i:j]), i})
+			i = j
+		case unicode.IsLetter(c) || c == '_':
+			j := i + 1
+			for j < len(r) && (unicode.IsLetter(r[j]) || unicode.IsDigit(r[j]) || r[j] == '_') {
+				j++
+			}
+			toks = append(toks, tokenConsulta{tokPalabra, string(r[i:j]), i})
+			i = j
+		default:
+			return nil, fmt.Errorf("consulta: carácter inesperado %q en la posición %d", c, i+1)
+		}
+	}
+	return toks, nil
+}
+
+type parserConsulta struct {
+	toks []tokenConsulta
+	i    int
+}
+
+func (ps *parserConsulta) peek() tokenConsulta {
+	if ps.i == len(ps.toks) {
+		return tokenConsulta{tipo: tokFin, pos: len(ps.toks)}
+	}
+	return ps.toks[ps.i]
+}
+
+func (ps *parserConsulta) next() tokenConsulta {
+	t := ps.peek()
+	if t.tipo != tokFin {
+		ps.i++
+	}
+	return t
+}
+
+// palabra reports whether the next token is the keyword w, and takes it.
+func (ps *parserConsulta) palabra(w string) bool {
+	if t := ps.peek(); t.tipo == tokPalabra && strings.EqualFold(t.texto, w) {
+		ps.i++
+		return true
+	}
+	return false
+}
+
+func (ps *parserConsulta) or() (nodoConsulta, error) {
+	n, err := ps.and()
+	for err == nil && ps.palabra("or") {
+		var m nodoConsulta
+		if m, err = ps.and(); err == nil {
+			n = oConsulta{n, m}
+		}
+	}
+	return n, err
+}
+
+func (ps *parserConsulta) and() (nodoConsulta, error) {
+	n, err := ps.not()
+	for err == nil && ps.palabra("and") {
+		var m nodoConsulta
+		if m, err = ps.not(); err == nil {
+			n = yConsulta{n, m}
+		}
+	}
+	return n, err
+}
+
+func (ps *parserConsulta) not() (nodoConsulta, error) {
+	if ps.palabra("not") {
+		n, err := ps.not()
+		return noConsulta{n}, err
+	}
+	return ps.primario()
+}
+
+func (ps *parserConsulta) primario() (nodoConsulta, error) {
+	t := ps.next()
+	switch t.tipo {
+	case tokAbre:
+		n, err := ps.or()
+		if err != nil {
+			return nil, err
+		}
+		if c := ps.next(); c.tipo != tokCierra {
+			return nil, fmt.Errorf("consulta: falta cerrar el paréntesis de la posición %d", t.pos+1)
+		}
+		return n, nil
+	case tokPalabra:
+		return ps.comparacion(t)
+	case tokFin:
+		return nil, fmt.Errorf("consulta: la expresión termina antes de tiempo")
+	}
+	return nil, fmt.Errorf("consulta: se esperaba un campo en la posición %d, no %q", t.pos+1, t.texto)
+}
+
+// comparacion reads what follows the field name t: an operator and a
+// value, "in" and a list of values, or nothing for a field alone.
+func (ps *parserConsulta) comparacion(t tokenConsulta) (nodoConsulta, error) {
+	i, ok := camposProduct[t.texto]
+	if !ok {
+		return nil, fmt.Errorf("consulta: campo desconocido %q (válidos: %s)", t.texto, strings.Join(ordenProduct, ", "))
+	}
+	if ps.palabra("in") {
+		return ps.lista(t, i)
+	}
+	if ps.peek().tipo != tokOp {
+		return campoConsulta{campo: i}, nil
+	}
+	op := ps.next().texto
+	return ps.valor(t, i, op)
+}
+
+// lista reads the values of "campo in (a, b, ...)", true when the field
+// equals any of them.
+func (ps *parserConsulta) lista(t tokenConsulta, i int) (nodoConsulta, error) {
+	if ps.next().tipo != tokAbre {
+		return nil, fmt.Errorf("consulta: falta la lista de valores de %s in, como (\"a\", \"b\")", t.texto)
+	}
+	var n nodoConsulta
+	for {
+		v, err := ps.valor(t, i, "=")
+		if err != nil {
+			return nil, err
+		}
+		if n == nil {
+			n = v
+		} else {
+			n = oConsulta{n, v}
+		}
+		switch sep := ps.next(); sep.tipo {
+		case tokComa:
+		case tokCierra:
+			return n, nil
+		default:
+			return nil, fmt.Errorf("consulta: falta cerrar la lista de valores de %s in", t.texto)
+		}
+	}
+}
+
+// valor reads the value field t, the i-th of Product, is compared to with
+// op, checked against the field's type.
+func (ps *parserConsulta) valor(t tokenConsulta, i int, op string) (nodoConsulta, error) {
+	ft := reflect.TypeFor[Product]().Field(i).Type
+	val := ps.next()
+	if val.tipo != tokTexto && val.tipo != tokNumero && val.tipo != tokPalabra {
+		return nil, fmt.Errorf("consulta: falta el valor de %s%s", t.texto, op)
+	}
+	n := comparacion{campo: i, op: op, texto: val.texto}
+	if ft.Kind() == reflect.Slice {
+		ft = ft.Elem()
+	}
+	switch {
+	case ft == tipoTime:
+		var err error
+		if n.fecha, err = time.Parse(time.DateOnly, val.texto); err != nil {
+			if n.fecha, err = time.Parse(time.RFC3339, val.texto); err != nil {
+				return nil, fmt.Errorf("consulta: %s espera una fecha (2025-06-01), no %q", t.texto, val.texto)
+			}
+		}
+	case ft.Kind() == reflect.String:
+	case ft.Kind() == reflect.Bool:
+		switch {
+		case op != "=" && op != "!=":
+			return nil, fmt.Errorf("consulta: %s solo admite = y !=", t.texto)
+		case strings.EqualFold(val.texto, "true"):
+			n.num = 1
+		case !strings.EqualFold(val.texto, "false"):
+			return nil, fmt.Errorf("consulta: %s espera true o false, no %q", t.texto, val.texto)
+		}
+	case ft.Kind() == reflect.Float64, ft.Kind() == reflect.Int, ft.Kind() == reflect.Int64:
+		if op == "~" {
+			return nil, fmt.Errorf("consulta: %s no admite ~", t.texto)
+		}
+		num, err := strconv.ParseFloat(val.texto, 64)
+		if err != nil {
+			return nil, fmt.Errorf("consulta: %s espera un número, no %q", t.texto, val.texto)
+		}
+		n.num = num
+	default:
+		return nil, fmt.Errorf("consulta: %s solo se puede usar solo, como %q", t.texto, t.texto)
+	}
+	if op == "~" && ft.Kind() != reflect.String {
+		return nil, fmt.Errorf("consulta: %s no admite ~", t.texto)
+	}
+	return n, nil
+}
@@ -0,0 +1,132 @@
+package producto
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+var productosConsulta = []Product{
+	{Nombre: "Audífonos Bluetooth", Precio: 250, EnOferta: true, Stock: "5 disponibles", Categoria: "Audio", Subcategorias: []string{"Inalámbricos", "Deportivos"}, Tienda: "buytiti", UltimaActualizacion: time.Date(2025, 6, 10, 12, 0, 0, 0, time.UTC)},
+	{Nombre: "Bocina portátil", Precio: 450, Stock: "agotado", Categoria: "Audio", Tienda: "myshop", UltimaActualizacion: time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC)},
+	{Nombre: "Cable USB-C", Precio: 80, EnOferta: true, Stock: "20 disponibles", Categoria: "Cables", Subcategorias: []string{"USB"}, Tienda: "buytiti"},
+	{Nombre: "Cuaderno", Precio: 35, Stock: "3 disponibles", Categoria: "Papelería", Tienda: "otra"},
+}
+
+// nombresConsulta are the names of the products expr matches.
+func nombresConsulta(t *testing.T, expr string) []string {
+	t.Helper()
+	q, err := ParseConsulta(expr)
+	if err != nil {
+		t.Fatalf("ParseConsulta(%q): %v", expr, err)
+	}
+	var names []string
+	for _, p := range q.Filtrar(productosConsulta) {
+		names = append(names, p.Nombre)
+	}
+	return names
+}
+
+func TestConsulta(t *testing.T) {
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{``, []string{"Audífonos Bluetooth", "Bocina portátil", "Cable USB-C", "Cuaderno"}},
+		{`categoria="Audio" and precio<300 and enOferta`, []string{"Audífonos Bluetooth"}},
+
+		// Comparisons
+		{`precio<=80`, []string{"Cable USB-C", "Cuaderno"}},
+		{`precio>250`, []string{"Bocina portátil"}},
+		{`precio>=250`, []string{"Audífonos Bluetooth", "Bocina portátil"}},
+		{`precio!=80`, []string{"Audífonos Bluetooth", "Bocina portátil", "Cuaderno"}},
+		{`precio==35`, []string{"Cuaderno"}},
+		{`enOferta=false`, []string{"Bocina portátil", "Cuaderno"}},
+
+		// Text, without case or accents
+		{`categoria="papeleria"`, []string{"Cuaderno"}},
+		{`tienda=buytiti`, []string{"Audífonos Bluetooth", "Cable USB-C"}},
+		{`nombre~"AUDIFONOS"`, []string{"Audífonos Bluetooth"}},
+		{`nombre~"usb"`, []string{"Cable USB-C"}},
+		{`nombre="Cable \"USB\""`, nil},
+
+		// A field alone
+		{`enOferta`, []string{"Audífonos Bluetooth", "Cable USB-C"}},
+		{`subcategorias`, []string{"Audífonos Bluetooth", "Cable USB-C"}},
+
+		// Precedence: and binds tighter than or
+		{`categoria="Cables" or categoria="Audio" and precio>300`, []string{"Bocina portátil", "Cable USB-C"}},
+		{`(categoria="Cables" or categoria="Audio") and precio>200`, []string{"Audífonos Bluetooth", "Bocina portátil"}},
+		{`precio<50 or precio>400 or enOferta and categoria="Cables"`, []string{"Bocina portátil", "Cable USB-C", "Cuaderno"}},
+
+		// Negation
+		{`not enOferta`, []string{"Bocina portátil", "Cuaderno"}},
+		{`not not enOferta`, []string{"Audífonos Bluetooth", "Cable USB-C"}},
+		{`not categoria="Audio" and precio>50`, []string{"Cable USB-C"}},
+		{`not (categoria="Audio" and precio>50)`, []string{"Cable USB-C", "Cuaderno"}},
+		{`not stock="agotado" and not tienda in ("otra")`, []string{"Audífonos Bluetooth", "Cable USB-C"}},
+
+		// in lists
+		{`tienda in ("myshop", "otra")`, []string{"Bocina portátil", "Cuaderno"}},
+		{`precio in (35, 80, 1000)`, []string{"Cable USB-C", "Cuaderno"}},
+		{`categoria in ("audio") and precio in (450)`, []string{"Bocina portátil"}},
+		{`subcategorias in ("usb", "deportivos")`, []string{"Audífonos Bluetooth", "Cable USB-C"}},
+
+		// Lists: any item matches, != when none does
+		{`subcategorias="inalambricos"`, []string{"Audífonos Bluetooth"}},
+		{`subcategorias~"usb"`, []string{"Cable USB-C"}},
+		{`subcategorias!="usb"`, []string{"Audífonos Bluetooth", "Bocina portátil", "Cuaderno"}},
+
+		// Dates
+		{`ultimaActualizacion>="2025-06-01"`, []string{"Audífonos Bluetooth"}},
+		{`ultimaActualizacion<2025-06-01`, []string{"Bocina portátil", "Cable USB-C", "Cuaderno"}},
+		{`ultimaActualizacion>"2025-05-01T00:00:00Z"`, []string{"Audífonos Bluetooth"}},
+		{`ultimaActualizacion and ultimaActualizacion<"2025-06-01"`, []string{"Bocina portátil"}},
+	}
+	for _, tt := range tests {
+		if got := nombresConsulta(t, tt.expr); !slices.Equal(got, tt.want) {
+			t.Errorf("%s\n got %q\nwant %q", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestParseConsultaErrores(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{`precio<300 and`, "termina antes de tiempo"},
+		{`precio<300 or`, "termina antes de tiempo"},
+		{`not`, "termina antes de tiempo"},
+		{`and precio<300`, "campo desconocido \"and\""},
+		{`precio<300 precio>5`, "sobra \"precio\""},
+		{`precio<`, "falta el valor de precio<"},
+		{`foo=1`, "campo desconocido \"foo\""},
+		{`(precio<300`, "falta cerrar el paréntesis"},
+		{`precio<300)`, "sobra \")\""},
+		{`nombre="cable`, "falta cerrar las comillas"},
+		{`precio<"barato"`, "precio espera un número"},
+		{`enOferta>true`, "solo admite = y !="},
+		{`enOferta=si`, "espera true o false"},
+		{`precio~3`, "no admite ~"},
+		{`ultimaActualizacion>"ayer"`, "espera una fecha"},
+		{`etiquetasDerivadas="x"`, "solo se puede usar solo"},
+		{`precio ! 3`, "operador inválido"},
+		{`precio # 3`, "carácter inesperado"},
+		{`tienda in "buytiti"`, "falta la lista de valores"},
+		{`tienda in ("buytiti" "myshop")`, "falta cerrar la lista"},
+		{`tienda in ()`, "falta el valor"},
+		{`precio in (1, "x")`, "precio espera un número"},
+	}
+	for _, tt := range tests {
+		_, err := ParseConsulta(tt.expr)
+		if err == nil {
+			t.Errorf("ParseConsulta(%q): se esperaba un error", tt.expr)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ParseConsulta(%q) = %q, se esperaba %q", tt.expr, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package producto
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Conversion is a product's prices in another currency, at the exchange
+// rate of one run. The prices are named after the currency, as in
+//
+//	"conversion": {"moneda": "USD", "tipoCambio": 17.2, "fuente": "banxico",
+//	               "precioUSD": 17.39, "precioOriginalUSD": 23.2}
+//
+// so a page reading them cannot mistake one currency for another.
+type Conversion struct {
+	Moneda string
+	// TipoCambio is how many pesos one unit of Moneda costs.
+	TipoCambio     float64
+	Fuente         string
+	Precio         float64
+	PrecioOriginal float64
+}
+
+type conversionJSON struct {
+	Moneda     string  `json:"moneda"`
+	TipoCambio float64 `json:"tipoCambio"`
+	Fuente     string  `json:"fuente"`
+}
+
+func (c Conversion) MarshalJSON() ([]byte, error) {
+	head, err := json.Marshal(conversionJSON{c.Moneda, c.TipoCambio, c.Fuente})
+	if err != nil {
+		return nil, err
+	}
+	precio, _ := json.Marshal(c.Precio)
+	original, _ := json.Marshal(c.PrecioOriginal)
+	tail := fmt.Sprintf(`,"precio%[1]s":%[2]s,"precioOriginal%[1]s":%[3]s}`, c.Moneda, precio, original)
+	return append(head[:len(head)-1], tail...), nil
+}
+
+func (c *Conversion) UnmarshalJSON(data []byte) error {
+	var head conversionJSON
+	if err := json.Unmarshal(data, &head); err != nil {
+		return err
+	}
+	var prices map[string]json.RawMessage
+	if err := json.Unmarshal(data, &prices); err != nil {
+		return err
+	}
+	*c = Conversion{Moneda: head.Moneda, TipoCambio: head.TipoCambio, Fuente: head.Fuente}
+	for key, dst := range map[string]*float64{"precio": &c.Precio, "precioOriginal": &c.PrecioOriginal} {
+		if raw, ok := prices[key+strings.ToUpper(head.Moneda)]; ok {
+			if err := json.Unmarshal(raw, dst); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package producto
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Esquema renames Product's JSON fields for an output meant for other tools
+// (-schema en): it maps each Spanish name to the one written. Nested
+// objects keep their keys. A nil Esquema is the Spanish schema, which the
+// catalog sites read.
+type Esquema map[string]string
+
+// esquemas are the schemas -schema accepts.
+var esquemas = map[string]Esquema{
+	"es": nil,
+	"en": {
+		"nombre":                 "name",
+		"precio":                 "price",
+		"precioOriginal":         "originalPrice",
+		"enOferta":               "onSale",
+		"stock":                  "stock",
+		"imagen":                 "image",
+		"imagen64":               "image64",
+		"link":                   "link",
+		"categoria":              "category",
+		"subcategorias":          "subcategories",
+		"moneda":                 "currency",
+		"tienda":                 "store",
+		"variante":               "variant",
+		"etiquetasDerivadas":     "derivedTags",
+		"conversion":             "conversion",
+		"cantidadPaquete":        "packQuantity",
+		"unidad":                 "unit",
+		"precioUnitario":         "unitPrice",
+		"precioConIVA":           "priceWithVAT",
+		"precioSinIVA":           "priceWithoutVAT",
+		"mesesSinIntereses":      "interestFreeMonths",
+		"envioGratis":            "freeShipping",
+		"costoEnvio":             "shippingCost",
+		"precioCentavos":         "priceCents",
+		"precioOriginalCentavos": "originalPriceCents",
+		"ultimaActualizacion":    "lastUpdated",
+		"precioPublico":          "displayPrice",
+		"nombreEN":               "nameEN",
+		"descripcionEN":          "descriptionEN",
+	},
+}
+
+// ParseEsquema reads the -schema flag: "es" (the default) or "en".
+func ParseEsquema(name string) (Esquema, error) {
+	e, ok := esquemas[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		names := make([]string, 0, len(esquemas))
+		for n := range esquemas {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("esquema desconocido %q (válidos: %s)", name, strings.Join(names, ", "))
+	}
+	return e, nil
+}
+
+// nombre is the name e writes the Spanish field campo with.
+func (e Esquema) nombre(campo string) string {
+	if n, ok := e[campo]; ok {
+		return n
+	}
+	return campo
+}
+
+// traducida returns data, a JSON array of products written with some
+// schema, with the Spanish field names back.
+func traducida(data []byte) ([]byte, error) {
+	spanish := make(map[string]string)
+	for _, e := range esquemas {
+		for es, other := range e {
+			spanish[other] = es
+		}
+	}
+	var rows []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return nil, err
+	}
+	for i, row := range rows {
+		out := make(map[string]json.RawMessage, len(row))
+		for k, v := range row {
+			if es, ok := spanish[k]; ok {
+				k = es
+			}
+			out[k] = v
+		}
+		rows[i] = out
+	}
+	return json.Marshal(rows)
+}
+
+// enEspanol reports whether data, a productos.json, already uses the
+// Spanish schema, which is most of the time and needs no translation.
+func enEspanol(data []byte) bool {
+	return bytes.Contains(data, []byte(`"nombre"`)) || !bytes.Contains(data, []byte(`"name"`))
+}
@@ -0,0 +1,153 @@
+package producto
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Stock states counted in Facetas.Stock.
+const (
+	StockDisponible = "disponible"
+	StockAgotado    = "agotado"
+	StockSinDato    = "sin dato"
+)
+
+// limitesPrecio are the upper bounds of the price buckets; the last bucket
+// has no upper bound.
+var limitesPrecio = []float64{50, 100, 200, 500, 1000}
+
+// Faceta is one value of a filter and how many products have it.
+type Faceta struct {
+	Valor     string `json:"valor"`
+	Productos int    `json:"productos"`
+}
+
+// RangoPrecio is a price bucket: Min <= precio < Max, with Max 0 for the
+// last, open bucket.
+type RangoPrecio struct {
+	Etiqueta  string  `json:"etiqueta"`
+	Min       float64 `json:"min"`
+	Max       float64 `json:"max,omitempty"`
+	Productos int     `json:"productos"`
+}
+
+// Facetas is the content of facets.json: the counts the catalog page needs
+// to draw its filters before, or without, loading every product.
+type Facetas struct {
+	Generado  time.Time `json:"generado"`
+	Productos int       `json:"productos"`
+	// Categorias and Subcategorias are sorted by name, as the page lists
+	// them; SubcategoriasPorCategoria narrows the list to a category.
+	Categorias                []Faceta            `json:"categorias"`
+	Subcategorias             []Faceta            `json:"subcategorias"`
+	SubcategoriasPorCategoria map[string][]Faceta `json:"subcategoriasPorCategoria"`
+	Precios                   []RangoPrecio       `json:"precios"`
+	EnOferta                  int                 `json:"enOferta"`
+	Stock                     []Faceta            `json:"stock"`
+}
+
+// FacetsPath is where a scraper writes facets.json: next to its output.
+func FacetsPath(output string) string {
+	return filepath.Join(filepath.Dir(output), "facets.json")
+}
+
+// EstadoStock classifies p's stock as StockDisponible, StockAgotado or
+// StockSinDato. The scrapers write "Agotado" for anything the store marks
+// out of stock and "Desconocido" (or nothing) when the page does not say.
+func (p Product) EstadoStock() string {
+	switch {
+	case strings.TrimSpace(p.Stock) == "", strings.EqualFold(strings.TrimSpace(p.Stock), "desconocido"):
+		return StockSinDato
+	case p.Agotado():
+		return StockAgotado
+	}
+	return StockDisponible
+}
+
+// Facets counts products per category, subcategory, price bucket, sale and
+// stock state.
+func Facets(products []Product, now time.Time) Facetas {
+	f := Facetas{Generado: now, Productos: len(products), SubcategoriasPorCategoria: make(map[string][]Faceta)}
+	cats := make(map[string]int)
+	subs := make(map[string]int)
+	subsByCat := make(map[string]map[string]int)
+	stock := make(map[string]int)
+	for i := range limitesPrecio {
+		f.Precios = append(f.Precios, rangoPrecio(i))
+	}
+	f.Precios = append(f.Precios, rangoPrecio(len(limitesPrecio)))
+
+	for _, p := range products {
+		if p.Categoria != "" {
+			cats[p.Categoria]++
+		}
+		for _, s := range p.Subcategorias {
+			subs[s]++
+			if p.Categoria != "" {
+				if subsByCat[p.Categoria] == nil {
+					subsByCat[p.Categoria] = make(map[string]int)
+				}
+				subsByCat[p.Categoria][s]++
+			}
+		}
+		bucket := sort.SearchFloat64s(limitesPrecio, p.Precio)
+		if bucket < len(limitesPrecio) && limitesPrecio[bucket] == p.Precio {
+			bucket++
+		}
+		f.Precios[bucket].Productos++
+		if p.EnOferta {
+			f.EnOferta++
+		}
+		stock[p.EstadoStock()]++
+	}
+
+	f.Categorias = facetas(cats)
+	f.Subcategorias = facetas(subs)
+	for cat, counts := range subsByCat {
+		f.SubcategoriasPorCategoria[cat] = facetas(counts)
+	}
+	for _, s := range []string{StockDisponible, StockAgotado, StockSinDato} {
+		f.Stock = append(f.Stock, Faceta{Valor: s, Productos: stock[s]})
+	}
+	return f
+}
+
+func rangoPrecio(i int) RangoPrecio {
+	var r RangoPrecio
+	if i > 0 {
+		r.Min = limitesPrecio[i-1]
+	}
+	if i < len(limitesPrecio) {
+		r.Max = limitesPrecio[i]
+		r.Etiqueta = fmt.Sprintf("$%.0f – $%.0f", r.Min, r.Max)
+	} else {
+		r.Etiqueta = fmt.Sprintf("Más de $%.0f", r.Min)
+	}
+	return r
+}
+
+func facetas(counts map[string]int) []Faceta {
+	out := make([]Faceta, 0, len(counts))
+	for v, n := range counts {
+		out = append(out, Faceta{Valor: v, Productos: n})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Valor < out[j].Valor })
+	return out
+}
+
+// WriteFacets writes the facets of products to fpath.
+func WriteFacets(products []Product, fpath string, now time.Time) error {
+	data, err := json.MarshalIndent(Facets(products, now), "", "    ")
+	if err != nil {
+		return fmt.Errorf("error serializando JSON: %w", err)
+	}
+	if err := os.WriteFile(fpath, data, 0644); err != nil {
+		return fmt.Errorf("error escribiendo %s: %w", fpath, err)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package producto
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Filtro limits a run to the products that matter, as set by the scrapers'
+// -match-name, -min-price, -max-price, -only-on-sale and -in-stock-only
+// flags. The zero Filtro keeps everything.
+type Filtro struct {
+	// Nombre, when set, must match the product's name.
+	Nombre *regexp.Regexp
+	// PrecioMin and PrecioMax bound Precio; zero is no bound.
+	PrecioMin float64
+	PrecioMax float64
+	// SoloOferta keeps only products on sale.
+	SoloOferta bool
+	// SoloDisponibles drops sold-out products; those with no stock data stay.
+	SoloDisponibles bool
+}
+
+// NewFiltro builds a Filtro from the flags. The name pattern is compared
+// without case.
+func NewFiltro(nombre string, min, max float64, soloOferta bool) (Filtro, error) {
+	f := Filtro{PrecioMin: min, PrecioMax: max, SoloOferta: soloOferta}
+	if min < 0 || max < 0 {
+		return f, fmt.Errorf("precio negativo en -min-price/-max-price")
+	}
+	if max > 0 && min > max {
+		return f, fmt.Errorf("-min-price %.2f mayor que -max-price %.2f", min, max)
+	}
+	if nombre != "" {
+		re, err := regexp.Compile("(?i)" + nombre)
+		if err != nil {
+			return f, fmt.Errorf("error parsing -match-name: %w", err)
+		}
+		f.Nombre = re
+	}
+	return f, nil
+}
+
+// Activo reports whether f leaves any product out.
+func (f Filtro) Activo() bool {
+	return f.Nombre != nil || f.PrecioMin > 0 || f.PrecioMax > 0 || f.SoloOferta || f.SoloDisponibles
+}
+
+// Acepta reports whether p passes f.
+func (f Filtro) Acepta(p Product) bool {
+	switch {
+	case f.Nombre != nil && !f.Nombre.MatchString(p.Nombre):
+		return false
+	case f.PrecioMin > 0 && p.Precio < f.PrecioMin:
+		return false
+	case f.PrecioMax > 0 && p.Precio > f.PrecioMax:
+		return false
+	case f.SoloOferta && !p.EnOferta:
+		return false
+	case f.SoloDisponibles && p.EstadoStock() == StockAgotado:
+		return false
+	}
+	return true
+}
+
+// Aplicar returns the products that pass f, reusing products' storage.
+func (f Filtro) Aplicar(products []Product) []Product {
+	if !f.Activo() {
+		return products
+	}
+	out := products[:0]
+	for _, p := range products {
+		if f.Acepta(p) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
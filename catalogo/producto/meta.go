@@ -0,0 +1,33 @@
+package producto
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"time"
+)
+
+// Meta describes a productos.json as a whole. It goes beside it, in
+// MetaPath, because the catalog sites read productos.json as a bare array.
+type Meta struct {
+	Tienda string `json:"tienda"`
+	// GeneradoEn is when the scraper last wrote or confirmed the file, in
+	// the store's time zone.
+	GeneradoEn time.Time `json:"generadoEn"`
+	Productos  int       `json:"productos"`
+}
+
+// MetaPath is where the Meta of output goes (productos.json →
+// productos.meta.json).
+func MetaPath(output string) string {
+	return strings.TrimSuffix(output, ".json") + ".meta.json"
+}
+
+// WriteMeta writes m beside output.
+func WriteMeta(output string, m Meta) error {
+	data, err := json.MarshalIndent(m, "", "    ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(MetaPath(output), data, 0644)
+}
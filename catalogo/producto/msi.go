@@ -0,0 +1,28 @@
+package producto
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+)
+
+var (
+	reTags = regexp.MustCompile(`<[^>]*>`)
+	// reMSI matches the stores' financing badges: "12 MSI", "hasta 18
+	// meses sin intereses", "6 meses s/intereses".
+	reMSI = regexp.MustCompile(`(?i)\b(\d{1,2})\s*(?:MSI\b|meses\s+(?:sin|s/)\s*intereses)`)
+)
+
+// MesesSinIntereses reads the most interest-free months (meses sin
+// intereses) a product page or description offers, or 0 when it offers
+// none. Tags in between ("12 <b>MSI</b>") are ignored.
+func MesesSinIntereses(page string) int {
+	text := html.UnescapeString(reTags.ReplaceAllString(page, " "))
+	best := 0
+	for _, m := range reMSI.FindAllStringSubmatch(text, -1) {
+		if n, _ := strconv.Atoi(m[1]); n <= 48 {
+			best = max(best, n)
+		}
+	}
+	return best
+}
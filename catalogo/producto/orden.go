@@ -0,0 +1,124 @@
+package producto
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// OrdenPredeterminado is the order of the outputs without -sort: by
+// category, then name.
+const OrdenPredeterminado = "categoria,nombre"
+
+// Orden is the sort order of an output, set by the scrapers' -sort flag: a
+// list of Product's JSON fields, each descending when prefixed with "-".
+// Later keys break the ties of earlier ones.
+type Orden []claveOrden
+
+type claveOrden struct {
+	campo int
+	desc  bool
+}
+
+// ordenables lists the JSON fields an Orden can use, in schema order.
+var ordenables = func() []string {
+	var names []string
+	for _, name := range ordenProduct {
+		if ordenable(name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}()
+
+var tipoTime = reflect.TypeFor[time.Time]()
+
+// ordenable reports whether the field has an order: text, numbers,
+// booleans and times.
+func ordenable(name string) bool {
+	f := reflect.TypeFor[Product]().Field(camposProduct[name])
+	switch f.Type.Kind() {
+	case reflect.String, reflect.Float64, reflect.Int, reflect.Int64, reflect.Bool:
+		return true
+	}
+	return f.Type == tipoTime
+}
+
+// ParseOrden reads a comma-separated list of sort keys ("precio,-nombre").
+// An empty list is OrdenPredeterminado.
+func ParseOrden(list string) (Orden, error) {
+	if strings.TrimSpace(list) == "" {
+		list = OrdenPredeterminado
+	}
+	var o Orden
+	for key := range strings.SplitSeq(list, ",") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		name := strings.TrimLeft(key, "+-")
+		i, ok := camposProduct[name]
+		if !ok || !ordenable(name) {
+			return nil, fmt.Errorf("campo de orden inválido %q (válidos: %s)", name, strings.Join(ordenables, ", "))
+		}
+		o = append(o, claveOrden{campo: i, desc: strings.HasPrefix(key, "-")})
+	}
+	return o, nil
+}
+
+// Ordenar sorts products by o, keeping the relative order of products
+// equal in every key.
+func (o Orden) Ordenar(products []Product) {
+	sort.SliceStable(products, func(i, j int) bool {
+		a, b := reflect.ValueOf(&products[i]).Elem(), reflect.ValueOf(&products[j]).Elem()
+		for _, k := range o {
+			c := comparar(a.Field(k.campo), b.Field(k.campo))
+			if c == 0 {
+				continue
+			}
+			if k.desc {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+}
+
+// comparar returns -1, 0 or 1 as a is less than, equal to or greater than b.
+func comparar(a, b reflect.Value) int {
+	if a.Type() == tipoTime {
+		return a.Interface().(time.Time).Compare(b.Interface().(time.Time))
+	}
+	switch a.Kind() {
+	case reflect.String:
+		return strings.Compare(a.String(), b.String())
+	case reflect.Float64:
+		x, y := a.Float(), b.Float()
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	case reflect.Int, reflect.Int64:
+		x, y := a.Int(), b.Int()
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	case reflect.Bool:
+		x, y := a.Bool(), b.Bool()
+		switch {
+		case !x && y:
+			return -1
+		case x && !y:
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,86 @@
+package producto
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Formato is how a store writes the prices it shows: "1,234.56" in Mexico,
+// "1.234,56" in most of Europe and South America. Each scraper reads its
+// store's with the -price-locale flag.
+type Formato struct {
+	Nombre  string
+	Decimal rune
+	Miles   rune
+}
+
+var (
+	// FormatoMX is Mexico's and the US's: decimal point, thousands comma.
+	FormatoMX = Formato{Nombre: "es-MX", Decimal: '.', Miles: ','}
+	// FormatoEU is continental Europe's and most of South America's:
+	// decimal comma, thousands point.
+	FormatoEU = Formato{Nombre: "es-ES", Decimal: ',', Miles: '.'}
+	// FormatoMaquina is the one of machine-readable prices, like
+	// schema.org's itemprop="price": a decimal point and nothing else.
+	FormatoMaquina = Formato{Nombre: "máquina", Decimal: '.'}
+)
+
+// formatos maps locale tags, lowercased, to their price format.
+var formatos = map[string]Formato{
+	"es-mx": FormatoMX, "en-us": FormatoMX, "en": FormatoMX, "mx": FormatoMX,
+	"es-es": FormatoEU, "es-ar": FormatoEU, "es-co": FormatoEU, "es-cl": FormatoEU,
+	"pt-br": FormatoEU, "de-de": FormatoEU, "it-it": FormatoEU, "fr-fr": FormatoEU,
+	"eu": FormatoEU,
+}
+
+// ParseFormato reads a locale tag ("es-MX", "es_ES") into its price format.
+func ParseFormato(locale string) (Formato, error) {
+	f, ok := formatos[strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))]
+	if !ok {
+		return Formato{}, fmt.Errorf("locale de precios desconocido %q (es-MX, en-US, es-ES, pt-BR, ...)", locale)
+	}
+	return f, nil
+}
+
+// Parse reads a price as shown in f ("$1,234.56", "1.234,56 €", "MXN 99").
+// Currency symbols and codes and any space, non-breaking ones included, are
+// ignored. A price that does not fit f is an error rather than a number off
+// by a factor of a thousand: a decimal separator after a thousands one, two
+// decimal separators, or thousands groups of other than three digits.
+func (f Formato) Parse(s string) (float64, error) {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= '0' && r <= '9' || r == '.' || r == ',' {
+			b.WriteRune(r)
+		}
+	}
+	num := strings.TrimRight(b.String(), ".,")
+	if num == "" {
+		return 0, fmt.Errorf("precio %q sin dígitos", s)
+	}
+	bad := fmt.Errorf("precio %q no tiene el formato %s", s, f.Nombre)
+	whole, frac, hasFrac := strings.Cut(num, string(f.Decimal))
+	if hasFrac && strings.ContainsAny(frac, ".,") {
+		return 0, bad
+	}
+	if f.Miles != 0 && strings.ContainsRune(whole, f.Miles) {
+		groups := strings.Split(whole, string(f.Miles))
+		if len(groups[0]) > 3 {
+			return 0, bad
+		}
+		for _, g := range groups[1:] {
+			if len(g) != 3 {
+				return 0, bad
+			}
+		}
+		whole = strings.Join(groups, "")
+	}
+	if strings.ContainsAny(whole, ".,") {
+		return 0, bad
+	}
+	if hasFrac {
+		whole += "." + frac
+	}
+	return strconv.ParseFloat(whole, 64)
+}
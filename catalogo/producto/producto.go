@@ -0,0 +1,166 @@
+// Package producto holds the catalog schema shared by every store scraper
+// and the helpers that read and export it.
+package producto
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"catalogo/texto"
+)
+
+// Product is one entry of productos.json. Field names are part of the public
+// contract with the static catalog sites, so they stay in Spanish.
+type Product struct {
+	Nombre         string   `json:"nombre"`
+	Precio         float64  `json:"precio"`
+	PrecioOriginal float64  `json:"precioOriginal"`
+	EnOferta       bool     `json:"enOferta"`
+	Stock          string   `json:"stock"`
+	Imagen         string   `json:"imagen"`
+	Imagen64       string   `json:"imagen64"`
+	Link           string   `json:"link"`
+	Categoria      string   `json:"categoria"`
+	Subcategorias  []string `json:"subcategorias"`
+	// Moneda is the ISO 4217 code of the prices, as the store reports it.
+	Moneda string `json:"moneda,omitempty"`
+	// Tienda is the id of the store the product was scraped from, as in
+	// catalogo.json.
+	Tienda string `json:"tienda,omitempty"`
+	// Variante names the attribute values of a variant listed on its own
+	// (-expand-variants), e.g. "Color: Rojo".
+	Variante string `json:"variante,omitempty"`
+	// EtiquetasDerivadas are the business tags the "etiquetas" rules of
+	// catalogo.json derive from the price, store and category.
+	EtiquetasDerivadas map[string]string `json:"etiquetasDerivadas,omitempty"`
+	// Conversion is Precio and PrecioOriginal in the currency of the
+	// scrapers' -convert-to flag.
+	Conversion *Conversion `json:"conversion,omitempty"`
+	// CantidadPaquete and Unidad are the quantity the listing sells, read
+	// from its name by SetUnitPrice, and PrecioUnitario is Precio per unit.
+	CantidadPaquete float64 `json:"cantidadPaquete,omitempty"`
+	Unidad          string  `json:"unidad,omitempty"`
+	PrecioUnitario  float64 `json:"precioUnitario,omitempty"`
+	// PrecioConIVA and PrecioSinIVA are Precio with and without IVA,
+	// whichever the store shows, as its catalogo.json entry says.
+	PrecioConIVA float64 `json:"precioConIVA,omitempty"`
+	PrecioSinIVA float64 `json:"precioSinIVA,omitempty"`
+	// MesesSinIntereses is the most interest-free months the store offers
+	// for the product, 0 when it offers none or does not say.
+	MesesSinIntereses int `json:"mesesSinIntereses,omitempty"`
+	// EnvioGratis reports whether the store ships the product free, by its
+	// badge or the store's threshold; otherwise CostoEnvio is the shipping
+	// estimated from the store's rates in catalogo.json, if any.
+	EnvioGratis bool    `json:"envioGratis,omitempty"`
+	CostoEnvio  float64 `json:"costoEnvio,omitempty"`
+	// PrecioCentavos and PrecioOriginalCentavos are Precio and
+	// PrecioOriginal as integers in the currency's minor unit (-price-cents),
+	// for consumers that must not read prices as floating point.
+	PrecioCentavos         int64 `json:"precioCentavos,omitempty"`
+	PrecioOriginalCentavos int64 `json:"precioOriginalCentavos,omitempty"`
+	// UltimaActualizacion is when the scraper last found the product's data
+	// different, in the store's time zone.
+	UltimaActualizacion time.Time `json:"ultimaActualizacion,omitzero"`
+	// PrecioPublico is the price the catalog sites show, Precio rounded by
+	// the store's "precioPublico" policy in catalogo.json; zero without one.
+	PrecioPublico float64 `json:"precioPublico,omitempty"`
+	// NombreEN and DescripcionEN are the product's name and description in
+	// English, for the bilingual site, when the store publishes a
+	// translation and the scraper runs with -lang-en.
+	NombreEN      string `json:"nombreEN,omitempty"`
+	DescripcionEN string `json:"descripcionEN,omitempty"`
+}
+
+// MonedaBase is the currency of the stores the catalog started with, and of
+// catalogs scraped before Moneda existed.
+const MonedaBase = "MXN"
+
+// Divisa is the currency of p's prices: Moneda, or MonedaBase when the
+// product does not say.
+func (p Product) Divisa() string {
+	if p.Moneda == "" {
+		return MonedaBase
+	}
+	return p.Moneda
+}
+
+// Agotado reports whether the store marks the product as out of stock.
+func (p Product) Agotado() bool {
+	return strings.EqualFold(strings.TrimSpace(p.Stock), "agotado")
+}
+
+// Validate reports why p does not belong in a catalog, if it does not.
+func (p Product) Validate() error {
+	switch {
+	case strings.TrimSpace(p.Nombre) == "":
+		return errors.New("sin nombre")
+	case strings.TrimSpace(p.Link) == "":
+		return errors.New("sin link")
+	case p.Precio < 0 || p.PrecioOriginal < 0:
+		return errors.New("precio negativo")
+	}
+	return nil
+}
+
+// Slug is the last path segment of a product link. The catalog pages use it
+// as the product's id: ?producto= shows that product alone, and
+// similares.json lists alternatives by it.
+func Slug(link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	return path.Base(strings.TrimSuffix(u.Path, "/"))
+}
+
+// PartialPath is where a scraper leaves the products it gathered when the run
+// fails before writing output (productos.json → productos.partial.json).
+func PartialPath(output string) string {
+	return strings.TrimSuffix(output, ".json") + ".partial.json"
+}
+
+// Hash fingerprints a product set regardless of its order, so a run that
+// found exactly what the previous one did can be told apart from a real
+// change.
+func Hash(products []Product) string {
+	lines := make([]string, len(products))
+	for i, p := range products {
+		b, _ := json.Marshal(p)
+		lines[i] = string(b)
+	}
+	sort.Strings(lines)
+	h := sha256.New()
+	for _, line := range lines {
+		h.Write([]byte(line))
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ReadJSON loads a product list previously written by a scraper.
+func ReadJSON(fpath string) ([]Product, error) {
+	data, err := os.ReadFile(fpath)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo %s: %w", fpath, err)
+	}
+	data = texto.SinBOM(data)
+	if !enEspanol(data) {
+		if data, err = traducida(data); err != nil {
+			return nil, fmt.Errorf("error parsing %s: %w", fpath, err)
+		}
+	}
+	var products []Product
+	if err := json.Unmarshal(data, &products); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", fpath, err)
+	}
+	return products, nil
+}
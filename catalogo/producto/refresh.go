@@ -0,0 +1,126 @@
+package producto
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"catalogo/canonurl"
+)
+
+// ReadLinks reads product links from a watch file, one per line. Blank lines
+// and lines starting with # are ignored.
+func ReadLinks(fpath string) ([]string, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return nil, fmt.Errorf("error abriendo %s: %w", fpath, err)
+	}
+	defer f.Close()
+
+	var links []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		links = append(links, line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("error leyendo %s: %w", fpath, err)
+	}
+	return links, nil
+}
+
+// RefreshPriceStock copies the fields that move between full runs (prices
+// and their currency, offer flag, stock and free-shipping badge) from fresh
+// into p, updates the unit price to match
+// and reports whether any changed.
+func (p *Product) RefreshPriceStock(fresh Product) bool {
+	changed := p.Precio != fresh.Precio || p.PrecioOriginal != fresh.PrecioOriginal ||
+		p.EnOferta != fresh.EnOferta || p.Stock != fresh.Stock || p.Moneda != fresh.Moneda ||
+		p.EnvioGratis != fresh.EnvioGratis
+	p.Precio = fresh.Precio
+	p.PrecioOriginal = fresh.PrecioOriginal
+	p.EnOferta = fresh.EnOferta
+	p.Stock = fresh.Stock
+	p.Moneda = fresh.Moneda
+	p.EnvioGratis = fresh.EnvioGratis
+	p.SetUnitPrice()
+	return changed
+}
+
+// RefreshStats summarizes a Refresh pass.
+type RefreshStats struct {
+	Actualizados int
+	SinCambios   int
+	Fallidos     int
+	Desconocidos int
+}
+
+// Refresh re-fetches the products whose link is in links using fetch, with
+// the given number of workers and per-worker delay, and updates their price
+// and stock in place. Links not present in products are counted as unknown:
+// without a full run we don't know their category.
+func Refresh(products []Product, links []string, workers int, delay time.Duration, fetch func(Product) (Product, error)) RefreshStats {
+	index := make(map[string]int, len(products))
+	for i, p := range products {
+		index[canonurl.Key(p.Link)] = i
+	}
+
+	var stats RefreshStats
+	var mu sync.Mutex
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range max(1, workers) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				fresh, err := safeFetch(fetch, products[i])
+				mu.Lock()
+				switch {
+				case err != nil:
+					stats.Fallidos++
+				case products[i].RefreshPriceStock(fresh):
+					stats.Actualizados++
+				default:
+					stats.SinCambios++
+				}
+				mu.Unlock()
+				time.Sleep(delay)
+			}
+		}()
+	}
+
+	seen := make(map[int]bool)
+	for _, link := range links {
+		i, ok := index[canonurl.Key(link)]
+		if !ok {
+			stats.Desconocidos++
+			continue
+		}
+		if seen[i] {
+			continue
+		}
+		seen[i] = true
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return stats
+}
+
+// safeFetch calls fetch, reporting a panic as an error so that one bad page
+// doesn't kill its worker and strand the remaining links.
+func safeFetch(fetch func(Product) (Product, error), p Product) (fresh Product, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fetch(p)
+}
@@ -0,0 +1,28 @@
+package producto
+
+import (
+	"math"
+
+	"catalogo/texto"
+)
+
+// UnidadPieza is the unit of listings sold by the piece.
+const UnidadPieza = "pieza"
+
+// SetUnitPrice reads the quantity p sells from its name ("paquete 10 pzas",
+// "3 metros", "500 ml") and sets CantidadPaquete, Unidad and PrecioUnitario.
+// A piece count wins over a measure: a pack of ten 1 m cables is priced per
+// cable. The three fields are cleared when the name states no quantity.
+func (p *Product) SetUnitPrice() {
+	p.CantidadPaquete, p.Unidad, p.PrecioUnitario = 0, "", 0
+	n := texto.Parse(p.Nombre)
+	switch {
+	case n.Piezas > 0:
+		p.CantidadPaquete, p.Unidad = float64(n.Piezas), UnidadPieza
+	case n.Unidad != "":
+		p.CantidadPaquete, p.Unidad = n.Cantidad, n.Unidad
+	default:
+		return
+	}
+	p.PrecioUnitario = math.Round(p.Precio/p.CantidadPaquete*10000) / 10000
+}
@@ -0,0 +1,67 @@
+package producto
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Variantes is how a scraper lists a product sold in variants (color, size,
+// ...): once, as the store's parent product, or once per variant with its
+// own price and stock. The scrapers' -parents-only and -expand-variants
+// flags choose it.
+type Variantes int
+
+const (
+	// SoloPadres lists the parent product only, as the store's listings do.
+	SoloPadres Variantes = iota
+	// Expandir lists each variant instead of its parent.
+	Expandir
+)
+
+// ModoVariantes reads the -expand-variants and -parents-only flags.
+func ModoVariantes(expand, parentsOnly bool) (Variantes, error) {
+	switch {
+	case expand && parentsOnly:
+		return SoloPadres, fmt.Errorf("-expand-variants y -parents-only se excluyen")
+	case expand:
+		return Expandir, nil
+	}
+	return SoloPadres, nil
+}
+
+// Atributo is one attribute value that tells a variant apart.
+type Atributo struct {
+	Nombre string
+	Valor  string
+}
+
+// ComoVariante returns p as its variant with the given attribute values and
+// link: the values go in Variante ("Color: Rojo, Talla: M") and after the
+// name, and its English name, so the variants of a product can be told
+// apart in any listing.
+func (p Product) ComoVariante(attrs []Atributo, link string) Product {
+	parts := make([]string, 0, len(attrs))
+	values := make([]string, 0, len(attrs))
+	for _, a := range attrs {
+		if a.Valor == "" {
+			continue
+		}
+		values = append(values, a.Valor)
+		if a.Nombre != "" {
+			parts = append(parts, a.Nombre+": "+a.Valor)
+		} else {
+			parts = append(parts, a.Valor)
+		}
+	}
+	v := p
+	v.Subcategorias = append([]string(nil), p.Subcategorias...)
+	v.Link = link
+	if len(values) > 0 {
+		v.Variante = strings.Join(parts, ", ")
+		v.Nombre = p.Nombre + " - " + strings.Join(values, " / ")
+		if p.NombreEN != "" {
+			v.NombreEN = p.NombreEN + " - " + strings.Join(values, " / ")
+		}
+	}
+	return v
+}
@@ -0,0 +1,91 @@
+package producto
+
+import (
+	"crypto/sha1"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// whatsappHeader follows the Meta Commerce Manager data-feed columns, which is
+// what the WhatsApp Business catalog import accepts.
+var whatsappHeader = []string{"id", "title", "description", "availability", "condition", "price", "link", "image_link", "brand"}
+
+// WriteWhatsAppCSV writes products in the WhatsApp Business catalog CSV format.
+// Prices are emitted as "124.00 MXN"; brand is the store name shown in the catalog.
+func WriteWhatsAppCSV(products []Product, fpath, currency, brand string) error {
+	f, err := os.Create(fpath)
+	if err != nil {
+		return fmt.Errorf("error creando CSV: %w", err)
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	if err := w.Write(whatsappHeader); err != nil {
+		return fmt.Errorf("error escribiendo CSV: %w", err)
+	}
+	for _, p := range products {
+		if p.Nombre == "" || p.Link == "" {
+			continue
+		}
+		record := []string{
+			whatsappID(p.Link),
+			truncate(p.Nombre, 150),
+			whatsappDescription(p),
+			whatsappAvailability(p),
+			"new",
+			fmt.Sprintf("%.2f %s", p.Precio, currency),
+			p.Link,
+			p.Imagen,
+			brand,
+		}
+		if err := w.Write(record); err != nil {
+			return fmt.Errorf("error escribiendo CSV: %w", err)
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("error escribiendo CSV: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("error escribiendo CSV: %w", err)
+	}
+	return nil
+}
+
+// whatsappID derives a stable content ID from the product link, so re-imports
+// update existing catalog items instead of duplicating them.
+func whatsappID(link string) string {
+	sum := sha1.Sum([]byte(link))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// whatsappDescription builds a description from the fields we have, since
+// neither store exposes one in the data we scrape.
+func whatsappDescription(p Product) string {
+	parts := []string{p.Nombre}
+	if p.Categoria != "" {
+		parts = append(parts, "Categoría: "+p.Categoria)
+	}
+	if p.EnOferta && p.PrecioOriginal > p.Precio {
+		parts = append(parts, fmt.Sprintf("Antes $%.2f", p.PrecioOriginal))
+	}
+	return truncate(strings.Join(parts, ". "), 5000)
+}
+
+func whatsappAvailability(p Product) string {
+	if p.Agotado() {
+		return "out of stock"
+	}
+	return "in stock"
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n])
+}
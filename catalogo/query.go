@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"catalogo/producto"
+)
+
+// camposTabla are the columns of catalogo query's table and CSV without
+// -campos.
+const camposTabla = "nombre,precio,stock,link,categoria"
+
+// runQuery prints the products of a catalog that match a filter
+// expression, as a table, JSON or CSV, so a question about the catalog
+// does not need jq.
+func runQuery(args []string) error {
+	fs := flag.NewFlagSet("query", flag.ContinueOnError)
+	data := fs.String("data", "productos.json", "Catálogos a consultar, separados por coma")
+	formato := fs.String("formato", "tabla", "Formato de salida: tabla, json o csv")
+	campos := fs.String("campos", "", "Campos a mostrar separados por coma (tabla y csv: "+camposTabla+"; json: todos)")
+	sortBy := fs.String("sort", "", "Ordenar por estos campos, \"-\" para descendente (ej. precio,-nombre); vacío conserva el orden del archivo")
+	limite := fs.Int("limite", 0, "Mostrar solo los primeros N productos (0 = todos)")
+	output := fs.String("o", "", "Archivo donde escribir el resultado (vacío = la salida estándar)")
+	exprs, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if *formato != "tabla" && *formato != "json" && *formato != "csv" {
+		return fmt.Errorf("-formato inválido %q (tabla, json o csv)", *formato)
+	}
+	q, err := producto.ParseConsulta(strings.Join(exprs, " "))
+	if err != nil {
+		return err
+	}
+	list := *campos
+	if list == "" && *formato != "json" {
+		list = camposTabla
+	}
+	fields, err := producto.ParseCampos(list)
+	if err != nil {
+		return fmt.Errorf("-campos: %w", err)
+	}
+	var orden producto.Orden
+	if *sortBy != "" {
+		if orden, err = producto.ParseOrden(*sortBy); err != nil {
+			return fmt.Errorf("-sort: %w", err)
+		}
+	}
+
+	var products []producto.Product
+	total := 0
+	for fpath := range strings.SplitSeq(*data, ",") {
+		if fpath = strings.TrimSpace(fpath); fpath == "" {
+			continue
+		}
+		catalog, err := producto.ReadJSON(fpath)
+		if err != nil {
+			return err
+		}
+		total += len(catalog)
+		products = append(products, q.Filtrar(catalog)...)
+	}
+	orden.Ordenar(products)
+	log.Printf("[QUERY]  %d de %d productos", len(products), total)
+	if *limite > 0 && len(products) > *limite {
+		products = products[:*limite]
+	}
+
+	w := io.Writer(os.Stdout)
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("error creando %s: %w", *output, err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := writeQuery(w, products, fields, *formato); err != nil {
+		return fmt.Errorf("error escribiendo el resultado: %w", err)
+	}
+	return nil
+}
+
+func writeQuery(w io.Writer, products []producto.Product, fields producto.Campos, formato string) error {
+	switch formato {
+	case "json":
+		data, err := fields.Marshal(products, nil)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(data, '\n'))
+		return err
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write(fields)
+		for _, p := range products {
+			cw.Write(fields.Textos(p))
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.ToUpper(strings.Join(fields, "\t")))
+	for _, p := range products {
+		row := fields.Textos(p)
+		for i, v := range row {
+			// One line per product, even for long names or lists
+			row[i] = strings.NewReplacer("\t", " ", "\n", " ").Replace(v)
+		}
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
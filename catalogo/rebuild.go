@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"catalogo/canonurl"
+	"catalogo/producto"
+	"catalogo/spill"
+)
+
+// runRebuild reconstitutes a catalog from what an interrupted run left
+// behind: spill files (NDJSON) and partial outputs (JSON arrays).
+func runRebuild(args []string) error {
+	fs := flag.NewFlagSet("rebuild", flag.ContinueOnError)
+	from := fs.String("from", "", "Archivos de origen separados por coma: spill .ndjson o productos.partial.json (los posteriores ganan)")
+	output := fs.String("o", "", "Archivo productos.json a escribir")
+	force := fs.Bool("force", false, "Sobrescribir la salida si ya existe")
+	sortKeys := fs.String("sort", producto.OrdenPredeterminado, "Orden de la salida: campos separados por coma, con - para descendente (ej. precio,-nombre)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	order, err := producto.ParseOrden(*sortKeys)
+	if err != nil {
+		return fmt.Errorf("-sort: %w", err)
+	}
+	if *from == "" || *output == "" {
+		return fmt.Errorf("uso: catalogo rebuild -from spill.ndjson[,...] -o productos.json")
+	}
+	if _, err := os.Stat(*output); err == nil && !*force {
+		return fmt.Errorf("%s ya existe; usa -force para sobrescribirlo", *output)
+	}
+
+	// Dedupe by link; a later source replaces an earlier one
+	var products []producto.Product
+	index := make(map[string]int)
+	for fpath := range strings.SplitSeq(*from, ",") {
+		fpath = strings.TrimSpace(fpath)
+		read, err := readRebuildSource(fpath)
+		if err != nil {
+			return err
+		}
+		log.Printf("[REBUILD] %s: %d productos", fpath, len(read))
+		for _, p := range read {
+			key := canonurl.Key(p.Link)
+			if i, ok := index[key]; ok {
+				products[i] = p
+				continue
+			}
+			index[key] = len(products)
+			products = append(products, p)
+		}
+	}
+
+	valid := products[:0]
+	for _, p := range products {
+		if err := p.Validate(); err != nil {
+			log.Printf("[REBUILD] Descartado %q (%s): %v", p.Nombre, p.Link, err)
+			continue
+		}
+		valid = append(valid, p)
+	}
+	if len(valid) == 0 {
+		return errors.New("ningún producto válido en los archivos de origen")
+	}
+
+	order.Ordenar(valid)
+	data, err := json.MarshalIndent(valid, "", "    ")
+	if err != nil {
+		return fmt.Errorf("error serializando JSON: %w", err)
+	}
+	if err := os.WriteFile(*output, data, 0644); err != nil {
+		return fmt.Errorf("error escribiendo %s: %w", *output, err)
+	}
+	log.Printf("[REBUILD] %d productos escritos en %s (%d descartados)", len(valid), *output, len(products)-len(valid))
+	return nil
+}
+
+// readRebuildSource reads a JSON array of products or, failing that, a spill
+// file with one product per line.
+func readRebuildSource(fpath string) ([]producto.Product, error) {
+	data, err := os.ReadFile(fpath)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo %s: %w", fpath, err)
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		return producto.ReadJSON(fpath)
+	}
+	products, err := spill.Read(fpath)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo %s: %w", fpath, err)
+	}
+	return products, nil
+}
@@ -0,0 +1,105 @@
+// Package redondeo derives the price the catalog sites show (precioPublico)
+// from the scraped one by a store's rounding policy in catalogo.json, such
+// as rounding up to the next .90 or to the nearest peso, while Precio keeps
+// what the store asks.
+package redondeo
+
+import (
+	"fmt"
+	"math"
+
+	"catalogo/producto"
+	"catalogo/tienda"
+)
+
+// Regla rounds the prices up to Hasta with Redondeo, one of
+//
+//	".90"  up to the next price ending in .90 (123.10 → 123.90)
+//	".99"  up to the next price ending in .99 (123.10 → 123.99)
+//	"peso" to the nearest peso (123.49 → 123, 123.50 → 124)
+type Regla struct {
+	// Hasta is the top price the rule covers, inclusive; zero is no top.
+	Hasta    float64 `json:"hasta"`
+	Redondeo string  `json:"redondeo"`
+}
+
+// Politica is a store's "precioPublico" section of catalogo.json: rules by
+// price, the first whose Hasta the price does not exceed applying, e.g.
+//
+//	"precioPublico": [{"hasta": 100, "redondeo": "peso"}, {"redondeo": ".90"}]
+//
+// Prices no rule covers are shown as scraped.
+type Politica []Regla
+
+// Validate rejects unknown roundings and rules out of order.
+func (pol Politica) Validate() error {
+	for i, r := range pol {
+		if _, ok := redondeos[r.Redondeo]; !ok {
+			return fmt.Errorf("precioPublico: redondeo desconocido %q (.90, .99 o peso)", r.Redondeo)
+		}
+		if r.Hasta < 0 {
+			return fmt.Errorf("precioPublico: regla #%d con hasta negativo", i+1)
+		}
+		if i > 0 && (r.Hasta != 0 && r.Hasta <= pol[i-1].Hasta || pol[i-1].Hasta == 0) {
+			return fmt.Errorf("precioPublico: las reglas deben ir de menor a mayor, con la abierta al final")
+		}
+	}
+	return nil
+}
+
+// redondeos round a price in cents.
+var redondeos = map[string]func(int64) int64{
+	".90":  terminacion(90),
+	".99":  terminacion(99),
+	"peso": func(c int64) int64 { return (c + 50) / 100 * 100 },
+}
+
+// terminacion rounds up to the next price whose cents are cents.
+func terminacion(cents int64) func(int64) int64 {
+	return func(c int64) int64 {
+		n := c / 100 * 100
+		if c%100 > cents {
+			n += 100
+		}
+		return n + cents
+	}
+}
+
+// Publico is precio as shown under pol, and whether a rule covered it.
+func (pol Politica) Publico(precio float64) (float64, bool) {
+	for _, r := range pol {
+		if r.Hasta == 0 || precio <= r.Hasta {
+			c := int64(math.Round(precio * 100))
+			return float64(redondeos[r.Redondeo](c)) / 100, true
+		}
+	}
+	return 0, false
+}
+
+// Aplicar sets the PrecioPublico of every product with a price a rule
+// covers, and clears it for the rest.
+func (pol Politica) Aplicar(products []producto.Product) {
+	for i := range products {
+		p := &products[i]
+		p.PrecioPublico = 0
+		if p.Precio > 0 {
+			p.PrecioPublico, _ = pol.Publico(p.Precio)
+		}
+	}
+}
+
+// Leer returns the "precioPublico" policy of the store id in the
+// configuration file fpath (catalogo.json). A missing file or store has
+// none.
+func Leer(fpath, id string) (Politica, error) {
+	var s struct {
+		Politica Politica `json:"precioPublico"`
+	}
+	if err := tienda.Leer(fpath, id, &s); err != nil {
+		return nil, err
+	}
+	if err := s.Politica.Validate(); err != nil {
+		return nil, fmt.Errorf("tienda %s: %w", id, err)
+	}
+	return s.Politica, nil
+}
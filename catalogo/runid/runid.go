@@ -0,0 +1,51 @@
+// Package runid identifies runs and the tasks inside them, so the logs,
+// metrics and reports of stores scraped side by side by the same daemon can
+// be told apart.
+package runid
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+	"sync/atomic"
+)
+
+// EnvVar passes the run ID from the daemon to the scraper it starts.
+const EnvVar = "CATALOGO_RUN_ID"
+
+// New returns a random (version 4) UUID.
+func New() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// FromEnv returns the run ID set by the daemon, or a new one for runs
+// started by hand.
+func FromEnv() string {
+	if id := os.Getenv(EnvVar); id != "" {
+		return id
+	}
+	return New()
+}
+
+// Short is the prefix of id used in log lines.
+func Short(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
+
+// Seq hands out task IDs ("t1", "t2", …) unique within a run. The zero value
+// is ready to use and safe for concurrent use.
+type Seq struct {
+	n atomic.Int64
+}
+
+// Next returns the next task ID.
+func (s *Seq) Next() string {
+	return fmt.Sprintf("t%d", s.n.Add(1))
+}
@@ -0,0 +1,150 @@
+// Package secretos reads the credentials of the scrapers and the catalogo
+// commands (exchange-rate tokens, API keys of stores and search services)
+// and keeps them out of what the runs write. Each secret is named by an
+// environment variable, NAME, and is read from the first of
+//
+//	NAME          the variable itself
+//	NAME_FILE     a file only its owner can read (chmod 600)
+//	NAME_COMMAND  the output of a command, such as "pass show catalogo/banxico"
+//
+// Every value read is masked from then on in the log (Filtrar) and in the
+// audit and status files (Ocultar).
+package secretos
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Mascara replaces a secret wherever it would be written.
+const Mascara = "[secreto]"
+
+// TimeoutComando bounds a NAME_COMMAND.
+const TimeoutComando = 30 * time.Second
+
+// minimo is the shortest value masked; shorter ones would mask common text
+// and are no credential anyway.
+const minimo = 4
+
+var (
+	mu      sync.RWMutex
+	valores []string
+)
+
+// Leer returns the secret named nombre, or "" when none of its sources is
+// set. A file readable by others or a failing command is an error, which
+// never includes the value.
+func Leer(nombre string) (string, error) {
+	v, err := leer(nombre)
+	if err != nil {
+		return "", fmt.Errorf("secreto %s: %w", nombre, err)
+	}
+	Registrar(v)
+	return v, nil
+}
+
+func leer(nombre string) (string, error) {
+	if v := os.Getenv(nombre); v != "" {
+		return v, nil
+	}
+	if fpath := os.Getenv(nombre + "_FILE"); fpath != "" {
+		return leerArchivo(fpath)
+	}
+	if cmd := os.Getenv(nombre + "_COMMAND"); cmd != "" {
+		return ejecutar(cmd)
+	}
+	return "", nil
+}
+
+func leerArchivo(fpath string) (string, error) {
+	info, err := os.Stat(fpath)
+	if err != nil {
+		return "", err
+	}
+	// Windows has no permission bits to check
+	if perm := info.Mode().Perm(); runtime.GOOS != "windows" && perm&0o077 != 0 {
+		return "", fmt.Errorf("%s tiene permisos %v; debe ser legible solo por su dueño (chmod 600)", fpath, perm)
+	}
+	data, err := os.ReadFile(fpath)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// ejecutar runs cmd, split on spaces without a shell, and returns its
+// output. Its stderr goes to ours, for password prompts and errors.
+func ejecutar(cmd string) (string, error) {
+	args := strings.Fields(cmd)
+	if len(args) == 0 {
+		return "", errors.New("comando vacío")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), TimeoutComando)
+	defer cancel()
+	c := exec.CommandContext(ctx, args[0], args[1:]...)
+	c.Stderr = os.Stderr
+	out, err := c.Output()
+	if err != nil {
+		return "", fmt.Errorf("comando %q: %w", args[0], err)
+	}
+	v := strings.TrimSpace(string(out))
+	if v == "" {
+		return "", errors.New("el comando no devolvió nada")
+	}
+	return v, nil
+}
+
+// Registrar adds v to the values masked, for secrets that reach the program
+// by other means.
+func Registrar(v string) {
+	if len(v) < minimo {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, s := range valores {
+		if s == v {
+			return
+		}
+	}
+	valores = append(valores, v)
+}
+
+// Ocultar returns s with every secret read replaced by Mascara.
+func Ocultar(s string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, v := range valores {
+		s = strings.ReplaceAll(s, v, Mascara)
+	}
+	return s
+}
+
+// Filtrar returns a writer that masks the secrets in what it writes to w.
+// The log package writes each entry in one call, so none is split across
+// two writes.
+func Filtrar(w io.Writer) io.Writer { return filtro{w} }
+
+type filtro struct{ w io.Writer }
+
+func (f filtro) Write(p []byte) (int, error) {
+	mu.RLock()
+	masked := p
+	for _, v := range valores {
+		masked = bytes.ReplaceAll(masked, []byte(v), []byte(Mascara))
+	}
+	mu.RUnlock()
+	if _, err := f.w.Write(masked); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
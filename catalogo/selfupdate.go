@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"catalogo/secretos"
+)
+
+// releaseRepo is the GitHub repository whose releases self-update installs.
+const releaseRepo = "AlejandroGMota/Accesorios-compras"
+
+// checksumsAsset is the release asset with the SHA-256 of every binary, in
+// sha256sum's format; a binary not listed in it is not installed.
+const checksumsAsset = "SHA256SUMS"
+
+type release struct {
+	TagName string `json:"tag_name"`
+	Assets  []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+// assetURL is the download URL of the release asset named name.
+func (r release) assetURL(name string) (string, bool) {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a.URL, true
+		}
+	}
+	return "", false
+}
+
+// binaryAsset is the name of the release binary for this platform, as the
+// release workflow builds it.
+func binaryAsset() string {
+	name := "catalogo_" + runtime.GOOS + "_" + runtime.GOARCH
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+func runSelfUpdate(args []string) error {
+	fs := flag.NewFlagSet("self-update", flag.ContinueOnError)
+	repo := fs.String("repo", releaseRepo, "Repositorio de GitHub (dueño/nombre) del que se descargan los releases")
+	tag := fs.String("version", "", "Instalar este release (tag, como v1.4.0) en vez del más reciente")
+	check := fs.Bool("check", false, "Solo informar si hay una versión más reciente, sin instalarla")
+	force := fs.Bool("force", false, "Reinstalar aunque el binario ya sea de esa versión")
+	timeout := fs.Duration("timeout", 5*time.Minute, "Tiempo máximo de la consulta y la descarga")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// GITHUB_TOKEN is optional: it lifts the API's rate limit for
+	// anonymous requests and allows private repositories.
+	token, err := secretos.Leer("GITHUB_TOKEN")
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	client := &http.Client{}
+
+	rel, err := fetchRelease(ctx, client, *repo, *tag, token)
+	if err != nil {
+		return err
+	}
+	current := readBuildInfo().Version
+	if current == rel.TagName && !*force {
+		log.Printf("[UPDATE] catalogo %s ya está instalado", current)
+		return nil
+	}
+	if *check {
+		log.Printf("[UPDATE] Disponible %s (instalada: %s); ejecuta \"catalogo self-update\" para instalarla", rel.TagName, current)
+		return nil
+	}
+
+	name := binaryAsset()
+	binURL, ok := rel.assetURL(name)
+	if !ok {
+		return fmt.Errorf("el release %s no tiene binario para %s/%s (%s)", rel.TagName, runtime.GOOS, runtime.GOARCH, name)
+	}
+	sumsURL, ok := rel.assetURL(checksumsAsset)
+	if !ok {
+		return fmt.Errorf("el release %s no tiene %s; no se instala un binario sin verificar", rel.TagName, checksumsAsset)
+	}
+	want, err := fetchChecksum(ctx, client, sumsURL, name, token)
+	if err != nil {
+		return err
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("no se pudo determinar el ejecutable: %w", err)
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+	if strings.Contains(exe, filepath.Join("go-build", "")) {
+		return fmt.Errorf("self-update reemplaza un binario compilado; %s es temporal (go run)", exe)
+	}
+
+	log.Printf("[UPDATE] Descargando %s %s...", rel.TagName, name)
+	tmp, err := downloadBinary(ctx, client, binURL, filepath.Dir(exe), want, token)
+	if err != nil {
+		return err
+	}
+	if err := replaceExecutable(exe, tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	log.Printf("[UPDATE] catalogo %s → %s instalado en %s", current, rel.TagName, exe)
+	log.Printf("[UPDATE] Reinicia el daemon o el servicio para que use la nueva versión")
+	return nil
+}
+
+// fetchRelease reads the release tagged tag of repo, or its latest when
+// tag is empty.
+func fetchRelease(ctx context.Context, client *http.Client, repo, tag, token string) (release, error) {
+	url := "https://api.github.com/repos/" + repo + "/releases/latest"
+	if tag != "" {
+		url = "https://api.github.com/repos/" + repo + "/releases/tags/" + tag
+	}
+	resp, err := githubGet(ctx, client, url, "application/vnd.github+json", token)
+	if err != nil {
+		return release{}, err
+	}
+	defer resp.Body.Close()
+	var rel release
+	if err := json.NewDecoder(resp.Body).Decode(&rel); err != nil {
+		return release{}, fmt.Errorf("error parsing release de %s: %w", repo, err)
+	}
+	if rel.TagName == "" {
+		return release{}, fmt.Errorf("release de %s sin tag", repo)
+	}
+	return rel, nil
+}
+
+// fetchChecksum reads the SHA-256 of the asset name from the checksums file.
+func fetchChecksum(ctx context.Context, client *http.Client, url, name, token string) ([]byte, error) {
+	resp, err := githubGet(ctx, client, url, "application/octet-stream", token)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) != 2 || strings.TrimPrefix(fields[1], "*") != name {
+			continue
+		}
+		sum, err := hex.DecodeString(fields[0])
+		if err != nil || len(sum) != sha256.Size {
+			return nil, fmt.Errorf("%s: suma inválida para %s", checksumsAsset, name)
+		}
+		return sum, nil
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("error leyendo %s: %w", checksumsAsset, err)
+	}
+	return nil, fmt.Errorf("%s no incluye %s", checksumsAsset, name)
+}
+
+// downloadBinary downloads url to a temporary file in dir, so it can be
+// renamed over the executable, and checks its SHA-256 against want.
+func downloadBinary(ctx context.Context, client *http.Client, url, dir string, want []byte, token string) (string, error) {
+	resp, err := githubGet(ctx, client, url, "application/octet-stream", token)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	tmp, err := os.CreateTemp(dir, ".catalogo-update-*")
+	if err != nil {
+		return "", fmt.Errorf("no se puede escribir junto al ejecutable: %w", err)
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, h), resp.Body)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("error descargando el binario: %w", err)
+	}
+	if got := h.Sum(nil); string(got) != string(want) {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("el binario descargado no coincide con %s (sha256 %x, esperado %x)", checksumsAsset, got, want)
+	}
+	if err := os.Chmod(tmp.Name(), 0o755); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+// replaceExecutable puts the file tmp in place of exe. Windows does not let
+// a running executable be overwritten but does let it be renamed, so there
+// the old one is moved aside first and removed on the next update.
+func replaceExecutable(exe, tmp string) error {
+	if runtime.GOOS == "windows" {
+		old := exe + ".old"
+		os.Remove(old)
+		if err := os.Rename(exe, old); err != nil {
+			return fmt.Errorf("no se pudo apartar %s: %w", exe, err)
+		}
+		if err := os.Rename(tmp, exe); err != nil {
+			os.Rename(old, exe)
+			return fmt.Errorf("no se pudo instalar %s: %w", exe, err)
+		}
+		return nil
+	}
+	if err := os.Rename(tmp, exe); err != nil {
+		return fmt.Errorf("no se pudo instalar %s: %w", exe, err)
+	}
+	return nil
+}
+
+func githubGet(ctx context.Context, client *http.Client, url, accept, token string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	req.Header.Set("User-Agent", "catalogo/"+readBuildInfo().Version)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, errors.New("no encontrado (HTTP 404): " + url)
+		}
+		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, url)
+	}
+	return resp, nil
+}
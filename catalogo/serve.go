@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"catalogo/indice"
+	"catalogo/metrics"
+	"catalogo/producto"
+)
+
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	configPath := fs.String("config", "catalogo.json", "Ruta del archivo de configuración")
+	addr := fs.String("addr", ":8080", "Dirección HTTP")
+	metricsDir := fs.String("metrics-dir", defaultMetricsDir(), "Directorio con las métricas de los scrapers expuestas en /metrics")
+	indexPath := fs.String("indice", "indice-busqueda.idx", "Índice generado con catalogo index, usado por /api/buscar")
+	unifiedPath := fs.String("unificado", "catalogo-unificado.json", "Catálogo unificado de catalogo combine, en un archivo o en partes, usado por /api/unificado")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[SERVE]  Escuchando en %s", *addr)
+	return http.ListenAndServe(*addr, newServeMux(cfg, nil, *metricsDir, *indexPath, *unifiedPath))
+}
+
+// catalogCache keeps each productos.json in memory until the file changes
+// on disk, so requests between scrapes don't re-parse megabytes of JSON.
+type catalogCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedCatalog
+}
+
+type cachedCatalog struct {
+	modTime  time.Time
+	products []producto.Product
+}
+
+func (c *catalogCache) load(fpath string) ([]producto.Product, time.Time, error) {
+	info, err := os.Stat(fpath)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[fpath]; ok && e.modTime.Equal(info.ModTime()) {
+		return e.products, e.modTime, nil
+	}
+	products, err := producto.ReadJSON(fpath)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	c.entries[fpath] = cachedCatalog{modTime: info.ModTime(), products: products}
+	return products, info.ModTime(), nil
+}
+
+// storeInfo is one row of /api/tiendas and the dashboard.
+type storeInfo struct {
+	ID          string       `json:"id"`
+	Nombre      string       `json:"nombre"`
+	Productos   int          `json:"productos"`
+	Actualizado time.Time    `json:"actualizado,omitzero"`
+	Error       string       `json:"error,omitempty"`
+	Daemon      *storeStatus `json:"daemon,omitempty"`
+}
+
+// server holds what the HTTP handlers need. state is nil outside daemon mode.
+type server struct {
+	cfg        *Config
+	state      *daemonState
+	catalogs   *catalogCache
+	index      *indexCache
+	unified    *unifiedCache
+	metricsDir string
+}
+
+func newServeMux(cfg *Config, state *daemonState, metricsDir, indexPath, unifiedPath string) *http.ServeMux {
+	s := &server{
+		cfg:        cfg,
+		state:      state,
+		catalogs:   &catalogCache{entries: make(map[string]cachedCatalog)},
+		index:      &indexCache{path: indexPath},
+		unified:    &unifiedCache{path: unifiedPath, files: make(map[string]cachedUnified)},
+		metricsDir: metricsDir,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", s.handleDashboard)
+	mux.HandleFunc("GET /api/tiendas", s.handleStores)
+	mux.HandleFunc("GET /api/tiendas/{id}/productos", s.handleProducts)
+	mux.HandleFunc("GET /search", s.handleSearch)
+	mux.HandleFunc("GET /api/buscar", s.handleSearch)
+	mux.HandleFunc("GET /suggest", s.handleSuggest)
+	mux.HandleFunc("GET /api/sugerir", s.handleSuggest)
+	mux.HandleFunc("GET /api/unificado", s.handleUnified)
+	mux.HandleFunc("GET /api/openapi.json", s.handleOpenAPI)
+	mux.HandleFunc("GET /metrics", s.handleMetrics)
+	return mux
+}
+
+func (s *server) storeInfos() []storeInfo {
+	infos := make([]storeInfo, 0, len(s.cfg.Tiendas))
+	for _, st := range s.cfg.Tiendas {
+		info := storeInfo{ID: st.ID, Nombre: st.Nombre}
+		products, mod, err := s.catalogs.load(st.Salida)
+		if err != nil {
+			info.Error = err.Error()
+		} else {
+			info.Productos = len(products)
+			info.Actualizado = mod
+		}
+		if status, ok := s.state.snapshot(st.ID); ok {
+			info.Daemon = &status
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+func (s *server) handleStores(w http.ResponseWriter, r *http.Request) {
+	writeJSONResponse(w, s.storeInfos())
+}
+
+func (s *server) handleProducts(w http.ResponseWriter, r *http.Request) {
+	st := s.cfg.store(r.PathValue("id"))
+	if st == nil {
+		http.Error(w, "tienda desconocida", http.StatusNotFound)
+		return
+	}
+	products, _, err := s.catalogs.load(st.Salida)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	writeJSONResponse(w, products)
+}
+
+// handleSearch answers /search?q=...&limite=N, also served as /api/buscar,
+// from the search index.
+func (s *server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	ix, err := s.index.load()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	limit, ok := limitParam(w, r, 20)
+	if !ok {
+		return
+	}
+	results := ix.Search(r.URL.Query().Get("q"), limit, &s.cfg.Busqueda)
+	if results == nil {
+		results = []indice.Resultado{}
+	}
+	writeJSONResponse(w, results)
+}
+
+// handleSuggest answers /suggest?q=...&limite=N, also served as
+// /api/sugerir, with product names and categories that complete q, for
+// type-ahead.
+func (s *server) handleSuggest(w http.ResponseWriter, r *http.Request) {
+	ix, err := s.index.load()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	limit, ok := limitParam(w, r, 8)
+	if !ok {
+		return
+	}
+	suggestions := ix.Sugerir(r.URL.Query().Get("q"), limit)
+	if suggestions == nil {
+		suggestions = []indice.Sugerencia{}
+	}
+	writeJSONResponse(w, suggestions)
+}
+
+// limitParam reads the "limite" query parameter, capped at 200. It answers
+// 400 and returns false when the value is not a positive number.
+func limitParam(w http.ResponseWriter, r *http.Request, def int) (int, bool) {
+	v := r.URL.Query().Get("limite")
+	if v == "" {
+		return def, true
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		http.Error(w, "limite inválido", http.StatusBadRequest)
+		return 0, false
+	}
+	return min(n, 200), true
+}
+
+// handleMetrics exposes the catalogs' sizes, the daemon's own metrics and the
+// last metrics file written by each scraper, merged into one exposition.
+func (s *server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	reg := metrics.NewRegistry(nil)
+	products := reg.Gauge("catalogo_catalog_products", "Productos publicados en productos.json.", "tienda")
+	age := reg.Gauge("catalogo_catalog_age_seconds", "Antigüedad de productos.json.", "tienda")
+	for _, st := range s.cfg.Tiendas {
+		if list, mod, err := s.catalogs.load(st.Salida); err == nil {
+			products.Set(float64(len(list)), st.ID)
+			age.Set(time.Since(mod).Seconds(), st.ID)
+		}
+	}
+
+	var b bytes.Buffer
+	reg.WriteText(&b)
+	inputs := []io.Reader{&b}
+	if s.state != nil {
+		var d bytes.Buffer
+		s.state.metrics.WriteText(&d)
+		inputs = append(inputs, &d)
+	}
+	if s.metricsDir != "" {
+		files, _ := filepath.Glob(filepath.Join(s.metricsDir, "*.prom"))
+		for _, f := range files {
+			data, err := os.ReadFile(f)
+			if err != nil {
+				continue
+			}
+			inputs = append(inputs, bytes.NewReader(data))
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := metrics.Merge(w, inputs...); err != nil {
+		log.Printf("[ERROR]  /metrics: %v", err)
+	}
+}
+
+var dashboardTmpl = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"fecha": func(t time.Time) string {
+		if t.IsZero() {
+			return "—"
+		}
+		return t.Format("02/01/2006 15:04")
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="es">
+<head>
+<meta charset="UTF-8">
+<meta http-equiv="refresh" content="30">
+<title>Catálogos</title>
+<style>
+body { font-family: Inter, sans-serif; color: #023265; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { padding: .4em 1em; border-bottom: 1px solid #ddd; text-align: left; }
+.error { color: #c0392b; }
+</style>
+</head>
+<body>
+<h1>Catálogos</h1>
+<table>
+<tr><th>Tienda</th><th>Productos</th><th>Actualizado</th><th>Estado</th><th>Próxima corrida</th></tr>
+{{range .}}<tr>
+<td><a href="/api/tiendas/{{.ID}}/productos">{{.Nombre}}</a></td>
+<td>{{.Productos}}</td>
+<td>{{fecha .Actualizado}}</td>
+<td>{{if .Daemon}}{{if .Daemon.Ejecutando}}Ejecutando desde {{fecha .Daemon.UltimoInicio}}{{else if .Daemon.UltimoError}}<span class="error">{{.Daemon.UltimoError}}</span>{{else}}OK{{end}}{{end}}{{if .Error}} <span class="error">{{.Error}}</span>{{end}}</td>
+<td>{{if .Daemon}}{{fecha .Daemon.Proxima}}{{end}}</td>
+</tr>{{end}}
+</table>
+</body>
+</html>
+`))
+
+func (s *server) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboardTmpl.Execute(w, s.storeInfos()); err != nil {
+		log.Printf("[ERROR]  Dashboard: %v", err)
+	}
+}
+
+func writeJSONResponse(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("[ERROR]  Respuesta JSON: %v", err)
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// serviceOptions are the settings shared by service install/uninstall/status.
+type serviceOptions struct {
+	name       string
+	config     string
+	userUnit   bool
+	dryRun     bool
+	daemonArgs []string
+}
+
+func runService(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("uso: catalogo service install|uninstall|status [flags] [-- flags del daemon]")
+	}
+	action, args := args[0], args[1:]
+
+	fs := flag.NewFlagSet("service "+action, flag.ContinueOnError)
+	opts := serviceOptions{}
+	fs.StringVar(&opts.name, "name", "catalogo", "Nombre del servicio")
+	fs.StringVar(&opts.config, "config", "catalogo.json", "Ruta del archivo de configuración que usará el daemon")
+	fs.BoolVar(&opts.userUnit, "user", os.Geteuid() != 0, "Instalar como servicio de usuario de systemd (por defecto si no se ejecuta como root)")
+	fs.BoolVar(&opts.dryRun, "dry-run", false, "Solo mostrar lo que se instalaría")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	// Everything after "--" is passed to "catalogo daemon" as-is.
+	opts.daemonArgs = fs.Args()
+
+	switch runtime.GOOS {
+	case "linux":
+		return systemdService(action, opts)
+	case "windows":
+		return windowsService(action, opts)
+	default:
+		return fmt.Errorf("catalogo service no está soportado en %s; ejecuta \"catalogo daemon\" con el gestor de servicios del sistema", runtime.GOOS)
+	}
+}
+
+// daemonCommand returns the absolute executable and arguments that start the daemon.
+func (o serviceOptions) daemonCommand() (string, []string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", nil, fmt.Errorf("no se pudo determinar el ejecutable: %w", err)
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return "", nil, err
+	}
+	if strings.Contains(exe, filepath.Join("go-build", "")) {
+		return "", nil, fmt.Errorf("compila el binario (go build) antes de instalar el servicio; %s es temporal", exe)
+	}
+	config, err := filepath.Abs(o.config)
+	if err != nil {
+		return "", nil, err
+	}
+	if _, err := os.Stat(config); err != nil {
+		return "", nil, fmt.Errorf("config no encontrada: %w", err)
+	}
+	return exe, append([]string{"daemon", "-config", config}, o.daemonArgs...), nil
+}
+
+// --- systemd ---
+
+func (o serviceOptions) unitPath() (string, error) {
+	if !o.userUnit {
+		return filepath.Join("/etc/systemd/system", o.name+".service"), nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "systemd", "user", o.name+".service"), nil
+}
+
+func (o serviceOptions) systemctl(args ...string) error {
+	if o.userUnit {
+		args = append([]string{"--user"}, args...)
+	}
+	if o.dryRun {
+		log.Printf("[SERVICE] systemctl %s", strings.Join(args, " "))
+		return nil
+	}
+	cmd := exec.Command("systemctl", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func systemdService(action string, o serviceOptions) error {
+	unitPath, err := o.unitPath()
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "install":
+		unit, err := o.systemdUnit()
+		if err != nil {
+			return err
+		}
+		if o.dryRun {
+			fmt.Printf("# %s\n%s", unitPath, unit)
+			return nil
+		}
+		if err := os.MkdirAll(filepath.Dir(unitPath), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(unitPath, []byte(unit), 0644); err != nil {
+			return fmt.Errorf("error escribiendo unit: %w", err)
+		}
+		log.Printf("[SERVICE] Unit escrita: %s", unitPath)
+		if err := o.systemctl("daemon-reload"); err != nil {
+			return err
+		}
+		if err := o.systemctl("enable", "--now", o.name+".service"); err != nil {
+			return err
+		}
+		if o.userUnit {
+			log.Printf("[SERVICE] Servicio de usuario: ejecuta \"loginctl enable-linger\" para que siga corriendo sin sesión abierta")
+		}
+		return nil
+
+	case "uninstall":
+		if err := o.systemctl("disable", "--now", o.name+".service"); err != nil {
+			log.Printf("[WARN]   systemctl disable: %v", err)
+		}
+		if !o.dryRun {
+			if err := os.Remove(unitPath); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			log.Printf("[SERVICE] Unit eliminada: %s", unitPath)
+		}
+		return o.systemctl("daemon-reload")
+
+	case "status":
+		return o.systemctl("status", "--no-pager", o.name+".service")
+	}
+	return fmt.Errorf("acción desconocida %q (install|uninstall|status)", action)
+}
+
+// systemdUnit renders the unit file. The daemon runs from the config's
+// directory with the installer's PATH, since the default scraper command
+// is "go run .".
+func (o serviceOptions) systemdUnit() (string, error) {
+	exe, args, err := o.daemonCommand()
+	if err != nil {
+		return "", err
+	}
+	workDir := filepath.Dir(args[2])
+
+	var b strings.Builder
+	b.WriteString("[Unit]\n")
+	b.WriteString("Description=Catálogos de accesorios (catalogo daemon)\n")
+	b.WriteString("After=network-online.target\n")
+	b.WriteString("Wants=network-online.target\n\n")
+	b.WriteString("[Service]\n")
+	b.WriteString("Type=simple\n")
+	if !o.userUnit {
+		if u, err := user.Current(); err == nil && u.Uid != "0" {
+			fmt.Fprintf(&b, "User=%s\n", u.Username)
+		} else if sudoUser := os.Getenv("SUDO_USER"); sudoUser != "" {
+			fmt.Fprintf(&b, "User=%s\n", sudoUser)
+		}
+	}
+	fmt.Fprintf(&b, "WorkingDirectory=%s\n", systemdQuote(workDir))
+	fmt.Fprintf(&b, "Environment=%s\n", systemdQuote("PATH="+os.Getenv("PATH")))
+	fmt.Fprintf(&b, "ExecStart=%s", systemdQuote(exe))
+	for _, a := range args {
+		fmt.Fprintf(&b, " %s", systemdQuote(a))
+	}
+	b.WriteString("\n")
+	b.WriteString("Restart=on-failure\n")
+	b.WriteString("RestartSec=30\n")
+	b.WriteString("KillSignal=SIGTERM\n")
+	b.WriteString("TimeoutStopSec=60\n")
+	b.WriteString("NoNewPrivileges=true\n\n")
+	b.WriteString("[Install]\n")
+	if o.userUnit {
+		b.WriteString("WantedBy=default.target\n")
+	} else {
+		b.WriteString("WantedBy=multi-user.target\n")
+	}
+	return b.String(), nil
+}
+
+// systemdQuote quotes a value for a unit file: specifiers (%) are escaped and
+// values with spaces or quotes are wrapped in double quotes.
+func systemdQuote(s string) string {
+	s = strings.ReplaceAll(s, "%", "%%")
+	if s != "" && !strings.ContainsAny(s, " \t\"';$\\") {
+		return s
+	}
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "$", "$$")
+	return `"` + s + `"`
+}
+
+// --- Windows ---
+
+// windowsService registers the daemon as a scheduled task that starts with
+// the system. A native Windows service would need the service control
+// protocol, which the standard library doesn't implement.
+func windowsService(action string, o serviceOptions) error {
+	var args []string
+	switch action {
+	case "install":
+		exe, daemonArgs, err := o.daemonCommand()
+		if err != nil {
+			return err
+		}
+		tr := windowsQuote(exe)
+		for _, a := range daemonArgs {
+			tr += " " + windowsQuote(a)
+		}
+		args = []string{"/Create", "/TN", o.name, "/TR", tr, "/SC", "ONSTART", "/RU", "SYSTEM", "/RL", "HIGHEST", "/F"}
+	case "uninstall":
+		args = []string{"/Delete", "/TN", o.name, "/F"}
+	case "status":
+		args = []string{"/Query", "/TN", o.name, "/V", "/FO", "LIST"}
+	default:
+		return fmt.Errorf("acción desconocida %q (install|uninstall|status)", action)
+	}
+
+	if o.dryRun {
+		log.Printf("[SERVICE] schtasks %s", strings.Join(args, " "))
+		return nil
+	}
+	cmd := exec.Command("schtasks", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func windowsQuote(s string) string {
+	if !strings.ContainsAny(s, " \t\"") {
+		return s
+	}
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
@@ -0,0 +1,259 @@
+// Package sitemap writes the sitemaps of the published catalog site: an
+// index in sitemap.xml and one sitemap per store category listing the
+// category page and a deep link to each product, dated by when the product
+// last changed.
+package sitemap
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"catalogo/canonurl"
+	"catalogo/producto"
+	"catalogo/texto"
+)
+
+// maxURLs is the most URLs the protocol allows in one sitemap.
+const maxURLs = 50000
+
+// Catalogo is a store page of the site and the products it lists.
+type Catalogo struct {
+	// Ruta is the page's path from the site root, e.g. "catalogo-buytiti/".
+	Ruta      string
+	Productos []producto.Product
+}
+
+// Cambio is when a product last changed and the fingerprint it had then.
+type Cambio struct {
+	Huella string    `json:"huella"`
+	Fecha  time.Time `json:"fecha"`
+}
+
+// Fechas is the last change of every product, by canonical link. It is kept
+// between runs because productos.json has no dates of its own.
+type Fechas map[string]Cambio
+
+// LoadFechas reads the dates written by a previous run. A missing file is no
+// dates: every product counts as changed now.
+func LoadFechas(fpath string) (Fechas, error) {
+	data, err := os.ReadFile(fpath)
+	if errors.Is(err, os.ErrNotExist) {
+		return Fechas{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo %s: %w", fpath, err)
+	}
+	var f Fechas
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", fpath, err)
+	}
+	return f, nil
+}
+
+// Actualizar returns the dates of catalogs' products: the previous one for
+// a product that is unchanged, now for a new or changed one. Products no
+// longer in any catalog are dropped.
+func (f Fechas) Actualizar(catalogs []Catalogo, now time.Time) Fechas {
+	out := make(Fechas)
+	for _, cat := range catalogs {
+		for _, p := range cat.Productos {
+			key := canonurl.Key(p.Link)
+			h := producto.Hash([]producto.Product{p})
+			if old, ok := f[key]; ok && old.Huella == h {
+				out[key] = old
+			} else {
+				out[key] = Cambio{Huella: h, Fecha: now}
+			}
+		}
+	}
+	return out
+}
+
+// Save writes the dates to fpath.
+func (f Fechas) Save(fpath string) error {
+	data, err := json.MarshalIndent(f, "", "    ")
+	if err != nil {
+		return fmt.Errorf("error serializando JSON: %w", err)
+	}
+	if err := os.WriteFile(fpath, data, 0644); err != nil {
+		return fmt.Errorf("error escribiendo %s: %w", fpath, err)
+	}
+	return nil
+}
+
+// URL is one page in a sitemap.
+type URL struct {
+	Loc     string `xml:"loc"`
+	Lastmod string `xml:"lastmod,omitempty"`
+}
+
+// Mapa is one sitemap file: Archivo is its name inside the sitemaps
+// directory.
+type Mapa struct {
+	Archivo string
+	URLs    []URL
+}
+
+// Build lays out the sitemaps of catalogs under the site's base URL: one
+// with the home and store pages, then one per store and category with the
+// category page and its products. Each page is dated by its most recently
+// changed product.
+func Build(base string, catalogs []Catalogo, fechas Fechas) []Mapa {
+	base = strings.TrimSuffix(base, "/") + "/"
+	pages := Mapa{Archivo: "paginas.xml", URLs: []URL{{Loc: base}}}
+	var home time.Time
+	var mapas []Mapa
+	used := make(map[string]bool)
+	for _, cat := range catalogs {
+		byCat := make(map[string][]producto.Product)
+		for _, p := range cat.Productos {
+			byCat[p.Categoria] = append(byCat[p.Categoria], p)
+		}
+		names := make([]string, 0, len(byCat))
+		for c := range byCat {
+			names = append(names, c)
+		}
+		sort.Strings(names)
+
+		var store time.Time
+		for _, c := range names {
+			var urls []URL
+			var latest time.Time
+			for _, p := range byCat[c] {
+				fecha := fechas[canonurl.Key(p.Link)].Fecha
+				latest = later(latest, fecha)
+				urls = append(urls, URL{Loc: base + cat.Ruta + "?producto=" + url.QueryEscape(producto.Slug(p.Link)), Lastmod: lastmod(fecha)})
+			}
+			sort.Slice(urls, func(i, j int) bool { return urls[i].Loc < urls[j].Loc })
+			if c != "" {
+				urls = append([]URL{{Loc: base + cat.Ruta + "?categoria=" + url.QueryEscape(c), Lastmod: lastmod(latest)}}, urls...)
+			}
+			// Categories that differ only in accents or case share a name
+			name := archivo(cat.Ruta, c)
+			for n := 2; used[name]; n++ {
+				name = fmt.Sprintf("%s-%d.xml", strings.TrimSuffix(archivo(cat.Ruta, c), ".xml"), n)
+			}
+			used[name] = true
+			mapas = append(mapas, split(name, urls)...)
+			store = later(store, latest)
+		}
+		pages.URLs = append(pages.URLs, URL{Loc: base + cat.Ruta, Lastmod: lastmod(store)})
+		home = later(home, store)
+	}
+	pages.URLs[0].Lastmod = lastmod(home)
+	return append([]Mapa{pages}, mapas...)
+}
+
+// archivo names the sitemap of a store page's category, e.g.
+// "catalogo-buytiti-audifonos.xml".
+func archivo(ruta, categoria string) string {
+	name := strings.Trim(strings.ReplaceAll(strings.TrimSuffix(ruta, "/"), "/", "-"), "-")
+	c := strings.Join(texto.Words(categoria), "-")
+	if c == "" {
+		c = "sin-categoria"
+	}
+	if name == "" {
+		return c + ".xml"
+	}
+	return name + "-" + c + ".xml"
+}
+
+// split breaks urls into sitemaps of at most maxURLs, numbering the extra
+// files.
+func split(name string, urls []URL) []Mapa {
+	var out []Mapa
+	for i := 0; i < len(urls); i += maxURLs {
+		n := name
+		if i > 0 {
+			n = fmt.Sprintf("%s-%d.xml", strings.TrimSuffix(name, ".xml"), i/maxURLs+1)
+		}
+		out = append(out, Mapa{Archivo: n, URLs: urls[i:min(i+maxURLs, len(urls))]})
+	}
+	return out
+}
+
+func later(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
+
+func lastmod(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format("2006-01-02")
+}
+
+type urlset struct {
+	XMLName xml.Name `xml:"urlset"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	URLs    []URL    `xml:"url"`
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name `xml:"sitemapindex"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Sitemaps []URL    `xml:"sitemap"`
+}
+
+const xmlns = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+// Write writes mapas into dir and the index that lists them to index. dir
+// must be under the site root the base URL points to, at ruta (e.g.
+// "sitemaps/"). Sitemaps the previous index listed that mapas no longer has
+// are removed, so a category that disappears stops being published.
+func Write(mapas []Mapa, base, index, dir, ruta string) error {
+	base = strings.TrimSuffix(base, "/") + "/"
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creando %s: %w", dir, err)
+	}
+	keep := make(map[string]bool, len(mapas))
+	idx := sitemapIndex{Xmlns: xmlns}
+	for _, m := range mapas {
+		keep[m.Archivo] = true
+		if err := writeXML(filepath.Join(dir, m.Archivo), urlset{Xmlns: xmlns, URLs: m.URLs}); err != nil {
+			return err
+		}
+		var newest string
+		for _, u := range m.URLs {
+			newest = max(newest, u.Lastmod)
+		}
+		idx.Sitemaps = append(idx.Sitemaps, URL{Loc: base + ruta + m.Archivo, Lastmod: newest})
+	}
+	// Only files the previous index listed are removed, never anything else
+	// that happens to be in dir
+	if data, err := os.ReadFile(index); err == nil {
+		var prev sitemapIndex
+		if xml.Unmarshal(data, &prev) == nil {
+			for _, sm := range prev.Sitemaps {
+				name, ok := strings.CutPrefix(sm.Loc, base+ruta)
+				if ok && !keep[name] && !strings.Contains(name, "/") {
+					os.Remove(filepath.Join(dir, name))
+				}
+			}
+		}
+	}
+	return writeXML(index, idx)
+}
+
+func writeXML(fpath string, v any) error {
+	data, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error serializando XML: %w", err)
+	}
+	data = append([]byte(xml.Header), append(data, '\n')...)
+	if err := os.WriteFile(fpath, data, 0644); err != nil {
+		return fmt.Errorf("error escribiendo %s: %w", fpath, err)
+	}
+	return nil
+}
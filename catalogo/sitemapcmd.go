@@ -0,0 +1,123 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"catalogo/producto"
+	"catalogo/sitemap"
+)
+
+// runSitemap writes sitemap.xml and the per-category sitemaps of the
+// published site for the given catalogs, or for every store in the
+// configuration when none are given.
+func runSitemap(args []string) error {
+	fset := flag.NewFlagSet("sitemap", flag.ContinueOnError)
+	configPath := fset.String("config", "catalogo.json", "Configuración con las tiendas cuando no se indican archivos")
+	root := fset.String("raiz", "", "Raíz del sitio publicado (por defecto el directorio de -config)")
+	base := fset.String("base", "", "URL del sitio publicado (por defecto https:// y el dominio del archivo CNAME de la raíz)")
+	output := fset.String("o", "", "Índice de sitemaps a escribir (por defecto sitemap.xml en la raíz)")
+	dir := fset.String("dir", "", "Directorio de los sitemaps por categoría, dentro de la raíz (por defecto sitemaps/)")
+	fechasPath := fset.String("fechas", "", "Fecha del último cambio de cada producto, que se conserva entre corridas (por defecto fechas.json en -dir)")
+	files, err := parseInterspersed(fset, args)
+	if err != nil {
+		return err
+	}
+	if *root == "" {
+		*root = filepath.Dir(*configPath)
+	}
+	if len(files) == 0 {
+		cfg, err := loadConfig(*configPath)
+		if err != nil {
+			return err
+		}
+		for _, st := range cfg.Tiendas {
+			files = append(files, st.Salida)
+		}
+	}
+	if *base == "" {
+		cname, err := os.ReadFile(filepath.Join(*root, "CNAME"))
+		if err != nil {
+			return fmt.Errorf("sin -base ni CNAME en %s: %w", *root, err)
+		}
+		*base = "https://" + strings.TrimSpace(string(cname))
+	}
+	if *output == "" {
+		*output = filepath.Join(*root, "sitemap.xml")
+	}
+	if *dir == "" {
+		*dir = filepath.Join(*root, "sitemaps")
+	}
+	if *fechasPath == "" {
+		*fechasPath = filepath.Join(*dir, "fechas.json")
+	}
+	ruta, err := sitePath(*root, *dir)
+	if err != nil {
+		return err
+	}
+
+	catalogs := make([]sitemap.Catalogo, len(files))
+	for i, fpath := range files {
+		products, err := producto.ReadJSON(fpath)
+		if err != nil {
+			return err
+		}
+		page, err := sitePath(*root, filepath.Dir(fpath))
+		if err != nil {
+			return err
+		}
+		catalogs[i] = sitemap.Catalogo{Ruta: page, Productos: products}
+	}
+
+	prev, err := sitemap.LoadFechas(*fechasPath)
+	if err != nil {
+		return err
+	}
+	fechas := prev.Actualizar(catalogs, time.Now())
+	mapas := sitemap.Build(*base, catalogs, fechas)
+	if err := sitemap.Write(mapas, *base, *output, *dir, ruta); err != nil {
+		return err
+	}
+	if err := fechas.Save(*fechasPath); err != nil {
+		return err
+	}
+	changed := 0
+	for key, c := range fechas {
+		if old, ok := prev[key]; !ok || old.Huella != c.Huella {
+			changed++
+		}
+	}
+	urls := 0
+	for _, m := range mapas {
+		urls += len(m.URLs)
+	}
+	log.Printf("[WRITE]  %d URLs en %d sitemaps; %d productos nuevos o con cambios", urls, len(mapas), changed)
+	log.Printf("[WRITE]  Índice escrito en %s", *output)
+	return nil
+}
+
+// sitePath is dir's path from the site root, with a trailing slash, as it
+// goes in the site's URLs.
+func sitePath(root, dir string) (string, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(absRoot, absDir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s no está dentro de la raíz del sitio %s", dir, root)
+	}
+	if rel == "." {
+		return "", nil
+	}
+	return filepath.ToSlash(rel) + "/", nil
+}
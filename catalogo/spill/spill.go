@@ -0,0 +1,181 @@
+// Package spill checkpoints the products a run has collected but not yet
+// written. They are appended to an NDJSON file every few seconds, so a crash
+// (OOM, panic, kill) loses at most one interval of work; the next run finds
+// the file and recovers them.
+package spill
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"catalogo/canonurl"
+	"catalogo/producto"
+)
+
+// Spill buffers products and appends them to the spill file periodically.
+// A nil Spill ignores every call.
+type Spill struct {
+	path string
+
+	mu      sync.Mutex
+	f       *os.File
+	pending []producto.Product
+	err     error
+	closed  bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// DefaultPath is the spill file used for output.
+func DefaultPath(output string) string {
+	return output + ".spill.ndjson"
+}
+
+// Open starts spilling to fpath every interval and returns the products left
+// there by an interrupted run, if any. New products are appended after them.
+func Open(fpath string, interval time.Duration) (*Spill, []producto.Product, error) {
+	recovered, err := Read(fpath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, err
+	}
+	f, err := os.OpenFile(fpath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error abriendo spill: %w", err)
+	}
+	// Terminate a line cut short by a crash so new entries start clean
+	if info, err := f.Stat(); err == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if r, err := os.Open(fpath); err == nil {
+			r.ReadAt(last, info.Size()-1)
+			r.Close()
+		}
+		if last[0] != '\n' {
+			f.Write([]byte{'\n'})
+		}
+	}
+	s := &Spill{path: fpath, f: f, stop: make(chan struct{}), done: make(chan struct{})}
+	go s.loop(interval)
+	return s, recovered, nil
+}
+
+// Read returns the products in a spill file, one per link as canonurl.Key
+// compares them (the last one written wins). A truncated last line, left by a crash in the middle of a
+// write, is ignored.
+func Read(fpath string) ([]producto.Product, error) {
+	data, err := os.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+	var products []producto.Product
+	index := make(map[string]int)
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for sc.Scan() {
+		var p producto.Product
+		if err := json.Unmarshal(sc.Bytes(), &p); err != nil {
+			continue
+		}
+		key := canonurl.Key(p.Link)
+		if i, ok := index[key]; ok {
+			products[i] = p
+			continue
+		}
+		index[key] = len(products)
+		products = append(products, p)
+	}
+	return products, sc.Err()
+}
+
+func (s *Spill) loop(interval time.Duration) {
+	defer close(s.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.flush()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// Add queues products for the next flush.
+func (s *Spill) Add(products ...producto.Product) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.pending = append(s.pending, products...)
+	s.mu.Unlock()
+}
+
+func (s *Spill) flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.pending) == 0 || s.err != nil || s.closed {
+		return
+	}
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	for _, p := range s.pending {
+		enc.Encode(p)
+	}
+	if _, err := s.f.Write(b.Bytes()); err != nil {
+		s.err = fmt.Errorf("error escribiendo spill: %w", err)
+		return
+	}
+	s.pending = s.pending[:0]
+}
+
+// Close flushes what is pending and stops, keeping the file for the next run
+// to recover. It returns the first write error, if any. Calling it after Done
+// does nothing, so it can be deferred.
+func (s *Spill) Close() error {
+	if s == nil || !s.shutdown() {
+		return nil
+	}
+	s.flush()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	if err := s.f.Close(); err != nil && s.err == nil {
+		s.err = err
+	}
+	return s.err
+}
+
+// Done stops spilling and removes the file, once the products are safely in
+// the output.
+func (s *Spill) Done() error {
+	if s == nil || !s.shutdown() {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	s.f.Close()
+	if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// shutdown stops the flush loop; it reports false if it was already stopped.
+func (s *Spill) shutdown() bool {
+	select {
+	case <-s.stop:
+		return false
+	default:
+		close(s.stop)
+	}
+	<-s.done
+	return true
+}
@@ -0,0 +1,175 @@
+// Package status keeps a small JSON file describing a run in progress —
+// phase, categories done, products so far, errors — rewritten periodically so
+// monitoring can follow a run without attaching to the process.
+package status
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"catalogo/secretos"
+)
+
+// Status is the content of the status file.
+type Status struct {
+	Tienda                string     `json:"tienda"`
+	Corrida               string     `json:"corrida"`
+	PID                   int        `json:"pid"`
+	Fase                  string     `json:"fase"`
+	CategoriasCompletadas int        `json:"categorias_completadas"`
+	CategoriasTotal       int        `json:"categorias_total"`
+	Productos             int        `json:"productos"`
+	Errores               int        `json:"errores"`
+	Iniciado              time.Time  `json:"iniciado"`
+	Actualizado           time.Time  `json:"actualizado"`
+	Terminado             *time.Time `json:"terminado,omitempty"`
+	Error                 string     `json:"error,omitempty"`
+	// Bloqueado names the anti-bot service whose challenge stopped the
+	// run, e.g. "Cloudflare".
+	Bloqueado string `json:"bloqueado,omitempty"`
+}
+
+// Reporter updates a Status and writes it to disk every interval. A nil
+// Reporter ignores every call, so scrapers can report unconditionally.
+type Reporter struct {
+	path string
+
+	mu    sync.Mutex
+	s     Status
+	dirty bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Start writes the initial status of run corrida to fpath and keeps
+// rewriting it every interval while it changes. It returns nil when fpath is
+// empty.
+func Start(fpath, tienda, corrida string, interval time.Duration) *Reporter {
+	if fpath == "" {
+		return nil
+	}
+	r := &Reporter{
+		path: fpath,
+		s:    Status{Tienda: tienda, Corrida: corrida, PID: os.Getpid(), Fase: "inicio", Iniciado: time.Now()},
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	r.write()
+	go r.loop(interval)
+	return r
+}
+
+func (r *Reporter) loop(interval time.Duration) {
+	defer close(r.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.mu.Lock()
+			dirty := r.dirty
+			r.mu.Unlock()
+			if dirty {
+				r.write()
+			}
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+func (r *Reporter) update(f func(s *Status)) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	f(&r.s)
+	r.dirty = true
+	r.mu.Unlock()
+}
+
+// Phase records the step the run is in (e.g. "categorias", "detalle").
+func (r *Reporter) Phase(fase string) {
+	r.update(func(s *Status) { s.Fase = fase })
+}
+
+// Categories sets the number of categories the run will go through.
+func (r *Reporter) Categories(total int) {
+	r.update(func(s *Status) { s.CategoriasTotal = total })
+}
+
+// CategoryDone counts one category as finished.
+func (r *Reporter) CategoryDone() {
+	r.update(func(s *Status) { s.CategoriasCompletadas++ })
+}
+
+// Products sets the number of products collected so far.
+func (r *Reporter) Products(n int) {
+	r.update(func(s *Status) { s.Productos = n })
+}
+
+// Error counts one failed page or product.
+func (r *Reporter) Error() {
+	r.update(func(s *Status) { s.Errores++ })
+}
+
+// Blocked marks the store as blocked by the anti-bot service servicio.
+func (r *Reporter) Blocked(servicio string) {
+	r.update(func(s *Status) { s.Bloqueado = servicio })
+}
+
+// Finish records the outcome, writes the file one last time and stops the
+// periodic writes.
+func (r *Reporter) Finish(err error) {
+	if r == nil {
+		return
+	}
+	now := time.Now()
+	r.update(func(s *Status) {
+		s.Terminado = &now
+		s.Fase = "terminado"
+		if err != nil {
+			s.Fase = "fallido"
+			if s.Bloqueado != "" {
+				s.Fase = "bloqueado"
+			}
+			s.Error = secretos.Ocultar(err.Error())
+		}
+	})
+	close(r.stop)
+	<-r.done
+	r.write()
+}
+
+// write replaces the file atomically so readers never see half a document.
+func (r *Reporter) write() {
+	r.mu.Lock()
+	r.s.Actualizado = time.Now()
+	data, err := json.MarshalIndent(r.s, "", "    ")
+	r.dirty = false
+	r.mu.Unlock()
+	if err != nil {
+		return
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(r.path), ".status-*.json")
+	if err != nil {
+		return
+	}
+	tmp.Chmod(0644)
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+	if err := os.Rename(tmp.Name(), r.path); err != nil {
+		os.Remove(tmp.Name())
+	}
+}
@@ -0,0 +1,266 @@
+// Package taxonomia maps each store's own categories to one canonical
+// taxonomy and reports how well the mapping covers the catalogs.
+package taxonomia
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"catalogo/canonurl"
+	"catalogo/match"
+	"catalogo/texto"
+)
+
+// Taxonomia is the content of taxonomia.json: the canonical categories and,
+// per store id, the canonical category of each store category.
+type Taxonomia struct {
+	Categorias []string                     `json:"categorias"`
+	Tiendas    map[string]map[string]string `json:"tiendas"`
+}
+
+// Load reads a taxonomy file.
+func Load(fpath string) (*Taxonomia, error) {
+	data, err := os.ReadFile(fpath)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo taxonomía: %w", err)
+	}
+	var t Taxonomia
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("error parsing taxonomía %s: %w", fpath, err)
+	}
+	return &t, nil
+}
+
+// Canonica returns the canonical category of a store's category, or "" when
+// it is not mapped. Store categories compare without case or accents, since
+// stores are not consistent about either. A nil Taxonomia maps nothing.
+func (t *Taxonomia) Canonica(tienda, categoria string) string {
+	if t == nil {
+		return ""
+	}
+	mapping := t.Tiendas[tienda]
+	if c, ok := mapping[categoria]; ok {
+		return c
+	}
+	key := texto.Normalize(categoria)
+	for cat, c := range mapping {
+		if texto.Normalize(cat) == key {
+			return c
+		}
+	}
+	return ""
+}
+
+// Fila is one store category in the report.
+type Fila struct {
+	Categoria string `json:"categoria"`
+	Productos int    `json:"productos"`
+	// Canonica is empty when the category is not mapped.
+	Canonica string `json:"canonica,omitempty"`
+	// Desconocida is set when Canonica is not in the taxonomy's list.
+	Desconocida bool `json:"desconocida,omitempty"`
+	// Sugerencias, for unmapped categories, are the canonical categories
+	// their products point to.
+	Sugerencias []Sugerencia `json:"sugerencias,omitempty"`
+}
+
+// Sugerencia is a canonical category an unmapped category's products point
+// to and how many do.
+type Sugerencia struct {
+	Canonica  string `json:"canonica"`
+	Productos int    `json:"productos"`
+}
+
+// ReporteTienda is the alignment of one store.
+type ReporteTienda struct {
+	Tienda    string `json:"tienda"`
+	Productos int    `json:"productos"`
+	SinMapear int    `json:"sinMapear"`
+	Filas     []Fila `json:"filas"`
+}
+
+// Cobertura is how many products each store has in a canonical category.
+type Cobertura struct {
+	Categoria string         `json:"categoria"`
+	PorTienda map[string]int `json:"porTienda"`
+}
+
+// Reporte is the category alignment report.
+type Reporte struct {
+	Tiendas   []ReporteTienda `json:"tiendas"`
+	Canonicas []Cobertura     `json:"canonicas"`
+}
+
+// Alinear maps the categories of every catalog through t. For unmapped
+// categories it gathers evidence of where they belong: subcategories of
+// their products that are mapped categories of the same store, and the
+// canonical categories of the products pairs link them to in other stores.
+func Alinear(t *Taxonomia, catalogs []match.Catalog, pairs []match.Pair) Reporte {
+	// Canonical category of every product, to follow pairs across stores
+	canonOf := make(map[string]string)
+	for _, cat := range catalogs {
+		for _, p := range cat.Productos {
+			if c := t.Canonica(cat.Tienda, p.Categoria); c != "" {
+				canonOf[cat.Tienda+"\x00"+canonurl.Key(p.Link)] = c
+			}
+		}
+	}
+	partners := make(map[string][]string)
+	for _, pair := range pairs {
+		a := pair.A.Tienda + "\x00" + canonurl.Key(pair.A.Link)
+		b := pair.B.Tienda + "\x00" + canonurl.Key(pair.B.Link)
+		partners[a] = append(partners[a], b)
+		partners[b] = append(partners[b], a)
+	}
+
+	known := make(map[string]bool)
+	coverage := make(map[string]map[string]int)
+	for _, c := range t.categorias() {
+		known[c] = true
+		coverage[c] = make(map[string]int)
+	}
+
+	var r Reporte
+	for _, cat := range catalogs {
+		rt := ReporteTienda{Tienda: cat.Tienda, Productos: len(cat.Productos)}
+		rows := make(map[string]*Fila)
+		evidence := make(map[string]map[string]int)
+		for _, p := range cat.Productos {
+			row, ok := rows[p.Categoria]
+			if !ok {
+				row = &Fila{Categoria: p.Categoria, Canonica: t.Canonica(cat.Tienda, p.Categoria)}
+				row.Desconocida = row.Canonica != "" && !known[row.Canonica]
+				rows[p.Categoria] = row
+			}
+			row.Productos++
+			if row.Canonica != "" {
+				if coverage[row.Canonica] == nil {
+					coverage[row.Canonica] = make(map[string]int)
+				}
+				coverage[row.Canonica][cat.Tienda]++
+				continue
+			}
+
+			rt.SinMapear++
+			if evidence[p.Categoria] == nil {
+				evidence[p.Categoria] = make(map[string]int)
+			}
+			// Each product counts once per canonical category it points to
+			seen := make(map[string]bool)
+			for _, sub := range p.Subcategorias {
+				if c := t.Canonica(cat.Tienda, sub); c != "" && !seen[c] {
+					seen[c] = true
+					evidence[p.Categoria][c]++
+				}
+			}
+			for _, other := range partners[cat.Tienda+"\x00"+canonurl.Key(p.Link)] {
+				if c := canonOf[other]; c != "" && !seen[c] {
+					seen[c] = true
+					evidence[p.Categoria][c]++
+				}
+			}
+		}
+
+		for _, row := range rows {
+			for c, n := range evidence[row.Categoria] {
+				row.Sugerencias = append(row.Sugerencias, Sugerencia{Canonica: c, Productos: n})
+			}
+			sort.Slice(row.Sugerencias, func(i, j int) bool {
+				if row.Sugerencias[i].Productos != row.Sugerencias[j].Productos {
+					return row.Sugerencias[i].Productos > row.Sugerencias[j].Productos
+				}
+				return row.Sugerencias[i].Canonica < row.Sugerencias[j].Canonica
+			})
+			rt.Filas = append(rt.Filas, *row)
+		}
+		// Unmapped first, then by size
+		sort.Slice(rt.Filas, func(i, j int) bool {
+			a, b := rt.Filas[i], rt.Filas[j]
+			if (a.Canonica == "") != (b.Canonica == "") {
+				return a.Canonica == ""
+			}
+			if a.Productos != b.Productos {
+				return a.Productos > b.Productos
+			}
+			return a.Categoria < b.Categoria
+		})
+		r.Tiendas = append(r.Tiendas, rt)
+	}
+
+	for c, byStore := range coverage {
+		r.Canonicas = append(r.Canonicas, Cobertura{Categoria: c, PorTienda: byStore})
+	}
+	sort.Slice(r.Canonicas, func(i, j int) bool { return r.Canonicas[i].Categoria < r.Canonicas[j].Categoria })
+	return r
+}
+
+func (t *Taxonomia) categorias() []string {
+	if t == nil {
+		return nil
+	}
+	return t.Categorias
+}
+
+// WriteMarkdown writes r as a Markdown report: per store, its categories
+// with their canonical category, unmapped ones first and highlighted with
+// the evidence of where they belong; then the coverage of each canonical
+// category.
+func WriteMarkdown(r Reporte, fpath string) error {
+	var b strings.Builder
+	b.WriteString("# Alineación de categorías\n")
+
+	for _, rt := range r.Tiendas {
+		fmt.Fprintf(&b, "\n## %s\n\n", rt.Tienda)
+		fmt.Fprintf(&b, "%d productos, %d en categorías sin mapear.\n\n", rt.Productos, rt.SinMapear)
+		b.WriteString("| Categoría | Productos | Canónica |\n|---|---:|---|\n")
+		for _, f := range rt.Filas {
+			canon := f.Canonica
+			switch {
+			case f.Canonica == "":
+				canon = "⚠️ **sin mapear**"
+				if len(f.Sugerencias) > 0 {
+					var parts []string
+					for _, s := range f.Sugerencias[:min(3, len(f.Sugerencias))] {
+						parts = append(parts, fmt.Sprintf("%s (%d)", s.Canonica, s.Productos))
+					}
+					canon += " — evidencia: " + strings.Join(parts, ", ")
+				}
+			case f.Desconocida:
+				canon = "⚠️ **" + f.Canonica + "** (no está en la lista de categorías)"
+			}
+			fmt.Fprintf(&b, "| %s | %d | %s |\n", escapeCell(f.Categoria), f.Productos, canon)
+		}
+	}
+
+	if len(r.Canonicas) > 0 {
+		b.WriteString("\n## Categorías canónicas\n\n")
+		b.WriteString("| Canónica |")
+		for _, rt := range r.Tiendas {
+			fmt.Fprintf(&b, " %s |", rt.Tienda)
+		}
+		b.WriteString("\n|---|" + strings.Repeat("---:|", len(r.Tiendas)) + "\n")
+		for _, c := range r.Canonicas {
+			fmt.Fprintf(&b, "| %s |", escapeCell(c.Categoria))
+			for _, rt := range r.Tiendas {
+				if n := c.PorTienda[rt.Tienda]; n > 0 {
+					fmt.Fprintf(&b, " %d |", n)
+				} else {
+					b.WriteString(" — |")
+				}
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	if err := os.WriteFile(fpath, []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("error escribiendo reporte: %w", err)
+	}
+	return nil
+}
+
+func escapeCell(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
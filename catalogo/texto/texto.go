@@ -0,0 +1,235 @@
+// Package texto normalizes Spanish product names for comparison: lowercase,
+// no accents or HTML entities, common store abbreviations spelled out, and
+// quantities (pieces per pack, milliliters, grams, meters) pulled out into
+// structured fields.
+package texto
+
+import (
+	"html"
+	"maps"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var unaccent = strings.NewReplacer(
+	"á", "a", "é", "e", "í", "i", "ó", "o", "ú", "u", "ü", "u", "ñ", "n",
+	"à", "a", "è", "e", "ì", "i", "ò", "o", "ù", "u", "ç", "c",
+)
+
+// reSlashAbbrev matches the slash abbreviations of store listings:
+// "funda p/ celular", "cable c/ luz", "audífonos s/ micrófono".
+var reSlashAbbrev = regexp.MustCompile(`\b([pcs])/\s*`)
+
+var slashAbbrev = map[string]string{"p": "para ", "c": "con ", "s": "sin "}
+
+// abbreviations spells out words stores shorten in names.
+var abbreviations = map[string]string{
+	"pz":     "piezas",
+	"pzs":    "piezas",
+	"pza":    "piezas",
+	"pzas":   "piezas",
+	"pieza":  "piezas",
+	"mt":     "metros",
+	"mts":    "metros",
+	"mtr":    "metros",
+	"mtrs":   "metros",
+	"metro":  "metros",
+	"paq":    "paquete",
+	"pqt":    "paquete",
+	"pqte":   "paquete",
+	"univ":   "universal",
+	"inal":   "inalambrico",
+	"recarg": "recargable",
+}
+
+// reGlued splits a number glued to a unit, as in "500ml", "1.5m" or
+// "10pzas", without touching model codes like "a52s".
+var reGlued = regexp.MustCompile(`^(\d+(?:\.\d+)?)(ml|l|lt|lts|g|gr|grs|kg|m|mt|mts|cm|mm|pz|pzs|pza|pzas|piezas|pack)$`)
+
+// Normalize lowercases s, decodes HTML entities, removes accents, spells out
+// abbreviations and reduces punctuation to single spaces. Decimal points
+// between digits are kept.
+func Normalize(s string) string {
+	return strings.Join(Words(s), " ")
+}
+
+// Equal reports whether a and b are the same text once normalized, so
+// "Papelería" equals "papeleria" and "PAPELERIA". Filters on names and
+// categories compare with it rather than with ==.
+func Equal(a, b string) bool {
+	return Normalize(a) == Normalize(b)
+}
+
+// Words is Normalize split into words.
+func Words(s string) []string {
+	s = unaccent.Replace(strings.ToLower(html.UnescapeString(s)))
+	s = reSlashAbbrev.ReplaceAllStringFunc(s, func(m string) string {
+		return slashAbbrev[m[:1]]
+	})
+
+	var b strings.Builder
+	rs := []rune(s)
+	for i, r := range rs {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+		case (r == '.' || r == ',') && i > 0 && i+1 < len(rs) && unicode.IsDigit(rs[i-1]) && unicode.IsDigit(rs[i+1]):
+			b.WriteByte('.')
+		default:
+			b.WriteByte(' ')
+		}
+	}
+
+	var words []string
+	for _, w := range strings.Fields(b.String()) {
+		// Except "5g", which names a network, not five grams
+		if m := reGlued.FindStringSubmatch(w); m != nil && (m[2] != "g" || len(m[1]) > 1) {
+			words = append(words, m[1], expand(m[2]))
+			continue
+		}
+		words = append(words, expand(w))
+	}
+	return words
+}
+
+// Abbreviations returns the abbreviations Words spells out and their full
+// word, for analyzers outside Go that must agree with it.
+func Abbreviations() map[string]string {
+	return maps.Clone(abbreviations)
+}
+
+func expand(w string) string {
+	if full, ok := abbreviations[w]; ok {
+		return full
+	}
+	return w
+}
+
+// Nombre is a product name split into its words and the quantities it
+// states.
+type Nombre struct {
+	// Texto is the normalized name without the quantities below.
+	Texto string
+	// Piezas is the number of pieces in the pack; 0 when the name does
+	// not say.
+	Piezas int
+	// Cantidad is the measure of each piece in Unidad: "ml", "g" or "m".
+	// Both are zero when the name states no measure.
+	Cantidad float64
+	Unidad   string
+}
+
+// units maps a unit word to its base unit and the factor to convert to it.
+var units = map[string]struct {
+	base   string
+	factor float64
+}{
+	"ml": {"ml", 1}, "mililitro": {"ml", 1}, "mililitros": {"ml", 1},
+	"l": {"ml", 1000}, "lt": {"ml", 1000}, "lts": {"ml", 1000}, "litro": {"ml", 1000}, "litros": {"ml", 1000},
+	"g": {"g", 1}, "gr": {"g", 1}, "grs": {"g", 1}, "gramo": {"g", 1}, "gramos": {"g", 1},
+	"kg": {"g", 1000}, "kilo": {"g", 1000}, "kilos": {"g", 1000}, "kilogramo": {"g", 1000}, "kilogramos": {"g", 1000},
+	"m": {"m", 1}, "metros": {"m", 1},
+	"cm": {"m", 0.01}, "centimetro": {"m", 0.01}, "centimetros": {"m", 0.01},
+	"mm": {"m", 0.001}, "milimetro": {"m", 0.001}, "milimetros": {"m", 0.001},
+}
+
+// packWords follow a piece count: "10 piezas", "2 pares", "3 pack". A pair
+// counts as one piece, since it is sold as one.
+var packWords = map[string]bool{
+	"piezas": true, "unidades": true, "unidad": true, "pack": true, "pares": true,
+}
+
+// packLeads precede a piece count: "paquete 10", "kit de 3", "set con 5".
+var packLeads = map[string]bool{
+	"paquete": true, "pack": true, "kit": true, "set": true, "juego": true, "blister": true,
+}
+
+// Parse normalizes name and extracts the pieces per pack and the measure of
+// each piece. Only the first of each is taken.
+func Parse(name string) Nombre {
+	words := Words(name)
+	var n Nombre
+	drop := make([]bool, len(words))
+	number := func(i int) (float64, bool) {
+		if i < 0 || i >= len(words) {
+			return 0, false
+		}
+		v, err := strconv.ParseFloat(words[i], 64)
+		return v, err == nil && v > 0
+	}
+
+	isUnit := func(i int) bool {
+		if i < 0 || i >= len(words) {
+			return false
+		}
+		_, ok := units[words[i]]
+		return ok
+	}
+	// "11 x 11 cm" and "39 cm x 29 cm" are dimensions, not packs or measures
+	dimension := func(i int) bool {
+		_, prevNumber := number(i - 1)
+		return prevNumber || isUnit(i-1)
+	}
+
+	for i, w := range words {
+		// "x3" and "x 3"
+		if n.Piezas == 0 && strings.HasPrefix(w, "x") && !dimension(i) {
+			if v, ok := number(i + 1); ok && w == "x" && v == float64(int(v)) && !isUnit(i+2) {
+				n.Piezas = int(v)
+				drop[i], drop[i+1] = true, true
+				continue
+			}
+			if v, err := strconv.Atoi(w[1:]); err == nil && v > 1 {
+				n.Piezas = v
+				drop[i] = true
+				continue
+			}
+		}
+		v, ok := number(i)
+		if !ok || i+1 >= len(words) {
+			continue
+		}
+		next := words[i+1]
+		// "10 piezas", "2 pares"
+		if packWords[next] && n.Piezas == 0 && v == float64(int(v)) {
+			n.Piezas = int(v)
+			drop[i], drop[i+1] = true, true
+			continue
+		}
+		// "500 ml", "1.5 m"; a bare "5 g" is more likely a phone's 5G
+		inDimension := (i > 0 && words[i-1] == "x") || (i+2 < len(words) && words[i+2] == "x")
+		if u, ok := units[next]; ok && n.Unidad == "" && (next != "g" || v >= 10) && !inDimension {
+			n.Cantidad = math.Round(v*u.factor*1e6) / 1e6
+			n.Unidad = u.base
+			drop[i], drop[i+1] = true, true
+		}
+	}
+	// "paquete 10", "paquete de 10", "kit con 3"
+	for i, w := range words {
+		if n.Piezas != 0 || !packLeads[w] {
+			continue
+		}
+		j := i + 1
+		if j < len(words) && (words[j] == "de" || words[j] == "con") {
+			j++
+		}
+		if v, ok := number(j); ok && v == float64(int(v)) && !drop[j] {
+			n.Piezas = int(v)
+			drop[j] = true
+			if j+1 < len(words) && words[j+1] == "piezas" {
+				drop[j+1] = true
+			}
+		}
+	}
+	kept := words[:0]
+	for i, w := range words {
+		if !drop[i] {
+			kept = append(kept, w)
+		}
+	}
+	n.Texto = strings.Join(kept, " ")
+	return n
+}
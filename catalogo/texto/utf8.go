@@ -0,0 +1,79 @@
+package texto
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// bom is the UTF-8 byte order mark Windows editors and some servers put at
+// the start of a file.
+var bom = []byte("\xef\xbb\xbf")
+
+// SinBOM returns data without a leading UTF-8 byte order mark, which
+// encoding/json rejects.
+func SinBOM(data []byte) []byte {
+	return bytes.TrimPrefix(data, bom)
+}
+
+// cp1252 are the characters Windows-1252 puts in 0x80-0x9F, where
+// ISO-8859-1 has control codes; the rest of both is Unicode's first 256
+// code points. The five bytes Windows-1252 leaves undefined keep their
+// ISO-8859-1 meaning.
+var cp1252 = [32]rune{
+	'€', 0x81, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0x8d, 'Ž', 0x8f,
+	0x90, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0x9d, 'ž', 'Ÿ',
+}
+
+var reMetaCharset = regexp.MustCompile(`(?i)<meta[^>]+charset=["']?([\w-]+)`)
+
+// latinos are the charset labels read as Windows-1252, as browsers do.
+var latinos = map[string]bool{
+	"windows-1252": true, "cp1252": true, "iso-8859-1": true, "latin1": true,
+	"iso8859-1": true, "l1": true, "us-ascii": true,
+}
+
+// UTF8 returns body, a scraped page or API response, as UTF-8 without a
+// byte order mark. A body in Windows-1252 or ISO-8859-1, whether declared
+// in contentType or a <meta charset> or just not valid UTF-8, is
+// transcoded.
+func UTF8(body []byte, contentType string) []byte {
+	body = SinBOM(body)
+	charset := ""
+	if _, params, ok := strings.Cut(contentType, "charset="); ok {
+		charset = strings.Trim(strings.TrimSpace(strings.Split(params, ";")[0]), `"'`)
+	} else if m := reMetaCharset.FindSubmatch(body[:min(len(body), 1024)]); m != nil {
+		charset = string(m[1])
+	}
+	if !latinos[strings.ToLower(charset)] && utf8.Valid(body) {
+		return body
+	}
+	// A page that says it is Latin-1 but is valid UTF-8 with non-ASCII
+	// text was most likely mislabeled.
+	if utf8.Valid(body) && !esASCII(body) {
+		return body
+	}
+	var b bytes.Buffer
+	b.Grow(len(body) + len(body)/8)
+	for _, c := range body {
+		switch {
+		case c < 0x80:
+			b.WriteByte(c)
+		case c < 0xa0:
+			b.WriteRune(cp1252[c-0x80])
+		default:
+			b.WriteRune(rune(c))
+		}
+	}
+	return b.Bytes()
+}
+
+func esASCII(b []byte) bool {
+	for _, c := range b {
+		if c >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
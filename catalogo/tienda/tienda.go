@@ -0,0 +1,104 @@
+// Package tienda reads a store's own settings from catalogo.json for its
+// scraper, which knows only its store id and the -config path.
+package tienda
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"catalogo/texto"
+)
+
+// ZonaPredeterminada is the time zone of stores that set none.
+const ZonaPredeterminada = "America/Mexico_City"
+
+// Leer decodes the entry of the store id in the configuration file fpath
+// (catalogo.json) into v, whose fields name the settings wanted. A missing
+// file or store leaves v as it is.
+func Leer(fpath, id string, v any) error {
+	data, err := os.ReadFile(fpath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error leyendo %s: %w", fpath, err)
+	}
+	var cfg struct {
+		Tiendas []json.RawMessage `json:"tiendas"`
+	}
+	if err := json.Unmarshal(texto.SinBOM(data), &cfg); err != nil {
+		return fmt.Errorf("error parsing %s: %w", fpath, err)
+	}
+	for _, raw := range cfg.Tiendas {
+		var s struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return fmt.Errorf("error parsing %s: %w", fpath, err)
+		}
+		if texto.Equal(s.ID, id) {
+			if err := json.Unmarshal(raw, v); err != nil {
+				return fmt.Errorf("error parsing %s: tienda %s: %w", fpath, s.ID, err)
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// Zona loads the time zone name ("zonaHoraria" in catalogo.json), or
+// ZonaPredeterminada when empty.
+func Zona(name string) (*time.Location, error) {
+	if name == "" {
+		name = ZonaPredeterminada
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("zonaHoraria %q: %w", name, err)
+	}
+	return loc, nil
+}
+
+// LeerZona returns the time zone of the store id in fpath.
+func LeerZona(fpath, id string) (*time.Location, error) {
+	var s struct {
+		Zona string `json:"zonaHoraria"`
+	}
+	if err := Leer(fpath, id, &s); err != nil {
+		return nil, err
+	}
+	loc, err := Zona(s.Zona)
+	if err != nil {
+		return nil, fmt.Errorf("tienda %s: %w", id, err)
+	}
+	return loc, nil
+}
+
+// Rutas returns the default output and configuration of the scraper of the
+// store whose directory is dir ("catalogo-buytiti"): dir/productos.json and
+// the catalogo.json beside dir. They are found from the working directory
+// when it is the store's directory or one below it, such as its scraper,
+// or the repository root; anywhere else, as with an installed binary, both
+// are in the working directory.
+func Rutas(dir string) (salida, config string) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return "productos.json", "catalogo.json"
+	}
+	for d := wd; ; d = filepath.Dir(d) {
+		if filepath.Base(d) == dir {
+			return filepath.Join(d, "productos.json"), filepath.Join(filepath.Dir(d), "catalogo.json")
+		}
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+	if info, err := os.Stat(filepath.Join(wd, dir)); err == nil && info.IsDir() {
+		return filepath.Join(wd, dir, "productos.json"), filepath.Join(wd, "catalogo.json")
+	}
+	return filepath.Join(wd, "productos.json"), filepath.Join(wd, "catalogo.json")
+}
@@ -0,0 +1,156 @@
+// Package timing accumulates where a scrape run spends its time — per
+// category and per worker — for the [RESUMEN] block printed at the end, so
+// -workers and -delay can be tuned from data.
+package timing
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Category is the time spent fetching and parsing one category's pages.
+type Category struct {
+	Tiempo     time.Duration
+	Paginas    int
+	Reintentos int
+}
+
+// Worker splits a worker's wall time into fetching (Ocupado), sleeping
+// between requests (Delay) and waiting for work (Ocioso).
+type Worker struct {
+	Paginas int
+	Ocupado time.Duration
+	Delay   time.Duration
+	Ocioso  time.Duration
+}
+
+// Stats is safe for concurrent use by the workers.
+type Stats struct {
+	mu         sync.Mutex
+	categories map[string]*Category
+	workers    map[int]*Worker
+}
+
+// New returns empty stats.
+func New() *Stats {
+	return &Stats{categories: make(map[string]*Category), workers: make(map[int]*Worker)}
+}
+
+// Page records one page (listing or product detail) of categoria handled by
+// worker in d, including the retries it needed. worker 0 means the page was
+// not fetched by a pool worker.
+func (s *Stats) Page(worker int, categoria string, d time.Duration, retries int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.category(categoria)
+	c.Tiempo += d
+	c.Paginas++
+	c.Reintentos += retries
+	if worker > 0 {
+		w := s.worker(worker)
+		w.Paginas++
+		w.Ocupado += d
+	}
+}
+
+// Delay records time worker slept between requests.
+func (s *Stats) Delay(worker int, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.worker(worker).Delay += d
+}
+
+// Idle records time worker waited for a task.
+func (s *Stats) Idle(worker int, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.worker(worker).Ocioso += d
+}
+
+func (s *Stats) category(name string) *Category {
+	c, ok := s.categories[name]
+	if !ok {
+		c = &Category{}
+		s.categories[name] = c
+	}
+	return c
+}
+
+func (s *Stats) worker(id int) *Worker {
+	w, ok := s.workers[id]
+	if !ok {
+		w = &Worker{}
+		s.workers[id] = w
+	}
+	return w
+}
+
+// Summary renders the breakdown as log lines: categories by time spent, the
+// average page latency and each worker's busy, delay and idle time.
+func (s *Stats) Summary() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var lines []string
+	var total time.Duration
+	var pages, retries int
+
+	names := make([]string, 0, len(s.categories))
+	for name, c := range s.categories {
+		names = append(names, name)
+		total += c.Tiempo
+		pages += c.Paginas
+		retries += c.Reintentos
+	}
+	if pages == 0 {
+		return nil
+	}
+	sort.Slice(names, func(i, j int) bool {
+		ci, cj := s.categories[names[i]], s.categories[names[j]]
+		if ci.Tiempo != cj.Tiempo {
+			return ci.Tiempo > cj.Tiempo
+		}
+		return names[i] < names[j]
+	})
+
+	lines = append(lines, "Tiempo por categoría:")
+	for _, name := range names {
+		c := s.categories[name]
+		lines = append(lines, fmt.Sprintf("  %s: %v en %d págs (%v/pág), %s",
+			name, round(c.Tiempo), c.Paginas, round(c.Tiempo/time.Duration(c.Paginas)), reintentos(c.Reintentos)))
+	}
+	lines = append(lines, fmt.Sprintf("Latencia promedio: %v/pág en %d págs, %s",
+		round(total/time.Duration(pages)), pages, reintentos(retries)))
+
+	if len(s.workers) > 0 {
+		ids := make([]int, 0, len(s.workers))
+		for id := range s.workers {
+			ids = append(ids, id)
+		}
+		sort.Ints(ids)
+		lines = append(lines, "Workers:")
+		for _, id := range ids {
+			w := s.workers[id]
+			lines = append(lines, fmt.Sprintf("  W%d: %d págs, ocupado %v, delay %v, ocioso %v",
+				id, w.Paginas, round(w.Ocupado), round(w.Delay), round(w.Ocioso)))
+		}
+	}
+	return lines
+}
+
+func reintentos(n int) string {
+	if n == 1 {
+		return "1 reintento"
+	}
+	return fmt.Sprintf("%d reintentos", n)
+}
+
+// round keeps durations readable: milliseconds under a second, else tenths.
+func round(d time.Duration) time.Duration {
+	if d < time.Second {
+		return d.Round(time.Millisecond)
+	}
+	return d.Round(100 * time.Millisecond)
+}
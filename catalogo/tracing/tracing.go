@@ -0,0 +1,360 @@
+// Package tracing records spans of a scrape run and exports them to an
+// OpenTelemetry collector over OTLP/HTTP (JSON encoding). It covers what the
+// scrapers need — nested spans with attributes, events and an error status —
+// without pulling in the OpenTelemetry SDK.
+//
+// A nil *Tracer and a nil *Span are valid and do nothing, so call sites don't
+// need to check whether tracing is enabled.
+package tracing
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// batchSize is the number of finished spans buffered before they are exported.
+const batchSize = 512
+
+// Tracer buffers finished spans and exports them in batches.
+type Tracer struct {
+	url     string
+	service string
+	client  *http.Client
+
+	mu      sync.Mutex
+	traceID [16]byte
+	run     *Span
+	pending []*Span
+	wg      sync.WaitGroup
+	err     error
+}
+
+// New returns a tracer exporting to the OTLP/HTTP endpoint (the collector's
+// base URL, e.g. http://localhost:4318; /v1/traces is appended unless the URL
+// already has a path). It returns nil, a disabled tracer, when endpoint is empty.
+func New(endpoint, service string) *Tracer {
+	if endpoint == "" {
+		return nil
+	}
+	u := strings.TrimSuffix(endpoint, "/")
+	if i := strings.Index(u, "://"); i < 0 || !strings.Contains(u[i+3:], "/") {
+		u += "/v1/traces"
+	}
+	t := &Tracer{url: u, service: service, client: &http.Client{Timeout: 10 * time.Second}}
+	rand.Read(t.traceID[:])
+	return t
+}
+
+// Span is one timed operation.
+type Span struct {
+	tracer *Tracer
+	name   string
+	id     [8]byte
+	parent [8]byte
+	kind   int
+	start  time.Time
+
+	mu     sync.Mutex
+	end    time.Time
+	attrs  []attribute
+	events []event
+	err    string
+}
+
+type attribute struct {
+	key   string
+	value any
+}
+
+type event struct {
+	name  string
+	time  time.Time
+	attrs []attribute
+}
+
+// Span kinds, as defined by OTLP.
+const (
+	KindInternal = 1
+	KindClient   = 3
+)
+
+// StartRun starts the root span of the run. Spans started with a nil parent
+// become its children.
+func (t *Tracer) StartRun(name string, kv ...any) *Span {
+	if t == nil {
+		return nil
+	}
+	s := t.newSpan(nil, name, KindInternal, kv)
+	t.mu.Lock()
+	t.run = s
+	t.mu.Unlock()
+	return s
+}
+
+// Start starts an internal span under parent (the run span when parent is nil).
+// kv are attribute key/value pairs.
+func (t *Tracer) Start(parent *Span, name string, kv ...any) *Span {
+	if t == nil {
+		return nil
+	}
+	return t.newSpan(parent, name, KindInternal, kv)
+}
+
+// StartClient starts a span for an outgoing request.
+func (t *Tracer) StartClient(parent *Span, name string, kv ...any) *Span {
+	if t == nil {
+		return nil
+	}
+	return t.newSpan(parent, name, KindClient, kv)
+}
+
+func (t *Tracer) newSpan(parent *Span, name string, kind int, kv []any) *Span {
+	s := &Span{tracer: t, name: name, kind: kind, start: time.Now(), attrs: pairs(kv)}
+	rand.Read(s.id[:])
+	if parent == nil {
+		t.mu.Lock()
+		parent = t.run
+		t.mu.Unlock()
+	}
+	if parent != nil {
+		s.parent = parent.id
+	}
+	return s
+}
+
+// SetAttr sets an attribute on the span. Values are strings, bools, integers
+// or floats; anything else is formatted with fmt.
+func (s *Span) SetAttr(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.attrs = append(s.attrs, attribute{key, value})
+	s.mu.Unlock()
+}
+
+// Event records a point in time inside the span, such as a retry.
+func (s *Span) Event(name string, kv ...any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.events = append(s.events, event{name: name, time: time.Now(), attrs: pairs(kv)})
+	s.mu.Unlock()
+}
+
+// End finishes the span, marking it as failed when err is not nil, and queues
+// it for export.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if !s.end.IsZero() {
+		s.mu.Unlock()
+		return
+	}
+	s.end = time.Now()
+	if err != nil {
+		s.err = err.Error()
+	}
+	s.mu.Unlock()
+
+	t := s.tracer
+	t.mu.Lock()
+	t.pending = append(t.pending, s)
+	var batch []*Span
+	if len(t.pending) >= batchSize {
+		batch, t.pending = t.pending, nil
+	}
+	t.mu.Unlock()
+	if batch != nil {
+		t.wg.Add(1)
+		go func() {
+			defer t.wg.Done()
+			t.export(batch)
+		}()
+	}
+}
+
+// Shutdown exports the spans still buffered and waits for in-flight exports.
+// It returns the first export error of the run.
+func (t *Tracer) Shutdown() error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	batch := t.pending
+	t.pending = nil
+	t.mu.Unlock()
+	if len(batch) > 0 {
+		t.export(batch)
+	}
+	t.wg.Wait()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
+
+func (t *Tracer) export(batch []*Span) {
+	err := t.post(batch)
+	if err != nil {
+		t.mu.Lock()
+		if t.err == nil {
+			t.err = err
+		}
+		t.mu.Unlock()
+	}
+}
+
+func (t *Tracer) post(batch []*Span) error {
+	spans := make([]otlpSpan, 0, len(batch))
+	for _, s := range batch {
+		spans = append(spans, t.encode(s))
+	}
+	payload := otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: encodeAttrs([]attribute{{"service.name", t.service}})},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "catalogo/tracing"},
+			Spans: spans,
+		}},
+	}}}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error serializando trazas: %w", err)
+	}
+
+	resp, err := t.client.Post(t.url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("error enviando trazas: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 200))
+		return fmt.Errorf("colector OTLP HTTP %d: %s", resp.StatusCode, body)
+	}
+	return nil
+}
+
+func (t *Tracer) encode(s *Span) otlpSpan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := otlpSpan{
+		TraceID:    hex.EncodeToString(t.traceID[:]),
+		SpanID:     hex.EncodeToString(s.id[:]),
+		Name:       s.name,
+		Kind:       s.kind,
+		Start:      fmt.Sprint(s.start.UnixNano()),
+		End:        fmt.Sprint(s.end.UnixNano()),
+		Attributes: encodeAttrs(s.attrs),
+	}
+	if s.parent != [8]byte{} {
+		out.ParentSpanID = hex.EncodeToString(s.parent[:])
+	}
+	for _, e := range s.events {
+		out.Events = append(out.Events, otlpEvent{
+			Time:       fmt.Sprint(e.time.UnixNano()),
+			Name:       e.name,
+			Attributes: encodeAttrs(e.attrs),
+		})
+	}
+	if s.err != "" {
+		out.Status = &otlpStatus{Code: 2, Message: s.err}
+	}
+	return out
+}
+
+// pairs turns key/value arguments into attributes; a trailing key without a
+// value is dropped.
+func pairs(kv []any) []attribute {
+	var attrs []attribute
+	for i := 0; i+1 < len(kv); i += 2 {
+		attrs = append(attrs, attribute{fmt.Sprint(kv[i]), kv[i+1]})
+	}
+	return attrs
+}
+
+// --- OTLP/HTTP JSON payload ---
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID      string         `json:"traceId"`
+	SpanID       string         `json:"spanId"`
+	ParentSpanID string         `json:"parentSpanId,omitempty"`
+	Name         string         `json:"name"`
+	Kind         int            `json:"kind"`
+	Start        string         `json:"startTimeUnixNano"`
+	End          string         `json:"endTimeUnixNano"`
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+	Events       []otlpEvent    `json:"events,omitempty"`
+	Status       *otlpStatus    `json:"status,omitempty"`
+}
+
+type otlpEvent struct {
+	Time       string         `json:"timeUnixNano"`
+	Name       string         `json:"name"`
+	Attributes []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"`
+}
+
+func encodeAttrs(attrs []attribute) []otlpKeyValue {
+	out := make([]otlpKeyValue, 0, len(attrs))
+	for _, a := range attrs {
+		var v map[string]any
+		switch x := a.value.(type) {
+		case string:
+			v = map[string]any{"stringValue": x}
+		case bool:
+			v = map[string]any{"boolValue": x}
+		case int:
+			v = map[string]any{"intValue": fmt.Sprint(x)}
+		case int64:
+			v = map[string]any{"intValue": fmt.Sprint(x)}
+		case float64:
+			v = map[string]any{"doubleValue": x}
+		default:
+			v = map[string]any{"stringValue": fmt.Sprint(x)}
+		}
+		out = append(out, otlpKeyValue{a.key, v})
+	}
+	return out
+}
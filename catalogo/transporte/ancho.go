@@ -0,0 +1,130 @@
+package transporte
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// unidades are the sizes -max-bandwidth accepts, in bytes.
+var unidades = map[string]float64{
+	"b": 1, "kb": 1 << 10, "mb": 1 << 20, "gb": 1 << 30,
+	"k": 1 << 10, "m": 1 << 20, "g": 1 << 30,
+}
+
+// ParseAnchoBanda reads a -max-bandwidth value, "2MB/s", "512KB/s" or
+// "1.5M", in bytes per second; "" and "0" are no limit.
+func ParseAnchoBanda(s string) (float64, error) {
+	spec := strings.ToLower(strings.TrimSpace(s))
+	spec = strings.TrimSuffix(spec, "/s")
+	if spec == "" || spec == "0" {
+		return 0, nil
+	}
+	i := strings.IndexFunc(spec, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	num, unit := spec, "b"
+	if i >= 0 {
+		num, unit = spec[:i], strings.TrimSpace(spec[i:])
+	}
+	v, err := strconv.ParseFloat(num, 64)
+	mult, ok := unidades[unit]
+	if err != nil || !ok || v <= 0 {
+		return 0, fmt.Errorf("ancho de banda inválido %q (ej. 2MB/s, 512KB/s)", s)
+	}
+	return v * mult, nil
+}
+
+// rafaga is how much unused bandwidth a Limitador lets accumulate, so a
+// pause between requests does not allow a burst above the limit later.
+const rafaga = 100 * time.Millisecond
+
+// Limitador caps the bytes per second shared by every response read
+// through it, across all the goroutines that use it.
+type Limitador struct {
+	porSegundo float64
+
+	mu sync.Mutex
+	// libre is when the bytes reserved so far will have been transferred
+	libre time.Time
+}
+
+// NewLimitador returns a limiter of porSegundo bytes per second, or nil
+// (no limit) when it is zero.
+func NewLimitador(porSegundo float64) *Limitador {
+	if porSegundo <= 0 {
+		return nil
+	}
+	return &Limitador{porSegundo: porSegundo}
+}
+
+// Esperar blocks until n more bytes fit in the limit, or ctx is done.
+func (l *Limitador) Esperar(ctx context.Context, n int) error {
+	if l == nil || n <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if l.libre.Before(now.Add(-rafaga)) {
+		l.libre = now.Add(-rafaga)
+	}
+	l.libre = l.libre.Add(time.Duration(float64(n) / l.porSegundo * float64(time.Second)))
+	wait := l.libre.Sub(now)
+	l.mu.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Limitar returns base with its response bodies read within l. With a nil
+// Limitador it returns base.
+func Limitar(base http.RoundTripper, l *Limitador) http.RoundTripper {
+	if l == nil {
+		return base
+	}
+	return &limitado{base: base, lim: l}
+}
+
+type limitado struct {
+	base http.RoundTripper
+	lim  *Limitador
+}
+
+func (t *limitado) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = &cuerpoLimitado{ReadCloser: resp.Body, ctx: req.Context(), lim: t.lim}
+	return resp, nil
+}
+
+type cuerpoLimitado struct {
+	io.ReadCloser
+	ctx context.Context
+	lim *Limitador
+}
+
+func (b *cuerpoLimitado) Read(p []byte) (int, error) {
+	// Small reads keep the rate smooth rather than one long pause per
+	// buffer
+	if len(p) > 16<<10 {
+		p = p[:16<<10]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if werr := b.lim.Esperar(b.ctx, n); werr != nil && err == nil {
+		err = werr
+	}
+	return n, err
+}
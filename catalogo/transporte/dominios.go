@@ -0,0 +1,67 @@
+package transporte
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"catalogo/tienda"
+)
+
+// ErrDominio is the error of a request to a host outside the allowed
+// domains.
+var ErrDominio = errors.New("dominio no permitido")
+
+// Dominios are the domains a scraper may request, each with its
+// subdomains: "buytiti.com" allows www.buytiti.com and cdn.buytiti.com.
+type Dominios []string
+
+// Permite reports whether host, with or without a port, is one of d or a
+// subdomain of one.
+func (d Dominios) Permite(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for _, dom := range d {
+		dom = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(dom)), ".")
+		if host == dom || strings.HasSuffix(host, "."+dom) {
+			return true
+		}
+	}
+	return false
+}
+
+// Restringir returns base refusing, with ErrDominio, every request outside
+// d, redirects included, since the client sends each hop through it.
+// bloqueado, when not nil, is told of each refused request.
+func Restringir(base http.RoundTripper, d Dominios, bloqueado func(*http.Request)) http.RoundTripper {
+	return &restringido{base: base, dominios: d, bloqueado: bloqueado}
+}
+
+type restringido struct {
+	base      http.RoundTripper
+	dominios  Dominios
+	bloqueado func(*http.Request)
+}
+
+func (t *restringido) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.dominios.Permite(req.URL.Hostname()) {
+		if t.bloqueado != nil {
+			t.bloqueado(req)
+		}
+		return nil, fmt.Errorf("%w: %s", ErrDominio, req.URL.Hostname())
+	}
+	return t.base.RoundTrip(req)
+}
+
+// LeerDominios returns the domains the scraper of the store id may
+// request: propios, its site's, and the "dominios" of its entry in the
+// configuration file fpath (catalogo.json), such as a CDN.
+func LeerDominios(fpath, id string, propios ...string) (Dominios, error) {
+	var s struct {
+		Dominios []string `json:"dominios"`
+	}
+	if err := tienda.Leer(fpath, id, &s); err != nil {
+		return nil, err
+	}
+	return append(Dominios(propios), s.Dominios...), nil
+}
@@ -0,0 +1,41 @@
+// Package transporte builds the HTTP transport the scrapers share, with
+// the TLS settings of suppliers behind corporate proxies or with
+// self-signed staging certificates.
+package transporte
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// TLS returns a copy of http.DefaultTransport that also trusts the PEM
+// certificates in caCert, when set, besides the system's, and that skips
+// certificate verification altogether when insecure is true.
+func TLS(caCert string, insecure bool) (*http.Transport, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if caCert == "" && !insecure {
+		return t, nil
+	}
+	cfg := &tls.Config{InsecureSkipVerify: insecure}
+	if caCert != "" {
+		pem, err := os.ReadFile(caCert)
+		if err != nil {
+			return nil, fmt.Errorf("error leyendo %s: %w", caCert, err)
+		}
+		// Without a system pool (some minimal containers) the given CA is
+		// the only one trusted
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: sin certificados PEM", caCert)
+		}
+		cfg.RootCAs = pool
+	}
+	t.TLSClientConfig = cfg
+	return t, nil
+}
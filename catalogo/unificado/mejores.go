@@ -0,0 +1,107 @@
+package unificado
+
+import (
+	"math"
+	"sort"
+)
+
+// Alternativa is another store's offer for a recommended product and what
+// buying the recommendation instead saves, per unit when the recommendation
+// has one.
+type Alternativa struct {
+	Tienda         string  `json:"tienda"`
+	Link           string  `json:"link"`
+	Precio         float64 `json:"precio"`
+	PrecioUnitario float64 `json:"precioUnitario,omitempty"`
+	Stock          string  `json:"stock"`
+	Disponible     bool    `json:"disponible"`
+	Ahorro         float64 `json:"ahorro"`
+}
+
+// Recomendacion is one entry of mejores-precios.json: where to buy a product
+// sold by more than one store.
+type Recomendacion struct {
+	Nombre       string        `json:"nombre"`
+	Categoria    string        `json:"categoria"`
+	Tienda       string        `json:"tienda"`
+	Link         string        `json:"link"`
+	Precio       float64       `json:"precio"`
+	Moneda       string        `json:"moneda,omitempty"`
+	Stock        string        `json:"stock"`
+	Alternativas []Alternativa `json:"alternativas"`
+	// PrecioUnitario and Unidad are set when the offers were compared per
+	// unit because some state a quantity; savings are then per Unidad.
+	PrecioUnitario float64 `json:"precioUnitario,omitempty"`
+	Unidad         string  `json:"unidad,omitempty"`
+	// AhorroMaximo is the saving over the most expensive alternative.
+	AhorroMaximo float64 `json:"ahorroMaximo"`
+}
+
+// MejoresPrecios recommends the cheapest in-stock offer of every product
+// found in more than one store, biggest savings first. Offers are compared
+// per unit when they share one, so a pack of 10 is not beaten by a single
+// piece just for costing less, and only with offers in the same currency.
+// Products no store has in stock are left out.
+func MejoresPrecios(products []Producto) []Recomendacion {
+	var out []Recomendacion
+	for _, p := range products {
+		if len(p.Ofertas) < 2 {
+			continue
+		}
+		offers := comparables(p.Ofertas)
+		if len(offers) < 2 {
+			continue
+		}
+		price := comparePrice(offers)
+		best := -1
+		for i, o := range offers {
+			if o.Disponible() && (best < 0 || price(o) < price(offers[best])) {
+				best = i
+			}
+		}
+		if best < 0 {
+			continue
+		}
+		o := offers[best]
+		r := Recomendacion{
+			Nombre:    p.Nombre,
+			Categoria: p.Categoria,
+			Tienda:    o.Tienda,
+			Link:      o.Link,
+			Precio:    o.Precio,
+			Moneda:    o.Moneda,
+			Stock:     o.Stock,
+		}
+		unitary := perUnit(offers)
+		if unitary {
+			r.PrecioUnitario, r.Unidad = o.costo()
+		}
+		for i, alt := range offers {
+			if i == best {
+				continue
+			}
+			a := Alternativa{
+				Tienda:     alt.Tienda,
+				Link:       alt.Link,
+				Precio:     alt.Precio,
+				Stock:      alt.Stock,
+				Disponible: alt.Disponible(),
+			}
+			if unitary {
+				a.PrecioUnitario, _ = alt.costo()
+			}
+			ahorro := math.Round((price(alt)-price(o))*100) / 100
+			a.Ahorro = ahorro
+			r.Alternativas = append(r.Alternativas, a)
+			r.AhorroMaximo = max(r.AhorroMaximo, ahorro)
+		}
+		out = append(out, r)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].AhorroMaximo != out[j].AhorroMaximo {
+			return out[i].AhorroMaximo > out[j].AhorroMaximo
+		}
+		return out[i].Nombre < out[j].Nombre
+	})
+	return out
+}
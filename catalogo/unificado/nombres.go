@@ -0,0 +1,162 @@
+package unificado
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"catalogo/producto"
+	"catalogo/texto"
+)
+
+// CriteriosNombre are what tells apart products with the same name, for
+// catalogo combine's -nombre-mostrar: the "Color" of the variant, the whole
+// variant, the pack size, the stores and the category.
+var CriteriosNombre = []string{"color", "variante", "paquete", "tienda", "categoria"}
+
+// NombreMostrarPredeterminado is the default -nombre-mostrar.
+const NombreMostrarPredeterminado = "color,paquete,tienda"
+
+// ParseCriterios reads a comma-separated list of CriteriosNombre, in the
+// order they are tried.
+func ParseCriterios(list string) ([]string, error) {
+	var out []string
+	for c := range strings.SplitSeq(list, ",") {
+		c = strings.ToLower(strings.TrimSpace(c))
+		if c == "" {
+			continue
+		}
+		if !contiene(CriteriosNombre, c) {
+			return nil, fmt.Errorf("criterio desconocido %q (válidos: %s)", c, strings.Join(CriteriosNombre, ", "))
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+func contiene(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// NombresMostrar sets NombreMostrar of the products that share their name,
+// compared without case or accents, with others: the name followed by what
+// tells it apart, e.g. "Cable USB-C (Rojo, BuyTiti)". Criterios are tried in
+// order; one whose value is the same for the whole group adds nothing, and
+// once every product of the group reads differently the rest are skipped.
+// Products with a name of their own have no NombreMostrar.
+func NombresMostrar(products []Producto, criterios []string) {
+	groups := make(map[string][]int)
+	for i := range products {
+		products[i].NombreMostrar = ""
+		key := texto.Normalize(products[i].Nombre)
+		groups[key] = append(groups[key], i)
+	}
+	for _, group := range groups {
+		if len(group) < 2 {
+			continue
+		}
+		parts := make([][]string, len(group))
+		for _, c := range criterios {
+			if distintos(parts) {
+				break
+			}
+			values := make([]string, len(group))
+			for i, idx := range group {
+				values[i] = valorCriterio(products[idx], c)
+			}
+			if iguales(values) {
+				continue
+			}
+			for i, v := range values {
+				if v != "" {
+					parts[i] = append(parts[i], v)
+				}
+			}
+		}
+		for i, idx := range group {
+			if len(parts[i]) > 0 {
+				products[idx].NombreMostrar = products[idx].Nombre + " (" + strings.Join(parts[i], ", ") + ")"
+			}
+		}
+	}
+}
+
+// distintos reports whether every product already has a suffix of its own.
+func distintos(parts [][]string) bool {
+	seen := make(map[string]bool, len(parts))
+	for _, p := range parts {
+		key := strings.Join(p, "\x00")
+		if seen[key] {
+			return false
+		}
+		seen[key] = true
+	}
+	return true
+}
+
+func iguales(values []string) bool {
+	for _, v := range values[1:] {
+		if texto.Normalize(v) != texto.Normalize(values[0]) {
+			return false
+		}
+	}
+	return true
+}
+
+// valorCriterio is what criterio c says of p, "" when nothing.
+func valorCriterio(p Producto, c string) string {
+	switch c {
+	case "color":
+		return atributo(p.Variante, "color")
+	case "variante":
+		return p.Variante
+	case "paquete":
+		if len(p.Ofertas) == 0 {
+			return ""
+		}
+		return paquete(p.Ofertas[0])
+	case "tienda":
+		var stores []string
+		for _, o := range p.Ofertas {
+			if !contiene(stores, o.Tienda) {
+				stores = append(stores, o.Tienda)
+			}
+		}
+		return strings.Join(stores, " / ")
+	case "categoria":
+		return p.Categoria
+	}
+	return ""
+}
+
+// atributo is the value of the attribute name in a variant such as
+// "Color: Rojo, Talla: M".
+func atributo(variante, name string) string {
+	for pair := range strings.SplitSeq(variante, ",") {
+		k, v, ok := strings.Cut(pair, ":")
+		if ok && texto.Normalize(k) == name {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+// paquete describes the quantity an offer sells: "10 pzs", "500 ml".
+func paquete(o Oferta) string {
+	if o.CantidadPaquete <= 0 || o.Unidad == "" {
+		return ""
+	}
+	n := strconv.FormatFloat(o.CantidadPaquete, 'f', -1, 64)
+	if o.Unidad != producto.UnidadPieza {
+		return n + " " + o.Unidad
+	}
+	if o.CantidadPaquete == 1 {
+		return "1 pza"
+	}
+	return n + " pzs"
+}
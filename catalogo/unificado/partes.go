@@ -0,0 +1,203 @@
+package unificado
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"catalogo/texto"
+)
+
+// A unified catalog too big for one file (catalogo combine -shard-size) is
+// written in parts, catalogo-unificado-part-001.json and on, with a
+// manifest, catalogo-unificado.manifest.json, that says which parts hold
+// each category, so a page or catalogo serve loads only the parts it needs.
+
+// Parte is one file of a sharded catalog.
+type Parte struct {
+	// Archivo is the part's file name, next to the manifest.
+	Archivo    string   `json:"archivo"`
+	Productos  int      `json:"productos"`
+	Bytes      int      `json:"bytes"`
+	Categorias []string `json:"categorias"`
+}
+
+// Manifiesto describes a sharded catalog.
+type Manifiesto struct {
+	Formato    int       `json:"formato"`
+	GeneradoEn time.Time `json:"generadoEn"`
+	Total      int       `json:"total"`
+	Partes     []Parte   `json:"partes"`
+	// Categorias maps each category to the parts that hold its products.
+	Categorias map[string][]string `json:"categorias"`
+	// Conteos counts the products of each category.
+	Conteos map[string]int `json:"conteos"`
+}
+
+// ManifiestoPath is where the manifest of the catalog fpath goes.
+func ManifiestoPath(fpath string) string {
+	return strings.TrimSuffix(fpath, ".json") + ".manifest.json"
+}
+
+func partePath(fpath string, n int) string {
+	return fmt.Sprintf("%s-part-%03d.json", strings.TrimSuffix(fpath, ".json"), n)
+}
+
+func partesGlob(fpath string) string {
+	return strings.TrimSuffix(fpath, ".json") + "-part-*.json"
+}
+
+// EscribirPartes writes products as the sharded catalog fpath, in parts of
+// at most maxBytes of JSON each, and its manifest, which it returns.
+// Products are grouped by category, in name order, so a category spans as
+// few parts as it can: one that does not fit in what is left of a part
+// starts a new one, and only a category bigger than maxBytes is split. The
+// single file fpath and the parts of an earlier, bigger catalog are
+// removed, so no reader mixes old and new.
+func EscribirPartes(products []Producto, fpath string, maxBytes int) (Manifiesto, error) {
+	sorted := slices.Clone(products)
+	slices.SortStableFunc(sorted, func(a, b Producto) int { return strings.Compare(a.Categoria, b.Categoria) })
+	sizes := make([]int, len(sorted))
+	catBytes := make(map[string]int)
+	for i, p := range sorted {
+		data, err := json.MarshalIndent(p, "    ", "    ")
+		if err != nil {
+			return Manifiesto{}, fmt.Errorf("error serializando JSON: %w", err)
+		}
+		sizes[i] = len(data) + 6
+		catBytes[p.Categoria] += sizes[i]
+	}
+
+	m := Manifiesto{Formato: 1, GeneradoEn: time.Now(), Total: len(sorted), Categorias: make(map[string][]string), Conteos: make(map[string]int)}
+	var part []Producto
+	partBytes := 0
+	flush := func() error {
+		if len(part) == 0 {
+			return nil
+		}
+		fpart := partePath(fpath, len(m.Partes)+1)
+		data, err := json.MarshalIndent(part, "", "    ")
+		if err != nil {
+			return fmt.Errorf("error serializando JSON: %w", err)
+		}
+		if err := os.WriteFile(fpart, data, 0644); err != nil {
+			return fmt.Errorf("error escribiendo %s: %w", fpart, err)
+		}
+		p := Parte{Archivo: filepath.Base(fpart), Productos: len(part), Bytes: len(data)}
+		for _, prod := range part {
+			if !slices.Contains(p.Categorias, prod.Categoria) {
+				p.Categorias = append(p.Categorias, prod.Categoria)
+				m.Categorias[prod.Categoria] = append(m.Categorias[prod.Categoria], p.Archivo)
+			}
+			m.Conteos[prod.Categoria]++
+		}
+		m.Partes = append(m.Partes, p)
+		part, partBytes = nil, 0
+		return nil
+	}
+	for i, p := range sorted {
+		starts := i == 0 || p.Categoria != sorted[i-1].Categoria
+		fitsAlone := catBytes[p.Categoria] <= maxBytes
+		if partBytes > 0 && (partBytes+sizes[i] > maxBytes || starts && fitsAlone && partBytes+catBytes[p.Categoria] > maxBytes) {
+			if err := flush(); err != nil {
+				return m, err
+			}
+		}
+		part = append(part, p)
+		partBytes += sizes[i]
+	}
+	if err := flush(); err != nil {
+		return m, err
+	}
+
+	data, err := json.MarshalIndent(m, "", "    ")
+	if err != nil {
+		return m, err
+	}
+	if err := os.WriteFile(ManifiestoPath(fpath), data, 0644); err != nil {
+		return m, fmt.Errorf("error escribiendo %s: %w", ManifiestoPath(fpath), err)
+	}
+	old, _ := filepath.Glob(partesGlob(fpath))
+	for _, f := range old {
+		if !slices.ContainsFunc(m.Partes, func(p Parte) bool { return p.Archivo == filepath.Base(f) }) {
+			os.Remove(f)
+		}
+	}
+	if err := os.Remove(fpath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return m, err
+	}
+	return m, nil
+}
+
+// QuitarPartes removes the manifest and parts of the catalog fpath, once
+// it is written as a single file again.
+func QuitarPartes(fpath string) error {
+	old, _ := filepath.Glob(partesGlob(fpath))
+	for _, f := range append(old, ManifiestoPath(fpath)) {
+		if err := os.Remove(f); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// LeerManifiesto reads the manifest at fpath.
+func LeerManifiesto(fpath string) (Manifiesto, error) {
+	var m Manifiesto
+	data, err := os.ReadFile(fpath)
+	if err != nil {
+		return m, fmt.Errorf("error leyendo %s: %w", fpath, err)
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return m, fmt.Errorf("error parsing %s: %w", fpath, err)
+	}
+	return m, nil
+}
+
+// Archivos are the parts that hold the products of categoria, compared
+// without case or accents, or every part when categoria is "".
+func (m Manifiesto) Archivos(categoria string) []string {
+	if categoria != "" {
+		var files []string
+		for cat, parts := range m.Categorias {
+			if !texto.Equal(cat, categoria) {
+				continue
+			}
+			for _, f := range parts {
+				if !slices.Contains(files, f) {
+					files = append(files, f)
+				}
+			}
+		}
+		slices.Sort(files)
+		return files
+	}
+	files := make([]string, len(m.Partes))
+	for i, p := range m.Partes {
+		files[i] = p.Archivo
+	}
+	return files
+}
+
+// leerPartes reads every part of the sharded catalog fpath.
+func leerPartes(fpath string) ([]Producto, error) {
+	m, err := LeerManifiesto(ManifiestoPath(fpath))
+	if err != nil {
+		return nil, err
+	}
+	products := make([]Producto, 0, m.Total)
+	for _, f := range m.Archivos("") {
+		part, err := readFile(filepath.Join(filepath.Dir(fpath), f))
+		if err != nil {
+			return nil, err
+		}
+		products = append(products, part...)
+	}
+	return products, nil
+}
@@ -0,0 +1,309 @@
+// Package unificado merges the catalogs of several stores into one, using the
+// pairs found by package match to fold the same product into a single record.
+package unificado
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"sort"
+
+	"catalogo/canonurl"
+	"catalogo/match"
+	"catalogo/producto"
+)
+
+// Oferta is what one store asks for a product.
+type Oferta struct {
+	Tienda         string  `json:"tienda"`
+	Link           string  `json:"link"`
+	Precio         float64 `json:"precio"`
+	PrecioOriginal float64 `json:"precioOriginal"`
+	EnOferta       bool    `json:"enOferta"`
+	Stock          string  `json:"stock"`
+	// Moneda, PrecioConIVA, EnvioGratis, CostoEnvio, CantidadPaquete,
+	// Unidad and PrecioUnitario are as in productos.json.
+	Moneda          string  `json:"moneda,omitempty"`
+	PrecioConIVA    float64 `json:"precioConIVA,omitempty"`
+	EnvioGratis     bool    `json:"envioGratis,omitempty"`
+	CostoEnvio      float64 `json:"costoEnvio,omitempty"`
+	CantidadPaquete float64 `json:"cantidadPaquete,omitempty"`
+	Unidad          string  `json:"unidad,omitempty"`
+	PrecioUnitario  float64 `json:"precioUnitario,omitempty"`
+}
+
+// Disponible reports whether the store has the product in stock.
+func (o Oferta) Disponible() bool {
+	return !producto.Product{Stock: o.Stock}.Agotado()
+}
+
+// divisa is the currency of o's prices.
+func (o Oferta) divisa() string {
+	return producto.Product{Moneda: o.Moneda}.Divisa()
+}
+
+// comparables returns the offers priced in the same currency as the first,
+// the only ones whose prices can be compared with it.
+func comparables(offers []Oferta) []Oferta {
+	var out []Oferta
+	for _, o := range offers {
+		if o.divisa() == offers[0].divisa() {
+			out = append(out, o)
+		}
+	}
+	return out
+}
+
+// conIVA is o's price with IVA, which stores are compared by: one showing
+// prices before tax is not cheaper for it. Catalogs scraped before
+// PrecioConIVA existed showed it included.
+func (o Oferta) conIVA() float64 {
+	if o.PrecioConIVA == 0 {
+		return o.Precio
+	}
+	return o.PrecioConIVA
+}
+
+// costo is what o charges per unit, with IVA, and the unit. Offers whose
+// name states no quantity count as one piece.
+func (o Oferta) costo() (float64, string) {
+	switch {
+	case o.Unidad == "" || o.PrecioUnitario == 0:
+		return o.conIVA(), producto.UnidadPieza
+	case o.conIVA() == o.Precio || o.Precio == 0:
+		return o.PrecioUnitario, o.Unidad
+	}
+	return math.Round(o.PrecioUnitario*o.conIVA()/o.Precio*10000) / 10000, o.Unidad
+}
+
+// unitOf returns the unit every offer is priced in, or "" when they differ
+// and only listing prices can be compared.
+func unitOf(offers []Oferta) string {
+	var unit string
+	for i, o := range offers {
+		_, u := o.costo()
+		if i > 0 && u != unit {
+			return ""
+		}
+		unit = u
+	}
+	return unit
+}
+
+// comparePrice returns the price offers should be ranked by: per unit when
+// they share one, so a 10-piece pack competes with a single piece fairly,
+// and per listing otherwise.
+func comparePrice(offers []Oferta) func(Oferta) float64 {
+	if unitOf(offers) == "" {
+		return func(o Oferta) float64 { return o.conIVA() }
+	}
+	return func(o Oferta) float64 {
+		c, _ := o.costo()
+		return c
+	}
+}
+
+// perUnit reports whether any offer states a quantity, which is when a unit
+// price says more than the listing price.
+func perUnit(offers []Oferta) bool {
+	if unitOf(offers) == "" {
+		return false
+	}
+	for _, o := range offers {
+		if o.Unidad != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Producto is one entry of catalogo-unificado.json: a product and every
+// store that sells it, cheapest first (per unit when the offers share one).
+// Offers in pesos go before those in other currencies, which are ranked
+// among themselves.
+type Producto struct {
+	Nombre string `json:"nombre"`
+	// NombreMostrar is the name to show when other products have the same
+	// Nombre, with what tells this one apart; see NombresMostrar.
+	NombreMostrar string `json:"nombreMostrar,omitempty"`
+	// Variante is that of the product describing the record, e.g.
+	// "Color: Rojo".
+	Variante      string   `json:"variante,omitempty"`
+	Imagen        string   `json:"imagen"`
+	Imagen64      string   `json:"imagen64"`
+	Categoria     string   `json:"categoria"`
+	Subcategorias []string `json:"subcategorias"`
+	Ofertas       []Oferta `json:"ofertas"`
+	// DisponibleEn counts the stores that have it in stock.
+	DisponibleEn int `json:"disponibleEn"`
+	// PrecioMinimo and TiendaMasBarata describe the cheapest offer in
+	// stock, or the cheapest overall when no store has it; the price is
+	// with IVA.
+	PrecioMinimo    float64 `json:"precioMinimo"`
+	TiendaMasBarata string  `json:"tiendaMasBarata"`
+	// Moneda is the currency of PrecioMinimo, when its store says.
+	Moneda string `json:"moneda,omitempty"`
+	// PrecioUnitario and Unidad are the cheapest offer's price per unit,
+	// set when some offer states a quantity.
+	PrecioUnitario float64 `json:"precioUnitario,omitempty"`
+	Unidad         string  `json:"unidad,omitempty"`
+}
+
+// Combine merges catalogs into unified products. Products linked by pairs,
+// directly or through a chain of pairs, become one record described by the
+// first catalog that has it; every other product stands alone.
+func Combine(catalogs []match.Catalog, pairs []match.Pair) []Producto {
+	type ref struct{ catalog, product int }
+	var refs []ref
+	ids := make(map[string]int)
+	for c, cat := range catalogs {
+		for p, prod := range cat.Productos {
+			key := cat.Tienda + "\x00" + canonurl.Key(prod.Link)
+			if _, ok := ids[key]; ok {
+				continue
+			}
+			ids[key] = len(refs)
+			refs = append(refs, ref{c, p})
+		}
+	}
+
+	parent := make([]int, len(refs))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	for _, pair := range pairs {
+		a, okA := ids[pair.A.Tienda+"\x00"+canonurl.Key(pair.A.Link)]
+		b, okB := ids[pair.B.Tienda+"\x00"+canonurl.Key(pair.B.Link)]
+		if !okA || !okB {
+			continue
+		}
+		// Keep the earliest reference as root so the first catalog
+		// describes the group
+		ra, rb := find(a), find(b)
+		if ra > rb {
+			ra, rb = rb, ra
+		}
+		parent[rb] = ra
+	}
+
+	groups := make(map[int]int)
+	var out []Producto
+	for i, r := range refs {
+		prod := catalogs[r.catalog].Productos[r.product]
+		root := find(i)
+		g, ok := groups[root]
+		if !ok {
+			g = len(out)
+			groups[root] = g
+			out = append(out, Producto{
+				Nombre:        prod.Nombre,
+				Variante:      prod.Variante,
+				Imagen:        prod.Imagen,
+				Imagen64:      prod.Imagen64,
+				Categoria:     prod.Categoria,
+				Subcategorias: prod.Subcategorias,
+			})
+		}
+		out[g].Ofertas = append(out[g].Ofertas, oferta(catalogs[r.catalog].Tienda, prod))
+	}
+
+	for i := range out {
+		summarize(&out[i])
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Categoria != out[j].Categoria {
+			return out[i].Categoria < out[j].Categoria
+		}
+		return out[i].Nombre < out[j].Nombre
+	})
+	return out
+}
+
+func oferta(tienda string, p producto.Product) Oferta {
+	// Catalogs scraped before the unit fields existed lack them
+	if p.Unidad == "" {
+		p.SetUnitPrice()
+	}
+	return Oferta{
+		Tienda:          tienda,
+		Link:            p.Link,
+		Precio:          p.Precio,
+		PrecioOriginal:  p.PrecioOriginal,
+		EnOferta:        p.EnOferta,
+		Stock:           p.Stock,
+		Moneda:          p.Moneda,
+		PrecioConIVA:    p.PrecioConIVA,
+		EnvioGratis:     p.EnvioGratis,
+		CostoEnvio:      p.CostoEnvio,
+		CantidadPaquete: p.CantidadPaquete,
+		Unidad:          p.Unidad,
+		PrecioUnitario:  p.PrecioUnitario,
+	}
+}
+
+// summarize sorts the offers of p by price and fills in the fields derived
+// from them.
+func summarize(p *Producto) {
+	price := comparePrice(p.Ofertas)
+	sort.SliceStable(p.Ofertas, func(i, j int) bool {
+		a, b := p.Ofertas[i], p.Ofertas[j]
+		if base := producto.MonedaBase; a.divisa() != b.divisa() && (a.divisa() == base || b.divisa() == base) {
+			return a.divisa() == base
+		}
+		return price(a) < price(b)
+	})
+	p.DisponibleEn = 0
+	for _, o := range p.Ofertas {
+		if o.Disponible() {
+			p.DisponibleEn++
+		}
+	}
+	same := comparables(p.Ofertas)
+	best := same[0]
+	for _, o := range same {
+		if o.Disponible() {
+			best = o
+			break
+		}
+	}
+	p.PrecioMinimo = best.conIVA()
+	p.TiendaMasBarata = best.Tienda
+	p.Moneda = best.Moneda
+	p.PrecioUnitario, p.Unidad = 0, ""
+	if perUnit(same) {
+		p.PrecioUnitario, p.Unidad = best.costo()
+	}
+}
+
+// ReadJSON loads a catalogo-unificado.json, or all the parts of its
+// manifest when it was written sharded.
+func ReadJSON(fpath string) ([]Producto, error) {
+	if _, err := os.Stat(fpath); errors.Is(err, fs.ErrNotExist) {
+		if _, err := os.Stat(ManifiestoPath(fpath)); err == nil {
+			return leerPartes(fpath)
+		}
+	}
+	return readFile(fpath)
+}
+
+func readFile(fpath string) ([]Producto, error) {
+	data, err := os.ReadFile(fpath)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo %s: %w", fpath, err)
+	}
+	var products []Producto
+	if err := json.Unmarshal(data, &products); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", fpath, err)
+	}
+	return products, nil
+}
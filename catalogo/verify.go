@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"catalogo/firma"
+)
+
+// runVerify checks outputs against the signatures the scrapers wrote with
+// -sign, as the site does before publishing them.
+func runVerify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	key := fs.String("key", "", "Clave pública Ed25519 (PEM) de la firma")
+	files, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if *key == "" || len(files) == 0 {
+		return fmt.Errorf("uso: catalogo verify -key firma.pub.pem <productos.json> [...]")
+	}
+	pub, err := firma.LeerPublica(*key)
+	if err != nil {
+		return err
+	}
+	for _, fpath := range files {
+		if err := firma.Verificar(pub, fpath); err != nil {
+			return err
+		}
+		log.Printf("[VERIFY] %s: firma válida", fpath)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+)
+
+// version is the release the binary was built as, set by the release
+// workflow with -ldflags "-X main.version=v1.2.3". Other builds report the
+// module version Go stamps from the repository, or "(devel)".
+var version string
+
+// buildInfo is what "catalogo version" reports about the running binary.
+type buildInfo struct {
+	Version    string `json:"version"`
+	Commit     string `json:"commit,omitempty"`
+	CommitTime string `json:"commitTime,omitempty"`
+	Modified   bool   `json:"modified,omitempty"`
+	GoVersion  string `json:"goVersion"`
+	Platform   string `json:"platform"`
+}
+
+func readBuildInfo() buildInfo {
+	b := buildInfo{Version: version, GoVersion: runtime.Version(), Platform: runtime.GOOS + "/" + runtime.GOARCH}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		if b.Version == "" {
+			b.Version = "(devel)"
+		}
+		return b
+	}
+	if b.Version == "" {
+		b.Version = info.Main.Version
+	}
+	if b.Version == "" {
+		b.Version = "(devel)"
+	}
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			b.Commit = s.Value
+		case "vcs.time":
+			b.CommitTime = s.Value
+		case "vcs.modified":
+			b.Modified = s.Value == "true"
+		}
+	}
+	return b
+}
+
+func runVersion(args []string) error {
+	fs := flag.NewFlagSet("version", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "Escribir la información en JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	b := readBuildInfo()
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(b)
+	}
+	fmt.Printf("catalogo %s\n", b.Version)
+	if b.Commit != "" {
+		modified := ""
+		if b.Modified {
+			modified = " (con cambios sin commit)"
+		}
+		fmt.Printf("  commit:     %s%s\n", b.Commit, modified)
+	}
+	if b.CommitTime != "" {
+		fmt.Printf("  fecha:      %s\n", b.CommitTime)
+	}
+	fmt.Printf("  go:         %s\n", b.GoVersion)
+	fmt.Printf("  plataforma: %s\n", b.Platform)
+	return nil
+}
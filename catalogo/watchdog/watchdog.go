@@ -0,0 +1,116 @@
+// Package watchdog cancels worker tasks that run for too long. Timeouts on
+// the HTTP client do not cover every way a connection can hang, and a single
+// wedged worker near the end of a run stalls the whole run.
+package watchdog
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Watchdog tracks the task each worker is on. A nil Watchdog does nothing, so
+// scrapers can use it unconditionally.
+type Watchdog struct {
+	timeout time.Duration
+	onStuck func(worker int, label string, running time.Duration)
+
+	mu     sync.Mutex
+	active map[int]*job
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+type job struct {
+	label  string
+	start  time.Time
+	cancel context.CancelFunc
+	fired  bool
+}
+
+// New starts a watchdog that cancels tasks running longer than timeout and
+// reports each one to onStuck. It returns nil when timeout is not positive.
+func New(timeout time.Duration, onStuck func(worker int, label string, running time.Duration)) *Watchdog {
+	if timeout <= 0 {
+		return nil
+	}
+	w := &Watchdog{
+		timeout: timeout,
+		onStuck: onStuck,
+		active:  make(map[int]*job),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go w.loop(max(timeout/4, 100*time.Millisecond))
+	return w
+}
+
+// Begin records that worker started the task described by label. The task
+// must use the returned context, which is cancelled if the task gets stuck,
+// and call end when it finishes.
+func (w *Watchdog) Begin(ctx context.Context, worker int, label string) (context.Context, func()) {
+	if w == nil {
+		return ctx, func() {}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	j := &job{label: label, start: time.Now(), cancel: cancel}
+	w.mu.Lock()
+	w.active[worker] = j
+	w.mu.Unlock()
+	return ctx, func() {
+		w.mu.Lock()
+		if w.active[worker] == j {
+			delete(w.active, worker)
+		}
+		w.mu.Unlock()
+		cancel()
+	}
+}
+
+func (w *Watchdog) loop(every time.Duration) {
+	defer close(w.done)
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.check()
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+type stuck struct {
+	worker  int
+	label   string
+	running time.Duration
+}
+
+func (w *Watchdog) check() {
+	var found []stuck
+	w.mu.Lock()
+	for worker, j := range w.active {
+		if running := time.Since(j.start); running > w.timeout && !j.fired {
+			j.fired = true
+			j.cancel()
+			found = append(found, stuck{worker, j.label, running})
+		}
+	}
+	w.mu.Unlock()
+	if w.onStuck != nil {
+		for _, s := range found {
+			w.onStuck(s.worker, s.label, s.running)
+		}
+	}
+}
+
+// Stop stops watching.
+func (w *Watchdog) Stop() {
+	if w == nil {
+		return
+	}
+	close(w.stop)
+	<-w.done
+}